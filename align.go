@@ -0,0 +1,118 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// ErrInvalidAlignment indicates that an alignment isn't a power of two multiple of the block size, 2048 bytes
+var ErrInvalidAlignment = errors.New("alignment must be a power of two multiple of 2048 bytes")
+
+// DefaultPadding is the number of blocks of padding added to an image by mkisofs -pad: 300 KiB, which is enough to stop
+// the read-ahead of some drives from reaching the end of the disc and failing
+const DefaultPadding = 150
+
+// Alignment aligns the data of files in an image to boundaries larger than a block, for readers that need it, such as
+// loop devices for partition images within the image, or readers that transfer data by DMA. Each alignment is in bytes
+// from the start of the image, and must be a power of two multiple of 2048 bytes, such as 32 KiB or 1 MiB. The blocks
+// skipped to align files are filled with zeros.
+type Alignment struct {
+	// Size is the alignment of the data of every file. The data of files is only aligned to blocks if this is 0.
+	Size int64
+
+	// MinFileSize is the size in bytes below which files aren't aligned to Size, so that small files don't each take
+	// up a whole alignment
+	MinFileSize int64
+
+	// Files contains alignments of individual files by their path in the image's contents, which are used instead of
+	// Size and regardless of MinFileSize. An alignment of 2048 bytes stops a file from being aligned to Size.
+	Files map[string]int64
+}
+
+// WithAlignment aligns the data of files (see [Alignment])
+func WithAlignment(alignment Alignment) ImageOption {
+	return func(i *Image) error {
+		if _, err := alignmentBlocks(alignment.Size); err != nil {
+			return err
+		}
+
+		for filePath, size := range alignment.Files {
+			if _, err := alignmentBlocks(size); err != nil {
+				return fmt.Errorf("could not align '%s': %w", filePath, err)
+			}
+		}
+
+		i.alignment = &alignment
+		return nil
+	}
+}
+
+// WithPadding adds the given number of blocks of zeros to the end of the ISO 9660 filesystem, like mkisofs -pad, which
+// pads images by [DefaultPadding] blocks. Some drives fail to read the last files on a disc without padding, since
+// they read ahead of the data requested.
+//
+// The padding is part of the volume, and comes before anything appended to the image, such as partitions for a GPT.
+func WithPadding(blocks uint32) ImageOption {
+	return func(i *Image) error {
+		i.padding = blocks
+		return nil
+	}
+}
+
+// alignmentBlocks returns the number of blocks in an alignment of the given size in bytes. Alignments of 0 bytes are
+// to a single block.
+func alignmentBlocks(size int64) (uint32, error) {
+	if size == 0 {
+		return 1, nil
+	}
+
+	blocks := size / spec.LogicalSectorSize
+	if size < 0 || size%spec.LogicalSectorSize != 0 || blocks > math.MaxUint32 || bits.OnesCount64(uint64(blocks)) != 1 {
+		return 0, fmt.Errorf("%w: %d bytes", ErrInvalidAlignment, size)
+	}
+
+	return uint32(blocks), nil
+}
+
+// fileAlignments returns the alignment, in blocks, of each file in files, which are by their path in the image's
+// contents. Files aren't aligned if the image has no alignment.
+func (i *Image) fileAlignments(files map[string]*builder.File) func(*builder.File) uint32 {
+	alignments := make(map[*builder.File]uint32)
+	if i.alignment != nil {
+		// Alignments were checked by WithAlignment, so can't be invalid
+		size, _ := alignmentBlocks(i.alignment.Size)
+		for filePath, file := range files {
+			if custom, ok := i.alignment.Files[filePath]; ok {
+				alignments[file], _ = alignmentBlocks(custom)
+			} else if file.PointerRecord().DataLength.RealValue() >= uint32(min(i.alignment.MinFileSize, math.MaxUint32)) {
+				alignments[file] = size
+			}
+		}
+	}
+
+	return func(file *builder.File) uint32 {
+		return max(alignments[file], 1)
+	}
+}
+
+// writeZeros returns a function that writes the given number of blocks of zeros
+func writeZeros(blocks uint32) func(w io.Writer) (int64, error) {
+	return func(w io.Writer) (int64, error) {
+		written := int64(0)
+		for remaining := int64(blocks) * spec.LogicalSectorSize; remaining > 0; {
+			n, err := w.Write(zeroBuffer[:min(remaining, int64(len(zeroBuffer)))])
+			written += int64(n)
+			remaining -= int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		return written, nil
+	}
+}
@@ -0,0 +1,69 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithAlignment(t *testing.T) {
+	source := fstest.MapFS{
+		"A.TXT":         {Data: []byte("small")},
+		"DISK.IMG":      {Data: bytes.Repeat([]byte("d"), 40000)},
+		"EMPTY.TXT":     {Data: nil},
+		"PART/EFI.IMG":  {Data: []byte("efi")},
+		"PART/ROOT.IMG": {Data: bytes.Repeat([]byte("r"), 70000)},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithAlignment(iso9660.Alignment{
+		Size:        32 << 10,
+		MinFileSize: 32 << 10,
+		Files:       map[string]int64{"PART/EFI.IMG": 64 << 10},
+	}), iso9660.WithPadding(iso9660.DefaultPadding), iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Aligned image should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	for name, file := range source {
+		assert.Equal(t, string(file.Data), readRecord(t, img, name), "'%s' should be written to its extent", name)
+	}
+
+	for name, blocks := range map[string]uint32{"DISK.IMG": 16, "PART/ROOT.IMG": 16, "PART/EFI.IMG": 32} {
+		assert.Zero(t, findRecord(t, img, name).ExtentLocation.RealValue()%blocks, "'%s' should be aligned to %d blocks", name, blocks)
+	}
+
+	// Padding comes after every file, before the UDF anchor in the last block
+	size := img.Primary.VolumeSpaceSize.RealValue()
+	assert.EqualValues(t, size*2048, buff.Len(), "Padding should be part of the volume")
+
+	end := uint32(0)
+	for name, file := range source {
+		location := findRecord(t, img, name).ExtentLocation.RealValue()
+		end = max(end, location+uint32(len(file.Data)+2047)/2048)
+	}
+
+	assert.LessOrEqual(t, end+iso9660.DefaultPadding, size-1, "Image should be padded after the last file")
+	assert.Equal(t, make([]byte, iso9660.DefaultPadding*2048), buff.Bytes()[(size-1-iso9660.DefaultPadding)*2048:(size-1)*2048], "Padding should be zeros")
+}
+
+func TestWithAlignment_Invalid(t *testing.T) {
+	for _, alignment := range []iso9660.Alignment{
+		{Size: 1000},
+		{Size: 3 * 2048},
+		{Size: -2048},
+		{Files: map[string]int64{"A.TXT": 4096 + 2048}},
+	} {
+		_, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithAlignment(alignment))
+		assert.ErrorIs(t, err, iso9660.ErrInvalidAlignment, "WithAlignment should reject %+v", alignment)
+	}
+}
@@ -0,0 +1,321 @@
+package iso9660
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// archiveFileInfo describes an entry in an archive. Sys returns the archive's own header for the entry, i.e. a
+// [*tar.Header] or [*zip.FileHeader].
+type archiveFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	header  any
+
+	// target is the path, relative to the root of the archive, of the entry that a hard or symbolic link refers to
+	target string
+}
+
+var _ fs.FileInfo = &archiveFileInfo{}
+var _ linkedFileInfo = &archiveFileInfo{}
+
+func (a *archiveFileInfo) Name() string       { return a.name }
+func (a *archiveFileInfo) Size() int64        { return a.size }
+func (a *archiveFileInfo) Mode() fs.FileMode  { return a.mode }
+func (a *archiveFileInfo) ModTime() time.Time { return a.modTime }
+func (a *archiveFileInfo) IsDir() bool        { return a.mode.IsDir() }
+func (a *archiveFileInfo) Sys() any           { return a.header }
+
+func (a *archiveFileInfo) linkTarget() string {
+	return a.target
+}
+
+// archiveFS is the directory tree of an archive, built from the archive's headers
+type archiveFS struct {
+	*treeFS
+
+	// links holds every hard and symbolic link, so that their metadata can be fixed up once the archive has been read
+	links []*treeNode
+}
+
+// NewTarFS reads the headers of a tar archive, and returns a filesystem that can be passed to [NewImage].
+//
+// File modes, modification times, symbolic links and hard links are preserved. Links to files within the archive are
+// recorded in an image as entries that share the extent of the file they refer to; other links are ignored.
+//
+// If r also implements [io.ReaderAt] and [io.Seeker] (e.g. an [*os.File]), file contents are read from r when the image
+// is written, and r must remain valid until then. Otherwise, the archive must be read in one pass, and so the contents
+// of each file are held in memory.
+func NewTarFS(r io.Reader) (fs.ReadDirFS, error) {
+	a := &archiveFS{treeFS: newTreeFS(time.Now())}
+
+	var section *io.SectionReader
+	if ra, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		start, err := ra.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, fmt.Errorf("could not get position of tar archive: %w", err)
+		}
+
+		end, err := ra.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, fmt.Errorf("could not get size of tar archive: %w", err)
+		}
+
+		section = io.NewSectionReader(ra, start, end-start)
+		r = section
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		name, ok := archivePath(hdr.Name)
+		if !ok {
+			continue
+		}
+
+		info := &archiveFileInfo{
+			name:    path.Base(name),
+			size:    hdr.Size,
+			mode:    hdr.FileInfo().Mode(),
+			modTime: hdr.ModTime,
+			header:  hdr,
+		}
+
+		node := &treeNode{info: info}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			node = newTreeDir(info)
+
+		case tar.TypeReg, tar.TypeGNUSparse:
+			if section != nil && !isSparseTarHeader(hdr) {
+				// Since the tar reader only ever reads whole headers, the section reader is now positioned at the start
+				// of the file's contents, and we can come back to it later
+				offset, err := section.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return nil, fmt.Errorf("could not get position of '%s' in tar archive: %w", hdr.Name, err)
+				}
+
+				contents := io.NewSectionReader(section, offset, hdr.Size)
+				node.open = func() (io.ReadCloser, error) {
+					return io.NopCloser(io.NewSectionReader(contents, 0, contents.Size())), nil
+				}
+			} else {
+				// Sparse files don't have contiguous contents in the archive, so have to be spooled like non-seekable
+				// archives
+				data, err := io.ReadAll(tr)
+				if err != nil {
+					return nil, fmt.Errorf("could not read '%s' from tar archive: %w", hdr.Name, err)
+				}
+
+				node.open = func() (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(data)), nil
+				}
+			}
+
+		case tar.TypeLink:
+			target, ok := archivePath(hdr.Linkname)
+			if !ok {
+				continue
+			}
+
+			info.target = target
+
+		case tar.TypeSymlink:
+			info.target = symlinkTarget(name, hdr.Linkname)
+
+		default:
+			// Devices, FIFOs and the like can't be represented in an image
+			continue
+		}
+
+		if err := a.add(name, node); err != nil {
+			return nil, err
+		}
+	}
+
+	a.resolveLinks()
+
+	return a, nil
+}
+
+// NewZipFS reads the central directory of a zip archive, and returns a filesystem that can be passed to [NewImage].
+// File contents are decompressed from r when the image is written, and so r must remain valid until then.
+//
+// File modes, modification times and symbolic links are preserved in the same way as [NewTarFS]; zip archives do
+// not support hard links.
+func NewZipFS(r *zip.Reader) (fs.ReadDirFS, error) {
+	a := &archiveFS{treeFS: newTreeFS(time.Now())}
+
+	for _, f := range r.File {
+		name, ok := archivePath(f.Name)
+		if !ok {
+			continue
+		}
+
+		info := &archiveFileInfo{
+			name:    path.Base(name),
+			size:    int64(f.UncompressedSize64),
+			mode:    f.Mode(),
+			modTime: f.Modified,
+			header:  &f.FileHeader,
+		}
+
+		node := &treeNode{info: info}
+
+		switch {
+		case info.mode.IsDir():
+			node = newTreeDir(info)
+
+		case info.mode&fs.ModeSymlink != 0:
+			target, err := readZipSymlink(f)
+			if err != nil {
+				return nil, err
+			}
+
+			info.target = symlinkTarget(name, target)
+
+		case info.mode.IsRegular():
+			node.open = f.Open
+
+		default:
+			continue
+		}
+
+		if err := a.add(name, node); err != nil {
+			return nil, err
+		}
+	}
+
+	a.resolveLinks()
+
+	return a, nil
+}
+
+// NewImageFromTar creates an [Image] from the contents of a tar archive. See [NewTarFS].
+func NewImageFromTar(r io.Reader) (*Image, error) {
+	contents, err := NewTarFS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewImage(contents)
+}
+
+// NewImageFromZip creates an [Image] from the contents of a zip archive. See [NewZipFS].
+func NewImageFromZip(r *zip.Reader) (*Image, error) {
+	contents, err := NewZipFS(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewImage(contents)
+}
+
+func (a *archiveFS) add(name string, node *treeNode) error {
+	if node.info.(*archiveFileInfo).target != "" {
+		node.link = node.info.(*archiveFileInfo).target
+		a.links = append(a.links, node)
+	}
+
+	parent := a.mkdirAll(path.Dir(name), node.info.ModTime())
+	if parent == nil {
+		return fmt.Errorf("archive entry '%s' is inside a file", name)
+	}
+
+	base := path.Base(name)
+	if existing, ok := parent.children[base]; ok && existing.isDir() && node.isDir() {
+		// Directories can be implied by their children before they appear in the archive, or can appear more than
+		// once; either way, keep the children we already know about
+		existing.info = node.info
+		return nil
+	}
+
+	// Later entries replace earlier entries of the same name, as they would when extracting the archive
+	parent.children[base] = node
+	return nil
+}
+
+// resolveLinks gives hard links the size of the file they refer to, since their own headers don't include it
+func (a *archiveFS) resolveLinks() {
+	for _, link := range a.links {
+		info := link.info.(*archiveFileInfo)
+		if info.mode&fs.ModeSymlink != 0 {
+			continue
+		}
+
+		if target, err := a.resolveDepth(link.link, true, 0); err == nil && !target.isDir() {
+			info.size = target.info.Size()
+			info.mode = target.info.Mode()
+		}
+	}
+}
+
+// archivePath converts the name of an archive entry to a valid [fs.FS] path. Names that would escape the root of the
+// archive are confined to it, and false is returned for names that refer to the root itself.
+func archivePath(name string) (string, bool) {
+	cleaned := path.Clean("/" + name)[1:]
+	return cleaned, cleaned != ""
+}
+
+// symlinkTarget resolves the target of a symbolic link relative to the root of an archive
+func symlinkTarget(name string, target string) string {
+	if !strings.HasPrefix(target, "/") {
+		target = path.Join(path.Dir(name), target)
+	}
+
+	cleaned, ok := archivePath(target)
+	if !ok {
+		return "."
+	}
+
+	return cleaned
+}
+
+func readZipSymlink(f *zip.File) (string, error) {
+	r, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("could not open symlink '%s' in zip archive: %w", f.Name, err)
+	}
+	defer r.Close()
+
+	target, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("could not read symlink '%s' in zip archive: %w", f.Name, err)
+	}
+
+	return string(target), nil
+}
+
+// isSparseTarHeader returns true if the contents of a file are stored in a sparse format in the archive
+func isSparseTarHeader(hdr *tar.Header) bool {
+	if hdr.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+
+	for key := range hdr.PAXRecords {
+		if strings.HasPrefix(key, "GNU.sparse.") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,162 @@
+package iso9660_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+)
+
+var archiveModTime = time.Date(2021, 6, 5, 4, 3, 2, 0, time.UTC)
+
+func buildTestTar(t *testing.T) []byte {
+	var buff bytes.Buffer
+	tw := tar.NewWriter(&buff)
+
+	entries := []struct {
+		header *tar.Header
+		data   string
+	}{
+		{&tar.Header{Typeflag: tar.TypeDir, Name: "BOOT/", Mode: 0o755, ModTime: archiveModTime}, ""},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "BOOT/VMLINUZ", Mode: 0o600, ModTime: archiveModTime}, "unique kernel data"},
+		{&tar.Header{Typeflag: tar.TypeReg, Name: "./ETC/CONFIG/INIT.CFG", Mode: 0o644, ModTime: archiveModTime}, "init"},
+		{&tar.Header{Typeflag: tar.TypeLink, Name: "BOOT/KERNEL", Linkname: "BOOT/VMLINUZ", ModTime: archiveModTime}, ""},
+		{&tar.Header{Typeflag: tar.TypeSymlink, Name: "ETC/LINK.CFG", Linkname: "CONFIG/INIT.CFG", Mode: 0o777, ModTime: archiveModTime}, ""},
+		{&tar.Header{Typeflag: tar.TypeSymlink, Name: "ETC/DIRLINK", Linkname: "/BOOT", Mode: 0o777, ModTime: archiveModTime}, ""},
+		{&tar.Header{Typeflag: tar.TypeSymlink, Name: "ETC/DANGLING", Linkname: "NOWHERE", Mode: 0o777, ModTime: archiveModTime}, ""},
+		{&tar.Header{Typeflag: tar.TypeChar, Name: "DEV/NULL", Mode: 0o666, Devmajor: 1, Devminor: 3}, ""},
+	}
+
+	for _, entry := range entries {
+		entry.header.Size = int64(len(entry.data))
+		require.NoError(t, tw.WriteHeader(entry.header), "Should be able to write tar header")
+		_, err := tw.Write([]byte(entry.data))
+		require.NoError(t, err, "Should be able to write tar contents")
+	}
+
+	require.NoError(t, tw.Close(), "Should be able to close tar writer")
+
+	return buff.Bytes()
+}
+
+func TestNewTarFS(t *testing.T) {
+	archive := buildTestTar(t)
+
+	sources := map[string]io.Reader{
+		// bytes.Reader is an io.ReaderAt, so contents should be read lazily
+		"seekable": bytes.NewReader(archive),
+		// Wrapping hides the io.ReaderAt implementation, so contents must be spooled
+		"streamed": io.MultiReader(bytes.NewReader(archive)),
+	}
+
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			tarFS, err := iso9660.NewTarFS(source)
+			require.NoError(t, err, "NewTarFS should not return an error for a valid archive")
+
+			data, err := fs.ReadFile(tarFS, "BOOT/VMLINUZ")
+			require.NoError(t, err, "Should be able to read a regular file")
+			assert.Equal(t, "unique kernel data", string(data), "Regular file should have the correct contents")
+
+			data, err = fs.ReadFile(tarFS, "BOOT/KERNEL")
+			require.NoError(t, err, "Should be able to read a hard link")
+			assert.Equal(t, "unique kernel data", string(data), "Hard link should have the contents of its target")
+
+			data, err = fs.ReadFile(tarFS, "ETC/LINK.CFG")
+			require.NoError(t, err, "Should be able to read through a symbolic link")
+			assert.Equal(t, "init", string(data), "Symbolic link should have the contents of its target")
+
+			info, err := fs.Stat(tarFS, "BOOT/VMLINUZ")
+			require.NoError(t, err, "Should be able to stat a regular file")
+			assert.Equal(t, fs.FileMode(0o600), info.Mode(), "Mode should be preserved")
+			assert.True(t, archiveModTime.Equal(info.ModTime()), "Modification time should be preserved")
+			assert.IsType(t, &tar.Header{}, info.Sys(), "Sys should return the tar header")
+
+			info, err = fs.Stat(tarFS, "BOOT/KERNEL")
+			require.NoError(t, err, "Should be able to stat a hard link")
+			assert.EqualValues(t, len("unique kernel data"), info.Size(), "Hard link should have the size of its target")
+
+			entries, err := tarFS.ReadDir("ETC")
+			require.NoError(t, err, "Should be able to read a directory")
+			modes := make(map[string]fs.FileMode)
+			for _, entry := range entries {
+				modes[entry.Name()] = entry.Type()
+			}
+			assert.Equal(t, map[string]fs.FileMode{
+				"CONFIG":   fs.ModeDir,
+				"DANGLING": fs.ModeSymlink,
+				"DIRLINK":  fs.ModeSymlink,
+				"LINK.CFG": fs.ModeSymlink,
+			}, modes, "Directories should be implied by their contents, and symbolic links should be listed as links")
+
+			_, err = fs.Stat(tarFS, "DEV/NULL")
+			assert.ErrorIs(t, err, fs.ErrNotExist, "Devices should not be included in the filesystem")
+		})
+	}
+}
+
+func TestNewImageFromTar(t *testing.T) {
+	image, err := iso9660.NewImageFromTar(bytes.NewReader(buildTestTar(t)))
+	require.NoError(t, err, "NewImageFromTar should not return an error for a valid archive")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for an image created from a tar archive")
+	assert.Equal(t, 1, strings.Count(buff.String(), "unique kernel data"), "Hard links should share the extent of their target rather than duplicating it")
+	assert.Equal(t, 1, strings.Count(buff.String(), "init"), "Symbolic links to files should share the extent of their target rather than duplicating it")
+}
+
+func TestNewZipFS(t *testing.T) {
+	var buff bytes.Buffer
+	zw := zip.NewWriter(&buff)
+
+	fileHeader := &zip.FileHeader{Name: "EFI/BOOT/BOOTX64.EFI", Method: zip.Deflate, Modified: archiveModTime}
+	fileHeader.SetMode(0o640)
+	w, err := zw.CreateHeader(fileHeader)
+	require.NoError(t, err, "Should be able to create zip file")
+	_, err = w.Write([]byte("efi application"))
+	require.NoError(t, err, "Should be able to write zip file")
+
+	linkHeader := &zip.FileHeader{Name: "EFI/BOOT/LINK.EFI", Modified: archiveModTime}
+	linkHeader.SetMode(fs.ModeSymlink | 0o777)
+	w, err = zw.CreateHeader(linkHeader)
+	require.NoError(t, err, "Should be able to create zip symlink")
+	_, err = w.Write([]byte("BOOTX64.EFI"))
+	require.NoError(t, err, "Should be able to write zip symlink")
+
+	require.NoError(t, zw.Close(), "Should be able to close zip writer")
+
+	zr, err := zip.NewReader(bytes.NewReader(buff.Bytes()), int64(buff.Len()))
+	require.NoError(t, err, "Should be able to read zip archive")
+
+	zipFS, err := iso9660.NewZipFS(zr)
+	require.NoError(t, err, "NewZipFS should not return an error for a valid archive")
+
+	data, err := fs.ReadFile(zipFS, "EFI/BOOT/BOOTX64.EFI")
+	require.NoError(t, err, "Should be able to read a compressed file")
+	assert.Equal(t, "efi application", string(data), "Compressed file should have the correct contents")
+
+	data, err = fs.ReadFile(zipFS, "EFI/BOOT/LINK.EFI")
+	require.NoError(t, err, "Should be able to read through a symbolic link")
+	assert.Equal(t, "efi application", string(data), "Symbolic link should have the contents of its target")
+
+	info, err := fs.Stat(zipFS, "EFI/BOOT/BOOTX64.EFI")
+	require.NoError(t, err, "Should be able to stat a file")
+	assert.Equal(t, fs.FileMode(0o640), info.Mode(), "Mode should be preserved")
+	assert.True(t, archiveModTime.Equal(info.ModTime()), "Modification time should be preserved")
+
+	image, err := iso9660.NewImageFromZip(zr)
+	require.NoError(t, err, "NewImageFromZip should not return an error for a valid archive")
+
+	buff.Reset()
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for an image created from a zip archive")
+	assert.Equal(t, 1, strings.Count(buff.String(), "efi application"), "Symbolic links should share the extent of their target rather than duplicating it")
+}
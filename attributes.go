@@ -0,0 +1,151 @@
+package iso9660
+
+import (
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/encode"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io/fs"
+	"math"
+	"time"
+)
+
+// RecordFormat is the structure of the records of a file, for software that reads files as a series of records
+type RecordFormat uint8
+
+const (
+	// RecordFormatNone means that the file isn't structured as records
+	RecordFormatNone RecordFormat = RecordFormat(spec.RecordFormatNone)
+	// RecordFormatFixedLength means that every record is ExtendedAttributes.RecordLength bytes long
+	RecordFormatFixedLength = RecordFormat(spec.RecordFormatFixedLength)
+	// RecordFormatVariableLengthLSB means that each record is preceded by its length, as a little endian 16-bit number
+	RecordFormatVariableLengthLSB = RecordFormat(spec.RecordFormatVariableLengthLSB)
+	// RecordFormatVariableLengthMSB means that each record is preceded by its length, as a big endian 16-bit number
+	RecordFormatVariableLengthMSB = RecordFormat(spec.RecordFormatVariableLengthMSB)
+)
+
+// ExtendedAttributes are attributes of a file or directory that are recorded in an extended attribute record, which
+// precedes its data
+type ExtendedAttributes struct {
+	// Owner and Group identify the owner of the file, and the group of users that the Permissions for the group apply
+	// to
+	Owner uint16
+	Group uint16
+
+	// Permissions are the permissions of the owner, the group and other users, like those of a [fs.FileMode]. Only
+	// read and execute permissions are recorded, since the image is read-only. Users with special privileges, such as
+	// root, are given the owner's permissions. Permissions of 0 deny everyone access.
+	Permissions fs.FileMode
+
+	// Created, Modified, Expires and Effective are the times at which the file was created and last modified, after
+	// which it is obsolete, and from which it may be used. The zero time means that a time isn't specified.
+	Created   time.Time
+	Modified  time.Time
+	Expires   time.Time
+	Effective time.Time
+
+	// RecordFormat, RecordAttributes and RecordLength describe the structure of the records of the file. The meaning
+	// of RecordAttributes and RecordLength depends on RecordFormat; they are 0 if the file isn't structured as records.
+	RecordFormat     RecordFormat
+	RecordAttributes uint8
+	RecordLength     uint16
+
+	// SystemIdentifier identifies a system that can recognise and act on SystemUse, in a-characters, and SystemUse is
+	// up to 64 bytes of data for that system
+	SystemIdentifier string
+	SystemUse        []byte
+
+	// ApplicationUse is up to 65535 bytes of data for applications
+	ApplicationUse []byte
+}
+
+// WithExtendedAttributes records extended attribute records for files and directories. attributes is called with the
+// path of every file and directory in the image's contents, including the root directory, which is ".", and returns
+// the attributes to record for it, or nil if it shouldn't have an extended attribute record. [FileInfoAttributes]
+// records the owner, permissions and modification time given by each file's [fs.FileInfo].
+//
+// Each extended attribute record occupies at least one block at the start of the extent of its file or directory,
+// before the data, and the number of blocks is recorded in its directory and path table records. Links share the
+// extended attribute record of their target, along with its data. Files from a previous session are recorded without
+// their extended attribute records.
+func WithExtendedAttributes(attributes func(filePath string, info fs.FileInfo) *ExtendedAttributes) ImageOption {
+	return func(i *Image) error {
+		i.flags.attributes = attributes
+		return nil
+	}
+}
+
+// FileInfoAttributes returns extended attributes with the permissions and modification time of a file, for use with
+// [WithExtendedAttributes]. On Unix systems, files on disk are recorded with their owner and group too.
+func FileInfoAttributes(_ string, info fs.FileInfo) *ExtendedAttributes {
+	attributes := &ExtendedAttributes{
+		Permissions: info.Mode().Perm(),
+		Modified:    info.ModTime(),
+	}
+
+	if uid, gid, ok := fileOwner(info); ok && uid <= math.MaxUint16 && gid <= math.MaxUint16 {
+		attributes.Owner = uint16(uid)
+		attributes.Group = uint16(gid)
+	}
+
+	return attributes
+}
+
+// record encodes the attributes as an extended attribute record
+func (a *ExtendedAttributes) record() (*spec.ExtendedAttributeRecord, error) {
+	if len(a.SystemUse) > 64 {
+		return nil, fmt.Errorf("system use of extended attribute record is %d bytes, but at most 64 bytes are allowed", len(a.SystemUse))
+	}
+
+	if len(a.ApplicationUse) > math.MaxUint16 {
+		return nil, fmt.Errorf("application use of extended attribute record is %d bytes, but at most %d bytes are allowed", len(a.ApplicationUse), math.MaxUint16)
+	}
+
+	record := &spec.ExtendedAttributeRecord{
+		OwnerIdentification:            encode.AsUInt16BothByte(a.Owner),
+		GroupIdentification:            encode.AsUInt16BothByte(a.Group),
+		Permissions:                    permissions(a.Permissions),
+		FileCreationDateTime:           encode.AsLongDateTime(a.Created),
+		FileModificationDateTime:       encode.AsLongDateTime(a.Modified),
+		FileExpirationDateTime:         encode.AsLongDateTime(a.Expires),
+		FileEffectiveDateTime:          encode.AsLongDateTime(a.Effective),
+		RecordFormat:                   spec.RecordFormat(a.RecordFormat),
+		RecordAttributes:               a.RecordAttributes,
+		RecordLength:                   encode.AsUInt16BothByte(a.RecordLength),
+		ExtendedAttributeRecordVersion: 1,
+		LengthOfApplicationUse:         encode.AsUInt16BothByte(uint16(len(a.ApplicationUse))),
+		ApplicationUse:                 a.ApplicationUse,
+	}
+
+	encode.ZeroCharacterArray(record.SystemIdentifier[:])
+	if err := encode.AsACharacters(a.SystemIdentifier, record.SystemIdentifier[:], true, false); err != nil {
+		return nil, fmt.Errorf("invalid system identifier of extended attribute record: %w", err)
+	}
+
+	copy(record.SystemUse[:], a.SystemUse)
+	return record, nil
+}
+
+// permissions converts the read and execute permissions of a file mode to the permissions field of an extended
+// attribute record, in which set bits deny access
+func permissions(mode fs.FileMode) spec.Permission {
+	denied := spec.PermissionsReserved
+	for _, bit := range []struct {
+		mode       fs.FileMode
+		permission spec.Permission
+	}{
+		{0o400, spec.PermissionSystemRead},
+		{0o100, spec.PermissionSystemExecute},
+		{0o400, spec.PermissionOwnerRead},
+		{0o100, spec.PermissionOwnerExecute},
+		{0o040, spec.PermissionGroupRead},
+		{0o010, spec.PermissionGroupExecute},
+		{0o004, spec.PermissionOtherRead},
+		{0o001, spec.PermissionOtherExecute},
+	} {
+		if mode&bit.mode == 0 {
+			denied |= bit.permission
+		}
+	}
+
+	return denied
+}
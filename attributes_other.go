@@ -0,0 +1,9 @@
+//go:build !unix
+
+package iso9660
+
+import "io/fs"
+
+func fileOwner(fs.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
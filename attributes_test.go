@@ -0,0 +1,119 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestWithExtendedAttributes(t *testing.T) {
+	modified := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	source := fstest.MapFS{
+		"BIN/TOOL":   {Data: []byte("#!/bin/sh"), Mode: 0o750, ModTime: modified},
+		"README.TXT": {Data: []byte("readme"), Mode: 0o644},
+		"PLAIN.TXT":  {Data: []byte("plain")},
+		"DISK.IMG":   {Data: bytes.Repeat([]byte("d"), 5000)},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithExtendedAttributes(func(filePath string, info fs.FileInfo) *iso9660.ExtendedAttributes {
+		switch filePath {
+		case "PLAIN.TXT":
+			return nil
+		case "README.TXT":
+			return &iso9660.ExtendedAttributes{
+				Owner:            1000,
+				Group:            100,
+				Permissions:      info.Mode(),
+				RecordFormat:     iso9660.RecordFormatVariableLengthLSB,
+				SystemIdentifier: "LINUX",
+				ApplicationUse:   bytes.Repeat([]byte("a"), 3000),
+			}
+		}
+
+		attributes := iso9660.FileInfoAttributes(filePath, info)
+		attributes.Owner, attributes.Group = 1, 2
+		return attributes
+	}), iso9660.WithAlignment(iso9660.Alignment{Files: map[string]int64{"DISK.IMG": 32 << 10}}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with extended attribute records should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	for name, file := range source {
+		assert.Equal(t, string(file.Data), readRecord(t, img, name), "Data of '%s' should follow its extended attribute record", name)
+	}
+
+	// ear reads the fixed part of the extended attribute record of a file
+	ear := func(record *reader.Record) []byte {
+		data := make([]byte, 250)
+		_, err := img.ReaderAt().ReadAt(data, int64(record.ExtentLocation.RealValue())*2048)
+		require.NoError(t, err, "Should be able to read extended attribute record")
+		return data
+	}
+
+	tool := findRecord(t, img, "BIN/TOOL")
+	assert.EqualValues(t, 1, tool.ExtendedAttributeRecordLength, "Directory record should give the length of the extended attribute record")
+	assert.NotZero(t, tool.FileFlags&spec.FileFlagProtection, "Files that not everyone may read should have the protection bit set")
+	assert.Zero(t, tool.FileFlags&spec.FileFlagRecord, "Files without a record format should not have the record bit set")
+
+	data := ear(tool)
+	assert.Equal(t, []byte{1, 0, 0, 1, 2, 0, 0, 2}, data[0:8], "Owner and group should be recorded in both byte orders")
+	assert.Equal(t, uint16(0xAAAA|0x1000|0x4000), binary.BigEndian.Uint16(data[8:10]), "Permissions should deny access to other users")
+	assert.Equal(t, "2024050607080900", string(data[27:43]), "Modification time should be recorded")
+	assert.Equal(t, "0000000000000000", string(data[10:26]), "Unspecified times should be recorded as zero digits")
+	assert.EqualValues(t, 1, data[180], "Extended attribute record version should be 1")
+
+	readme := findRecord(t, img, "README.TXT")
+	assert.EqualValues(t, 2, readme.ExtendedAttributeRecordLength, "Extended attribute record with a long application use field should span blocks")
+	assert.NotZero(t, readme.FileFlags&spec.FileFlagRecord, "Files with a record format should have the record bit set")
+
+	data = ear(readme)
+	assert.EqualValues(t, spec.RecordFormatVariableLengthLSB, data[78], "Record format should be recorded")
+	assert.Equal(t, "LINUX", string(bytes.TrimRight(data[84:116], " ")), "System identifier should be recorded")
+	assert.Equal(t, []byte{0xB8, 0x0B, 0x0B, 0xB8}, data[246:250], "Length of application use field should be recorded")
+
+	assert.Zero(t, findRecord(t, img, "PLAIN.TXT").ExtendedAttributeRecordLength, "Files without attributes should have no extended attribute record")
+
+	disk := findRecord(t, img, "DISK.IMG")
+	assert.Zero(t, (disk.ExtentLocation.RealValue()+uint32(disk.ExtendedAttributeRecordLength))%16, "Data of aligned files should be aligned, rather than their extended attribute record")
+
+	// Directories have extended attribute records too, which the path table records
+	pathTable, err := img.ReadPathTable(false)
+	require.NoError(t, err, "Should be able to read path table")
+	for _, record := range pathTable {
+		assert.EqualValues(t, 1, record.ExtendedAttributeRecordLength, "Path table should give the length of the extended attribute record of '%s'", record.DirectoryIdentifier)
+	}
+
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root directory")
+	assert.EqualValues(t, 1, root.ExtendedAttributeRecordLength, "Root directory should have an extended attribute record")
+}
+
+func TestWithExtendedAttributes_Invalid(t *testing.T) {
+	for name, attributes := range map[string]*iso9660.ExtendedAttributes{
+		"long system use":           {SystemUse: make([]byte, 65)},
+		"invalid system identifier": {SystemIdentifier: "lower case"},
+	} {
+		image, err := iso9660.NewImage(fstest.MapFS{"A.TXT": {Data: []byte("a")}}, iso9660.WithExtendedAttributes(func(string, fs.FileInfo) *iso9660.ExtendedAttributes {
+			return attributes
+		}))
+		require.NoError(t, err, "NewImage should not return an error")
+
+		_, err = image.WriteTo(io.Discard)
+		assert.Error(t, err, "Extended attributes with %s should not be recorded", name)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package iso9660
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileOwner returns the user and group that own a file on disk
+func fileOwner(info fs.FileInfo) (uint32, uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+
+	return stat.Uid, stat.Gid, true
+}
@@ -0,0 +1,455 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var descriptorTypes = map[spec.VolumeDescriptorType]string{
+	spec.VolumeDescriptorTypeBootRecord:    "boot record",
+	spec.VolumeDescriptorTypePrimary:       "primary",
+	spec.VolumeDescriptorTypeSupplementary: "supplementary",
+	spec.VolumeDescriptorTypePartition:     "partition",
+	spec.VolumeDescriptorTypeTerminator:    "terminator",
+}
+
+var fileFlags = []struct {
+	flag spec.FileFlag
+	name string
+}{
+	{spec.FileFlagHidden, "hidden"},
+	{spec.FileFlagDirectory, "directory"},
+	{spec.FileFlagAssociatedFile, "associated"},
+	{spec.FileFlagRecord, "record"},
+	{spec.FileFlagProtection, "protection"},
+	{spec.FileFlagMultiExtent, "multi-extent"},
+}
+
+type volumeInfo struct {
+	SystemIdentifier            string    `json:"systemIdentifier"`
+	VolumeIdentifier            string    `json:"volumeIdentifier"`
+	VolumeSpaceSize             uint32    `json:"volumeSpaceSize"`
+	VolumeSetSize               uint16    `json:"volumeSetSize"`
+	VolumeSequenceNumber        uint16    `json:"volumeSequenceNumber"`
+	LogicalBlockSize            uint16    `json:"logicalBlockSize"`
+	PathTableSize               uint32    `json:"pathTableSize"`
+	TypeLPathTable              uint32    `json:"typeLPathTable"`
+	TypeMPathTable              uint32    `json:"typeMPathTable"`
+	RootExtentLocation          uint32    `json:"rootExtentLocation"`
+	RootDataLength              uint32    `json:"rootDataLength"`
+	VolumeSetIdentifier         string    `json:"volumeSetIdentifier"`
+	PublisherIdentifier         string    `json:"publisherIdentifier"`
+	DataPreparerIdentifier      string    `json:"dataPreparerIdentifier"`
+	ApplicationIdentifier       string    `json:"applicationIdentifier"`
+	CopyrightFileIdentifier     string    `json:"copyrightFileIdentifier"`
+	AbstractFileIdentifier      string    `json:"abstractFileIdentifier"`
+	BibliographicFileIdentifier string    `json:"bibliographicFileIdentifier"`
+	CreationTime                time.Time `json:"creationTime"`
+	ModificationTime            time.Time `json:"modificationTime"`
+	ExpirationTime              time.Time `json:"expirationTime"`
+	EffectiveTime               time.Time `json:"effectiveTime"`
+	FileStructureVersion        uint8     `json:"fileStructureVersion"`
+}
+
+type descriptorInfo struct {
+	Block   uint32      `json:"block"`
+	Type    string      `json:"type"`
+	Version uint8       `json:"version"`
+	Volume  *volumeInfo `json:"volume,omitempty"`
+
+	// BootSystemIdentifier is only set for boot records
+	BootSystemIdentifier string `json:"bootSystemIdentifier,omitempty"`
+}
+
+type pathTableEntry struct {
+	Number         int    `json:"number"`
+	Identifier     string `json:"identifier"`
+	ExtentLocation uint32 `json:"extentLocation"`
+	Parent         uint16 `json:"parent"`
+}
+
+type imageInfo struct {
+	Descriptors     []descriptorInfo `json:"descriptors"`
+	TypeLPathTable  []pathTableEntry `json:"typeLPathTable"`
+	TypeMPathTable  []pathTableEntry `json:"typeMPathTable"`
+	UsesSUSP        bool             `json:"usesSUSP"`
+	PathTablesMatch bool             `json:"pathTablesMatch"`
+}
+
+type suspEntry struct {
+	Signature string `json:"signature"`
+	Version   uint8  `json:"version"`
+	Data      string `json:"data"`
+}
+
+type listingEntry struct {
+	Path                 string      `json:"path"`
+	Identifier           string      `json:"identifier"`
+	ExtentLocation       uint32      `json:"extentLocation"`
+	DataLength           uint32      `json:"dataLength"`
+	Flags                []string    `json:"flags"`
+	RecordingTime        time.Time   `json:"recordingTime"`
+	VolumeSequenceNumber uint16      `json:"volumeSequenceNumber"`
+	ExtendedAttributes   uint8       `json:"extendedAttributeRecordLength"`
+	SystemUse            []suspEntry `json:"systemUse,omitempty"`
+}
+
+// openImage opens the image given by the -input flag, exiting with usage information if there isn't one
+func openImage(flags *flag.FlagSet, input string) (*reader.Image, io.Closer) {
+	if len(input) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	f, closer, err := openInput(input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	img, err := reader.Open(f)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return img, closer
+}
+
+func info(args []string) {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	input := flags.String("input", "", "ISO file to inspect")
+	asJSON := flags.Bool("json", false, "Print information as JSON")
+
+	_ = flags.Parse(args)
+
+	img, closer := openImage(flags, *input)
+	defer closer.Close()
+
+	result, err := inspectImage(img)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		printJSON(os.Stdout, result)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, descriptor := range result.Descriptors {
+		fmt.Fprintf(w, "Volume descriptor at block %d (%s, version %d)\n", descriptor.Block, descriptor.Type, descriptor.Version)
+
+		if descriptor.BootSystemIdentifier != "" {
+			fmt.Fprintf(w, "  Boot system identifier:\t%s\n", descriptor.BootSystemIdentifier)
+		}
+
+		if v := descriptor.Volume; v != nil {
+			fmt.Fprintf(w, "  System identifier:\t%s\n", v.SystemIdentifier)
+			fmt.Fprintf(w, "  Volume identifier:\t%s\n", v.VolumeIdentifier)
+			fmt.Fprintf(w, "  Volume space size:\t%d blocks\n", v.VolumeSpaceSize)
+			fmt.Fprintf(w, "  Volume set size:\t%d\n", v.VolumeSetSize)
+			fmt.Fprintf(w, "  Volume sequence number:\t%d\n", v.VolumeSequenceNumber)
+			fmt.Fprintf(w, "  Logical block size:\t%d\n", v.LogicalBlockSize)
+			fmt.Fprintf(w, "  Path table size:\t%d bytes\n", v.PathTableSize)
+			fmt.Fprintf(w, "  Type L path table:\tblock %d\n", v.TypeLPathTable)
+			fmt.Fprintf(w, "  Type M path table:\tblock %d\n", v.TypeMPathTable)
+			fmt.Fprintf(w, "  Root directory:\tblock %d, %d bytes\n", v.RootExtentLocation, v.RootDataLength)
+			fmt.Fprintf(w, "  Volume set identifier:\t%s\n", v.VolumeSetIdentifier)
+			fmt.Fprintf(w, "  Publisher identifier:\t%s\n", v.PublisherIdentifier)
+			fmt.Fprintf(w, "  Data preparer identifier:\t%s\n", v.DataPreparerIdentifier)
+			fmt.Fprintf(w, "  Application identifier:\t%s\n", v.ApplicationIdentifier)
+			fmt.Fprintf(w, "  Copyright file identifier:\t%s\n", v.CopyrightFileIdentifier)
+			fmt.Fprintf(w, "  Abstract file identifier:\t%s\n", v.AbstractFileIdentifier)
+			fmt.Fprintf(w, "  Bibliographic file identifier:\t%s\n", v.BibliographicFileIdentifier)
+			fmt.Fprintf(w, "  Creation time:\t%s\n", formatTime(v.CreationTime))
+			fmt.Fprintf(w, "  Modification time:\t%s\n", formatTime(v.ModificationTime))
+			fmt.Fprintf(w, "  Expiration time:\t%s\n", formatTime(v.ExpirationTime))
+			fmt.Fprintf(w, "  Effective time:\t%s\n", formatTime(v.EffectiveTime))
+			fmt.Fprintf(w, "  File structure version:\t%d\n", v.FileStructureVersion)
+		}
+	}
+
+	fmt.Fprintf(w, "\nSystem Use Sharing Protocol:\t%t\n", result.UsesSUSP)
+	fmt.Fprintf(w, "Path tables match:\t%t\n", result.PathTablesMatch)
+
+	fmt.Fprintf(w, "\nType L path table:\n  #\tExtent\tParent\tIdentifier\n")
+	for _, entry := range result.TypeLPathTable {
+		fmt.Fprintf(w, "  %d\t%d\t%d\t%s\n", entry.Number, entry.ExtentLocation, entry.Parent, entry.Identifier)
+	}
+
+	_ = w.Flush()
+}
+
+func ls(args []string) {
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	input := flags.String("input", "", "ISO file to list")
+	dir := flags.String("path", "/", "Directory in the ISO file to list")
+	asJSON := flags.Bool("json", false, "Print listing as JSON")
+
+	_ = flags.Parse(args)
+
+	img, closer := openImage(flags, *input)
+	defer closer.Close()
+
+	entries, err := listImage(img, *dir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *asJSON {
+		printJSON(os.Stdout, entries)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Extent\tLength\tRecorded\tFlags\tSUSP\tPath\n")
+	for _, entry := range entries {
+		signatures := make([]string, 0, len(entry.SystemUse))
+		for _, su := range entry.SystemUse {
+			signatures = append(signatures, su.Signature)
+		}
+
+		fmt.Fprintf(
+			w,
+			"%d\t%d\t%s\t%s\t%s\t%s\n",
+			entry.ExtentLocation,
+			entry.DataLength,
+			formatTime(entry.RecordingTime),
+			strings.Join(entry.Flags, ","),
+			strings.Join(signatures, ","),
+			entry.Path,
+		)
+	}
+
+	_ = w.Flush()
+}
+
+func inspectImage(img *reader.Image) (*imageInfo, error) {
+	result := &imageInfo{}
+
+	for _, descriptor := range img.Descriptors {
+		d := descriptorInfo{
+			Block:   descriptor.Block,
+			Type:    descriptorTypes[descriptor.Header.Kind],
+			Version: descriptor.Header.VolumeDescriptorVersion,
+		}
+
+		if d.Type == "" {
+			d.Type = fmt.Sprintf("reserved (%d)", descriptor.Header.Kind)
+		}
+
+		switch descriptor.Header.Kind {
+		case spec.VolumeDescriptorTypeBootRecord:
+			// ECMA-119 (5th ed.) §9.2.3
+			d.BootSystemIdentifier = reader.Identifier(descriptor.Data[7:39])
+
+		case spec.VolumeDescriptorTypePrimary, spec.VolumeDescriptorTypeSupplementary:
+			pvd, err := descriptor.Volume()
+			if err != nil {
+				return nil, err
+			}
+
+			d.Volume = &volumeInfo{
+				SystemIdentifier:            reader.Identifier(pvd.SystemIdentifier[:]),
+				VolumeIdentifier:            reader.Identifier(pvd.VolumeIdentifier[:]),
+				VolumeSpaceSize:             pvd.VolumeSpaceSize.RealValue(),
+				VolumeSetSize:               pvd.VolumeSetSize.RealValue(),
+				VolumeSequenceNumber:        pvd.VolumeSequenceNumber.RealValue(),
+				LogicalBlockSize:            pvd.LogicalBlockSize.RealValue(),
+				PathTableSize:               pvd.PathTableSize.RealValue(),
+				TypeLPathTable:              pvd.LocationTypeLPathTable,
+				TypeMPathTable:              pvd.LocationTypeMPathTable,
+				RootExtentLocation:          pvd.RootDirectoryRecord.ExtentLocation.RealValue(),
+				RootDataLength:              pvd.RootDirectoryRecord.DataLength.RealValue(),
+				VolumeSetIdentifier:         reader.Identifier(pvd.VolumeSetIdentifier[:]),
+				PublisherIdentifier:         reader.Identifier(pvd.PublisherIdentifier[:]),
+				DataPreparerIdentifier:      reader.Identifier(pvd.DataPreparerIdentifier[:]),
+				ApplicationIdentifier:       reader.Identifier(pvd.ApplicationIdentifier[:]),
+				CopyrightFileIdentifier:     reader.Identifier(pvd.CopyrightFileIdentifier[:]),
+				AbstractFileIdentifier:      reader.Identifier(pvd.AbstractFileIdentifier[:]),
+				BibliographicFileIdentifier: reader.Identifier(pvd.BibliographicFileIdentifier[:]),
+				CreationTime:                pvd.VolumeCreationDateTime.Time(),
+				ModificationTime:            pvd.VolumeModificationDateTime.Time(),
+				ExpirationTime:              pvd.VolumeExpirationDateTime.Time(),
+				EffectiveTime:               pvd.VolumeEffectiveDateTime.Time(),
+				FileStructureVersion:        uint8(pvd.FileStructureVersion),
+			}
+		}
+
+		result.Descriptors = append(result.Descriptors, d)
+	}
+
+	var err error
+	if result.TypeLPathTable, err = pathTable(img, false); err != nil {
+		return nil, err
+	}
+
+	if result.TypeMPathTable, err = pathTable(img, true); err != nil {
+		return nil, err
+	}
+
+	result.PathTablesMatch = len(result.TypeLPathTable) == len(result.TypeMPathTable)
+	for i := 0; result.PathTablesMatch && i < len(result.TypeLPathTable); i++ {
+		result.PathTablesMatch = result.TypeLPathTable[i] == result.TypeMPathTable[i]
+	}
+
+	if result.UsesSUSP, err = img.HasSUSP(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func pathTable(img *reader.Image, bigEndian bool) ([]pathTableEntry, error) {
+	records, err := img.ReadPathTable(bigEndian)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]pathTableEntry, 0, len(records))
+	for i, record := range records {
+		identifier := string(record.DirectoryIdentifier)
+		if i == 0 {
+			identifier = "/"
+		}
+
+		entries = append(entries, pathTableEntry{
+			Number:         i + 1,
+			Identifier:     identifier,
+			ExtentLocation: record.LocationOfExtent,
+			Parent:         record.ParentDirectoryNumber,
+		})
+	}
+
+	return entries, nil
+}
+
+// listImage recursively lists the records below a directory, given as a slash-separated path of file identifiers.
+// Every record is listed, including associated files and every version of a file, since the listing is meant for
+// debugging images rather than browsing them.
+func listImage(img *reader.Image, dirPath string) ([]listingEntry, error) {
+	dir, err := img.Root()
+	if err != nil {
+		return nil, err
+	}
+
+	dirPath = path.Clean("/" + dirPath)
+	if dirPath != "/" {
+	components:
+		for _, component := range strings.Split(strings.TrimPrefix(dirPath, "/"), "/") {
+			records, err := img.ReadDir(dir)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, record := range records {
+				if record.IsDir() && !record.IsSelf() && !record.IsParent() && record.Name() == component {
+					dir = record
+					continue components
+				}
+			}
+
+			return nil, fmt.Errorf("directory '%s' not found in image", dirPath)
+		}
+	}
+
+	var entries []listingEntry
+	visited := make(map[uint32]bool)
+
+	var walk func(dir *reader.Record, dirPath string) error
+	walk = func(dir *reader.Record, dirPath string) error {
+		visited[dir.ExtentLocation.RealValue()] = true
+
+		records, err := img.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("could not read directory '%s': %w", dirPath, err)
+		}
+
+		for _, record := range records {
+			if record.IsSelf() || record.IsParent() {
+				continue
+			}
+
+			entry, err := newListingEntry(img, record, path.Join(dirPath, string(record.FileIdentifier)))
+			if err != nil {
+				return err
+			}
+
+			entries = append(entries, entry)
+
+			if record.IsDir() && !visited[record.ExtentLocation.RealValue()] {
+				if err := walk(record, entry.Path); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(dir, dirPath); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+func newListingEntry(img *reader.Image, record *reader.Record, entryPath string) (listingEntry, error) {
+	entry := listingEntry{
+		Path:                 entryPath,
+		Identifier:           string(record.FileIdentifier),
+		ExtentLocation:       record.ExtentLocation.RealValue(),
+		DataLength:           record.DataLength.RealValue(),
+		Flags:                []string{},
+		RecordingTime:        record.RecordingDateAndTime.Time(),
+		VolumeSequenceNumber: record.VolumeSequenceNumber.RealValue(),
+		ExtendedAttributes:   record.ExtendedAttributeRecordLength,
+	}
+
+	for _, f := range fileFlags {
+		if record.FileFlags&f.flag != 0 {
+			entry.Flags = append(entry.Flags, f.name)
+		}
+	}
+
+	systemUse, err := img.SystemUseEntries(record)
+	if err != nil {
+		return entry, fmt.Errorf("could not read system use entries of '%s': %w", entryPath, err)
+	}
+
+	for _, su := range systemUse {
+		entry.SystemUse = append(entry.SystemUse, suspEntry{
+			Signature: su.Signature,
+			Version:   su.Version,
+			Data:      hex.EncodeToString(su.Data),
+		})
+	}
+
+	return entry, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func printJSON(w io.Writer, v any) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		log.Fatal(err)
+	}
+}
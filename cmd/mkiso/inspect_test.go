@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var update = flag.Bool("update", false, "Update golden files")
+
+// inspectTestImage writes an image with an enhanced volume descriptor, so that it has a supplementary volume descriptor
+// too
+func inspectTestImage(t *testing.T) *reader.Image {
+	modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	image, err := iso9660.NewImage(fstest.MapFS{
+		"BOOT":            {Mode: os.ModeDir | 0o755, ModTime: modTime},
+		"BOOT/KERNEL.IMG": {Data: []byte("kernel"), ModTime: modTime},
+		"README.TXT":      {Data: []byte("readme"), ModTime: modTime},
+	}, iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	return img
+}
+
+// assertGolden compares JSON output with a file in testdata, or updates the file if the -update flag is given
+func assertGolden(t *testing.T, name string, v any) {
+	var buff bytes.Buffer
+	printJSON(&buff, v)
+
+	golden := filepath.Join("testdata", name)
+	if *update {
+		require.NoError(t, os.WriteFile(golden, buff.Bytes(), 0o644), "Should be able to update golden file")
+	}
+
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err, "Should be able to read golden file")
+	assert.Equal(t, string(expected), buff.String(), "Output should match golden file '%s'", golden)
+}
+
+func TestInspectImage(t *testing.T) {
+	result, err := inspectImage(inspectTestImage(t))
+	require.NoError(t, err, "inspectImage should not return an error for an image we wrote")
+
+	assertGolden(t, "info.golden.json", result)
+}
+
+func TestListImage(t *testing.T) {
+	entries, err := listImage(inspectTestImage(t), "/")
+	require.NoError(t, err, "listImage should not return an error for an image we wrote")
+	assertGolden(t, "ls.golden.json", entries)
+
+	entries, err = listImage(inspectTestImage(t), "/BOOT")
+	require.NoError(t, err, "listImage should not return an error for a directory in the image")
+	require.Len(t, entries, 1, "Listing of a directory should only contain its entries")
+	assert.Equal(t, "/BOOT/KERNEL.IMG;1", entries[0].Path, "Listing should give the full path of entries")
+
+	_, err = listImage(inspectTestImage(t), "/MISSING")
+	assert.Error(t, err, "listImage should return an error for a missing directory")
+}
@@ -1,38 +1,552 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/davejbax/go-iso9660"
-	"io/fs"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
+var conflictPolicies = map[string]iso9660.ConflictPolicy{
+	"error": iso9660.ConflictPolicyError,
+	"first": iso9660.ConflictPolicyFirstWins,
+	"last":  iso9660.ConflictPolicyLastWins,
+}
+
+var compressedFormats = map[string]iso9660.CompressedFormat{
+	"cso":  iso9660.CompressedFormatCSO,
+	"cso2": iso9660.CompressedFormatCSOv2,
+	"zso":  iso9660.CompressedFormatZSO,
+}
+
+var rawSectorModes = map[string]iso9660.RawSectorMode{
+	"mode1": iso9660.RawSectorMode1,
+	"mode2": iso9660.RawSectorMode2Form1,
+}
+
+// commands are the subcommands of mkiso. If no subcommand is given, 'create' is assumed.
+var commands = map[string]func(args []string){
+	"create":  create,
+	"extract": extract,
+	"info":    info,
+	"ls":      ls,
+	"verify":  verify,
+}
+
 func main() {
-	dir := flag.String("dir", "", "Directory to use as source for ISO file")
-	output := flag.String("output", "mkiso.iso", "Output file name/path")
+	args := os.Args[1:]
+	command := create
+
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		var ok bool
+		if command, ok = commands[args[0]]; !ok {
+			fmt.Fprintf(os.Stderr, "unknown command '%s': expected create, extract, info, ls or verify\n", args[0])
+			os.Exit(2)
+		}
+
+		args = args[1:]
+	}
+
+	command(args)
+}
+
+func create(args []string) {
+	var grafts []iso9660.GraftPoint
+
+	flags := flag.NewFlagSet("create", flag.ExitOnError)
+	dir := flags.String("dir", "", "Directory to use as source for ISO file")
+	output := flags.String("output", "mkiso.iso", "Output file name/path")
+	conflict := flags.String("conflict", "error", "How to resolve graft points that provide the same path: error, first, or last")
+	flags.Func("graft", "Graft a file or directory into the ISO file, given as path/in/image=path/on/host (may be repeated)", func(value string) error {
+		graft, err := parseGraftPoint(value)
+		if err != nil {
+			return err
+		}
+
+		grafts = append(grafts, graft)
+		return nil
+	})
+
+	hybridMBR := flags.String("hybrid-mbr", "", "Boot code template (e.g. isohdpfx.bin) for an isohybrid MBR, so the ISO file can also boot from a disk")
+	hybridBootLoader := flags.String("hybrid-boot-loader", "", "Path in the ISO file of the boot loader loaded by the isohybrid boot code (e.g. ISOLINUX/ISOLINUX.BIN)")
+	hybridEFIImage := flags.String("hybrid-efi-image", "", "Path in the ISO file of an EFI system partition image to add to the isohybrid MBR")
+
+	gpt := flags.Bool("gpt", false, "Write a GPT covering the ISO 9660 filesystem, for booting with UEFI from a disk")
+	apm := flags.Bool("apm", false, "Write an Apple partition map alongside the GPT, with the same partitions (implies -gpt)")
+	efiPartition := flags.String("efi-partition", "", "EFI system partition image (e.g. a FAT filesystem) to append to the ISO file, with a GPT entry")
+	efiDir := flags.String("efi-dir", "", "Directory (e.g. containing EFI/BOOT/BOOTX64.EFI) to build a FAT EFI system partition image from, which is appended like -efi-partition, and also added to the ISO file at the -hybrid-efi-image path if given")
+
+	systemArea := flags.String("system-area", "", "File of up to 32 KiB to write verbatim to the system area at the start of the ISO file")
+
+	previous := flags.String("previous", "", "Existing ISO file to append a new session to. Only the new session is written to -output, which must then be written at block -session-start of the existing ISO file or disc")
+	previousStart := flags.Uint("previous-start", 0, "Block at which the last session of the -previous ISO file starts")
+	sessionStart := flags.Uint("session-start", 0, "Block at which the new session will be written (default: the end of the -previous ISO file)")
+
+	enhanced := flags.Bool("enhanced", false, "Add an ISO 9660:1999 enhanced volume descriptor, recording names of up to 207 bytes as they are in the source")
+	udf := flags.Bool("udf", false, "Add a UDF 1.02 bridge, for readers that only understand UDF")
+
+	var zisofsExclude []string
+	zisofs := flags.Bool("zisofs", false, "Compress files with zisofs, which Linux decompresses transparently")
+	zisofsMinSize := flags.Int64("zisofs-min-size", 0, "Size in bytes below which files aren't compressed with -zisofs")
+	flags.Func("zisofs-exclude", "Pattern (e.g. *.EFI) of paths or names of files not to compress with -zisofs (may be repeated)", func(value string) error {
+		zisofsExclude = append(zisofsExclude, value)
+		return nil
+	})
+
+	volumeSize := flags.Int64("volume-size", 0, "Split the ISO file into a volume set of volumes of at most this many bytes, written to files named like the -output file with the volume number before the extension (e.g. mkiso.1.iso)")
+	compress := flags.String("compress", "", "Compress the ISO file for emulators, in one of the formats cso, cso2 or zso")
+	implantMD5 := flags.Bool("implant-md5", false, "Record an MD5 checksum of the ISO file in its PVD, like implantisomd5, for installers that verify their media with checkisomd5")
+	manifest := flags.String("manifest", "", "Add a manifest with this name (e.g. SHA256SUMS) to the root of the ISO file, listing the SHA-256 digest of every file for checking with sha256sum -c")
+	sortFile := flags.String("sort", "", "Path to a sort file of paths or patterns (e.g. boot/*) and weights, one per line, placing the data of files with greater weights first, like mkisofs -sort")
+	var hidden []string
+	flags.Func("hidden", "Pattern (e.g. BOOT.CAT) of paths or names of files and directories to hide (may be repeated)", func(value string) error {
+		hidden = append(hidden, value)
+		return nil
+	})
+	associated := make(map[string]string)
+	flags.Func("associated", "Record a file as the associated file (e.g. resource fork) of another file in the same directory, given as path/in/image=name (may be repeated)", func(value string) error {
+		filePath, name, ok := strings.Cut(value, "=")
+		if !ok {
+			return errors.New("associated file must be given as path=name")
+		}
+
+		associated[filePath] = name
+		return nil
+	})
+	fileVersions := make(map[string]iso9660.FileVersion)
+	flags.Func("file-version", "Record a file with a version number, and optionally under the name of another file in the same directory, given as path/in/image=version or path/in/image=NAME;version (may be repeated)", func(value string) error {
+		filePath, version, ok := strings.Cut(value, "=")
+		if !ok {
+			return errors.New("file version must be given as path=version or path=NAME;version")
+		}
+
+		var fileVersion iso9660.FileVersion
+		if name, number, ok := strings.Cut(version, ";"); ok {
+			fileVersion.Name, version = name, number
+		}
+
+		var err error
+		if fileVersion.Version, err = strconv.Atoi(version); err != nil {
+			return fmt.Errorf("invalid file version: %w", err)
+		}
+
+		fileVersions[filePath] = fileVersion
+		return nil
+	})
+	omitVersionOne := flags.Bool("omit-version-one", false, "Record files with version 1 without a version number (e.g. KERNEL. rather than KERNEL.;1), which ECMA-119 doesn't allow")
+	extendedAttributes := flags.Bool("extended-attributes", false, "Record the owner, group, permissions and modification time of every file and directory in extended attribute records")
+
+	alignFiles := make(map[string]int64)
+	align := flags.Int64("align", 0, "Align the data of files to this many bytes (e.g. 32768), which must be a power of two multiple of 2048")
+	alignMinSize := flags.Int64("align-min-size", 0, "Size in bytes below which files aren't aligned by -align")
+	flags.Func("align-file", "Align the data of a file, given as path/in/image=bytes, instead of by -align (may be repeated)", func(value string) error {
+		filePath, size, ok := strings.Cut(value, "=")
+		if !ok {
+			return errors.New("alignment must be given as path=bytes")
+		}
+
+		var err error
+		if alignFiles[filePath], err = strconv.ParseInt(size, 10, 64); err != nil {
+			return fmt.Errorf("invalid alignment: %w", err)
+		}
+
+		return nil
+	})
+	pad := flags.Bool("pad", false, "Pad the end of the ISO file with 150 blocks of zeros, for drives that fail to read the last files on a disc")
+	sparse := flags.Bool("sparse", false, "Skip over blocks of zeros rather than writing them, so that the ISO file is sparse")
+	jobs := flags.Int("jobs", 0, "Write the ISO file out of order, with the data of up to this many files written at once")
+	raw := flags.String("raw", "", "Write the ISO file as raw 2352-byte sectors of mode1 or mode2 (Mode 2 Form 1), with a cue sheet named like the -output file with a .cue extension")
+
+	_ = flags.Parse(args)
+
+	var opts []iso9660.ImageOption
+	if len(*systemArea) > 0 {
+		data, err := os.ReadFile(*systemArea)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts = append(opts, iso9660.WithSystemArea(bytes.NewReader(data)))
+	}
+
+	if *enhanced {
+		opts = append(opts, iso9660.WithEnhancedVolumeDescriptor())
+	}
+
+	if *udf {
+		opts = append(opts, iso9660.WithUDF())
+	}
+
+	if *implantMD5 {
+		opts = append(opts, iso9660.WithImplantedMD5())
+	}
+
+	if len(*manifest) > 0 {
+		opts = append(opts, iso9660.WithManifest(iso9660.Manifest{Name: *manifest}))
+	}
 
-	flag.Parse()
+	if len(*sortFile) > 0 {
+		f, err := os.Open(*sortFile)
+		if err != nil {
+			log.Fatal(err)
+		}
 
-	if len(*dir) == 0 {
-		flag.Usage()
+		weight, err := iso9660.ParseSortFile(f)
+		f.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts = append(opts, iso9660.WithSortWeights(weight))
+	}
+
+	if len(hidden) > 0 {
+		opts = append(opts, iso9660.WithHiddenFiles(hidden...))
+	}
+
+	if len(associated) > 0 {
+		opts = append(opts, iso9660.WithAssociatedFiles(associated))
+	}
+
+	if len(fileVersions) > 0 || *omitVersionOne {
+		opts = append(opts, iso9660.WithFileVersions(iso9660.FileVersions{Files: fileVersions, OmitVersionOne: *omitVersionOne}))
+	}
+
+	if *extendedAttributes {
+		opts = append(opts, iso9660.WithExtendedAttributes(iso9660.FileInfoAttributes))
+	}
+
+	if *align > 0 || len(alignFiles) > 0 {
+		opts = append(opts, iso9660.WithAlignment(iso9660.Alignment{Size: *align, MinFileSize: *alignMinSize, Files: alignFiles}))
+	}
+
+	if *pad {
+		opts = append(opts, iso9660.WithPadding(iso9660.DefaultPadding))
+	}
+
+	if *zisofs {
+		opts = append(opts, iso9660.WithZisofs(iso9660.Zisofs{MinSize: *zisofsMinSize, Exclude: zisofsExclude}))
+	}
+
+	if len(*previous) > 0 {
+		previousFile, err := os.Open(*previous)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer previousFile.Close()
+
+		opts = append(opts, iso9660.WithPreviousSession(iso9660.PreviousSession{
+			Image:     previousFile,
+			Start:     uint32(*previousStart),
+			NextStart: uint32(*sessionStart),
+		}))
+	}
+
+	var efiImage *iso9660.FATImage
+	if len(*efiDir) > 0 {
+		if len(*efiPartition) > 0 {
+			log.Fatal("-efi-dir and -efi-partition cannot be used together")
+		}
+
+		var err error
+		if efiImage, err = iso9660.NewFATImage(os.DirFS(*efiDir)); err != nil {
+			log.Fatal(err)
+		}
+
+		if len(*hybridEFIImage) > 0 {
+			grafts = append(grafts, efiImage.GraftPoint(*hybridEFIImage))
+		}
 	}
 
-	img, err := iso9660.NewImage(os.DirFS(*dir).(fs.ReadDirFS))
+	if *gpt || *apm || len(*efiPartition) > 0 || efiImage != nil {
+		var appended []iso9660.AppendedPartition
+		if efiImage != nil {
+			appended = append(appended, efiImage.AppendedPartition())
+		}
+
+		if len(*efiPartition) > 0 {
+			partitionFile, err := os.Open(*efiPartition)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer partitionFile.Close()
+
+			info, err := partitionFile.Stat()
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			appended = append(appended, iso9660.AppendedPartition{
+				Name: "EFI system partition",
+				Type: iso9660.PartitionTypeEFISystem,
+				Data: partitionFile,
+				Size: info.Size(),
+			})
+		}
+
+		opts = append(opts, iso9660.WithGPT(iso9660.GPT{ISOPartition: true, AppendedPartitions: appended, AppleMap: *apm}))
+	}
+
+	if len(*hybridMBR) > 0 || len(*hybridEFIImage) > 0 {
+		var bootCode []byte
+		if len(*hybridMBR) > 0 {
+			var err error
+			if bootCode, err = os.ReadFile(*hybridMBR); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		opts = append(opts, iso9660.WithHybridMBR(iso9660.HybridMBR{
+			BootCode:   bootCode,
+			BootLoader: *hybridBootLoader,
+			EFIImage:   *hybridEFIImage,
+		}))
+	}
+
+	if len(*dir) > 0 {
+		grafts = append([]iso9660.GraftPoint{{Path: ".", Source: os.DirFS(*dir)}}, grafts...)
+	}
+
+	policy, ok := conflictPolicies[*conflict]
+	if len(grafts) == 0 || !ok {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	format, compressed := compressedFormats[*compress]
+	if len(*compress) > 0 && (!compressed || *volumeSize > 0) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	mode, rawSectors := rawSectorModes[*raw]
+	if len(*raw) > 0 && (!rawSectors || compressed || *volumeSize > 0 || len(*previous) > 0) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if (*jobs > 0 || *sparse) && (compressed || rawSectors || *volumeSize > 0) {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	contents, err := iso9660.NewGraftFS(policy, grafts...)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	outputFile, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	img, err := iso9660.NewImage(contents, opts...)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *volumeSize > 0 {
+		count, err := img.WriteVolumeSet(*volumeSize, func(sequenceNumber int) (io.Writer, error) {
+			return os.OpenFile(volumePath(*output, sequenceNumber), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("successfully wrote %d volumes %s to %s\n", count, volumePath(*output, 1), volumePath(*output, count))
+		return
+	}
+
+	// Writing out of order reads the ISO file back to implant an MD5 checksum
+	outputFile, err := os.OpenFile(*output, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o644)
 	defer outputFile.Close()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if _, err := img.WriteTo(outputFile); err != nil {
+	if compressed {
+		err = writeCompressed(img, outputFile, format)
+	} else if rawSectors {
+		err = writeRawSectors(img, outputFile, *output, mode)
+	} else if *sparse {
+		err = writeSparse(img, outputFile, *jobs)
+	} else if *jobs > 0 {
+		_, err = img.WriteToWriterAt(outputFile, *jobs)
+	} else {
+		_, err = img.WriteTo(outputFile)
+	}
+
+	if err != nil {
 		log.Fatal(err)
 	}
 
 	fmt.Printf("successfully wrote file %s\n", *output)
 }
+
+func extract(args []string) {
+	flags := flag.NewFlagSet("extract", flag.ExitOnError)
+	input := flags.String("input", "", "ISO file to extract")
+	output := flags.String("output", "", "Directory to extract the ISO file into")
+	owners := flags.Bool("owners", false, "Restore file ownership from Rock Ridge metadata")
+	devices := flags.Bool("devices", false, "Create device nodes and named pipes from Rock Ridge metadata")
+
+	_ = flags.Parse(args)
+
+	if len(*input) == 0 || len(*output) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	inputFile, closer, err := openInput(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closer.Close()
+
+	if err := iso9660.Extract(inputFile, *output, &iso9660.ExtractOptions{
+		PreserveOwnership: *owners,
+		CreateDevices:     *devices,
+	}); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("successfully extracted %s to %s\n", *input, *output)
+}
+
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	input := flags.String("input", "", "ISO file to verify")
+
+	_ = flags.Parse(args)
+
+	if len(*input) == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	inputFile, closer, err := openInput(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer closer.Close()
+
+	problems := iso9660.Validate(inputFile)
+
+	// Images without an implanted checksum are fine, but one that doesn't match is a problem
+	if err := iso9660.VerifyImplantedMD5(inputFile); err == nil {
+		fmt.Println("implanted MD5 checksum matches")
+	} else if !errors.Is(err, iso9660.ErrNoImplantedMD5) {
+		problems = append(problems, iso9660.Problem{Err: err})
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("found %d problems in %s\n", len(problems), *input)
+		os.Exit(1)
+	}
+
+	fmt.Printf("no problems found in %s\n", *input)
+}
+
+// writeCompressed writes an image to w, compressed in the given format
+func writeCompressed(img *iso9660.Image, w io.WriteSeeker, format iso9660.CompressedFormat) error {
+	cw, err := iso9660.NewCompressedWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	if _, err := img.WriteTo(cw); err != nil {
+		return err
+	}
+
+	return cw.Close()
+}
+
+// writeRawSectors writes an image to w as raw sectors of the given mode, and a cue sheet for it alongside output
+func writeRawSectors(img *iso9660.Image, w io.Writer, output string, mode iso9660.RawSectorMode) error {
+	rw, err := iso9660.NewRawSectorWriter(w, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := img.WriteTo(rw); err != nil {
+		return err
+	}
+
+	if err := rw.Close(); err != nil {
+		return err
+	}
+
+	cuePath := strings.TrimSuffix(output, filepath.Ext(output)) + ".cue"
+	return os.WriteFile(cuePath, []byte(iso9660.CueSheet(filepath.Base(output), mode)), 0o644)
+}
+
+// writeSparse writes an image to f without writing blocks of zeros, out of order with the given number of jobs if it is
+// positive
+func writeSparse(img *iso9660.Image, f *os.File, jobs int) error {
+	sw, err := iso9660.NewSparseWriter(f)
+	if err != nil {
+		return err
+	}
+
+	if jobs > 0 {
+		_, err = img.WriteToWriterAt(sw, jobs)
+	} else {
+		_, err = img.WriteTo(sw)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return sw.Close()
+}
+
+// openInput opens an ISO file to read, which may be compressed in any of the formats supported by -compress
+func openInput(input string) (io.ReaderAt, io.Closer, error) {
+	f, err := os.Open(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if compressed, err := iso9660.OpenCompressedImage(f); err == nil {
+		return compressed, f, nil
+	}
+
+	return f, f, nil
+}
+
+// volumePath returns the path of a volume of a volume set, by inserting the volume's sequence number before the
+// extension of the output path
+func volumePath(output string, sequenceNumber int) string {
+	extension := filepath.Ext(output)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(output, extension), sequenceNumber, extension)
+}
+
+// parseGraftPoint parses a graft point in the form used by mkisofs, i.e. path/in/image=path/on/host
+func parseGraftPoint(value string) (iso9660.GraftPoint, error) {
+	imagePath, hostPath, ok := strings.Cut(value, "=")
+	if !ok {
+		return iso9660.GraftPoint{}, errors.New("graft point must be of the form path/in/image=path/on/host")
+	}
+
+	info, err := os.Stat(hostPath)
+	if err != nil {
+		return iso9660.GraftPoint{}, fmt.Errorf("could not stat graft point source: %w", err)
+	}
+
+	if info.IsDir() {
+		return iso9660.GraftPoint{Path: imagePath, Source: os.DirFS(hostPath)}, nil
+	}
+
+	return iso9660.GraftPoint{
+		Path:       imagePath,
+		Source:     os.DirFS(filepath.Dir(hostPath)),
+		SourcePath: filepath.Base(hostPath),
+	}, nil
+}
@@ -0,0 +1,109 @@
+package iso9660
+
+import (
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/ciso"
+	"io"
+)
+
+// CompressedFormat is a compressed image format used by emulators, see [NewCompressedWriter]
+type CompressedFormat int
+
+const (
+	// CompressedFormatCSO is version 1 of the CSO (or CISO) format, in which sectors are compressed with deflate. This
+	// is the most widely supported format.
+	CompressedFormatCSO CompressedFormat = iota + 1
+	// CompressedFormatCSOv2 is version 2 of the CSO format, as written by maxcso, in which each sector is compressed
+	// with deflate or LZ4, whichever is smaller
+	CompressedFormatCSOv2
+	// CompressedFormatZSO is the ZSO format, in which sectors are compressed with LZ4, which is faster to decompress
+	CompressedFormatZSO
+)
+
+func (f CompressedFormat) String() string {
+	return ciso.Format(f).String()
+}
+
+// sizedWriter is implemented by writers that need to know the size of an image before it is written, such as
+// [CompressedWriter]
+type sizedWriter interface {
+	SetSize(size int64) error
+}
+
+// CompressedWriter compresses an image, a sector at a time, as it is written. An image can be written to it directly
+// with [Image.WriteTo], which sets its size before writing anything:
+//
+//	w, err := iso9660.NewCompressedWriter(f, iso9660.CompressedFormatCSO)
+//	...
+//	if _, err := image.WriteTo(w); err != nil {
+//		...
+//	}
+//
+//	err = w.Close()
+//
+// Since the index of compressed sectors precedes them, it is written when the writer is closed, by seeking back to
+// it. This means that no temporary files are needed.
+type CompressedWriter struct {
+	w *ciso.Writer
+}
+
+var _ sizedWriter = &CompressedWriter{}
+
+// NewCompressedWriter returns a writer that compresses an image to w in the given format, starting at the current
+// offset of w
+func NewCompressedWriter(w io.WriteSeeker, format CompressedFormat) (*CompressedWriter, error) {
+	cw, err := ciso.NewWriter(w, ciso.Format(format))
+	if err != nil {
+		return nil, fmt.Errorf("could not create compressed writer: %w", err)
+	}
+
+	return &CompressedWriter{w: cw}, nil
+}
+
+// SetSize sets the uncompressed size of the image, which must be done before anything is written. [Image.WriteTo] does
+// this itself, so SetSize only needs to be called to write other data.
+func (c *CompressedWriter) SetSize(size int64) error {
+	return c.w.SetSize(size)
+}
+
+func (c *CompressedWriter) Write(p []byte) (int, error) {
+	return c.w.Write(p)
+}
+
+// Close finishes writing the compressed image. If less data was written than the size of the image, the rest of the
+// image is zeros. Close doesn't close the underlying writer.
+func (c *CompressedWriter) Close() error {
+	return c.w.Close()
+}
+
+// CompressedImage is a compressed image, in any [CompressedFormat], which decompresses sectors as they are read. It
+// implements [io.ReaderAt], so can be passed to [Extract] and [Validate] like an uncompressed image.
+type CompressedImage struct {
+	r *ciso.Reader
+}
+
+var _ io.ReaderAt = &CompressedImage{}
+
+// OpenCompressedImage reads the header and index of a compressed image
+func OpenCompressedImage(r io.ReaderAt) (*CompressedImage, error) {
+	cr, err := ciso.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not open compressed image: %w", err)
+	}
+
+	return &CompressedImage{r: cr}, nil
+}
+
+// Format returns the format that the image is compressed in
+func (c *CompressedImage) Format() CompressedFormat {
+	return CompressedFormat(c.r.Format())
+}
+
+// Size returns the uncompressed size of the image in bytes
+func (c *CompressedImage) Size() int64 {
+	return c.r.Size()
+}
+
+func (c *CompressedImage) ReadAt(p []byte, off int64) (int, error) {
+	return c.r.ReadAt(p, off)
+}
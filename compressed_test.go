@@ -0,0 +1,59 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCompressedWriter(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT":   {Data: bytes.Repeat([]byte("compressible "), 5000)},
+		"DATA/EMPTY":   {Data: []byte{}},
+		"DATA/ABC.BIN": {Data: []byte("abc")},
+	}
+
+	image, err := iso9660.NewImage(source)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var uncompressed bytes.Buffer
+	_, err = image.WriteTo(&uncompressed)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	for _, format := range []iso9660.CompressedFormat{iso9660.CompressedFormatCSO, iso9660.CompressedFormatCSOv2, iso9660.CompressedFormatZSO} {
+		f, err := os.Create(filepath.Join(t.TempDir(), "image"))
+		require.NoError(t, err, "Should be able to create output file")
+		defer f.Close()
+
+		w, err := iso9660.NewCompressedWriter(f, format)
+		require.NoError(t, err, "NewCompressedWriter should not return an error for valid arguments")
+
+		_, err = image.WriteTo(w)
+		require.NoError(t, err, "WriteTo should set the size of a compressed writer")
+		require.NoError(t, w.Close(), "Close should not return an error")
+
+		info, err := f.Stat()
+		require.NoError(t, err, "Should be able to stat output file")
+		assert.Less(t, info.Size(), int64(uncompressed.Len())/4, "%s image should be smaller than the uncompressed image", format)
+
+		compressed, err := iso9660.OpenCompressedImage(f)
+		require.NoError(t, err, "OpenCompressedImage should be able to read a %s image", format)
+		assert.Equal(t, format, compressed.Format(), "OpenCompressedImage should detect the format of a %s image", format)
+		assert.EqualValues(t, uncompressed.Len(), compressed.Size(), "%s image should have the size of the uncompressed image", format)
+		assert.Empty(t, iso9660.Validate(compressed), "%s image should not violate the spec", format)
+
+		dst := t.TempDir()
+		require.NoError(t, iso9660.Extract(compressed, dst, nil), "Extract should be able to read a %s image", format)
+
+		for name, file := range source {
+			extracted, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+			require.NoError(t, err, "'%s' should be extracted from a %s image", name, format)
+			assert.Equal(t, file.Data, extracted, "'%s' should be extracted from a %s image with its contents", name, format)
+		}
+	}
+}
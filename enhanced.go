@@ -0,0 +1,84 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
+	"io/fs"
+	"time"
+)
+
+// maxEnhancedIdentifierLength is the maximum length in bytes of a file identifier in the enhanced hierarchy, which is
+// the most that fits in a directory record without a system use field (ISO 9660:1999)
+const maxEnhancedIdentifierLength = 207
+
+// ErrEnhancedNameTooLong indicates that a name is too long to be recorded in the enhanced hierarchy
+var ErrEnhancedNameTooLong = errors.New("name too long for enhanced hierarchy")
+
+// WithEnhancedVolumeDescriptor adds an enhanced volume descriptor to the image, as defined by ISO 9660:1999. This
+// describes a second directory hierarchy in which names are recorded as they are in the image's contents: they may be
+// up to 207 bytes long, may contain any characters, and have no version numbers. The hierarchy may also be deeper than
+// the 8 levels that ECMA-119 allows. This gives long names on systems that support ISO 9660:1999, without needing Rock
+// Ridge. Files in both hierarchies share the same extents, so the enhanced hierarchy only adds its own directories.
+// Names close to the limit leave no room for system use entries, such as the ZF entries added by [WithZisofs], and
+// writing the image fails if a record would be longer than 255 bytes.
+//
+// So that every name can be recorded in the primary hierarchy too, characters in names that aren't d-characters are
+// replaced with underscores in the primary hierarchy.
+func WithEnhancedVolumeDescriptor() ImageOption {
+	return func(i *Image) error {
+		i.enhanced = true
+		return nil
+	}
+}
+
+// enhancedNaming records names unchanged, without version numbers
+type enhancedNaming struct{}
+
+var _ hierarchyNaming = enhancedNaming{}
+
+func (enhancedNaming) recordedName(name string, _ bool) string {
+	return name
+}
+
+func (enhancedNaming) versioned() bool {
+	return false
+}
+
+func (enhancedNaming) identifier(recordedName string, _ bool, _ int) (spec.FileIdentifier, error) {
+	if len(recordedName) > maxEnhancedIdentifierLength {
+		return nil, fmt.Errorf("%w: '%s' is %d bytes, but at most %d bytes are allowed", ErrEnhancedNameTooLong, recordedName, len(recordedName), maxEnhancedIdentifierLength)
+	}
+
+	return spec.FileIdentifier(recordedName), nil
+}
+
+// primaryNaming returns the naming of the primary hierarchy of the image
+func (i *Image) primaryNaming() hierarchyNaming {
+	return primaryNaming{relaxed: i.enhanced, omitVersionOne: i.omitVersionOne}
+}
+
+// newEnhancedDirectoryFromFS builds the enhanced hierarchy of a filesystem, whose files share the extents of the files
+// in the primary hierarchy, given by primaryFiles. Only the directories of the enhanced hierarchy have their own
+// extents. flags, compressed and sharingProtocol must be the same as for the primary hierarchy, so that the records of
+// files in both hierarchies describe them in the same way.
+func newEnhancedDirectoryFromFS(filesystem fs.ReadDirFS, recordedAt time.Time, volume uint16, primaryFiles map[string]*builder.File, flags fileFlags, compressed map[string]*zisofs.Layout, sharingProtocol bool) (*builder.Directory, error) {
+	dir, files, err := newDirectoryFromFS(filesystem, ".", recordedAt, volume, enhancedNaming{}, flags, compressed, sharingProtocol)
+	if err != nil {
+		return nil, err
+	}
+
+	for filePath, file := range files {
+		primary, ok := primaryFiles[filePath]
+		if !ok {
+			// This shouldn't happen: both hierarchies are built from the same filesystem
+			return nil, fmt.Errorf("file '%s' is not in the primary hierarchy", filePath)
+		}
+
+		file.Link(primary)
+	}
+
+	return dir, nil
+}
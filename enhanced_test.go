@@ -0,0 +1,120 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// findEnhancedRecord finds the record at a slash-separated path in the enhanced hierarchy of an image
+func findEnhancedRecord(t *testing.T, img *reader.Image, name string) *reader.Record {
+	var record *reader.Record
+	for _, descriptor := range img.Descriptors {
+		if descriptor.Header.Kind == spec.VolumeDescriptorTypeSupplementary && descriptor.Header.VolumeDescriptorVersion == spec.FileStructureVersionEnhanced {
+			var err error
+			record, err = descriptor.Root()
+			require.NoError(t, err, "Should be able to read enhanced root directory")
+		}
+	}
+	require.NotNil(t, record, "Image should have an enhanced volume descriptor")
+
+	for _, part := range strings.Split(name, "/") {
+		records, err := img.ReadDir(record)
+		require.NoError(t, err, "Should be able to read enhanced directory")
+
+		record = nil
+		for _, candidate := range records {
+			if !candidate.IsSelf() && !candidate.IsParent() && string(candidate.FileIdentifier) == part {
+				record = candidate
+				break
+			}
+		}
+
+		if record == nil {
+			return nil
+		}
+	}
+
+	return record
+}
+
+func TestWithEnhancedVolumeDescriptor(t *testing.T) {
+	deep := "a/b/c/d/e/f/g/h/i/j/deep file.txt"
+	source := fstest.MapFS{
+		"A much longer name than d-characters allow.tar.gz": {Data: []byte("long")},
+		"my-file.txt": {Data: []byte("hyphen")},
+		deep:          {Data: []byte("deep")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for names that aren't d-characters")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	var evd *spec.PrimaryVolumeDescriptor
+	for _, descriptor := range img.Descriptors {
+		if descriptor.Header.Kind == spec.VolumeDescriptorTypeSupplementary {
+			evd, err = descriptor.Volume()
+			require.NoError(t, err, "Enhanced volume descriptor should be readable")
+		}
+	}
+	require.NotNil(t, evd, "Image should have a supplementary volume descriptor")
+	assert.EqualValues(t, spec.FileStructureVersionEnhanced, evd.Header.VolumeDescriptorVersion, "Enhanced volume descriptor should have version 2")
+	assert.EqualValues(t, spec.FileStructureVersionEnhanced, evd.FileStructureVersion, "Enhanced volume descriptor should have file structure version 2")
+	assert.Equal(t, img.Primary.VolumeSpaceSize, evd.VolumeSpaceSize, "Enhanced volume descriptor should describe the same volume")
+
+	primaryNames := map[string]string{
+		"A much longer name than d-characters allow.tar.gz": "A_MUCH_LONGER_NAME_THAN_D_CHARACTERS_ALLOW_TAR.GZ",
+		"my-file.txt": "MY_FILE.TXT",
+		deep:          "A/B/C/D/E/F/G/H/I/J/DEEP_FILE.TXT",
+	}
+
+	for name, file := range source {
+		enhanced := findEnhancedRecord(t, img, name)
+		require.NotNil(t, enhanced, "Enhanced hierarchy should record '%s' unchanged", name)
+		assert.Equal(t, 0, enhanced.Version(), "Enhanced hierarchy should not record versions")
+
+		primary := findRecord(t, img, primaryNames[name])
+		require.NotNil(t, primary, "Primary hierarchy should record '%s' as '%s'", name, primaryNames[name])
+		assert.Equal(t, primary.ExtentLocation, enhanced.ExtentLocation, "Both hierarchies should share the extent of '%s'", name)
+
+		data, err := io.ReadAll(img.Open(enhanced))
+		require.NoError(t, err, "Should be able to read '%s' from the enhanced hierarchy", name)
+		assert.Equal(t, file.Data, data, "'%s' should have the correct contents", name)
+	}
+}
+
+func TestWithEnhancedVolumeDescriptor_NameTooLong(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{strings.Repeat("x", 208): {}}, iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, iso9660.ErrEnhancedNameTooLong, "WriteTo should fail for names longer than 207 bytes")
+}
+
+func TestWithEnhancedVolumeDescriptor_RecordTooLong(t *testing.T) {
+	// The longest enhanced name leaves no room in the record for the ZF entry of a compressed file
+	name := strings.Repeat("x", 203) + ".txt"
+	image, err := iso9660.NewImage(
+		fstest.MapFS{name: {Data: make([]byte, 64<<10)}},
+		iso9660.WithEnhancedVolumeDescriptor(),
+		iso9660.WithZisofs(iso9660.Zisofs{}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, spec.ErrDirectoryRecordTooLong, "WriteTo should fail for records longer than 255 bytes")
+}
@@ -0,0 +1,330 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrUnsafePath indicates that an image contains a file identifier that could be used to write outside of the
+	// extraction directory, such as '..' or a name containing a path separator
+	ErrUnsafePath = errors.New("image contains an unsafe path")
+	// ErrDirectoryCycle indicates that a directory in an image refers to one of its own ancestors
+	ErrDirectoryCycle = errors.New("image contains a directory cycle")
+)
+
+// ExtractOptions controls how [Extract] restores metadata. The zero value restores modification times, and, when the
+// image has Rock Ridge metadata, permissions and symbolic links.
+type ExtractOptions struct {
+	// PreserveOwnership restores the owner and group of files from Rock Ridge metadata. This usually requires elevated
+	// privileges.
+	PreserveOwnership bool
+
+	// CreateDevices creates device nodes and named pipes from Rock Ridge metadata. Creating device nodes usually
+	// requires elevated privileges. If false, these files are skipped.
+	CreateDevices bool
+}
+
+// extractedDir is a directory whose metadata is restored once all of its contents have been extracted, since adding
+// files would otherwise change its modification time, and its permissions may not allow adding files at all
+type extractedDir struct {
+	path    string
+	modTime time.Time
+	rr      *reader.RockRidge
+}
+
+type extractedSymlink struct {
+	path   string
+	target string
+	rr     *reader.RockRidge
+}
+
+type extractor struct {
+	image   *reader.Image
+	options ExtractOptions
+
+	visited  map[uint32]bool
+	dirs     []extractedDir
+	symlinks []extractedSymlink
+}
+
+// Extract recreates the directory tree of an image in dst, which is created if it doesn't exist. Existing files are
+// never overwritten: an error is returned if any file to be extracted already exists.
+//
+// Modification times are restored from directory records, or from Rock Ridge metadata where it is present. File
+// identifiers are stripped of their version numbers, and where an identifier is recorded more than once (e.g. with
+// different versions), only the first, i.e. highest, version is extracted. Associated files are not extracted.
+//
+// File identifiers that could refer to a location outside of dst, such as '..', result in [ErrUnsafePath]. Symbolic
+// links are created after all other files, so that no file is ever written through a link, and are skipped if they
+// have no recorded target. Files compressed with zisofs (see [WithZisofs]) are decompressed.
+func Extract(img io.ReaderAt, dst string, opts *ExtractOptions) error {
+	image, err := reader.Open(img)
+	if err != nil {
+		return fmt.Errorf("could not read image: %w", err)
+	}
+
+	e := &extractor{
+		image:   image,
+		visited: make(map[uint32]bool),
+	}
+
+	if opts != nil {
+		e.options = *opts
+	}
+
+	root, err := image.Root()
+	if err != nil {
+		return fmt.Errorf("could not read root directory: %w", err)
+	}
+
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return fmt.Errorf("could not create destination directory: %w", err)
+	}
+
+	if err := e.directory(root, dst); err != nil {
+		return err
+	}
+
+	for _, symlink := range e.symlinks {
+		if err := os.Symlink(symlink.target, symlink.path); err != nil {
+			return fmt.Errorf("could not create symbolic link: %w", err)
+		}
+
+		if err := e.restoreOwnership(symlink.path, symlink.rr); err != nil {
+			return err
+		}
+	}
+
+	// Restore directories deepest-first, so that restoring a directory's metadata happens after all changes to it
+	for _, dir := range slices.Backward(e.dirs) {
+		if err := e.restoreMetadata(dir.path, dir.modTime, dir.rr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *extractor) directory(dir *reader.Record, dirPath string) error {
+	location := dir.ExtentLocation.RealValue()
+	if e.visited[location] {
+		return fmt.Errorf("%w: directory at block %d", ErrDirectoryCycle, location)
+	}
+	e.visited[location] = true
+
+	records, err := e.image.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("could not read directory '%s': %w", dirPath, err)
+	}
+
+	extracted := make(map[string]bool)
+
+	for i := 0; i < len(records); i++ {
+		record := records[i]
+		if record.IsSelf() || record.IsParent() {
+			continue
+		}
+
+		// A file may be recorded in several sections, each with its own record, where all but the last have the
+		// multi-extent flag set
+		sections := []*reader.Record{record}
+		for sections[len(sections)-1].FileFlags&spec.FileFlagMultiExtent != 0 && i+1 < len(records) {
+			i++
+			sections = append(sections, records[i])
+		}
+
+		if record.FileFlags&spec.FileFlagAssociatedFile != 0 {
+			continue
+		}
+
+		rr, err := e.image.RockRidge(record)
+		if err != nil {
+			return fmt.Errorf("could not read Rock Ridge metadata: %w", err)
+		}
+
+		if rr != nil && rr.Relocated {
+			// This directory has been moved here from deeper in the hierarchy, and will be extracted in its original
+			// location through a CL entry
+			continue
+		}
+
+		name := record.Name()
+		if rr != nil && rr.Name != "" {
+			name = rr.Name
+		}
+
+		if err := checkSafeName(name); err != nil {
+			return err
+		}
+
+		if extracted[name] {
+			continue
+		}
+		extracted[name] = true
+
+		if err := e.entry(sections, rr, filepath.Join(dirPath, name)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *extractor) entry(sections []*reader.Record, rr *reader.RockRidge, entryPath string) error {
+	record := sections[0]
+
+	modTime := record.RecordingDateAndTime.Time()
+	if rr != nil && !rr.ModTime.IsZero() {
+		modTime = rr.ModTime
+	}
+
+	mode := fs.FileMode(0)
+	if rr != nil && rr.HasAttributes {
+		mode = rr.Mode
+	}
+
+	switch {
+	case rr != nil && rr.ChildLink != 0:
+		child, err := e.image.DirectoryAt(rr.ChildLink)
+		if err != nil {
+			return fmt.Errorf("could not follow relocated directory '%s': %w", entryPath, err)
+		}
+
+		return e.subdirectory(child, entryPath, modTime, rr)
+
+	case record.IsDir():
+		return e.subdirectory(record, entryPath, modTime, rr)
+
+	case rr != nil && rr.SymlinkTarget != "":
+		e.symlinks = append(e.symlinks, extractedSymlink{path: entryPath, target: rr.SymlinkTarget, rr: rr})
+		return nil
+
+	case mode&fs.ModeSymlink != 0:
+		// A link whose PX entry isn't accompanied by an SL entry has no target, so there's nothing to extract
+		return nil
+
+	case mode&(fs.ModeDevice|fs.ModeNamedPipe) != 0:
+		if !e.options.CreateDevices {
+			return nil
+		}
+
+		if err := mknod(entryPath, rr); err != nil {
+			return fmt.Errorf("could not create device '%s': %w", entryPath, err)
+		}
+
+	case mode&fs.ModeSocket != 0:
+		// Sockets only exist while something is listening on them, so there's nothing useful to extract
+		return nil
+
+	default:
+		if err := e.file(sections, rr, entryPath); err != nil {
+			return err
+		}
+	}
+
+	return e.restoreMetadata(entryPath, modTime, rr)
+}
+
+func (e *extractor) subdirectory(dir *reader.Record, dirPath string, modTime time.Time, rr *reader.RockRidge) error {
+	// Directories are created writable, and their permissions are restored after extracting their contents
+	if err := os.Mkdir(dirPath, 0o700); err != nil {
+		return fmt.Errorf("could not create directory: %w", err)
+	}
+
+	e.dirs = append(e.dirs, extractedDir{path: dirPath, modTime: modTime, rr: rr})
+
+	return e.directory(dir, dirPath)
+}
+
+func (e *extractor) file(sections []*reader.Record, rr *reader.RockRidge, filePath string) error {
+	var data []io.Reader
+	for _, section := range sections {
+		data = append(data, e.image.Open(section))
+	}
+
+	// Files compressed with zisofs are decompressed, as Linux does when reading them
+	if rr != nil && rr.Compressed {
+		if len(sections) > 1 {
+			return fmt.Errorf("compressed file '%s' is recorded in more than one section", filePath)
+		}
+
+		decompressed, err := zisofs.NewReader(e.image.Open(sections[0]))
+		if err != nil {
+			return fmt.Errorf("could not decompress file '%s': %w", filePath, err)
+		}
+
+		data = []io.Reader{decompressed}
+	}
+
+	// O_EXCL ensures that we never write to an existing file, or through a symbolic link
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+
+	if _, err := io.Copy(f, io.MultiReader(data...)); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("could not extract file '%s': %w", filePath, err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not close file '%s': %w", filePath, err)
+	}
+
+	return nil
+}
+
+func (e *extractor) restoreMetadata(entryPath string, modTime time.Time, rr *reader.RockRidge) error {
+	if err := e.restoreOwnership(entryPath, rr); err != nil {
+		return err
+	}
+
+	if rr != nil && rr.HasAttributes {
+		if err := os.Chmod(entryPath, rr.Mode&(fs.ModePerm|fs.ModeSetuid|fs.ModeSetgid|fs.ModeSticky)); err != nil {
+			return fmt.Errorf("could not restore mode of '%s': %w", entryPath, err)
+		}
+	}
+
+	accessTime := modTime
+	if rr != nil && !rr.AccessTime.IsZero() {
+		accessTime = rr.AccessTime
+	}
+
+	if err := os.Chtimes(entryPath, accessTime, modTime); err != nil {
+		return fmt.Errorf("could not restore modification time of '%s': %w", entryPath, err)
+	}
+
+	return nil
+}
+
+func (e *extractor) restoreOwnership(entryPath string, rr *reader.RockRidge) error {
+	if !e.options.PreserveOwnership || rr == nil || !rr.HasAttributes {
+		return nil
+	}
+
+	if err := os.Lchown(entryPath, int(rr.UID), int(rr.GID)); err != nil {
+		return fmt.Errorf("could not restore ownership of '%s': %w", entryPath, err)
+	}
+
+	return nil
+}
+
+// checkSafeName ensures that a name from an image refers to an entry directly inside the directory being extracted
+func checkSafeName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\\\x00") || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return fmt.Errorf("%w: '%s'", ErrUnsafePath, name)
+	}
+
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package iso9660
+
+import (
+	"errors"
+	"github.com/davejbax/go-iso9660/internal/reader"
+)
+
+func mknod(string, *reader.RockRidge) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,122 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestISOIsExtractableWithExtract(t *testing.T) {
+	sourceFS := os.DirFS("testdata/imageroot").(fs.ReadDirFS)
+	isoFilePath := filepath.Join(t.TempDir(), "output.iso")
+	assertISOWritten(t, sourceFS, isoFilePath)
+
+	isoFile, err := os.Open(isoFilePath)
+	require.NoError(t, err, "Should be able to open written ISO file")
+	defer isoFile.Close()
+
+	isoExtractionPath := filepath.Join(t.TempDir(), "extracted")
+	require.NoError(t, iso9660.Extract(isoFile, isoExtractionPath, nil), "Extract should not return an error for an image we wrote")
+
+	assertFilesystemsEqual(t, sourceFS, os.DirFS(isoExtractionPath).(fs.ReadDirFS), ".", false)
+}
+
+func TestExtract_UnsafePaths(t *testing.T) {
+	cases := map[string]struct {
+		name    string
+		patched string
+	}{
+		"parent directory":   {"XY", ".."},
+		"path separator":     {"ABCDEF", "../../"},
+		"absolute path":      {"ABCDEF", "/ETC/X"},
+		"windows separators": {"ABCDEF", "..\\..\\"},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			image, err := iso9660.NewImage(fstest.MapFS{c.name: {Data: []byte("malicious")}})
+			require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+			var buff bytes.Buffer
+			_, err = image.WriteTo(&buff)
+			require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+			data := bytes.Replace(buff.Bytes(), []byte(c.name), []byte(c.patched), 1)
+
+			parent := t.TempDir()
+			err = iso9660.Extract(bytes.NewReader(data), filepath.Join(parent, "a", "b"), nil)
+			assert.ErrorIs(t, err, iso9660.ErrUnsafePath, "Extract should refuse identifiers that could escape the destination")
+
+			entries, err := os.ReadDir(parent)
+			require.NoError(t, err, "Should be able to read parent of destination")
+			assert.Len(t, entries, 1, "Nothing should be written outside of the destination")
+		})
+	}
+}
+
+func TestExtract_DoesNotOverwrite(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{"FILE.TXT": {Data: []byte("from image")}})
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	dst := t.TempDir()
+	existing := filepath.Join(dst, "FILE.TXT")
+	require.NoError(t, os.WriteFile(existing, []byte("existing"), 0o644), "Should be able to write existing file")
+
+	err = iso9660.Extract(bytes.NewReader(buff.Bytes()), dst, nil)
+	assert.ErrorIs(t, err, fs.ErrExist, "Extract should not overwrite existing files")
+
+	data, err := os.ReadFile(existing)
+	require.NoError(t, err, "Should be able to read existing file")
+	assert.Equal(t, "existing", string(data), "Existing file should be unchanged")
+}
+
+func TestExtract_SymlinkWithoutTarget(t *testing.T) {
+	// The image uses SUSP, since it has a compressed file, but has no other Rock Ridge entries to start with
+	longName := "LINK" + strings.Repeat("X", 60) + ".TXT"
+	image, err := iso9660.NewImage(fstest.MapFS{
+		"BIG.TXT": {Data: make([]byte, 64<<10)},
+		longName:  {Data: []byte("link")},
+	}, iso9660.WithZisofs(iso9660.Zisofs{}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	data := buff.Bytes()
+
+	// Shorten the identifier to 'LINK', so that the rest of it becomes the system use field, and record a PX entry
+	// for a symbolic link there without an SL entry
+	identifier := bytes.Index(data, []byte(longName+";1"))
+	require.NotEqual(t, -1, identifier, "Image should contain the record of the file")
+	data[identifier-1] = 4
+
+	px := []byte{'P', 'X', 36, 1}
+	// The mode is S_IFLNK | 0777, followed by the link count, UID and GID
+	for _, value := range []uint32{0o120777, 1, 0, 0} {
+		px = binary.LittleEndian.AppendUint32(px, value)
+		px = binary.BigEndian.AppendUint32(px, value)
+	}
+	copy(data[identifier+5:], append(px, 'S', 'T', 4, 1))
+
+	dst := t.TempDir()
+	require.NoError(t, iso9660.Extract(bytes.NewReader(data), dst, nil), "Extract should skip symbolic links without a target")
+
+	_, err = os.Lstat(filepath.Join(dst, "LINK"))
+	assert.ErrorIs(t, err, fs.ErrNotExist, "Symbolic link without a target should not be extracted")
+
+	contents, err := os.ReadFile(filepath.Join(dst, "BIG.TXT"))
+	require.NoError(t, err, "Other files should be extracted")
+	assert.Len(t, contents, 64<<10, "Other files should be extracted in full")
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package iso9660
+
+import (
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"golang.org/x/sys/unix"
+	"io/fs"
+)
+
+func mknod(path string, rr *reader.RockRidge) error {
+	mode := uint32(rr.Mode.Perm())
+
+	switch {
+	case rr.Mode&fs.ModeNamedPipe != 0:
+		mode |= unix.S_IFIFO
+	case rr.Mode&fs.ModeCharDevice != 0:
+		mode |= unix.S_IFCHR
+	default:
+		mode |= unix.S_IFBLK
+	}
+
+	return unix.Mknod(path, mode, int(unix.Mkdev(rr.DeviceMajor, rr.DeviceMinor)))
+}
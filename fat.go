@@ -0,0 +1,89 @@
+package iso9660
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/fat"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// efiSystemPartitionLabel is the volume label of FAT images built by [NewFATImage]
+const efiSystemPartitionLabel = "EFISYS"
+
+// FATImage is a FAT12 or FAT16 filesystem image built in memory, such as an EFI system partition image containing
+// EFI/BOOT/BOOTX64.EFI. It can be added to an image as a file with [FATImage.GraftPoint], e.g. for [HybridMBR.EFIImage],
+// or appended to an image as a partition with [FATImage.AppendedPartition].
+//
+// FATImage implements [io.ReaderAt] and [io.WriterTo], so that it can also be written elsewhere.
+type FATImage struct {
+	data    []byte
+	modTime time.Time
+}
+
+var _ io.ReaderAt = &FATImage{}
+var _ io.WriterTo = &FATImage{}
+
+// NewFATImage builds a FAT filesystem containing the files in contents, in the same way that [NewImage] builds an ISO
+// 9660 image. The filesystem is only as large as it needs to be, and is FAT12 if it is small enough, as is conventional
+// for EFI system partition images.
+//
+// Files are recorded with 8.3 names, converted to upper case; names that can't be converted (e.g. because they are too
+// long) result in an error. This is sufficient for the files that UEFI firmware looks for. The volume serial number is
+// derived from the contents of the filesystem, so that building the same contents twice gives the same image.
+func NewFATImage(contents fs.FS) (*FATImage, error) {
+	data, err := fat.Build(contents, fat.Options{Label: efiSystemPartitionLabel})
+	if err != nil {
+		return nil, fmt.Errorf("could not build FAT image: %w", err)
+	}
+
+	modTime := time.Now()
+	if info, err := fs.Stat(contents, "."); err == nil {
+		modTime = info.ModTime()
+	}
+
+	return &FATImage{data: data, modTime: modTime}, nil
+}
+
+// Size returns the size of the filesystem in bytes
+func (f *FATImage) Size() int64 {
+	return int64(len(f.data))
+}
+
+func (f *FATImage) ReadAt(p []byte, off int64) (int, error) {
+	return bytes.NewReader(f.data).ReadAt(p, off)
+}
+
+func (f *FATImage) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(f.data)
+	return int64(n), err
+}
+
+// AppendedPartition returns an EFI system partition containing the filesystem, to be appended to an image with
+// [WithGPT]
+func (f *FATImage) AppendedPartition() AppendedPartition {
+	return AppendedPartition{
+		Name: "EFI system partition",
+		Type: PartitionTypeEFISystem,
+		Data: f,
+		Size: f.Size(),
+	}
+}
+
+// GraftPoint returns a graft point that adds the filesystem to an image as a file at the given path, for use with
+// [NewGraftFS]
+func (f *FATImage) GraftPoint(imagePath string) GraftPoint {
+	name := path.Base(imagePath)
+
+	source := newTreeFS(f.modTime)
+	source.root.children[name] = &treeNode{
+		info: &syntheticFileInfo{name: name, size: f.Size(), modTime: f.modTime},
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(f.data)), nil
+		},
+	}
+
+	return GraftPoint{Path: imagePath, Source: source, SourcePath: name}
+}
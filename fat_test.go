@@ -0,0 +1,81 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+func TestNewFATImage(t *testing.T) {
+	esp := fstest.MapFS{"EFI/BOOT/BOOTX64.EFI": {Data: bytes.Repeat([]byte("EFI!"), 10000)}}
+
+	fatImage, err := iso9660.NewFATImage(esp)
+	require.NoError(t, err, "NewFATImage should not return an error for valid contents")
+
+	var fatData bytes.Buffer
+	written, err := fatImage.WriteTo(&fatData)
+	require.NoError(t, err, "Should be able to write FAT image")
+	assert.Equal(t, fatImage.Size(), written, "WriteTo should write the whole FAT image")
+	assert.Equal(t, []byte{0x55, 0xAA}, fatData.Bytes()[510:512], "FAT image should start with a boot sector")
+	assert.Equal(t, "FAT12   ", string(fatData.Bytes()[54:62]), "Small FAT images should be FAT12")
+
+	again, err := iso9660.NewFATImage(esp)
+	require.NoError(t, err, "NewFATImage should not return an error for valid contents")
+	var againData bytes.Buffer
+	_, err = again.WriteTo(&againData)
+	require.NoError(t, err, "Should be able to write FAT image")
+	assert.Equal(t, fatData.Bytes(), againData.Bytes(), "FAT images of the same contents should be identical")
+
+	_, err = iso9660.NewFATImage(fstest.MapFS{"EFI/BOOT/a-long-file-name.efi": {}})
+	assert.Error(t, err, "NewFATImage should reject names that aren't valid 8.3 names")
+
+	contents, err := iso9660.NewGraftFS(
+		iso9660.ConflictPolicyError,
+		iso9660.GraftPoint{Path: ".", Source: fstest.MapFS{"README.TXT": {Data: []byte("readme")}}},
+		fatImage.GraftPoint("EFI/EFIBOOT.IMG"),
+	)
+	require.NoError(t, err, "Should be able to graft FAT image into image")
+
+	image, err := iso9660.NewImage(
+		contents,
+		iso9660.WithHybridMBR(iso9660.HybridMBR{EFIImage: "EFI/EFIBOOT.IMG"}),
+		iso9660.WithGPT(iso9660.GPT{
+			DiskGUID:           "01234567-89AB-CDEF-0123-456789ABCDEF",
+			AppendedPartitions: []iso9660.AppendedPartition{fatImage.AppendedPartition()},
+		}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for a FAT image")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for a FAT image")
+	data := buff.Bytes()
+
+	entries := data[1024:]
+	first := binary.LittleEndian.Uint64(entries[32:40])
+	last := binary.LittleEndian.Uint64(entries[40:48])
+	assert.Equal(t, fatData.Bytes(), data[first*512:first*512+uint64(fatImage.Size())], "Appended partition should contain the FAT image")
+	assert.GreaterOrEqual(t, (last-first+1)*512, uint64(fatImage.Size()), "Appended partition should cover the FAT image")
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Should be able to read image")
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root")
+	dirs, err := img.ReadDir(root)
+	require.NoError(t, err, "Should be able to read root directory")
+	require.Equal(t, "EFI", dirs[2].Name(), "Root directory should contain EFI directory")
+	records, err := img.ReadDir(dirs[2])
+	require.NoError(t, err, "Should be able to read EFI directory")
+	require.Equal(t, "EFIBOOT.IMG", records[2].Name(), "EFI directory should contain grafted FAT image")
+	grafted, err := io.ReadAll(img.Open(records[2]))
+	require.NoError(t, err, "Should be able to read grafted FAT image")
+	assert.Equal(t, fatData.Bytes(), grafted, "Grafted FAT image should be in the image as a file")
+
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image with a FAT image should not violate the spec")
+}
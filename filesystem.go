@@ -1,19 +1,185 @@
 package iso9660
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"github.com/davejbax/go-iso9660/internal/builder"
 	"github.com/davejbax/go-iso9660/internal/encode"
 	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
 	"io"
 	"io/fs"
 	"path"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func newDirectoryFromFS(filesystem fs.ReadDirFS, filesystemPath string, parent *builder.Directory, recordedAt time.Time) (*builder.Directory, error) {
+// linkedFileInfo is implemented by the [fs.FileInfo] of filesystems that know the target of hard and symbolic links,
+// such as those returned by [NewTarFS]
+type linkedFileInfo interface {
+	// linkTarget is the slash-separated path, in the same filesystem, of the file that a link refers to
+	linkTarget() string
+}
+
+// placedFileInfo is implemented by the [fs.FileInfo] of files whose data is already in the image, such as files from a
+// previous session
+type placedFileInfo interface {
+	// extentLocation is the block at which the file's data starts
+	extentLocation() uint32
+
+	// extentVolume is the sequence number of the volume, in a volume set, on which the file's data is recorded
+	extentVolume() uint16
+}
+
+// systemUseFileInfo is implemented by the [fs.FileInfo] of files whose records must have particular system use entries,
+// such as compressed files from a previous session, whose data can only be read with their ZF entries
+type systemUseFileInfo interface {
+	// recordSystemUse is the system use field of the file's record, or nil if it needs none
+	recordSystemUse() []byte
+}
+
+// treeBuilder builds a directory tree from a filesystem
+type treeBuilder struct {
+	filesystem fs.ReadDirFS
+
+	// files contains every file in the tree by its path in the filesystem, and links contains the target path of any
+	// file that is a link. These allow links to share the extent of their target once the tree has been built.
+	files map[string]*builder.File
+	links map[string]string
+
+	// volume is the sequence number of the volume, in a volume set, that the tree is being built for
+	volume uint16
+
+	// naming determines the identifiers of the directories and files in the tree, and flags determines which of them
+	// are hidden or associated files
+	naming hierarchyNaming
+	flags  fileFlags
+
+	// compressed contains the layout of every file to be compressed, by its path in the filesystem
+	compressed map[string]*zisofs.Layout
+
+	// rootSystemUse and paddingSystemUse are the system use fields of the root directory's '.' record and of records
+	// with no other system use entries, if the tree has compressed files (see [sharingProtocolSystemUse])
+	rootSystemUse    []byte
+	paddingSystemUse []byte
+}
+
+// hierarchyNaming determines how the names of files and directories in a filesystem are recorded in a directory
+// hierarchy. The primary hierarchy and the enhanced hierarchy (see [WithEnhancedVolumeDescriptor]) have different
+// rules for identifiers.
+type hierarchyNaming interface {
+	// recordedName returns the name under which a file or directory is recorded, which determines the order of its
+	// record in its directory
+	recordedName(name string, isDir bool) string
+
+	// versioned returns true if files are recorded with version numbers, in which case several files may be recorded
+	// under the same name with different versions (see [WithFileVersions])
+	versioned() bool
+
+	// identifier encodes a name returned by recordedName as a file identifier, with the given version if it's a file
+	identifier(recordedName string, isDir bool, version int) (spec.FileIdentifier, error)
+}
+
+// primaryNaming records names as d-characters, with a version number for files. Lower case letters are converted to
+// upper case. Other characters that aren't d-characters are an error, unless relaxed is true, in which case they are
+// replaced with underscores. If omitVersionOne is true, files with version 1 are recorded without a version number.
+type primaryNaming struct {
+	relaxed        bool
+	omitVersionOne bool
+}
+
+var _ hierarchyNaming = primaryNaming{}
+
+func (p primaryNaming) recordedName(name string, isDir bool) string {
+	name = strings.ToUpper(name)
+	if !p.relaxed {
+		return name
+	}
+
+	if isDir || !strings.Contains(name, ".") {
+		return relaxedDCharacters(name)
+	}
+
+	filename, extension := splitExtension(name, false)
+	return relaxedDCharacters(filename) + "." + relaxedDCharacters(extension)
+}
+
+func (p primaryNaming) versioned() bool {
+	return true
+}
+
+func (p primaryNaming) identifier(recordedName string, isDir bool, version int) (spec.FileIdentifier, error) {
+	if isDir {
+		return encode.AsDirectoryIdentifier(recordedName, encode.FileIdentifierEncodingDCharacter)
+	}
+
+	if version == 1 && p.omitVersionOne {
+		version = 0
+	}
+
+	filename, extension := splitExtension(recordedName, false)
+	return encode.AsFileIdentifier(filename, extension, version, encode.FileIdentifierEncodingDCharacter)
+}
+
+// relaxedDCharacters replaces every character of an upper case string that isn't a d-character with an underscore
+func relaxedDCharacters(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+
+		return '_'
+	}, s)
+}
+
+// splitExtension splits a name into a file name and extension at its last period. Directories have no extension.
+func splitExtension(name string, isDir bool) (string, string) {
+	index := strings.LastIndex(name, ".")
+	if isDir || index == -1 {
+		return name, ""
+	}
+
+	return name[:index], name[index+1:]
+}
+
+// newDirectoryFromFS builds a directory tree from a filesystem. It also returns every file in the tree by its path in
+// the filesystem, so that callers can find the location of particular files once the tree has been relocated. The
+// directories and files in the tree are recorded on the given volume of a volume set, except for files whose data is
+// already in the image. Files in compressed are recorded in their compressed form (see [WithZisofs]). If sharingProtocol
+// is true, the tree uses SUSP even if no files are compressed, since some files have SUSP entries of their own (see
+// [systemUseFileInfo]).
+func newDirectoryFromFS(filesystem fs.ReadDirFS, filesystemPath string, recordedAt time.Time, volume uint16, naming hierarchyNaming, flags fileFlags, compressed map[string]*zisofs.Layout, sharingProtocol bool) (*builder.Directory, map[string]*builder.File, error) {
+	t := &treeBuilder{
+		filesystem: filesystem,
+		files:      make(map[string]*builder.File),
+		links:      make(map[string]string),
+		volume:     volume,
+		naming:     naming,
+		flags:      flags,
+		compressed: compressed,
+	}
+
+	if len(compressed) > 0 || sharingProtocol {
+		var err error
+		if t.rootSystemUse, t.paddingSystemUse, err = sharingProtocolSystemUse(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	dir, err := t.directory(filesystemPath, nil, recordedAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	t.resolveLinks()
+
+	return dir, t.files, nil
+}
+
+func (t *treeBuilder) directory(filesystemPath string, parent *builder.Directory, recordedAt time.Time) (*builder.Directory, error) {
 	var identifier spec.FileIdentifier
 
 	if parent == nil {
@@ -21,22 +187,93 @@ func newDirectoryFromFS(filesystem fs.ReadDirFS, filesystemPath string, parent *
 		identifier = spec.FileIdentifierSelf
 	} else {
 		var err error
-		identifier, err = encode.AsFileIdentifier(path.Base(filesystemPath), "", 1, encode.FileIdentifierEncodingDCharacter)
+		identifier, err = t.naming.identifier(t.naming.recordedName(path.Base(filesystemPath), true), true, 0)
 		if err != nil {
 			return nil, fmt.Errorf("Directory has invalid name: %w", err)
 		}
 	}
 
 	dir := builder.NewEmptyDirectory(identifier, recordedAt, parent)
+	dir.SetVolume(t.volume)
 
-	entries, err := filesystem.ReadDir(filesystemPath)
+	if t.flags.attributes != nil {
+		info, err := fs.Stat(t.filesystem, filesystemPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not stat directory '%s': %w", filesystemPath, err)
+		}
+
+		attributes, err := t.flags.extendedAttributes(filesystemPath, info)
+		if err != nil {
+			return nil, err
+		}
+
+		if attributes != nil {
+			dir.SetExtendedAttributes(attributes)
+		}
+	}
+
+	setSystemUse := dir.SetSystemUse
+	systemUse := t.paddingSystemUse
+	if parent == nil {
+		setSystemUse, systemUse = dir.SetSelfSystemUse, t.rootSystemUse
+	}
+
+	if err := setSystemUse(systemUse); err != nil {
+		return nil, fmt.Errorf("could not record '%s': %w", filesystemPath, err)
+	}
+
+	entries, err := t.filesystem.ReadDir(filesystemPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read filesystem Directory: %w", err)
 	}
 
-	// Records in a Directory must be sorted in a particular order (ECMA-119 5th edition, §10.3)
+	// Associated files are recorded under the name of the file they are associated with
+	associated, err := t.flags.associatedNames(filesystemPath, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	// Files may be recorded under the name of another file, with a different version, if the hierarchy has versions
+	var versions map[string]FileVersion
+	if t.naming.versioned() {
+		recordedName := func(name string) string { return t.naming.recordedName(name, false) }
+		if versions, err = t.flags.fileVersions(filesystemPath, entries, recordedName); err != nil {
+			return nil, err
+		}
+	}
+
+	// fileVersion returns the name and version under which a file is recorded
+	fileVersion := func(name string) (string, int) {
+		if version, ok := versions[name]; ok {
+			return t.naming.recordedName(version.Name, false), version.Version
+		}
+
+		return t.naming.recordedName(name, false), 1
+	}
+
+	// Records in a Directory must be sorted in a particular order (ECMA-119 5th edition, §10.3), which depends on the
+	// names and versions under which entries are recorded rather than their names in the filesystem. Associated files
+	// are recorded with the version of the file they are associated with.
+	names := make(map[string]string, len(entries))
+	fileVersions := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		switch name, isAssociated := associated[entry.Name()]; {
+		case entry.IsDir():
+			names[entry.Name()] = t.naming.recordedName(entry.Name(), true)
+		case isAssociated:
+			names[entry.Name()], fileVersions[entry.Name()] = fileVersion(name)
+		default:
+			names[entry.Name()], fileVersions[entry.Name()] = fileVersion(entry.Name())
+		}
+	}
+
+	adapter := func(entry fs.DirEntry) *directoryEntryAdapter {
+		_, isAssociated := associated[entry.Name()]
+		return &directoryEntryAdapter{entry, names[entry.Name()], fileVersions[entry.Name()], isAssociated}
+	}
+
 	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
-		return spec.CompareDirectoryEntries(&directoryEntryAdapter{a}, &directoryEntryAdapter{b})
+		return spec.CompareDirectoryEntries(adapter(a), adapter(b))
 	})
 
 	for _, entry := range entries {
@@ -48,20 +285,87 @@ func newDirectoryFromFS(filesystem fs.ReadDirFS, filesystemPath string, parent *
 			return nil, fmt.Errorf("directory '%s' has invalid info: %w", entry.Name(), err)
 		}
 
-		if entry.IsDir() {
-			entryDir, err := newDirectoryFromFS(filesystem, entryPath, dir, info.ModTime())
+		if linked, ok := info.(linkedFileInfo); ok && linked.linkTarget() != "" {
+			t.links[entryPath] = linked.linkTarget()
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Symbolic links can't be represented in an image, so we follow links to files instead. Links to
+			// directories are skipped, since they could create cycles.
+			info, err = fs.Stat(t.filesystem, entryPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, fmt.Errorf("could not follow symbolic link '%s': %w", entryPath, err)
+			}
+
+			if info.IsDir() {
+				delete(t.links, entryPath)
+				continue
+			}
+		}
+
+		if info.IsDir() {
+			entryDir, err := t.directory(entryPath, dir, info.ModTime())
 			if err != nil {
 				return nil, fmt.Errorf("failed to create subdirectory '%s': %w", entryPath, err)
 			}
 
+			if t.flags.isHidden(entryPath) {
+				entryDir.SetHidden()
+			}
+
 			entryFileLike = entryDir
 		} else {
 			// TODO: handle case where file is > 4GB here
-			entryFile, err := newFile(filesystem, entryPath, info.ModTime(), uint32(info.Size()))
+			identifier, err := t.naming.identifier(names[entry.Name()], false, fileVersions[entry.Name()])
 			if err != nil {
-				return nil, fmt.Errorf("failed to create file '%s': %w", entryPath, err)
+				return nil, fmt.Errorf("could not create file identifier for '%s': %w", entryPath, err)
 			}
 
+			entryFile, err := newFile(t.filesystem, entryPath, identifier, info.ModTime(), uint32(info.Size()), t.compressed[entryPath])
+			if err != nil {
+				return nil, err
+			}
+
+			systemUse := t.paddingSystemUse
+			if recorded, ok := info.(systemUseFileInfo); ok && recorded.recordSystemUse() != nil {
+				systemUse = recorded.recordSystemUse()
+			}
+
+			if _, compressed := t.compressed[entryPath]; !compressed {
+				if err := entryFile.SetSystemUse(systemUse); err != nil {
+					return nil, fmt.Errorf("could not record '%s': %w", entryPath, err)
+				}
+			}
+
+			entryFile.SetVolume(t.volume)
+			if placed, ok := info.(placedFileInfo); ok {
+				entryFile.Place(placed.extentLocation())
+				entryFile.SetVolume(placed.extentVolume())
+			}
+
+			if t.flags.isHidden(entryPath) {
+				entryFile.SetHidden()
+			}
+
+			if _, ok := associated[entry.Name()]; ok {
+				entryFile.SetAssociated()
+			}
+
+			// Files from a previous session have no room for an extended attribute record before their data
+			if _, previous := info.(*sessionFileInfo); !previous {
+				attributes, err := t.flags.extendedAttributes(entryPath, info)
+				if err != nil {
+					return nil, err
+				}
+
+				if attributes != nil {
+					entryFile.SetExtendedAttributes(attributes)
+				}
+			}
+
+			t.files[entryPath] = entryFile
 			entryFileLike = entryFile
 		}
 
@@ -72,58 +376,112 @@ func newDirectoryFromFS(filesystem fs.ReadDirFS, filesystemPath string, parent *
 	return dir, nil
 }
 
-func newFile(filesystem fs.FS, filesystemPath string, recordedAt time.Time, size uint32) (*builder.File, error) {
-	filenameAndExtension := path.Base(filesystemPath)
-	filename := filenameAndExtension
-	extension := ""
+// resolveLinks makes links share the extent of their target, where the target is a file in the tree. Links that can't
+// be resolved (for example, because they refer to a path through another link, or only one of the link and its target
+// is compressed) keep their own copy of the data, which is read by following the link in the filesystem.
+func (t *treeBuilder) resolveLinks() {
+	for linkPath := range t.links {
+		file, ok := t.files[linkPath]
+		if !ok {
+			continue
+		}
 
-	if index := strings.LastIndex(filenameAndExtension, "."); index != -1 {
-		filename = filenameAndExtension[:index]
-		extension = filenameAndExtension[index+1:]
+		// A link's record describes its target's extent, so it must have the same system use entries, such as ZF entries
+		target := t.resolveLink(linkPath, 0)
+		if target != nil && target != file && bytes.Equal(file.PointerRecord().SystemUse, target.PointerRecord().SystemUse) {
+			file.Link(target)
+		}
 	}
+}
 
-	identifier, err := encode.AsFileIdentifier(filename, extension, 1, encode.FileIdentifierEncodingDCharacter)
-	if err != nil {
-		return nil, fmt.Errorf("could not create file identifier: %w", err)
+func (t *treeBuilder) resolveLink(filesystemPath string, depth int) *builder.File {
+	if depth > maxLinkDepth {
+		return nil
+	}
+
+	if target, ok := t.links[filesystemPath]; ok {
+		return t.resolveLink(target, depth+1)
 	}
 
-	return builder.NewFile(identifier, recordedAt, size, func() (io.Reader, error) {
+	return t.files[filesystemPath]
+}
+
+// newFile creates a file whose data is read from a filesystem. If layout is not nil, the file is compressed, and its
+// record has a ZF entry.
+func newFile(filesystem fs.FS, filesystemPath string, identifier spec.FileIdentifier, recordedAt time.Time, size uint32, layout *zisofs.Layout) (*builder.File, error) {
+	if layout != nil {
+		size = layout.Size()
+	}
+
+	file := builder.NewFile(identifier, recordedAt, size, func() (io.Reader, error) {
 		f, err := filesystem.Open(filesystemPath)
 		if err != nil {
 			return nil, fmt.Errorf("could not read input file '%s': %w", filesystemPath, err)
 		}
 
+		if layout != nil {
+			return layout.NewReader(f), nil
+		}
+
+		// Holes in files on disk needn't be read, and are skipped when writing with a SparseWriter
+		if file, ok := f.(seekableFile); ok {
+			return &sparseFile{file}, nil
+		}
+
 		return f, nil
-	}), nil
+	})
+
+	if layout != nil {
+		entry := layout.Entry()
+		systemUse, err := spec.PackSystemUse(&entry)
+		if err != nil {
+			return nil, fmt.Errorf("could not create ZF entry for '%s': %w", filesystemPath, err)
+		}
+
+		if err := file.SetSystemUse(systemUse); err != nil {
+			return nil, fmt.Errorf("could not record '%s': %w", filesystemPath, err)
+		}
+	}
+
+	return file, nil
 }
 
+// directoryEntryAdapter allows entries in a filesystem to be compared with [spec.CompareDirectoryEntries], by the name
+// under which they are recorded (see [hierarchyNaming])
 type directoryEntryAdapter struct {
 	fs.DirEntry
+
+	recordedName string
+	version      int
+	associated   bool
 }
 
 var _ spec.DirectoryEntry = &directoryEntryAdapter{}
 
 func (d directoryEntryAdapter) Name() string {
-	index := strings.LastIndex(d.DirEntry.Name(), ".")
+	index := strings.LastIndex(d.recordedName, ".")
 	if index == -1 {
-		return d.DirEntry.Name()
+		return d.recordedName
 	}
 
-	return d.DirEntry.Name()[:index]
+	return d.recordedName[:index]
 }
 
 func (d directoryEntryAdapter) Extension() string {
-	index := strings.LastIndex(d.DirEntry.Name(), ".")
+	index := strings.LastIndex(d.recordedName, ".")
 	if index == -1 {
 		return ""
 	}
 
-	return d.DirEntry.Name()[index+1:]
+	return d.recordedName[index+1:]
 }
 
 func (d directoryEntryAdapter) Version() string {
-	// We don't support file versioning, so return an arbitrary value here
-	return "0"
+	return strconv.Itoa(d.version)
+}
+
+func (d directoryEntryAdapter) IsAssociated() bool {
+	return d.associated
 }
 
 func (d directoryEntryAdapter) FileSectionIndex() int {
@@ -0,0 +1,198 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io/fs"
+	"path"
+)
+
+// ErrAssociatedFile indicates that a file can't be recorded as the associated file of another file, because one of
+// them is a directory, or the other file isn't in the same directory
+var ErrAssociatedFile = errors.New("invalid associated file")
+
+// WithHiddenFiles hides the files and directories that match any of the given patterns, in the syntax of
+// [path.Match], by setting the existence bit in their records. Each pattern is matched against both the path of a file
+// or directory in the image's contents and its name, as for [Zisofs.Exclude]. Most readers don't list hidden files,
+// but they can still be opened by name, so this suits files that only software needs to find, such as boot catalogs.
+//
+// Hidden files are hidden in the enhanced hierarchy and UDF bridge too, if the image has them.
+func WithHiddenFiles(patterns ...string) ImageOption {
+	return func(i *Image) error {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid hidden file pattern '%s': %w", pattern, err)
+			}
+		}
+
+		i.flags.hidden = append(i.flags.hidden, patterns...)
+		return nil
+	}
+}
+
+// WithAssociatedFiles records files as the associated files of other files, in the way that Apple's extensions to ISO
+// 9660 record the resource forks of Mac files. associated contains the name of the file that each associated file is
+// associated with, by the path of the associated file in the image's contents; both files must be in the same
+// directory. An associated file is recorded under the same identifier as its file, with the associated file bit set,
+// just before the record of its file.
+//
+// Readers that don't understand associated files usually skip them, as does [Extract]. Associated files aren't recorded
+// in the UDF bridge, which has no equivalent.
+func WithAssociatedFiles(associated map[string]string) ImageOption {
+	return func(i *Image) error {
+		if i.flags.associated == nil {
+			i.flags.associated = make(map[string]string, len(associated))
+		}
+
+		for filePath, name := range associated {
+			if !fs.ValidPath(filePath) || filePath == "." || !fs.ValidPath(name) || name == "." || path.Base(name) != name {
+				return fmt.Errorf("%w: '%s' cannot be associated with '%s'", ErrAssociatedFile, filePath, name)
+			}
+
+			i.flags.associated[filePath] = name
+		}
+
+		return nil
+	}
+}
+
+// fileFlags determines which files and directories are recorded with flags and attributes that the image's contents
+// don't describe
+type fileFlags struct {
+	// hidden are the patterns of files and directories to hide (see [WithHiddenFiles])
+	hidden []string
+
+	// associated contains the name of the file that each associated file is associated with, by the path of the
+	// associated file
+	associated map[string]string
+
+	// versions contains the name and version of files, by their paths (see [WithFileVersions])
+	versions map[string]FileVersion
+
+	// attributes returns the extended attributes of a file or directory (see [WithExtendedAttributes])
+	attributes func(filePath string, info fs.FileInfo) *ExtendedAttributes
+}
+
+// extendedAttributes returns the extended attribute record of a file or directory at the given path in the image's
+// contents, or nil if it has none
+func (f fileFlags) extendedAttributes(filePath string, info fs.FileInfo) (*spec.ExtendedAttributeRecord, error) {
+	if f.attributes == nil {
+		return nil, nil
+	}
+
+	attributes := f.attributes(filePath, info)
+	if attributes == nil {
+		return nil, nil
+	}
+
+	record, err := attributes.record()
+	if err != nil {
+		return nil, fmt.Errorf("could not record extended attributes of '%s': %w", filePath, err)
+	}
+
+	return record, nil
+}
+
+// isHidden returns true if a file or directory at the given path in the image's contents should be hidden
+func (f fileFlags) isHidden(filePath string) bool {
+	for _, pattern := range f.hidden {
+		if matched, _ := path.Match(pattern, filePath); matched {
+			return true
+		}
+
+		if matched, _ := path.Match(pattern, path.Base(filePath)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// associatedNames returns the name of the file that each associated file among entries, the entries of the directory
+// at the given path in the image's contents, is associated with, by the name of the associated file. Each file may
+// only have one associated file.
+func (f fileFlags) associatedNames(dirPath string, entries []fs.DirEntry) (map[string]string, error) {
+	if len(f.associated) == 0 {
+		return nil, nil
+	}
+
+	isDir := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		isDir[entry.Name()] = entry.IsDir()
+	}
+
+	names := make(map[string]string)
+	owners := make(map[string]string)
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+		name, ok := f.associated[entryPath]
+		if !ok {
+			continue
+		}
+
+		if entryIsDir, exists := isDir[name]; entry.IsDir() || !exists || entryIsDir || name == entry.Name() {
+			return nil, fmt.Errorf("%w: '%s' cannot be associated with '%s', which must be another file in the same directory", ErrAssociatedFile, entryPath, name)
+		}
+
+		if owner, ok := owners[name]; ok {
+			return nil, fmt.Errorf("%w: '%s' and '%s' are both associated with '%s'", ErrAssociatedFile, owner, entryPath, name)
+		}
+
+		names[entry.Name()] = name
+		owners[name] = entryPath
+	}
+
+	return names, nil
+}
+
+// fileVersions returns the name and version of each file among entries, the entries of the directory at the given path
+// in the image's contents, that isn't recorded under its own name with version 1, by the name of the file. No two files
+// other than associated files may be recorded under the same name with the same version, where recordedName gives the
+// name under which a file name is recorded, so that names differing only in case (for example) are the same.
+func (f fileFlags) fileVersions(dirPath string, entries []fs.DirEntry, recordedName func(name string) string) (map[string]FileVersion, error) {
+	if len(f.versions) == 0 {
+		return nil, nil
+	}
+
+	versions := make(map[string]FileVersion)
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+		version, ok := f.versions[entryPath]
+		if !ok {
+			continue
+		}
+
+		if entry.IsDir() {
+			return nil, fmt.Errorf("%w: '%s' is a directory, which has no version", ErrFileVersion, entryPath)
+		}
+
+		if version.Name == "" {
+			version.Name = entry.Name()
+		}
+
+		versions[entry.Name()] = version
+	}
+
+	recorded := make(map[FileVersion]string)
+	for _, entry := range entries {
+		entryPath := path.Join(dirPath, entry.Name())
+		if _, associated := f.associated[entryPath]; entry.IsDir() || associated {
+			continue
+		}
+
+		version, ok := versions[entry.Name()]
+		if !ok {
+			version = FileVersion{Name: entry.Name(), Version: 1}
+		}
+
+		key := FileVersion{Name: recordedName(version.Name), Version: version.Version}
+		if other, ok := recorded[key]; ok {
+			return nil, fmt.Errorf("%w: '%s' and '%s' are both recorded as version %d of '%s'", ErrFileVersion, other, entryPath, key.Version, key.Name)
+		}
+
+		recorded[key] = entryPath
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,119 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/udf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithHiddenFiles(t *testing.T) {
+	source := fstest.MapFS{
+		"BOOT/BOOT.CAT":   {Data: []byte("catalog")},
+		"BOOT/KERNEL":     {Data: []byte("kernel")},
+		"SECRET/FILE.TXT": {Data: []byte("secret")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithHiddenFiles("*.CAT", "SECRET"), iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with hidden files should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	for name, hidden := range map[string]bool{"BOOT/BOOT.CAT": true, "BOOT/KERNEL": false, "SECRET": true, "SECRET/FILE.TXT": false} {
+		record := findRecord(t, img, name)
+		require.NotNil(t, record, "'%s' should be recorded", name)
+		assert.Equal(t, hidden, record.FileFlags&spec.FileFlagHidden != 0, "'%s' should be hidden only if it matches a pattern", name)
+	}
+
+	assert.Equal(t, "catalog", readRecord(t, img, "BOOT/BOOT.CAT"), "Hidden files should be readable by name")
+
+	// The hidden directory's own '.' record shouldn't be hidden
+	records, err := img.ReadDir(findRecord(t, img, "SECRET"))
+	require.NoError(t, err, "Should be able to read hidden directory")
+	assert.Zero(t, records[0].FileFlags&spec.FileFlagHidden, "'.' record of hidden directory should not be hidden")
+
+	volume, err := udf.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "UDF structures should be readable")
+	assert.NotZero(t, findUDFEntry(t, volume, "BOOT/BOOT.CAT").Characteristics&udf.FileCharacteristicHidden, "Hidden files should be hidden with UDF")
+	assert.Zero(t, findUDFEntry(t, volume, "BOOT/KERNEL").Characteristics&udf.FileCharacteristicHidden, "Other files should not be hidden with UDF")
+}
+
+func TestWithAssociatedFiles(t *testing.T) {
+	source := fstest.MapFS{
+		"APP/PROGRAM":      {Data: []byte("data fork")},
+		"APP/PROGRAM.RSRC": {Data: []byte("resource fork")},
+		"APP/OTHER.TXT":    {Data: []byte("other")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithAssociatedFiles(map[string]string{"APP/PROGRAM.RSRC": "PROGRAM"}), iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with associated files should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	records, err := img.ReadDir(findRecord(t, img, "APP"))
+	require.NoError(t, err, "Should be able to read directory")
+	require.Len(t, records, 5, "Directory should have a record for each file")
+
+	// Records after '.' and '..' are OTHER.TXT, then the associated file, then the file it's associated with
+	associated, file := records[3], records[4]
+	assert.Equal(t, "PROGRAM", file.Name(), "File should keep its name")
+	assert.Equal(t, file.FileIdentifier, associated.FileIdentifier, "Associated file should have the identifier of its file")
+	assert.NotZero(t, associated.FileFlags&spec.FileFlagAssociatedFile, "Associated file should have the associated file bit set")
+	assert.Zero(t, file.FileFlags&spec.FileFlagAssociatedFile, "File should not have the associated file bit set")
+
+	data, err := io.ReadAll(img.Open(associated))
+	require.NoError(t, err, "Should be able to read associated file")
+	assert.Equal(t, "resource fork", string(data), "Associated file should have its own data")
+
+	// Extracting skips associated files, rather than overwriting their file with them
+	dir := t.TempDir()
+	require.NoError(t, iso9660.Extract(bytes.NewReader(buff.Bytes()), dir, nil), "Extract should not return an error")
+
+	extracted, err := os.ReadFile(filepath.Join(dir, "APP", "PROGRAM"))
+	require.NoError(t, err, "File should be extracted")
+	assert.Equal(t, "data fork", string(extracted), "Associated file should not be extracted in place of its file")
+}
+
+func TestWithAssociatedFiles_Invalid(t *testing.T) {
+	source := fstest.MapFS{
+		"A.TXT":     {Data: []byte("a")},
+		"A.RSRC":    {Data: []byte("a")},
+		"A.OTHER":   {Data: []byte("a")},
+		"DIR/B.TXT": {Data: []byte("b")},
+	}
+
+	for name, associated := range map[string]map[string]string{
+		"missing file":    {"A.RSRC": "MISSING.TXT"},
+		"directory":       {"A.RSRC": "DIR"},
+		"other directory": {"A.RSRC": "DIR/B.TXT"},
+		"itself":          {"A.RSRC": "A.RSRC"},
+		"two associated":  {"A.RSRC": "A.TXT", "A.OTHER": "A.TXT"},
+	} {
+		image, err := iso9660.NewImage(source, iso9660.WithAssociatedFiles(associated))
+		if err == nil {
+			_, err = image.WriteTo(io.Discard)
+		}
+
+		assert.ErrorIs(t, err, iso9660.ErrAssociatedFile, "Associating a file with %s should fail", name)
+	}
+}
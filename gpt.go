@@ -0,0 +1,221 @@
+package iso9660
+
+import (
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"io"
+)
+
+// Partition type GUIDs for use in [AppendedPartition]
+const (
+	PartitionTypeEFISystem = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	PartitionTypeBasicData = "EBD0A0A2-B9E5-4433-87C0-68B6B72699C7"
+)
+
+// firstISOPartitionLBA is the first sector of the partition covering the ISO 9660 filesystem, if there is one. This is
+// the start of the volume descriptor set, since the system area before it holds the GPT itself.
+const firstISOPartitionLBA = 16 * sectorsPerBlock
+
+// AppendedPartition is a partition whose contents are written after the ISO 9660 filesystem, such as an EFI system
+// partition image. This is equivalent to xorriso's -append_partition.
+type AppendedPartition struct {
+	// Name is the name of the partition in the GPT
+	Name string
+
+	// Type is the partition type GUID, e.g. [PartitionTypeEFISystem]
+	Type string
+
+	// Data is the contents of the partition, which is Size bytes long
+	Data io.ReaderAt
+	Size int64
+}
+
+// GPT describes a GUID partition table, which is written to the system area of the image along with a protective MBR,
+// and a backup copy of which is written at the end of the image. This allows UEFI firmware to boot the image from a
+// disk, such as a USB stick it has been written to.
+//
+// If used with [WithHybridMBR], the boot code from the hybrid MBR is kept, but its partition table is replaced by a
+// protective MBR partition.
+type GPT struct {
+	// DiskGUID is the GUID of the disk. If empty, a random GUID is used, along with random GUIDs for each partition.
+	// If set, partition GUIDs are derived from it, so that images are reproducible.
+	DiskGUID string
+
+	// ISOPartition adds a basic data partition covering the ISO 9660 filesystem. This is equivalent to xorriso's
+	// -isohybrid-gpt-basdat.
+	ISOPartition bool
+
+	// AppendedPartitions are written after the ISO 9660 filesystem, in order, and each given a GPT entry
+	AppendedPartitions []AppendedPartition
+
+	// AppleMap also writes an Apple partition map with the same partitions, for firmware and operating systems that
+	// look for one, such as older Macs. This is similar to xorriso's -appended_part_as_apm.
+	//
+	// The driver descriptor map that precedes an Apple partition map is written over the first 32 bytes of the MBR,
+	// so any boot code must start with at least 32 bytes that can safely be overwritten, as syslinux's isohdpfx.bin
+	// does. The primary GPT entry array is moved to follow the Apple partition map, so that both fit in the system area,
+	// which limits the GPT to six partitions.
+	AppleMap bool
+}
+
+// maxAPMPartitions is the maximum number of partitions in a GPT with an Apple partition map. The map itself and its
+// partitions each occupy a 2048-byte block after the first, and the primary GPT entry array must fit after them in the
+// system area.
+const maxAPMPartitions = (firstISOPartitionLBA-partition.EntryArraySectors)/sectorsPerBlock - 2
+
+// gptLayout is the location of the structures that a GPT adds after the ISO 9660 filesystem
+type gptLayout struct {
+	isoBlocks   uint32
+	appended    []uint32
+	backupBlock uint32
+	totalBlocks uint32
+}
+
+// WithGPT writes a GUID partition table to the image, optionally with partitions appended after the ISO 9660
+// filesystem
+func WithGPT(gpt GPT) ImageOption {
+	return func(i *Image) error {
+		if gpt.DiskGUID != "" {
+			if _, err := partition.ParseGUID(gpt.DiskGUID); err != nil {
+				return fmt.Errorf("invalid disk GUID: %w", err)
+			}
+		}
+
+		if partitions := gpt.partitions(); gpt.AppleMap && partitions > maxAPMPartitions {
+			return fmt.Errorf("GPT with an Apple partition map has %d partitions, but at most %d are supported", partitions, maxAPMPartitions)
+		}
+
+		for _, appended := range gpt.AppendedPartitions {
+			if _, err := partition.ParseGUID(appended.Type); err != nil {
+				return fmt.Errorf("invalid type for appended partition '%s': %w", appended.Name, err)
+			}
+
+			if appended.Size <= 0 || appended.Size > 0xFFFFFFFF {
+				return fmt.Errorf("appended partition '%s' has invalid size %d", appended.Name, appended.Size)
+			}
+		}
+
+		i.gpt = &gpt
+		return nil
+	}
+}
+
+// partitions returns the number of partitions in the GPT
+func (g *GPT) partitions() int {
+	if g.ISOPartition {
+		return len(g.AppendedPartitions) + 1
+	}
+
+	return len(g.AppendedPartitions)
+}
+
+// allocate allocates blocks for the appended partitions and the backup GPT, which follow the ISO 9660 filesystem.
+// block should point to the first block after the filesystem.
+func (g *GPT) allocate(block *uint32) *gptLayout {
+	layout := &gptLayout{isoBlocks: *block}
+
+	for _, appended := range g.AppendedPartitions {
+		layout.appended = append(layout.appended, builder.AllocateAndIncrementBlock(block, uint32(appended.Size)))
+	}
+
+	layout.backupBlock = builder.AllocateAndIncrementBlock(block, partition.BackupSectors*partition.SectorSize)
+	layout.totalBlocks = *block
+
+	return layout
+}
+
+// build creates the GPT, once the layout of the image is known
+func (g *GPT) build(layout *gptLayout) (*partition.GPT, error) {
+	var diskGUID partition.GUID
+	var err error
+
+	if g.DiskGUID != "" {
+		diskGUID, err = partition.ParseGUID(g.DiskGUID)
+	} else {
+		diskGUID, err = partition.NewRandomGUID()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	gpt := partition.NewGPT(diskGUID, uint64(layout.totalBlocks)*sectorsPerBlock)
+
+	addEntry := func(name string, partitionType partition.GUID, firstLBA uint64, sectors uint64) error {
+		entry := partition.GPTEntry{Type: partitionType, FirstLBA: firstLBA, LastLBA: firstLBA + sectors - 1}
+		entry.SetName(name)
+
+		if g.DiskGUID != "" {
+			entry.Unique = diskGUID
+			entry.Unique[15] ^= uint8(len(gpt.Entries) + 1)
+		} else if entry.Unique, err = partition.NewRandomGUID(); err != nil {
+			return err
+		}
+
+		gpt.Entries = append(gpt.Entries, entry)
+		return nil
+	}
+
+	if g.ISOPartition {
+		if err := addEntry("ISO9660", partition.TypeGUIDBasicData, firstISOPartitionLBA, uint64(layout.isoBlocks)*sectorsPerBlock-firstISOPartitionLBA); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, appended := range g.AppendedPartitions {
+		partitionType, err := partition.ParseGUID(appended.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		sectors := (uint64(appended.Size) + partition.SectorSize - 1) / partition.SectorSize
+		if err := addEntry(appended.Name, partitionType, uint64(layout.appended[i])*sectorsPerBlock, sectors); err != nil {
+			return nil, err
+		}
+	}
+
+	return gpt, nil
+}
+
+// buildAPM creates the Apple partition map, once the layout of the image is known. It has the same partitions as the
+// GPT.
+func (g *GPT) buildAPM(layout *gptLayout) *partition.APM {
+	apm := partition.NewAPM(layout.totalBlocks)
+
+	if g.ISOPartition {
+		apm.Add("ISO9660", partition.APMTypeData, firstISOPartitionLBA/sectorsPerBlock, layout.isoBlocks-firstISOPartitionLBA/sectorsPerBlock)
+	}
+
+	for i, appended := range g.AppendedPartitions {
+		apm.Add(appended.Name, partition.APMTypeData, layout.appended[i], uint32((appended.Size+partition.APMBlockSize-1)/partition.APMBlockSize))
+	}
+
+	return apm
+}
+
+// appendedWrites returns the writes of the appended partitions and backup GPT, which follow the ISO 9660 filesystem
+func (g *GPT) appendedWrites(layout *gptLayout, gpt *partition.GPT) ([]blockWrite, error) {
+	var writes []blockWrite
+	for i, appended := range g.AppendedPartitions {
+		writes = append(writes, blockWrite{layout.appended[i], fmt.Sprintf("appended partition '%s'", appended.Name), func(w io.Writer) (int64, error) {
+			return io.Copy(w, io.NewSectionReader(appended.Data, 0, appended.Size))
+		}, writePhaseMetadata})
+	}
+
+	backup, err := gpt.Backup()
+	if err != nil {
+		return nil, err
+	}
+
+	// The backup GPT must end in the last sector of the image, which may not be at the start of a block
+	return append(writes, blockWrite{layout.backupBlock, "backup GPT", func(w io.Writer) (int64, error) {
+		padding := int64(layout.totalBlocks-layout.backupBlock)*2048 - partition.BackupSectors*partition.SectorSize
+		if _, err := w.Write(make([]byte, padding)); err != nil {
+			return 0, fmt.Errorf("failed to write padding before backup GPT: %w", err)
+		}
+
+		written, err := backup.WriteTo(w)
+		return padding + written, err
+	}, writePhaseDescriptors}), nil
+}
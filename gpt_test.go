@@ -0,0 +1,148 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithGPT(t *testing.T) {
+	esp := bytes.Repeat([]byte("FAT!"), 3000)
+	source := fstest.MapFS{"README.TXT": {Data: []byte("readme")}}
+
+	image, err := iso9660.NewImage(
+		source,
+		iso9660.WithHybridMBR(iso9660.HybridMBR{BootCode: []byte{0xEB, 0x63}}),
+		iso9660.WithGPT(iso9660.GPT{
+			DiskGUID:     "01234567-89AB-CDEF-0123-456789ABCDEF",
+			ISOPartition: true,
+			AppendedPartitions: []iso9660.AppendedPartition{
+				{Name: "EFI", Type: iso9660.PartitionTypeEFISystem, Data: bytes.NewReader(esp), Size: int64(len(esp))},
+			},
+		}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for a valid GPT")
+
+	var buff bytes.Buffer
+	written, err := image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for a valid GPT")
+	data := buff.Bytes()
+	sectors := uint64(written / 512)
+
+	assert.Equal(t, []byte{0xEB, 0x63}, data[0:2], "Boot code from hybrid MBR should be kept")
+	assert.EqualValues(t, 0xEE, data[446+4], "MBR should have a protective partition")
+	assert.EqualValues(t, 1, binary.LittleEndian.Uint32(data[446+8:]), "Protective partition should start after the MBR")
+	assert.EqualValues(t, sectors-1, binary.LittleEndian.Uint32(data[446+12:]), "Protective partition should cover the rest of the image")
+
+	primary := data[512:1024]
+	backup := data[len(data)-512:]
+	assert.Equal(t, "EFI PART", string(primary[0:8]), "Primary GPT header should follow the MBR")
+	assert.Equal(t, "EFI PART", string(backup[0:8]), "Backup GPT header should be in the last sector")
+	assert.EqualValues(t, sectors-1, binary.LittleEndian.Uint64(primary[32:40]), "Primary header should refer to the backup header")
+
+	entries := data[1024 : 1024+2*128]
+	assert.EqualValues(t, 64, binary.LittleEndian.Uint64(entries[32:40]), "ISO partition should start at the volume descriptor set")
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Image with GPT should still be readable as ISO 9660")
+	volumeSpaceSize := uint64(img.Primary.VolumeSpaceSize.RealValue())
+	assert.EqualValues(t, volumeSpaceSize*4-1, binary.LittleEndian.Uint64(entries[40:48]), "ISO partition should end at the end of the filesystem")
+
+	espEntry := entries[128:256]
+	espStart := binary.LittleEndian.Uint64(espEntry[32:40])
+	espEnd := binary.LittleEndian.Uint64(espEntry[40:48])
+	assert.GreaterOrEqual(t, espStart, volumeSpaceSize*4, "Appended partition should not overlap the filesystem")
+	assert.EqualValues(t, (len(esp)+511)/512, espEnd-espStart+1, "Appended partition should cover its data")
+	assert.Less(t, espEnd, sectors-33, "Appended partition should not overlap the backup GPT")
+	assert.Equal(t, esp, data[espStart*512:espStart*512+uint64(len(esp))], "Appended partition data should be written at its location")
+
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image with GPT should not violate the spec")
+}
+
+func TestWithGPT_AppleMap(t *testing.T) {
+	esp := bytes.Repeat([]byte("FAT!"), 3000)
+	bootCode := append(bytes.Repeat([]byte{0x90}, 32), 0xEB, 0x63)
+
+	image, err := iso9660.NewImage(
+		fstest.MapFS{"README.TXT": {Data: []byte("readme")}},
+		iso9660.WithHybridMBR(iso9660.HybridMBR{BootCode: bootCode}),
+		iso9660.WithGPT(iso9660.GPT{
+			DiskGUID:     "01234567-89AB-CDEF-0123-456789ABCDEF",
+			ISOPartition: true,
+			AppendedPartitions: []iso9660.AppendedPartition{
+				{Name: "EFI", Type: iso9660.PartitionTypeEFISystem, Data: bytes.NewReader(esp), Size: int64(len(esp))},
+			},
+			AppleMap: true,
+		}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for a GPT with an Apple partition map")
+
+	var buff bytes.Buffer
+	written, err := image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for a GPT with an Apple partition map")
+	data := buff.Bytes()
+
+	assert.Equal(t, []byte{'E', 'R', 0x08, 0x00}, data[0:4], "Driver descriptor map should be at the start of the image, with 2048-byte blocks")
+	assert.EqualValues(t, written/2048, binary.BigEndian.Uint32(data[4:8]), "Driver descriptor map should cover the whole image")
+	assert.Equal(t, []byte{0xEB, 0x63}, data[32:34], "Boot code after the driver descriptor map should be kept")
+	assert.EqualValues(t, 0xEE, data[446+4], "MBR should have a protective partition")
+	assert.Equal(t, "EFI PART", string(data[512:520]), "Primary GPT header should follow the MBR")
+
+	// The map has entries for itself, the ISO partition, and the appended partition, in blocks 1 to 3
+	entryLBA := binary.LittleEndian.Uint64(data[512+72:])
+	assert.EqualValues(t, 16, entryLBA, "GPT entry array should follow the Apple partition map")
+	assert.EqualValues(t, 16+32, binary.LittleEndian.Uint64(data[512+40:]), "First usable LBA should follow the moved entry array")
+
+	gptEntries := data[entryLBA*512:]
+	espStart := binary.LittleEndian.Uint64(gptEntries[128+32:])
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Image with an Apple partition map should still be readable as ISO 9660")
+	volumeSpaceSize := img.Primary.VolumeSpaceSize.RealValue()
+
+	expected := []struct {
+		name, partitionType string
+		first, blocks       uint32
+	}{
+		{"Apple_partition_map", "Apple_partition_map", 1, 3},
+		{"ISO9660", "Apple_UNIX_SVR2", 16, volumeSpaceSize - 16},
+		{"EFI", "Apple_UNIX_SVR2", uint32(espStart / 4), uint32((len(esp) + 2047) / 2048)},
+	}
+
+	for i, e := range expected {
+		entry := data[(i+1)*2048 : (i+1)*2048+512]
+		assert.Equal(t, "PM", string(entry[0:2]), "Apple partition map entry %d should have the signature", i)
+		assert.EqualValues(t, 3, binary.BigEndian.Uint32(entry[4:8]), "Apple partition map entry %d should record the size of the map", i)
+		assert.Equal(t, e.name, string(bytes.TrimRight(entry[16:48], "\x00")), "Apple partition map entry %d should have its name", i)
+		assert.Equal(t, e.partitionType, string(bytes.TrimRight(entry[48:80], "\x00")), "Apple partition map entry %d should have its type", i)
+		assert.Equal(t, e.first, binary.BigEndian.Uint32(entry[8:12]), "Apple partition map entry %d should have its first block", i)
+		assert.Equal(t, e.blocks, binary.BigEndian.Uint32(entry[12:16]), "Apple partition map entry %d should have its size", i)
+	}
+
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image with an Apple partition map should not violate the spec")
+}
+
+func TestWithGPT_AppleMapTooManyPartitions(t *testing.T) {
+	appended := make([]iso9660.AppendedPartition, 6)
+	for i := range appended {
+		appended[i] = iso9660.AppendedPartition{Name: "DATA", Type: iso9660.PartitionTypeBasicData, Data: bytes.NewReader([]byte{1}), Size: 1}
+	}
+
+	_, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithGPT(iso9660.GPT{ISOPartition: true, AppendedPartitions: appended, AppleMap: true}))
+	assert.Error(t, err, "NewImage should reject more partitions than fit in the system area with an Apple partition map")
+
+	_, err = iso9660.NewImage(fstest.MapFS{}, iso9660.WithGPT(iso9660.GPT{AppendedPartitions: appended, AppleMap: true}))
+	assert.NoError(t, err, "NewImage should allow as many partitions as fit in the system area with an Apple partition map")
+}
+
+func TestWithGPT_InvalidType(t *testing.T) {
+	_, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithGPT(iso9660.GPT{
+		AppendedPartitions: []iso9660.AppendedPartition{{Name: "EFI", Type: "not a GUID", Data: bytes.NewReader([]byte{1}), Size: 1}},
+	}))
+	assert.Error(t, err, "NewImage should reject appended partitions with invalid types")
+}
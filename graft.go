@@ -0,0 +1,222 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// ConflictPolicy determines what happens when two graft points provide the same path. Directories provided by more
+// than one graft point are always merged; a conflict only occurs when at least one of the two entries is not a
+// directory.
+type ConflictPolicy int
+
+const (
+	// ConflictPolicyError causes [NewGraftFS] to return [ErrGraftConflict] when two graft points provide the same path
+	ConflictPolicyError ConflictPolicy = iota
+	// ConflictPolicyFirstWins keeps the entry from the graft point that was given first, and ignores later ones
+	ConflictPolicyFirstWins
+	// ConflictPolicyLastWins replaces existing entries with the entry from the graft point that was given last
+	ConflictPolicyLastWins
+)
+
+var (
+	// ErrGraftConflict indicates that two graft points provide the same path, and the conflict policy does not allow
+	// this to be resolved
+	ErrGraftConflict = errors.New("graft points provide conflicting entries for the same path")
+	// ErrInvalidGraftPath indicates that the path of a graft point is not a valid path in an image
+	ErrInvalidGraftPath = errors.New("invalid graft point path")
+)
+
+// GraftPoint mounts a file or directory from a source filesystem at a path inside an image, like mkisofs'
+// -graft-points option.
+type GraftPoint struct {
+	// Path is the slash-separated path at which the source is mounted in the image. Either "" or "." can be used to
+	// refer to the root of the image. Missing parent directories are created as necessary.
+	Path string
+
+	// Source is the filesystem providing the contents of the graft point
+	Source fs.FS
+
+	// SourcePath is the path within Source to mount. If empty, the root of Source is mounted.
+	SourcePath string
+}
+
+// graftFS is a read-only view over a merged tree of graft points. The tree listing is taken when the graftFS is
+// constructed, but file contents are only read from the underlying sources when files are opened.
+type graftFS struct {
+	*treeFS
+}
+
+// NewGraftFS merges several graft points into a single filesystem, which can be passed to [NewImage] to compose an
+// image from multiple sources. Graft points are applied in order, and conflicts between them are resolved according to
+// the given policy.
+//
+// The directory hierarchy of each source is read when NewGraftFS is invoked, so that conflicts are reported early;
+// file contents are read only when the image is written. Symbolic links in sources are followed, so that their targets
+// are grafted in their place; dangling links are skipped, and link cycles are reported as errors.
+func NewGraftFS(policy ConflictPolicy, points ...GraftPoint) (fs.ReadDirFS, error) {
+	g := &graftFS{treeFS: newTreeFS(time.Now())}
+
+	for _, point := range points {
+		if err := g.graft(point, policy); err != nil {
+			return nil, fmt.Errorf("failed to graft '%s' onto '%s': %w", point.SourcePath, point.Path, err)
+		}
+	}
+
+	return g, nil
+}
+
+func (g *graftFS) graft(point GraftPoint, policy ConflictPolicy) error {
+	mountPath := path.Clean("/" + point.Path)[1:]
+	if mountPath == "" {
+		mountPath = "."
+	}
+
+	if !fs.ValidPath(mountPath) {
+		return ErrInvalidGraftPath
+	}
+
+	sourcePath := point.SourcePath
+	if sourcePath == "" {
+		sourcePath = "."
+	}
+
+	return g.graftTree(point.Source, sourcePath, mountPath, policy, 0)
+}
+
+// graftTree adds the tree at sourcePath in source to the tree at mountPath. depth is the number of symbolic links to
+// directories that have been followed to reach sourcePath.
+func (g *graftFS) graftTree(source fs.FS, sourcePath string, mountPath string, policy ConflictPolicy, depth int) error {
+	return fs.WalkDir(source, sourcePath, func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not get info for '%s': %w", entryPath, err)
+		}
+
+		relativePath := strings.TrimPrefix(strings.TrimPrefix(entryPath, sourcePath), "/")
+		if sourcePath == "." {
+			relativePath = entryPath
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Symbolic links are followed when the source is walked, since their targets may be outside the graft
+			// point. Dangling links are skipped, as when building an image from any other filesystem.
+			target, err := fs.Stat(source, entryPath)
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("could not follow symbolic link '%s': %w", entryPath, err)
+			}
+
+			if target.IsDir() {
+				if depth >= maxLinkDepth {
+					return fmt.Errorf("could not follow symbolic link '%s': %w", entryPath, errTooManyLinks)
+				}
+
+				// The target is grafted in place of the link, which WalkDir would otherwise not descend into
+				return g.graftTree(source, entryPath, path.Join(mountPath, relativePath), policy, depth+1)
+			}
+
+			info = renameFileInfo(target, d.Name())
+		}
+
+		var node *treeNode
+		if d.IsDir() {
+			node = newTreeDir(info)
+		} else {
+			node = &treeNode{
+				info: info,
+				open: func() (io.ReadCloser, error) {
+					return source.Open(entryPath)
+				},
+			}
+		}
+
+		inserted, err := g.insert(path.Join(mountPath, relativePath), node, policy)
+		if err != nil {
+			return err
+		}
+
+		// If a directory lost a conflict, we don't want any of its descendants either
+		if !inserted && d.IsDir() {
+			return fs.SkipDir
+		}
+
+		return nil
+	})
+}
+
+// insert adds a node to the tree at the given path, creating parent directories as necessary. It returns false if the
+// node was discarded because of the conflict policy.
+func (g *graftFS) insert(name string, node *treeNode, policy ConflictPolicy) (bool, error) {
+	if name == "." {
+		if !node.isDir() {
+			return false, fmt.Errorf("%w: cannot replace the root directory with a file", ErrGraftConflict)
+		}
+
+		g.mergeDirInfo(g.root, node, policy)
+		return true, nil
+	}
+
+	parent := g.root
+	parts := strings.Split(name, "/")
+	for _, part := range parts[:len(parts)-1] {
+		child, ok := parent.children[part]
+		if !ok || !child.isDir() {
+			if ok {
+				// A file is in the way of a directory we need to create
+				switch policy {
+				case ConflictPolicyFirstWins:
+					return false, nil
+				case ConflictPolicyError:
+					return false, fmt.Errorf("%w: '%s' is both a file and a directory", ErrGraftConflict, part)
+				}
+			}
+
+			child = newTreeDir(&syntheticDirInfo{name: part, modTime: node.info.ModTime()})
+			parent.children[part] = child
+		}
+
+		parent = child
+	}
+
+	base := parts[len(parts)-1]
+	existing, ok := parent.children[base]
+	if !ok {
+		parent.children[base] = node
+		return true, nil
+	}
+
+	// Directories are merged rather than replaced, regardless of policy; the policy only decides which metadata to keep
+	if existing.isDir() && node.isDir() {
+		g.mergeDirInfo(existing, node, policy)
+		return true, nil
+	}
+
+	switch policy {
+	case ConflictPolicyFirstWins:
+		return false, nil
+	case ConflictPolicyLastWins:
+		parent.children[base] = node
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: '%s'", ErrGraftConflict, name)
+	}
+}
+
+// mergeDirInfo decides which metadata to keep when a directory is provided by more than one graft point. Synthetic
+// parent directories always take the metadata of a real directory.
+func (g *graftFS) mergeDirInfo(existing *treeNode, node *treeNode, policy ConflictPolicy) {
+	if _, synthetic := existing.info.(*syntheticDirInfo); synthetic || policy == ConflictPolicyLastWins {
+		existing.info = node.info
+	}
+}
@@ -0,0 +1,160 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var kernelFS = fstest.MapFS{
+	"VMLINUZ":           &fstest.MapFile{Data: []byte("kernel"), Mode: 0o644, ModTime: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)},
+	"CONFIG/KERNEL.CFG": &fstest.MapFile{Data: []byte("kernel config"), Mode: 0o644},
+}
+
+var configFS = fstest.MapFS{
+	"KERNEL.CFG": &fstest.MapFile{Data: []byte("overridden config"), Mode: 0o644},
+	"INIT.CFG":   &fstest.MapFile{Data: []byte("init config"), Mode: 0o644},
+}
+
+func TestNewGraftFS(t *testing.T) {
+	merged, err := iso9660.NewGraftFS(
+		iso9660.ConflictPolicyError,
+		iso9660.GraftPoint{Path: "BOOT", Source: kernelFS},
+		iso9660.GraftPoint{Path: "/BOOT/INITRD/INITRD.IMG", Source: fstest.MapFS{"initrd.img": {Data: []byte("initrd")}}, SourcePath: "initrd.img"},
+		iso9660.GraftPoint{Path: ".", Source: fstest.MapFS{"README.TXT": {Data: []byte("readme")}}},
+	)
+	require.NoError(t, err, "NewGraftFS should not return an error for non-conflicting graft points")
+
+	require.NoError(t, fstest.TestFS(merged,
+		"README.TXT",
+		"BOOT/VMLINUZ",
+		"BOOT/CONFIG/KERNEL.CFG",
+		"BOOT/INITRD/INITRD.IMG",
+	), "Merged filesystem should be a valid fs.FS containing all graft points")
+
+	data, err := fs.ReadFile(merged, "BOOT/INITRD/INITRD.IMG")
+	require.NoError(t, err, "Should be able to read a file grafted under a different name")
+	assert.Equal(t, []byte("initrd"), data, "File grafted under a different name should have the contents of its source")
+
+	info, err := fs.Stat(merged, "BOOT/VMLINUZ")
+	require.NoError(t, err, "Should be able to stat a grafted file")
+	assert.Equal(t, kernelFS["VMLINUZ"].ModTime, info.ModTime(), "Grafted file should keep its modification time")
+}
+
+func TestNewGraftFS_Conflicts(t *testing.T) {
+	points := []iso9660.GraftPoint{
+		{Path: "BOOT", Source: kernelFS},
+		{Path: "BOOT/CONFIG", Source: configFS},
+	}
+
+	_, err := iso9660.NewGraftFS(iso9660.ConflictPolicyError, points...)
+	assert.ErrorIs(t, err, iso9660.ErrGraftConflict, "NewGraftFS should return ErrGraftConflict when two graft points provide the same file")
+
+	cases := []struct {
+		policy   iso9660.ConflictPolicy
+		expected string
+	}{
+		{iso9660.ConflictPolicyFirstWins, "kernel config"},
+		{iso9660.ConflictPolicyLastWins, "overridden config"},
+	}
+
+	for _, c := range cases {
+		merged, err := iso9660.NewGraftFS(c.policy, points...)
+		require.NoError(t, err, "NewGraftFS should resolve conflicts when the policy allows it")
+
+		data, err := fs.ReadFile(merged, "BOOT/CONFIG/KERNEL.CFG")
+		require.NoError(t, err, "Should be able to read a conflicting file")
+		assert.Equal(t, c.expected, string(data), "Conflicting file should be resolved according to the policy")
+
+		_, err = fs.Stat(merged, "BOOT/CONFIG/INIT.CFG")
+		assert.NoError(t, err, "Directories provided by two graft points should be merged regardless of policy")
+	}
+
+	_, err = iso9660.NewGraftFS(
+		iso9660.ConflictPolicyError,
+		iso9660.GraftPoint{Path: "BOOT", Source: kernelFS, SourcePath: "VMLINUZ"},
+		iso9660.GraftPoint{Path: "BOOT", Source: kernelFS},
+	)
+	assert.ErrorIs(t, err, iso9660.ErrGraftConflict, "NewGraftFS should return ErrGraftConflict when a file and directory are grafted at the same path")
+
+	_, err = iso9660.NewGraftFS(iso9660.ConflictPolicyError, iso9660.GraftPoint{Path: ".", Source: kernelFS, SourcePath: "VMLINUZ"})
+	assert.ErrorIs(t, err, iso9660.ErrGraftConflict, "NewGraftFS should not allow replacing the root directory with a file")
+}
+
+func TestNewImage_WithGraftFS(t *testing.T) {
+	merged, err := iso9660.NewGraftFS(
+		iso9660.ConflictPolicyLastWins,
+		iso9660.GraftPoint{Path: "BOOT", Source: kernelFS},
+		iso9660.GraftPoint{Path: "BOOT/CONFIG", Source: configFS},
+	)
+	require.NoError(t, err, "NewGraftFS should not return an error for valid arguments")
+
+	image, err := iso9660.NewImage(merged)
+	require.NoError(t, err, "NewImage should accept a merged filesystem")
+
+	var buff bytes.Buffer
+	written, err := image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for a merged filesystem")
+	assert.EqualValues(t, buff.Len(), written, "WriteTo should report the number of bytes written")
+	assert.Contains(t, buff.String(), "overridden config", "Image should contain the contents of the winning graft point")
+	assert.NotContains(t, buff.String(), "kernel config", "Image should not contain the contents of the losing graft point")
+}
+
+func TestNewGraftFS_SymbolicLinks(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "real.txt"), []byte("hello-world-content"), 0o644), "Should be able to write file")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755), "Should be able to create directory")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "inner.txt"), []byte("inner"), 0o644), "Should be able to write file")
+	for link, target := range map[string]string{"link.txt": "real.txt", "dirlink": "sub", "dangling": "missing.txt"} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skipf("symbolic links are not supported: %v", err)
+		}
+	}
+
+	merged, err := iso9660.NewGraftFS(iso9660.ConflictPolicyError, iso9660.GraftPoint{Path: "D", Source: os.DirFS(dir)})
+	require.NoError(t, err, "NewGraftFS should not return an error for a source with symbolic links")
+
+	info, err := fs.Stat(merged, "D/link.txt")
+	require.NoError(t, err, "Link to a file should be grafted")
+	assert.EqualValues(t, len("hello-world-content"), info.Size(), "Link should have the size of its target")
+	assert.True(t, info.Mode().IsRegular(), "Link should be grafted as its target")
+
+	info, err = fs.Stat(merged, "D/dirlink")
+	require.NoError(t, err, "Link to a directory should be grafted")
+	assert.True(t, info.IsDir(), "Link to a directory should be grafted as its target")
+
+	_, err = fs.Stat(merged, "D/dangling")
+	assert.ErrorIs(t, err, fs.ErrNotExist, "Dangling links should not be grafted")
+
+	image, err := iso9660.NewImage(merged)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+	assert.Equal(t, "hello-world-content", readRecord(t, img, "D/LINK.TXT"), "Link should be recorded with the whole contents of its target")
+	assert.Equal(t, "inner", readRecord(t, img, "D/DIRLINK/INNER.TXT"), "Contents of a linked directory should be recorded under the link")
+	assert.Equal(t, "inner", readRecord(t, img, "D/SUB/INNER.TXT"), "Linked directory should still be recorded under its own name")
+}
+
+func TestNewGraftFS_SymbolicLinkCycle(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o755), "Should be able to create directory")
+	if err := os.Symlink("..", filepath.Join(dir, "sub", "parent")); err != nil {
+		t.Skipf("symbolic links are not supported: %v", err)
+	}
+
+	_, err := iso9660.NewGraftFS(iso9660.ConflictPolicyError, iso9660.GraftPoint{Path: "D", Source: os.DirFS(dir)})
+	assert.Error(t, err, "NewGraftFS should return an error for a source with a link cycle")
+}
@@ -0,0 +1,112 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"path"
+)
+
+// sectorsPerBlock is the number of 512-byte sectors, as used by partition tables, in a logical block of the image
+const sectorsPerBlock = 2048 / partition.SectorSize
+
+// ErrHybridFileNotFound indicates that a file referred to by a [HybridMBR] is not in the image
+var ErrHybridFileNotFound = errors.New("file for hybrid MBR not found in image")
+
+// HybridMBR describes an isohybrid-style master boot record, which is written to the start of the system area so that
+// the image can be booted from a disk (such as a USB stick it has been written to) as well as from a CD.
+//
+// The MBR contains a bootable partition covering the whole image, and optionally an EFI system partition covering an
+// EFI system partition image (a FAT filesystem) inside the image. This is the same image that an El Torito EFI boot
+// entry would refer to.
+type HybridMBR struct {
+	// BootCode is the x86 boot code run by a BIOS, such as syslinux's isohdpfx.bin. At most the first 432 bytes of
+	// the template are used; anything after that would overlap the partition table. If empty, the image will not be
+	// bootable by a BIOS, although it may still be bootable with UEFI.
+	BootCode []byte
+
+	// BootLoader is the path, in the image's source filesystem, of the boot loader that BootCode loads (e.g.
+	// isolinux.bin). Its location is recorded in the MBR in the way that isohybrid boot code expects. Optional.
+	BootLoader string
+
+	// EFIImage is the path, in the image's source filesystem, of an EFI system partition image. If set, a second
+	// partition is added for it, so that UEFI firmware can find it when booting from a disk. Optional.
+	EFIImage string
+
+	// PartitionType is the type of the partition covering the whole image. If zero, 0x17 is used, which is the type
+	// used by isohybrid.
+	PartitionType uint8
+
+	// DiskSignature is the disk signature recorded in the MBR, which some operating systems use to identify disks
+	DiskSignature uint32
+}
+
+// WithHybridMBR writes an isohybrid-style master boot record to the system area of the image
+func WithHybridMBR(mbr HybridMBR) ImageOption {
+	return func(i *Image) error {
+		if len(mbr.BootCode) > 512 {
+			return fmt.Errorf("hybrid MBR boot code is %d bytes, but must fit in a 512 byte sector", len(mbr.BootCode))
+		}
+
+		i.hybrid = &mbr
+		return nil
+	}
+}
+
+// build creates the MBR, once the files of the image have been allocated blocks. volumeSize is the size of the image
+// in blocks.
+func (h *HybridMBR) build(files map[string]*builder.File, volumeSize uint32) (*partition.MBR, error) {
+	bootCode := h.BootCode
+	if len(bootCode) > partition.BootCodeSize {
+		bootCode = bootCode[:partition.BootCodeSize]
+	}
+
+	mbr, err := partition.NewMBR(bootCode, h.DiskSignature)
+	if err != nil {
+		return nil, err
+	}
+
+	partitionType := h.PartitionType
+	if partitionType == 0 {
+		partitionType = partition.TypeISO9660
+	}
+
+	mbr.Partitions[0] = partition.NewEntry(partition.StatusBootable, partitionType, 0, volumeSize*sectorsPerBlock)
+
+	if h.BootLoader != "" {
+		bootLoader, err := findFile(files, h.BootLoader)
+		if err != nil {
+			return nil, err
+		}
+
+		mbr.BootLoaderLBA = uint64(bootLoader.DataLocation()) * sectorsPerBlock
+	}
+
+	if h.EFIImage != "" {
+		efiImage, err := findFile(files, h.EFIImage)
+		if err != nil {
+			return nil, err
+		}
+
+		size := efiImage.PointerRecord().DataLength.RealValue()
+		if size == 0 {
+			return nil, fmt.Errorf("EFI image '%s' is empty", h.EFIImage)
+		}
+
+		sectors := (size + partition.SectorSize - 1) / partition.SectorSize
+		mbr.Partitions[1] = partition.NewEntry(0, partition.TypeEFISystem, efiImage.DataLocation()*sectorsPerBlock, sectors)
+	}
+
+	return mbr, nil
+}
+
+// findFile finds a file in the tree by its path in the source filesystem. A leading slash is allowed.
+func findFile(files map[string]*builder.File, filePath string) (*builder.File, error) {
+	file, ok := files[path.Clean("/" + filePath)[1:]]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrHybridFileNotFound, filePath)
+	}
+
+	return file, nil
+}
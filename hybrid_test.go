@@ -0,0 +1,74 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithHybridMBR(t *testing.T) {
+	source := fstest.MapFS{
+		"ISOLINUX/ISOLINUX.BIN": {Data: []byte("boot loader")},
+		"EFI/EFIBOOT.IMG":       {Data: bytes.Repeat([]byte{0xEF}, 5000)},
+	}
+
+	bootCode := bytes.Repeat([]byte{0x90}, 440)
+	image, err := iso9660.NewImage(source, iso9660.WithHybridMBR(iso9660.HybridMBR{
+		BootCode:      bootCode,
+		BootLoader:    "/ISOLINUX/ISOLINUX.BIN",
+		EFIImage:      "EFI/EFIBOOT.IMG",
+		DiskSignature: 0xCAFEF00D,
+	}))
+	require.NoError(t, err, "NewImage should not return an error for a valid hybrid MBR")
+
+	var buff bytes.Buffer
+	written, err := image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for a valid hybrid MBR")
+	data := buff.Bytes()
+
+	assert.Equal(t, bootCode[:432], data[:432], "Boot code should be copied up to the boot loader location")
+	assert.Equal(t, []byte{0x55, 0xAA}, data[510:512], "MBR should end with the boot signature")
+	assert.EqualValues(t, 0xCAFEF00D, binary.LittleEndian.Uint32(data[440:444]), "Disk signature should be recorded")
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Image with hybrid MBR should still be readable as ISO 9660")
+
+	locations := make(map[string]uint32)
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root")
+	dirs, err := img.ReadDir(root)
+	require.NoError(t, err, "Should be able to read root directory")
+	for _, dir := range dirs[2:] {
+		records, err := img.ReadDir(dir)
+		require.NoError(t, err, "Should be able to read subdirectory")
+		locations[records[2].Name()] = records[2].ExtentLocation.RealValue()
+	}
+
+	assert.EqualValues(t, locations["ISOLINUX.BIN"]*4, binary.LittleEndian.Uint32(data[432:436]), "Boot loader location should be recorded in 512-byte sectors")
+
+	first := data[446:462]
+	assert.EqualValues(t, 0x80, first[0], "First partition should be bootable")
+	assert.EqualValues(t, 0x17, first[4], "First partition should have the isohybrid partition type")
+	assert.EqualValues(t, 0, binary.LittleEndian.Uint32(first[8:12]), "First partition should start at the start of the image")
+	assert.EqualValues(t, written/512, binary.LittleEndian.Uint32(first[12:16]), "First partition should cover the whole image")
+
+	second := data[462:478]
+	assert.EqualValues(t, 0xEF, second[4], "Second partition should be an EFI system partition")
+	assert.EqualValues(t, locations["EFIBOOT.IMG"]*4, binary.LittleEndian.Uint32(second[8:12]), "EFI system partition should start at the EFI image")
+	assert.EqualValues(t, 10, binary.LittleEndian.Uint32(second[12:16]), "EFI system partition should cover the EFI image")
+
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image with hybrid MBR should not violate the spec")
+}
+
+func TestWithHybridMBR_MissingFile(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithHybridMBR(iso9660.HybridMBR{EFIImage: "EFI/EFIBOOT.IMG"}))
+	require.NoError(t, err, "NewImage should not check files until the image is written")
+
+	_, err = image.WriteTo(&bytes.Buffer{})
+	assert.ErrorIs(t, err, iso9660.ErrHybridFileNotFound, "WriteTo should fail if the EFI image is not in the image")
+}
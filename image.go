@@ -1,9 +1,11 @@
 package iso9660
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/davejbax/go-iso9660/internal/builder"
 	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/udf"
 	"github.com/itchio/headway/counter"
 	"github.com/lunixbochs/struc"
 	"io"
@@ -13,22 +15,160 @@ import (
 
 type Image struct {
 	source fs.ReadDirFS
+
+	systemAreaData []byte
+	hybrid         *HybridMBR
+	gpt            *GPT
+	previous       *PreviousSession
+	enhanced       bool
+	udf            bool
+	zisofs         *Zisofs
+	implantMD5     bool
+	manifest       *Manifest
+	sortWeight     func(filePath string) int
+	alignment      *Alignment
+	padding        uint32
+	omitVersionOne bool
+	flags          fileFlags
+
+	// sessionCompressed is set once the previous session has been read if it has compressed files, whose ZF entries
+	// are carried over to the new session
+	sessionCompressed bool
 }
 
-func NewImage(contents fs.ReadDirFS) (*Image, error) {
-	return &Image{
+func NewImage(contents fs.ReadDirFS, opts ...ImageOption) (*Image, error) {
+	i := &Image{
 		source: contents,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		if err := opt(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return i, nil
 }
 
 func (i *Image) WriteTo(w io.Writer) (int64, error) {
+	source, start, err := i.sessionSource()
+	if err != nil {
+		return 0, err
+	}
+
+	if i.implantMD5 {
+		return i.writeWithImplantedMD5(w, source)
+	}
+
+	written, _, err := i.writeVolume(w, source, start, volume{setSize: 1, sequenceNumber: 1})
+	return written, err
+}
+
+// sessionSource checks that the image's options can be used together, and returns the contents of the session to
+// write, along with the block at which it starts. This is the first block of the image, unless a session is being
+// appended.
+func (i *Image) sessionSource() (fs.ReadDirFS, uint32, error) {
+	source := i.source
+
+	// start is the first block of the session that we're writing, which is 0 unless we're appending a session
+	start := uint32(0)
+
+	if i.previous != nil {
+		if i.systemAreaData != nil || i.hybrid != nil || i.gpt != nil {
+			return nil, 0, ErrSessionSystemArea
+		}
+
+		if i.udf {
+			return nil, 0, ErrUDFOptions
+		}
+
+		if i.implantMD5 {
+			return nil, 0, ErrImplantMD5Options
+		}
+
+		var err error
+		if source, start, i.sessionCompressed, err = i.previous.merge(i.source); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if i.udf && i.zisofs != nil {
+		return nil, 0, ErrZisofsOptions
+	}
+
+	return source, start, nil
+}
+
+// volume identifies a volume in a volume set. An image that isn't part of a volume set is volume 1 of 1.
+type volume struct {
+	setSize        uint16
+	sequenceNumber uint16
+}
+
+// writeVolume writes a volume containing the files in source, starting at the given block. It returns the files in the
+// volume by their path in source, so that callers can find where they were placed.
+func (i *Image) writeVolume(w io.Writer, source fs.ReadDirFS, start uint32, vol volume) (int64, map[string]*builder.File, error) {
 	// TODO: probably move this to the constructor?
-	dir, err := newDirectoryFromFS(i.source, ".", nil, time.Now())
+	const volumeIdentifier = "test"
+	recordedAt := time.Now()
+	compressed, err := i.compressFiles(source)
 	if err != nil {
-		return 0, fmt.Errorf("could not create directory: %w", err)
+		return 0, nil, err
 	}
 
-	block := uint32(18) // 18 because 16 is PVD and 17 is TVD
+	var manifest *manifestBuilder
+	if i.manifest != nil {
+		if manifest, err = i.manifest.newManifestBuilder(source); err != nil {
+			return 0, nil, err
+		}
+
+		// The manifest replaces any file of the same name, which mustn't be compressed, since the manifest isn't
+		delete(compressed, manifest.name)
+		source = manifest.filesystem(source, recordedAt)
+	}
+
+	dir, files, err := newDirectoryFromFS(source, ".", recordedAt, vol.sequenceNumber, i.primaryNaming(), i.flags, compressed, i.sessionCompressed)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	// The volume descriptor set starts at block 16, with the PVD, and is followed by the terminator
+	terminatorBlock := start + 17
+
+	var enhancedDir *builder.Directory
+	if i.enhanced {
+		if enhancedDir, err = newEnhancedDirectoryFromFS(source, recordedAt, vol.sequenceNumber, files, i.flags, compressed, i.sessionCompressed); err != nil {
+			return 0, nil, fmt.Errorf("could not create enhanced directory: %w", err)
+		}
+
+		terminatorBlock++
+	}
+
+	// A manifest whose digests are computed as files are written must be written after every other file, so it is left
+	// out of the tree's extents, and allocated separately once the tree has been relocated
+	var manifestFile *builder.File
+	if manifest != nil {
+		manifest.files = files
+		if manifest.streamed {
+			manifestFile = files[manifest.name]
+			manifestFile.Defer()
+		}
+	}
+
+	block := terminatorBlock + 1
+
+	// The UDF file set starts the UDF partition, so must come before any other data in the image, which is then in the
+	// partition too
+	var bridge *udf.Volume
+	var bridgeFiles map[*udf.Node]*builder.File
+	if i.udf {
+		if bridge, bridgeFiles, err = newUDFVolume(source, volumeIdentifier, recordedAt, files, i.flags); err != nil {
+			return 0, nil, fmt.Errorf("could not create UDF volume: %w", err)
+		}
+
+		block = udf.PartitionStart
+		bridge.Allocate(&block)
+	}
 
 	pathTable := builder.NewPathTable(dir)
 	pathTableSize := pathTable.Size()
@@ -38,17 +178,52 @@ func (i *Image) WriteTo(w io.Writer) (int64, error) {
 	pathTableLBlock := builder.AllocateAndIncrementBlock(&block, pathTableSize)
 	pathTableMBlock := builder.AllocateAndIncrementBlock(&block, pathTableSize)
 
-	// Set locations for the files and directories
-	builder.RelocateTree(dir, &block)
+	var enhancedPathTable *builder.PathTable
+	var enhancedPathTableLBlock, enhancedPathTableMBlock uint32
+	if enhancedDir != nil {
+		enhancedPathTable = builder.NewPathTable(enhancedDir)
+		enhancedPathTableLBlock = builder.AllocateAndIncrementBlock(&block, enhancedPathTable.Size())
+		enhancedPathTableMBlock = builder.AllocateAndIncrementBlock(&block, enhancedPathTable.Size())
+	}
+
+	// Set locations for the files and directories. The enhanced hierarchy's files share the extents of the primary
+	// hierarchy's files, so only its directories need locations.
+	i.relocateTree(dir, files, &block)
+	if enhancedDir != nil {
+		builder.RelocateTree(enhancedDir, &block)
+	}
+
+	if manifestFile != nil {
+		manifestFile.Relocate(builder.AllocateExtent(&block, manifestFile, i.fileAlignments(files)(manifestFile)))
+	}
+
+	// Padding comes after all of the data in the volume, but before the UDF anchor, which must be its last block
+	paddingBlock := block
+	block += i.padding
+
+	if bridge != nil {
+		setUDFLocations(bridgeFiles)
+		bridge.AllocateAnchor(&block)
+	}
+
+	volumeSpaceSize := block
+
+	// Anything after this point is outside of the ISO 9660 filesystem
+	var layout *gptLayout
+	if i.gpt != nil {
+		layout = i.gpt.allocate(&block)
+	}
 
 	pvd, err := builder.NewPrimaryVolumeDescriptor(
 		"",
-		"test",
+		volumeIdentifier,
 		"test",
 		"publisher",
 		"datapreparer",
 		"application",
-		block,
+		volumeSpaceSize,
+		vol.setSize,
+		vol.sequenceNumber,
 		pathTableSize,
 		pathTableLBlock,
 		0,
@@ -57,39 +232,113 @@ func (i *Image) WriteTo(w io.Writer) (int64, error) {
 		dir,
 	)
 	if err != nil {
-		return 0, fmt.Errorf("could not create primary volume descriptor: %w", err)
+		return 0, nil, fmt.Errorf("could not create primary volume descriptor: %w", err)
+	}
+
+	// Writers that compress the image need to know how large it is before anything is written
+	if sized, ok := w.(sizedWriter); ok {
+		if err := sized.SetSize(int64(block-start) * 2048); err != nil {
+			return 0, nil, fmt.Errorf("could not set size of image: %w", err)
+		}
+	}
+
+	if vw, ok := w.(volumeSpaceWriter); ok {
+		vw.setVolumeSpaceSize(volumeSpaceSize)
+	}
+
+	systemArea, gpt, err := i.systemArea(files, volumeSpaceSize, layout)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not create system area: %w", err)
 	}
 
-	bw := builder.NewBlockWriter(w)
+	// The writes are listed in roughly block order, but are sorted when they are written (see [writeBlocks])
+	var writes []blockWrite
+	if systemArea != nil {
+		writes = append(writes, blockWrite{0, "system area", bytes.NewReader(systemArea).WriteTo, writePhaseDescriptors})
+	}
+
+	writes = append(writes, blockWrite{start + 16, "PVD", pvd.WriteTo, writePhaseDescriptors})
 
-	if err := bw.WriteBlock(16, pvd); err != nil {
-		return bw.BytesWritten(), fmt.Errorf("failed to write PVD: %w", err)
+	if enhancedDir != nil {
+		evd := builder.NewEnhancedVolumeDescriptor(pvd, enhancedPathTable.Size(), enhancedPathTableLBlock, enhancedPathTableMBlock, enhancedDir)
+		writes = append(writes, blockWrite{start + 17, "enhanced volume descriptor", evd.WriteTo, writePhaseDescriptors})
 	}
 
-	if err := bw.WriteBlockFunc(17, func(w io.Writer) (int64, error) {
+	writes = append(writes, blockWrite{terminatorBlock, "terminator volume descriptor", func(w io.Writer) (int64, error) {
 		cw := counter.NewWriter(w)
 		if err := struc.Pack(cw, spec.TerminatorVolumeDescriptor); err != nil {
 			return cw.Count(), fmt.Errorf("could not pack structure: %w", err)
 		}
 
 		return cw.Count(), nil
-	}); err != nil {
-		return bw.BytesWritten(), fmt.Errorf("failed to write terminator volume descriptor: %w", err)
+	}, writePhaseDescriptors})
+
+	// The UDF structures are all before the ISO 9660 path tables, except for the anchor at the end of the volume
+	var bridgeExtents []udf.Extent
+	if bridge != nil {
+		if bridgeExtents, err = bridge.Extents(terminatorBlock + 1); err != nil {
+			return 0, nil, fmt.Errorf("could not create UDF structures: %w", err)
+		}
+
+		for len(bridgeExtents) > 0 && bridgeExtents[0].Location < pathTableLBlock {
+			writes = append(writes, blockWrite{bridgeExtents[0].Location, "UDF structure", bytes.NewReader(bridgeExtents[0].Data).WriteTo, writePhaseMetadata})
+			bridgeExtents = bridgeExtents[1:]
+		}
 	}
 
-	if err := bw.WriteBlock(pathTableLBlock, pathTable.LPathTable()); err != nil {
-		return bw.BytesWritten(), fmt.Errorf("failed to write L-type path table: %w", err)
+	writes = append(writes,
+		blockWrite{pathTableLBlock, "L-type path table", pathTable.LPathTable().WriteTo, writePhaseMetadata},
+		blockWrite{pathTableMBlock, "M-type path table", pathTable.MPathTable().WriteTo, writePhaseMetadata},
+	)
+
+	if enhancedDir != nil {
+		writes = append(writes,
+			blockWrite{enhancedPathTableLBlock, "enhanced L-type path table", enhancedPathTable.LPathTable().WriteTo, writePhaseMetadata},
+			blockWrite{enhancedPathTableMBlock, "enhanced M-type path table", enhancedPathTable.MPathTable().WriteTo, writePhaseMetadata},
+		)
 	}
 
-	if err := bw.WriteBlock(pathTableMBlock, pathTable.MPathTable()); err != nil {
-		return bw.BytesWritten(), fmt.Errorf("failed to write M-type path table: %w", err)
+	for entry := range dir.Extents() {
+		phase := writePhaseMetadata
+		if _, isFile := entry.(*builder.File); isFile {
+			phase = writePhaseFileData
+		}
+
+		writes = append(writes, blockWrite{entry.Location(), "entry", entry.WriteTo, phase})
 	}
 
-	for entry := range dir.Walk(false) {
-		if err := bw.WriteBlock(entry.Location(), entry); err != nil {
-			return bw.BytesWritten(), fmt.Errorf("failed to write entry: %w", err)
+	if enhancedDir != nil {
+		for entry := range enhancedDir.Extents() {
+			writes = append(writes, blockWrite{entry.Location(), "enhanced directory", entry.WriteTo, writePhaseMetadata})
 		}
 	}
 
-	return bw.BytesWritten(), nil
+	// The manifest is written once every file has been, since its digests are computed as files are written
+	if manifestFile != nil {
+		writes = append(writes, blockWrite{manifestFile.Location(), "manifest", manifestFile.WriteTo, writePhaseMetadata})
+	}
+
+	if i.padding > 0 {
+		writes = append(writes, blockWrite{paddingBlock, "padding", writeZeros(i.padding), writePhaseMetadata})
+	}
+
+	for _, extent := range bridgeExtents {
+		writes = append(writes, blockWrite{extent.Location, "UDF structure", bytes.NewReader(extent.Data).WriteTo, writePhaseMetadata})
+	}
+
+	if i.gpt != nil {
+		appended, err := i.gpt.appendedWrites(layout, gpt)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		writes = append(writes, appended...)
+	}
+
+	written, err := writeBlocks(w, start, writes)
+	if err != nil {
+		return written, nil, err
+	}
+
+	return written, files, nil
 }
@@ -38,6 +38,7 @@ func assertISOWritten(t *testing.T, contents fs.ReadDirFS, outputPath string) {
 	}
 
 	assert.Equal(t, stat.Size(), written, "Bytes written returned by WriteTo should match actual file size")
+	assert.Empty(t, iso9660.Validate(outputFile), "Written image should not violate the spec")
 }
 
 func TestISOIsExtractableWithXorriso(t *testing.T) {
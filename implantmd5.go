@@ -0,0 +1,300 @@
+package iso9660
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"hash"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+)
+
+// These follow implantisomd5 and checkisomd5 from isomd5sum, so that images can be verified by either
+const (
+	// md5ApplicationUseOffset is the offset in an image of the application use field of the PVD, at BP 884 of the
+	// descriptor in block 16 (ECMA-119 5th ed. §9.4.32). The checksum is recorded here, so it is computed as if the
+	// field were all spaces.
+	md5ApplicationUseOffset = 16*spec.LogicalSectorSize + 883
+	md5ApplicationUseSize   = 512
+
+	// md5SkipSectors is the number of sectors at the end of the volume that the checksum doesn't cover, since some
+	// drives can't read the last few sectors of a disc
+	md5SkipSectors = 15
+
+	// md5FragmentCount is the number of fragments for which partial checksums are recorded, so that checkers can stop
+	// early on corrupt media, and md5FragmentSumSize is the total length of their digits
+	md5FragmentCount   = 20
+	md5FragmentSumSize = 60
+
+	// md5ReadSize is the size of the reads with which isomd5sum checksums an image. Fragment checksums are taken at
+	// the end of the read that crosses a fragment boundary, rather than at the boundary itself.
+	md5ReadSize = 16 * spec.LogicalSectorSize
+)
+
+var (
+	// ErrImplantMD5Writer indicates that an image with an implanted MD5 checksum was written to a writer that can't go
+	// back to record the checksum once it has been computed, or, with [Image.WriteToWriterAt], that can't be read to
+	// compute it
+	ErrImplantMD5Writer = errors.New("writer cannot be used to implant an MD5 checksum")
+	// ErrImplantMD5Options indicates that an implanted MD5 checksum was requested along with options that it can't be
+	// used with
+	ErrImplantMD5Options = errors.New("an implanted MD5 checksum cannot be used when appending a session or with volume sets")
+	// ErrNoImplantedMD5 indicates that an image has no implanted MD5 checksum
+	ErrNoImplantedMD5 = errors.New("image has no implanted MD5 checksum")
+	// ErrMD5Mismatch indicates that an image doesn't match its implanted MD5 checksum
+	ErrMD5Mismatch = errors.New("image does not match its implanted MD5 checksum")
+)
+
+// WithImplantedMD5 records an MD5 checksum of the image in the application use field of its PVD, in the same way as
+// implantisomd5, so that installers that run checkisomd5 (such as those of Fedora and RHEL) can verify the media it is
+// written to. Images can also be verified with [VerifyImplantedMD5].
+//
+// The checksum is computed as the image is written, and then recorded by going back to the PVD, so the image must be
+// written with [Image.WriteTo] to an [io.WriteSeeker] or [io.WriterAt], such as a file, or with
+// [Image.WriteToWriterAt] to a writer that also implements [io.ReaderAt]. Other writers result in
+// [ErrImplantMD5Writer].
+func WithImplantedMD5() ImageOption {
+	return func(i *Image) error {
+		i.implantMD5 = true
+		return nil
+	}
+}
+
+// md5Sum computes the checksum of an image in the way that isomd5sum does, as the image is written to it. Anything
+// written after the end of the data that the checksum covers is ignored.
+type md5Sum struct {
+	hash hash.Hash
+
+	// size is the number of bytes that the checksum covers, and written is the number written so far
+	size    int64
+	written int64
+
+	// fragmentEnds are the offsets at which fragment checksums are taken, and fragmentSums are those taken so far
+	fragmentEnds []int64
+	fragmentSums []string
+}
+
+// newMD5Sum returns an md5Sum of the given number of bytes of an image
+func newMD5Sum(size int64) *md5Sum {
+	m := &md5Sum{hash: md5.New(), size: size}
+
+	fragmentSize := m.size / (md5FragmentCount + 1)
+	readSize := min(fragmentSize, md5ReadSize)
+	for fragment := int64(1); fragmentSize > 0 && fragment <= md5FragmentCount; fragment++ {
+		m.fragmentEnds = append(m.fragmentEnds, min((fragment*fragmentSize+readSize-1)/readSize*readSize, m.size))
+	}
+
+	return m
+}
+
+func (m *md5Sum) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 && m.written < m.size {
+		end := m.size
+		if len(m.fragmentSums) < len(m.fragmentEnds) {
+			end = m.fragmentEnds[len(m.fragmentSums)]
+		}
+
+		chunk := p[:min(int64(len(p)), end-m.written)]
+		p = p[len(chunk):]
+
+		// The application use field is checksummed as spaces, since that is where the checksum is recorded
+		start := max(md5ApplicationUseOffset-m.written, 0)
+		stop := min(md5ApplicationUseOffset+md5ApplicationUseSize-m.written, int64(len(chunk)))
+		if start < stop {
+			chunk = bytes.Clone(chunk)
+			copy(chunk[start:stop], bytes.Repeat([]byte{' '}, int(stop-start)))
+		}
+
+		m.hash.Write(chunk)
+		m.written += int64(len(chunk))
+
+		if m.written == end && len(m.fragmentSums) < len(m.fragmentEnds) {
+			m.fragmentSums = append(m.fragmentSums, fragmentSum(m.hash.Sum(nil)))
+		}
+	}
+
+	return n, nil
+}
+
+// fragmentSum formats a fragment checksum. isomd5sum formats each of the first few bytes of the checksum as hex, but
+// only keeps the first digit, which is the low nibble of bytes less than 16 and the high nibble of others.
+func fragmentSum(sum []byte) string {
+	var s strings.Builder
+	for _, b := range sum[:md5FragmentSumSize/md5FragmentCount] {
+		s.WriteString(strconv.FormatUint(uint64(b), 16)[:1])
+	}
+
+	return s.String()
+}
+
+// applicationUse returns the application use field recording the checksum, once the whole image has been written
+func (m *md5Sum) applicationUse() []byte {
+	field := fmt.Sprintf("ISO MD5SUM = %s;SKIPSECTORS = %d;RHLISOSTATUS=0;FRAGMENT SUMS = %s;FRAGMENT COUNT = %d;",
+		hex.EncodeToString(m.hash.Sum(nil)), md5SkipSectors, strings.Join(m.fragmentSums, ""), md5FragmentCount)
+
+	return append([]byte(field), bytes.Repeat([]byte{' '}, md5ApplicationUseSize-len(field))...)
+}
+
+// volumeSpaceWriter is implemented by writers that need to know the size of the ISO 9660 volume in an image before it
+// is written. Unlike the size given to a [sizedWriter], this doesn't include data appended after the volume, such as
+// a GPT.
+type volumeSpaceWriter interface {
+	setVolumeSpaceSize(blocks uint32)
+}
+
+// md5Writer computes an md5Sum of an image as it is written to w. Since the size of the volume is needed to know where
+// the checksum's fragments end, it is told the size by [Image.writeVolume] before anything is written.
+type md5Writer struct {
+	w   io.Writer
+	sum *md5Sum
+}
+
+var _ volumeSpaceWriter = &md5Writer{}
+
+func (m *md5Writer) setVolumeSpaceSize(blocks uint32) {
+	m.sum = newMD5Sum(max(int64(blocks)-md5SkipSectors, 0) * spec.LogicalSectorSize)
+}
+
+func (m *md5Writer) Write(p []byte) (int, error) {
+	n, err := m.w.Write(p)
+	_, _ = m.sum.Write(p[:n])
+	return n, err
+}
+
+// writeWithImplantedMD5 writes the image to w, and then records its checksum in the PVD
+func (i *Image) writeWithImplantedMD5(w io.Writer, source fs.ReadDirFS) (int64, error) {
+	var patch func(b []byte, off int64) error
+	switch w := w.(type) {
+	case io.WriteSeeker:
+		start, err := w.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, fmt.Errorf("could not find start of image: %w", err)
+		}
+
+		patch = func(b []byte, off int64) error {
+			end, err := w.Seek(0, io.SeekCurrent)
+			if err != nil {
+				return err
+			}
+
+			if _, err := w.Seek(start+off, io.SeekStart); err != nil {
+				return err
+			}
+
+			if _, err := w.Write(b); err != nil {
+				return err
+			}
+
+			_, err = w.Seek(end, io.SeekStart)
+			return err
+		}
+	case io.WriterAt:
+		patch = func(b []byte, off int64) error {
+			_, err := w.WriteAt(b, off)
+			return err
+		}
+	default:
+		return 0, ErrImplantMD5Writer
+	}
+
+	mw := &md5Writer{w: w}
+	written, _, err := i.writeVolume(mw, source, 0, volume{setSize: 1, sequenceNumber: 1})
+	if err != nil {
+		return written, err
+	}
+
+	if err := patch(mw.sum.applicationUse(), md5ApplicationUseOffset); err != nil {
+		return written, fmt.Errorf("could not record MD5 checksum: %w", err)
+	}
+
+	return written, nil
+}
+
+// implantMD5At computes the checksum of an image that has already been written to w, by reading it back, and then
+// records it in the PVD
+func implantMD5At(r io.ReaderAt, w io.WriterAt, volumeSpaceSize uint32) error {
+	sum := newMD5Sum(max(int64(volumeSpaceSize)-md5SkipSectors, 0) * spec.LogicalSectorSize)
+	if _, err := io.Copy(sum, io.NewSectionReader(r, 0, sum.size)); err != nil {
+		return fmt.Errorf("could not read image to compute MD5 checksum: %w", err)
+	}
+
+	if _, err := w.WriteAt(sum.applicationUse(), md5ApplicationUseOffset); err != nil {
+		return fmt.Errorf("could not record MD5 checksum: %w", err)
+	}
+
+	return nil
+}
+
+// VerifyImplantedMD5 checks an image against the MD5 checksum recorded by [WithImplantedMD5] or implantisomd5. It
+// returns [ErrNoImplantedMD5] if the image has no checksum, and [ErrMD5Mismatch] if it doesn't match; fragment
+// checksums are checked as the image is read, so a corrupt image can fail before it is read in full.
+func VerifyImplantedMD5(img io.ReaderAt) error {
+	pvd := make([]byte, spec.LogicalSectorSize)
+	if _, err := img.ReadAt(pvd, 16*spec.LogicalSectorSize); err != nil {
+		return fmt.Errorf("could not read PVD: %w", err)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range strings.Split(string(pvd[883:883+md5ApplicationUseSize]), ";") {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			fields[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	expected, ok := fields["ISO MD5SUM"]
+	if !ok {
+		return ErrNoImplantedMD5
+	}
+
+	skip, err := strconv.ParseUint(fields["SKIPSECTORS"], 10, 32)
+	if err != nil {
+		return fmt.Errorf("%w: invalid SKIPSECTORS", ErrNoImplantedMD5)
+	}
+
+	// The checksum covers the volume as given by the PVD, except for the skipped sectors
+	volumeSpaceSize := binary.BigEndian.Uint32(pvd[84:88])
+	sum := newMD5Sum(max(int64(volumeSpaceSize)-int64(skip), 0) * spec.LogicalSectorSize)
+
+	// Fragment checksums are only checked if the image records the same number of them as implantisomd5 does
+	var fragmentSums string
+	if fields["FRAGMENT COUNT"] == strconv.Itoa(md5FragmentCount) {
+		fragmentSums = fields["FRAGMENT SUMS"]
+	}
+
+	r := io.NewSectionReader(img, 0, sum.size)
+	buff := make([]byte, md5ReadSize)
+	for {
+		n, err := r.Read(buff)
+		_, _ = sum.Write(buff[:n])
+
+		for fragment, fragmentSum := range sum.fragmentSums {
+			if len(fragmentSums) >= (fragment+1)*len(fragmentSum) && fragmentSums[fragment*len(fragmentSum):(fragment+1)*len(fragmentSum)] != fragmentSum {
+				return fmt.Errorf("%w: fragment %d of %d differs", ErrMD5Mismatch, fragment+1, md5FragmentCount)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not read image: %w", err)
+		}
+	}
+
+	if sum.written < sum.size {
+		return fmt.Errorf("%w: image is truncated", ErrMD5Mismatch)
+	}
+
+	if actual := hex.EncodeToString(sum.hash.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("%w: checksum is %s, but %s is recorded", ErrMD5Mismatch, actual, expected)
+	}
+
+	return nil
+}
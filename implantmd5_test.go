@@ -0,0 +1,65 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithImplantedMD5(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT": {Data: []byte("verify me")},
+		"DATA.BIN":   {Data: bytes.Repeat([]byte("data"), 100000)},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithImplantedMD5())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteTo(&bytes.Buffer{})
+	assert.ErrorIs(t, err, iso9660.ErrImplantMD5Writer, "WriteTo should require a writer that can seek")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "image.iso"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	_, err = image.WriteTo(f)
+	require.NoError(t, err, "WriteTo should not return an error for a file")
+	require.NoError(t, iso9660.VerifyImplantedMD5(f), "Image should match its implanted checksum")
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err, "Should be able to read output file")
+
+	applicationUse := data[16*2048+883 : 16*2048+883+512]
+	matches := regexp.MustCompile(`^ISO MD5SUM = ([0-9a-f]{32});SKIPSECTORS = 15;RHLISOSTATUS=0;FRAGMENT SUMS = ([0-9a-f]{60});FRAGMENT COUNT = 20; +$`).FindSubmatch(applicationUse)
+	require.NotNil(t, matches, "Application use field should record the checksum in the format of implantisomd5")
+
+	// The checksum covers all but the last 15 sectors of the volume, with the application use field as spaces
+	covered := bytes.Clone(data[:(binary.LittleEndian.Uint32(data[16*2048+80:])-15)*2048])
+	copy(covered[16*2048+883:], bytes.Repeat([]byte{' '}, 512))
+	sum := md5.Sum(covered)
+	assert.Equal(t, hex.EncodeToString(sum[:]), string(matches[1]), "Checksum should be the MD5 of the image")
+
+	corrupt := bytes.Clone(data)
+	corrupt[len(covered)-1] ^= 0xFF
+	assert.ErrorIs(t, iso9660.VerifyImplantedMD5(bytes.NewReader(corrupt)), iso9660.ErrMD5Mismatch, "Corrupt image should not match its checksum")
+}
+
+func TestVerifyImplantedMD5_None(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{"A.TXT": {Data: []byte("a")}})
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	assert.ErrorIs(t, iso9660.VerifyImplantedMD5(bytes.NewReader(buff.Bytes())), iso9660.ErrNoImplantedMD5, "Image without a checksum should not be verified")
+}
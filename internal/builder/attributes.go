@@ -0,0 +1,54 @@
+package builder
+
+import (
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/itchio/headway/counter"
+	"io"
+)
+
+// ExtentSize returns the size in bytes of the extent of a file or directory, which includes its extended attribute
+// record, if it has one, as well as its data
+func ExtentSize(entry RelocatableFileSection) uint32 {
+	record := entry.PointerRecord()
+	return uint32(record.ExtendedAttributeRecordLength)*logicalBlockSize + record.DataLength.RealValue()
+}
+
+// attributeFlags returns the flags that a directory record must have for a file or directory with the given extended
+// attribute record, which may be nil
+func attributeFlags(attributes *spec.ExtendedAttributeRecord) spec.FileFlag {
+	var flags spec.FileFlag
+	if attributes == nil {
+		return flags
+	}
+
+	// The protection bit means that the owner and group are given, and that not everyone may read and execute the file
+	if attributes.Permissions&^spec.PermissionsReserved != 0 {
+		flags |= spec.FileFlagProtection
+	}
+
+	if attributes.RecordFormat != spec.RecordFormatNone {
+		flags |= spec.FileFlagRecord
+	}
+
+	return flags
+}
+
+// writeExtendedAttributes writes an extended attribute record, if it isn't nil, padded to a whole number of blocks so
+// that the data of its file or directory follows it
+func writeExtendedAttributes(w io.Writer, attributes *spec.ExtendedAttributeRecord) (int64, error) {
+	if attributes == nil {
+		return 0, nil
+	}
+
+	cw := counter.NewWriter(w)
+	if _, err := attributes.WriteTo(cw); err != nil {
+		return cw.Count(), err
+	}
+
+	if _, err := cw.Write(make([]byte, int64(attributes.Blocks())*logicalBlockSize-cw.Count())); err != nil {
+		return cw.Count(), fmt.Errorf("failed to pad extended attribute record: %w", err)
+	}
+
+	return cw.Count(), nil
+}
@@ -1,10 +1,13 @@
 package builder
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"github.com/itchio/headway/counter"
 	"io"
+	"slices"
+	"sync"
 )
 
 // Logical sector size is set pretty much unanimously to 2048.
@@ -25,7 +28,14 @@ type BlockWriter struct {
 var errNonSequentialBlockWrite = errors.New("cannot write blocks in non-sequential order or rewrite existing blocks")
 
 func NewBlockWriter(wrapped io.Writer) *BlockWriter {
-	return &BlockWriter{wrapped: counter.NewWriter(wrapped)}
+	return NewBlockWriterAt(wrapped, 0)
+}
+
+// NewBlockWriterAt creates a BlockWriter whose output starts at the given block rather than at block 0, such as a new
+// session of a multi-session image. Block numbers passed to the writer are still absolute, so blocks before base can't
+// be written.
+func NewBlockWriterAt(wrapped io.Writer, base uint32) *BlockWriter {
+	return &BlockWriter{wrapped: counter.NewWriter(wrapped), currentBlock: base}
 }
 
 func (w *BlockWriter) WriteBlockFunc(number uint32, writeTo func(io.Writer) (int64, error)) error {
@@ -69,3 +79,98 @@ func (w *BlockWriter) WriteBlock(number uint32, contents io.WriterTo) error {
 func (w *BlockWriter) BytesWritten() int64 {
 	return w.wrapped.Count()
 }
+
+var errBlockBeforeBase = errors.New("cannot write blocks before the base block")
+
+// ConcurrentBlockWriter writes blocks at their offsets in an [io.WriterAt], such as an [*os.File], rather than in
+// order. Blocks can be written in any order, rewritten, and written by several goroutines at once, as long as
+// concurrent writes don't overlap.
+type ConcurrentBlockWriter struct {
+	wrapped io.WriterAt
+	base    uint32
+
+	// written contains the ranges of blocks that have been written, so that the gaps between them can be filled
+	mu      sync.Mutex
+	written []blockRange
+}
+
+// blockRange is a range of blocks, from start up to but not including end
+type blockRange struct {
+	start uint32
+	end   uint32
+}
+
+// NewConcurrentBlockWriter creates a ConcurrentBlockWriter whose output starts at the given block, like
+// [NewBlockWriterAt]
+func NewConcurrentBlockWriter(wrapped io.WriterAt, base uint32) *ConcurrentBlockWriter {
+	return &ConcurrentBlockWriter{wrapped: wrapped, base: base}
+}
+
+func (w *ConcurrentBlockWriter) WriteBlockFunc(number uint32, writeTo func(io.Writer) (int64, error)) error {
+	if number < w.base {
+		return errBlockBeforeBase
+	}
+
+	offset := int64(number-w.base) * logicalBlockSize
+	contentsSize, err := writeTo(io.NewOffsetWriter(w.wrapped, offset))
+	if err != nil {
+		return fmt.Errorf("failed to write contents to block: %w", err)
+	}
+
+	contentsBlocks := (contentsSize + logicalBlockSize - 1) / logicalBlockSize
+
+	if contentsBlocks*logicalBlockSize > contentsSize {
+		padding := make([]byte, contentsBlocks*logicalBlockSize-contentsSize)
+		if _, err := w.wrapped.WriteAt(padding, offset+contentsSize); err != nil {
+			return fmt.Errorf("failed to write padding after contents: %w", err)
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.written = append(w.written, blockRange{start: number, end: number + uint32(contentsBlocks)})
+
+	return nil
+}
+
+func (w *ConcurrentBlockWriter) WriteBlock(number uint32, contents io.WriterTo) error {
+	return w.WriteBlockFunc(number, contents.WriteTo)
+}
+
+// FillUnwritten writes zeros to every block between the base and the last block written that hasn't been written, so
+// that the output is the same as that of a [BlockWriter] even if the destination didn't contain zeros
+func (w *ConcurrentBlockWriter) FillUnwritten() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slices.SortFunc(w.written, func(a, b blockRange) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	zeroBlock := make([]byte, logicalBlockSize)
+	next := w.base
+	for _, r := range w.written {
+		for ; next < r.start; next++ {
+			if _, err := w.wrapped.WriteAt(zeroBlock, int64(next-w.base)*logicalBlockSize); err != nil {
+				return fmt.Errorf("failed to write padding between blocks: %w", err)
+			}
+		}
+
+		next = max(next, r.end)
+	}
+
+	return nil
+}
+
+// BytesWritten returns the size of the output so far, up to the end of the last block written
+func (w *ConcurrentBlockWriter) BytesWritten() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	end := w.base
+	for _, r := range w.written {
+		end = max(end, r.end)
+	}
+
+	return int64(end-w.base) * logicalBlockSize
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/davejbax/go-iso9660/internal/builder"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"sync"
 	"testing"
 )
 
@@ -41,3 +42,58 @@ func TestBlockWriter_WriteBlock(t *testing.T) {
 	assert.Error(t, bw.WriteBlock(0x18, testBlock16), "WriteBlock should not allow rewriting a written block when given more than one block of data to write")
 	assert.Error(t, bw.WriteBlock(0x16, testBlock16), "WriteBlock should not allow writing prior blocks")
 }
+
+func TestNewBlockWriterAt(t *testing.T) {
+	var buff bytes.Buffer
+
+	bw := builder.NewBlockWriterAt(&buff, 100)
+	assert.Error(t, bw.WriteBlock(99, bytes.NewBufferString("test")), "WriteBlock should not allow writing blocks before the base")
+
+	require.NoError(t, bw.WriteBlock(102, bytes.NewBufferString("test")), "WriteBlock should not return an error for valid input")
+	assert.Equal(t, 3*2048, buff.Len(), "WriteBlock should only pad from the base block")
+	assert.Equal(t, []byte("test"), buff.Bytes()[2*2048:2*2048+4], "WriteBlock should write block relative to the base")
+}
+
+// memoryWriterAt is an [io.WriterAt] that grows as needed, which initially contains garbage rather than zeros
+type memoryWriterAt struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *memoryWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for int64(len(m.data)) < off+int64(len(p)) {
+		m.data = append(m.data, 0xFF)
+	}
+
+	return copy(m.data[off:], p), nil
+}
+
+func TestConcurrentBlockWriter(t *testing.T) {
+	var out memoryWriterAt
+	bw := builder.NewConcurrentBlockWriter(&out, 100)
+
+	assert.Error(t, bw.WriteBlock(99, bytes.NewBufferString("test")), "WriteBlock should not allow writing blocks before the base")
+
+	var wg sync.WaitGroup
+	for _, block := range []uint32{105, 103, 101} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, bw.WriteBlock(block, bytes.NewBufferString("test")), "WriteBlock should allow writing blocks out of order")
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, bw.WriteBlock(103, bytes.NewBuffer(make([]byte, 2048+1))), "WriteBlock should allow rewriting blocks")
+	assert.EqualValues(t, 6*2048, bw.BytesWritten(), "BytesWritten should be the end of the last block relative to the base")
+	assert.Equal(t, append([]byte("test"), make([]byte, 2044)...), out.data[5*2048:], "WriteBlock should write block relative to the base and pad it")
+	assert.Equal(t, bytes.Repeat([]byte{0xFF}, 2048), out.data[:2048], "Unwritten blocks should not be written")
+
+	require.NoError(t, bw.FillUnwritten(), "FillUnwritten should not return an error")
+	assert.Equal(t, make([]byte, 2048), out.data[:2048], "FillUnwritten should write zeros to unwritten blocks")
+	assert.Equal(t, make([]byte, 2048), out.data[2*2048:3*2048], "FillUnwritten should write zeros to unwritten blocks")
+	assert.Equal(t, append([]byte("test"), make([]byte, 2044)...), out.data[2048:2*2048], "FillUnwritten should not overwrite written blocks")
+}
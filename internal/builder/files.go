@@ -25,6 +25,7 @@ type RelocatableFileSection interface {
 
 	recordLength() uint8
 	children() []RelocatableFileSection
+	ownsExtent() bool
 }
 
 type Directory struct {
@@ -32,6 +33,13 @@ type Directory struct {
 	record         *spec.DirectoryRecord
 	parent         *Directory
 	realDataLength uint32
+
+	// selfSystemUse is the system use field of the directory's '.' record, and selfLength is the length of the record
+	selfSystemUse []byte
+	selfLength    uint8
+
+	// attributes is the extended attribute record at the start of the directory's extent, if it has one
+	attributes *spec.ExtendedAttributeRecord
 }
 
 var _ RelocatableFileSection = &Directory{}
@@ -50,8 +58,7 @@ func NewEmptyDirectory(identifier spec.FileIdentifier, recordedAt time.Time, par
 		FileUnitSize:      0,
 		InterleaveGapSize: 0,
 
-		// We aren't supporting multiple volumes currently
-		// TODO[multivolume]
+		// Directories are on the first volume of a volume set unless moved with SetVolume
 		VolumeSequenceNumber: encode.AsUInt16BothByte(1),
 
 		LengthOfFileIdentifier: uint8(len(identifier)),
@@ -59,8 +66,9 @@ func NewEmptyDirectory(identifier spec.FileIdentifier, recordedAt time.Time, par
 	}
 
 	d := &Directory{
-		record: pointerRecord,
-		parent: parent,
+		record:     pointerRecord,
+		parent:     parent,
+		selfLength: spec.DirectoryRecordLength(len(spec.FileIdentifierSelf)),
 
 		// Every Directory always contains a . (self) and .. (parent) pointerRecord
 		// Hence, the Directory payload starts off being that long, assuming there are no entries.
@@ -80,9 +88,11 @@ func (d *Directory) PointerRecord() spec.DirectoryRecord {
 
 func (d *Directory) SelfRecord() spec.DirectoryRecord {
 	selfRecord := *d.record
+	selfRecord.FileFlags &^= spec.FileFlagHidden
 	selfRecord.LengthOfFileIdentifier = uint8(len(spec.FileIdentifierSelf))
 	selfRecord.FileIdentifier = spec.FileIdentifierSelf
-	selfRecord.Length = spec.DirectoryRecordLength(len(spec.FileIdentifierSelf))
+	selfRecord.Length = d.selfLength
+	selfRecord.SystemUse = d.selfSystemUse
 
 	return selfRecord
 
@@ -102,13 +112,69 @@ func (d *Directory) ParentRecord() spec.DirectoryRecord {
 		parentRecord = d.parent.PointerRecord()
 	}
 
+	parentRecord.FileFlags &^= spec.FileFlagHidden
 	parentRecord.LengthOfFileIdentifier = uint8(len(spec.FileIdentifierParent))
 	parentRecord.FileIdentifier = spec.FileIdentifierParent
 	parentRecord.Length = spec.DirectoryRecordLength(len(spec.FileIdentifierParent))
+	parentRecord.SystemUse = nil
 
 	return parentRecord
 }
 
+// SetVolume sets the sequence number of the volume, in a volume set, on which the directory is recorded
+func (d *Directory) SetVolume(sequenceNumber uint16) {
+	d.record.VolumeSequenceNumber = encode.AsUInt16BothByte(sequenceNumber)
+}
+
+// SetHidden sets the existence bit in the directory's record in its parent, so that readers don't show the directory
+// unless asked to. The directory's '.' and '..' records aren't hidden.
+func (d *Directory) SetHidden() {
+	d.record.FileFlags |= spec.FileFlagHidden
+}
+
+// SetExtendedAttributes records an extended attribute record at the start of the directory's extent, before its
+// records
+func (d *Directory) SetExtendedAttributes(attributes *spec.ExtendedAttributeRecord) {
+	d.attributes = attributes
+	d.record.ExtendedAttributeRecordLength = attributes.Blocks()
+	d.record.FileFlags |= attributeFlags(attributes)
+}
+
+// SetSystemUse sets the system use field of the directory's record in its parent. Since this changes the length of
+// the record, it must be set before the directory is added to its parent. It returns an error if the record would be
+// too long.
+func (d *Directory) SetSystemUse(systemUse []byte) error {
+	length, err := spec.DirectoryRecordLengthWithSystemUse(len(d.record.FileIdentifier), len(systemUse))
+	if err != nil {
+		return err
+	}
+
+	d.record.SystemUse = systemUse
+	d.record.Length = length
+	return nil
+}
+
+// SetSelfSystemUse sets the system use field of the directory's '.' record. SUSP requires the SP entry, which indicates
+// that a volume uses SUSP, to be recorded here in the root directory. It returns an error if the record would be too
+// long.
+func (d *Directory) SetSelfSystemUse(systemUse []byte) error {
+	length, err := spec.DirectoryRecordLengthWithSystemUse(len(spec.FileIdentifierSelf), len(systemUse))
+	if err != nil {
+		return err
+	}
+
+	d.selfSystemUse = systemUse
+	d.selfLength = length
+
+	// The '.' record comes first, so every record after it may move
+	d.setRealDataLength(uint32(d.selfLength) + uint32(d.ParentRecord().Length))
+	for _, entry := range d.entries {
+		d.setRealDataLength(spec.DirectoryRecordOffset(d.realDataLength, entry.recordLength()) + uint32(entry.recordLength()))
+	}
+
+	return nil
+}
+
 func (d *Directory) Location() uint32 {
 	return d.PointerRecord().ExtentLocation.RealValue()
 }
@@ -124,10 +190,14 @@ func (d *Directory) Relocate(newLocation uint32) {
 // before invoking Add.
 func (d *Directory) Add(f RelocatableFileSection) {
 	d.entries = append(d.entries, f)
-	
+	d.setRealDataLength(spec.DirectoryRecordOffset(d.realDataLength, f.recordLength()) + uint32(f.recordLength()))
+}
+
+func (d *Directory) setRealDataLength(realDataLength uint32) {
+	d.realDataLength = realDataLength
+
 	// Round the DataLength to the nearest block. For some reason, ISO readers expect this.
 	// I guess it sorta makes sense, since it'll be stored across a full extent of blocks.
-	d.realDataLength += uint32(f.recordLength())
 	d.record.DataLength = encode.AsUInt32BothByte((d.realDataLength + logicalBlockSize - 1) / logicalBlockSize * logicalBlockSize)
 }
 
@@ -157,6 +227,19 @@ func (d *Directory) Walk(depthFirst bool) iter.Seq[RelocatableFileSection] {
 	}
 }
 
+// Extents returns all descendants that own an extent, including the directory itself, in the same order as Walk(false).
+// These are the entries that need to be allocated blocks and written to an image; entries that share the extent of
+// another entry (see [File.Link]) are omitted.
+func (d *Directory) Extents() iter.Seq[RelocatableFileSection] {
+	return func(yield func(RelocatableFileSection) bool) {
+		for entry := range d.Walk(false) {
+			if entry.ownsExtent() && !yield(entry) {
+				break
+			}
+		}
+	}
+}
+
 func (d *Directory) Entries() []spec.FileSection {
 	entries := make([]spec.FileSection, len(d.entries))
 
@@ -168,8 +251,14 @@ func (d *Directory) Entries() []spec.FileSection {
 }
 
 func (d *Directory) WriteTo(w io.Writer) (int64, error) {
+	written, err := writeExtendedAttributes(w, d.attributes)
+	if err != nil {
+		return written, err
+	}
+
 	dw := &spec.DirectoryWriter{Directory: d}
-	return dw.WriteTo(w)
+	n, err := dw.WriteTo(w)
+	return written + n, err
 }
 
 func (d *Directory) children() []RelocatableFileSection {
@@ -177,7 +266,11 @@ func (d *Directory) children() []RelocatableFileSection {
 }
 
 func (d *Directory) recordLength() uint8 {
-	return spec.DirectoryRecordLength(len(d.PointerRecord().FileIdentifier))
+	return d.record.Length
+}
+
+func (d *Directory) ownsExtent() bool {
+	return true
 }
 
 type File struct {
@@ -188,6 +281,25 @@ type File struct {
 
 	dataSize uint32
 	data     func() (io.Reader, error)
+
+	// target is the file whose extent this file shares, if this file is a link
+	target *File
+
+	// placed is true if the file's data is already on the medium, so its location is fixed
+	placed bool
+
+	// deferred is true if the file's extent is allocated separately from the rest of the tree
+	deferred bool
+
+	// volume is the sequence number of the volume, in a volume set, on which the file's data is recorded
+	volume uint16
+
+	// systemUse is the system use field of the file's record, and length is the length of the record
+	systemUse []byte
+	length    uint8
+
+	// attributes is the extended attribute record at the start of the file's extent, if it has one
+	attributes *spec.ExtendedAttributeRecord
 }
 
 func NewFile(identifier spec.FileIdentifier, recordedAt time.Time, dataSize uint32, data func() (io.Reader, error)) *File {
@@ -198,35 +310,124 @@ func NewFile(identifier spec.FileIdentifier, recordedAt time.Time, dataSize uint
 		flags:      0,
 		dataSize:   dataSize,
 		data:       data,
+		volume:     1,
+		length:     spec.DirectoryRecordLength(len(identifier)),
 	}
 }
 
+// Link makes a file share the extent of another file, in the same way as a hard link on other filesystems. A linked file
+// has no data of its own: it takes its location and data length from target, and is omitted from
+// [Directory.Extents].
+func (f *File) Link(target *File) {
+	for target.target != nil {
+		target = target.target
+	}
+
+	f.target = target
+}
+
+// Place fixes the location of a file whose data is already on the medium, such as a file from a previous session of a
+// multi-session image. A placed file keeps the given location, and is omitted from [Directory.Extents] since its data
+// doesn't need to be written.
+func (f *File) Place(location uint32) {
+	f.location = location
+	f.placed = true
+}
+
+// Defer leaves a file's extent to be allocated separately from the rest of the tree, e.g. because its data depends on
+// the data of other files, and so must be written after them. A deferred file is omitted from [Directory.Extents], and
+// its location should be set with [File.Relocate] once the tree has been relocated (see [AllocateExtent]).
+func (f *File) Defer() {
+	f.deferred = true
+}
+
+// SetVolume sets the sequence number of the volume, in a volume set, on which the file's data is recorded. Files are on
+// the first volume unless this is used. Links are always on the same volume as their target.
+func (f *File) SetVolume(sequenceNumber uint16) {
+	f.volume = sequenceNumber
+}
+
+// SetHidden sets the existence bit in the file's record, so that readers don't show the file unless asked to
+func (f *File) SetHidden() {
+	f.flags |= spec.FileFlagHidden
+}
+
+// SetAssociated sets the associated file bit in the file's record. An associated file has the same identifier as the
+// file it is associated with, and must be added to their directory just before it (see [spec.CompareDirectoryEntries]).
+func (f *File) SetAssociated() {
+	f.flags |= spec.FileFlagAssociatedFile
+}
+
+// SetExtendedAttributes records an extended attribute record at the start of the file's extent, before its data. Links
+// share the extended attribute record of their target, along with its extent.
+func (f *File) SetExtendedAttributes(attributes *spec.ExtendedAttributeRecord) {
+	f.attributes = attributes
+}
+
+// SetSystemUse sets the system use field of the file's record, such as SUSP entries that describe the file. Since
+// this changes the length of the record, it must be set before the file is added to a directory. It returns an error
+// if the record would be too long.
+func (f *File) SetSystemUse(systemUse []byte) error {
+	length, err := spec.DirectoryRecordLengthWithSystemUse(len(f.name), len(systemUse))
+	if err != nil {
+		return err
+	}
+
+	f.systemUse = systemUse
+	f.length = length
+	return nil
+}
+
+// Owner returns the file that owns the extent of f, which is f itself unless f is a link (see [File.Link])
+func (f *File) Owner() *File {
+	if f.target != nil {
+		return f.target
+	}
+
+	return f
+}
+
 func (f *File) WriteTo(w io.Writer) (int64, error) {
+	if f.target != nil {
+		// The data belongs to the target, which is responsible for writing it
+		return 0, nil
+	}
+
+	written, err := writeExtendedAttributes(w, f.attributes)
+	if err != nil {
+		return written, err
+	}
+
 	r, err := f.data()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get File data: %w", err)
+		return written, fmt.Errorf("failed to get File data: %w", err)
 	}
 
-	return io.Copy(w, r)
+	n, err := io.Copy(w, r)
+	return written + n, err
 }
 
 func (f *File) PointerRecord() spec.DirectoryRecord {
+	var attributeBlocks uint8
+	if attributes := f.Owner().attributes; attributes != nil {
+		attributeBlocks = attributes.Blocks()
+	}
+
 	return spec.DirectoryRecord{
 		Length:                        f.recordLength(),
-		ExtendedAttributeRecordLength: 0,
-		ExtentLocation:                encode.AsUInt32BothByte(f.location),
-		DataLength:                    encode.AsUInt32BothByte(f.dataSize),
+		ExtendedAttributeRecordLength: attributeBlocks,
+		ExtentLocation:                encode.AsUInt32BothByte(f.Location()),
+		DataLength:                    encode.AsUInt32BothByte(f.dataLength()),
 		RecordingDateAndTime:          encode.AsDateTime(f.recordedAt),
-		FileFlags:                     f.flags,
+		FileFlags:                     f.flags | attributeFlags(f.Owner().attributes),
 		// These fields are used for interleaving and hence we leave them unset
 		FileUnitSize:      0,
 		InterleaveGapSize: 0,
-		// We aren't supporting multiple volumes currently
-		// TODO[multivolume]
-		VolumeSequenceNumber: encode.AsUInt16BothByte(1),
+		VolumeSequenceNumber: encode.AsUInt16BothByte(f.Owner().volume),
 
 		LengthOfFileIdentifier: uint8(len(f.name)),
 		FileIdentifier:         f.name,
+		SystemUse:              f.systemUse,
 	}
 }
 
@@ -235,20 +436,38 @@ func (f *File) Relocate(newLocation uint32) {
 }
 
 func (f *File) Location() uint32 {
+	if f.target != nil {
+		return f.target.Location()
+	}
+
 	return f.location
 }
 
+// DataLocation returns the block at which the file's data starts, which follows its extended attribute record, if it
+// has one
+func (f *File) DataLocation() uint32 {
+	return f.Location() + uint32(f.PointerRecord().ExtendedAttributeRecordLength)
+}
+
 func (f *File) children() []RelocatableFileSection {
 	// Files have no children
 	return nil
 }
 
 func (f *File) recordLength() uint8 {
-	return spec.DirectoryRecordLength(len(f.name))
+	return f.length
 }
 
 func (f *File) dataLength() uint32 {
+	if f.target != nil {
+		return f.target.dataLength()
+	}
+
 	return f.dataSize
 }
 
+func (f *File) ownsExtent() bool {
+	return f.target == nil && !f.placed && !f.deferred
+}
+
 var _ RelocatableFileSection = &File{}
@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"io"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -466,3 +467,118 @@ func TestFile_Relocate(t *testing.T) {
 	assert.Equal(t, uint32(0x1000), f.Location(), "Successive relocations should still update Location()")
 	assert.Equal(t, uint32(0x1000), f.PointerRecord().ExtentLocation.RealValue(), "Successive relocations should still update PointerRecord()'s ExtentLocation")
 }
+
+func TestFile_Link(t *testing.T) {
+	data := func() (io.Reader, error) {
+		return bytes.NewReader([]byte("hello world")), nil
+	}
+
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+	target := builder.NewFile(spec.FileIdentifier("A.TXT;1"), time.Now(), 11, data)
+	link := builder.NewFile(spec.FileIdentifier("B.TXT;1"), time.Now(), 0, nil)
+	linkToLink := builder.NewFile(spec.FileIdentifier("C.TXT;1"), time.Now(), 0, nil)
+
+	link.Link(target)
+	linkToLink.Link(link)
+
+	root.Add(target)
+	root.Add(link)
+	root.Add(linkToLink)
+
+	block := uint32(20)
+	builder.RelocateTree(root, &block)
+
+	assert.Equal(t, uint32(21), target.Location(), "Target file should be allocated the block after its directory")
+	assert.Equal(t, uint32(22), block, "RelocateTree should not allocate blocks for linked files")
+	assert.Equal(t, target.Location(), link.Location(), "Linked file should share the location of its target")
+	assert.Equal(t, target.Location(), linkToLink.PointerRecord().ExtentLocation.RealValue(), "File linked to a link should share the location of the original target")
+	assert.Equal(t, uint32(11), linkToLink.PointerRecord().DataLength.RealValue(), "Linked file should have the data length of its target")
+
+	extents := slices.Collect(root.Extents())
+	assert.Equal(t, []builder.RelocatableFileSection{root, target}, extents, "Extents should omit linked files")
+
+	var buff bytes.Buffer
+	written, err := link.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo() should not produce an error for a linked file")
+	assert.Zero(t, written, "Linked files should not write any data of their own")
+}
+
+func TestFile_Place(t *testing.T) {
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+
+	placed := builder.NewFile(spec.FileIdentifier("OLD.TXT;1"), time.Now(), 5000, func() (io.Reader, error) { return bytes.NewReader(nil), nil })
+	placed.Place(1234)
+	root.Add(placed)
+
+	file := builder.NewFile(spec.FileIdentifier("NEW.TXT;1"), time.Now(), 1, func() (io.Reader, error) { return bytes.NewReader([]byte("a")), nil })
+	root.Add(file)
+
+	block := uint32(2000)
+	builder.RelocateTree(root, &block)
+
+	assert.EqualValues(t, 1234, placed.Location(), "Placed file should keep its location when the tree is relocated")
+	assert.EqualValues(t, 5000, placed.PointerRecord().DataLength.RealValue(), "Placed file should keep its data length")
+	assert.EqualValues(t, 2001, file.Location(), "Other files should be relocated after the directory")
+	assert.EqualValues(t, 2002, block, "Placed file should not be allocated any blocks")
+
+	var extents []builder.RelocatableFileSection
+	for extent := range root.Extents() {
+		extents = append(extents, extent)
+	}
+	assert.Equal(t, []builder.RelocatableFileSection{root, file}, extents, "Placed file should be omitted from extents")
+}
+
+func TestFile_Defer(t *testing.T) {
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+
+	deferred := builder.NewFile(spec.FileIdentifier("LAST.TXT;1"), time.Now(), 3, func() (io.Reader, error) { return bytes.NewReader([]byte("end")), nil })
+	deferred.Defer()
+	root.Add(deferred)
+
+	file := builder.NewFile(spec.FileIdentifier("FIRST.TXT;1"), time.Now(), 1, func() (io.Reader, error) { return bytes.NewReader([]byte("a")), nil })
+	root.Add(file)
+
+	block := uint32(2000)
+	builder.RelocateTree(root, &block)
+	assert.EqualValues(t, 2002, block, "Deferred file should not be allocated any blocks with the tree")
+
+	var extents []builder.RelocatableFileSection
+	for extent := range root.Extents() {
+		extents = append(extents, extent)
+	}
+	assert.Equal(t, []builder.RelocatableFileSection{root, file}, extents, "Deferred file should be omitted from extents")
+
+	deferred.Relocate(builder.AllocateExtent(&block, deferred, 1))
+	assert.EqualValues(t, 2002, deferred.Location(), "Deferred file should be allocated after the rest of the tree")
+	assert.EqualValues(t, 2003, block, "Deferred file should be allocated its own block")
+	assert.EqualValues(t, 3, deferred.PointerRecord().DataLength.RealValue(), "Deferred file should keep its data length")
+}
+
+func TestFile_SetSystemUse(t *testing.T) {
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+	require.NoError(t, root.SetSelfSystemUse([]byte("SP\x07\x01\xBE\xEF\x00")), "SetSelfSystemUse() should accept a short field")
+
+	file := builder.NewFile(spec.FileIdentifier("FOO.TXT;1"), time.Now(), 3, func() (io.Reader, error) { return bytes.NewReader([]byte("foo")), nil })
+	require.NoError(t, file.SetSystemUse([]byte("XX\x06\x01ab")), "SetSystemUse() should accept a short field")
+	root.Add(file)
+
+	assert.EqualValues(t, 34+8, root.SelfRecord().Length, "'.' record should include its system use field, padded to an even length")
+	assert.EqualValues(t, 33+9+6, file.PointerRecord().Length, "File record should include its system use field")
+
+	var buff bytes.Buffer
+	_, err := root.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo() should not produce an error")
+
+	data := buff.Bytes()
+	assert.Equal(t, []byte("SP\x07\x01\xBE\xEF\x00\x00"), data[34:42], "'.' record should end with its system use field")
+	assert.EqualValues(t, 42, data[0], "'.' record should record its length")
+
+	fileRecord := data[42+34:]
+	assert.EqualValues(t, 48, fileRecord[0], "File record should follow the '..' record")
+	assert.Equal(t, []byte("XX\x06\x01ab"), fileRecord[42:48], "File record should end with its system use field")
+
+	long := builder.NewFile(spec.FileIdentifier(strings.Repeat("X", 207)+";1"), time.Now(), 3, func() (io.Reader, error) { return bytes.NewReader([]byte("foo")), nil })
+	err = long.SetSystemUse(make([]byte, 16))
+	assert.ErrorIs(t, err, spec.ErrDirectoryRecordTooLong, "SetSystemUse() should reject a field that doesn't fit in the record")
+	assert.EqualValues(t, 33+209, long.PointerRecord().Length, "Rejected system use field should not change the record")
+}
@@ -39,7 +39,7 @@ func (p *PathTable) Records() iter.Seq[*spec.PathTableRecord] {
 
 			record := &spec.PathTableRecord{
 				LengthOfDirectoryIdentifier:   dir.PointerRecord().LengthOfFileIdentifier,
-				ExtendedAttributeRecordLength: 0,
+				ExtendedAttributeRecordLength: dir.PointerRecord().ExtendedAttributeRecordLength,
 				LocationOfExtent:              dir.PointerRecord().ExtentLocation.RealValue(),
 				ParentDirectoryNumber:         uint16(parentNumber),
 				DirectoryIdentifier:           dir.PointerRecord().FileIdentifier,
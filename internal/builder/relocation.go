@@ -1,14 +1,89 @@
 package builder
 
+import (
+	"cmp"
+	"slices"
+)
+
 func RelocateTree(root *Directory, block *uint32) {
-	for entry := range root.Walk(false) {
-		entry.Relocate(AllocateAndIncrementBlock(block, entry.PointerRecord().DataLength.RealValue()))
+	for entry := range root.Extents() {
+		entry.Relocate(AllocateExtent(block, entry, 1))
+	}
+}
+
+// RelocateTreeByWeight is like RelocateTree, but allocates blocks in the order given by [Directory.ExtentsByWeight],
+// so that files with greater weights are placed first
+func RelocateTreeByWeight(root *Directory, block *uint32, weight func(*File) int) {
+	RelocateExtents(root.ExtentsByWeight(weight), block, nil)
+}
+
+// RelocateExtents allocates blocks to extents in the order given. The extent of each file is aligned to the number of
+// blocks given by alignment (see [AllocateAlignedAndIncrementBlock]), unless alignment is nil.
+func RelocateExtents(extents []RelocatableFileSection, block *uint32, alignment func(*File) uint32) {
+	for _, entry := range extents {
+		blocks := uint32(1)
+		if file, ok := entry.(*File); ok && alignment != nil {
+			blocks = alignment(file)
+		}
+
+		entry.Relocate(AllocateExtent(block, entry, blocks))
 	}
 }
 
+// AllocateExtent allocates blocks for the extent of a file or directory, including its extended attribute record (see
+// [ExtentSize]), and returns its location. Its data is aligned to the given number of blocks, as for
+// [AllocateAlignedAndIncrementBlock], so any extended attribute record comes just before an aligned block.
+func AllocateExtent(block *uint32, entry RelocatableFileSection, alignment uint32) uint32 {
+	record := entry.PointerRecord()
+	attributeBlocks := uint32(record.ExtendedAttributeRecordLength)
+
+	*block += attributeBlocks
+	return AllocateAlignedAndIncrementBlock(block, record.DataLength.RealValue(), alignment) - attributeBlocks
+}
+
+// ExtentsByWeight returns the same entries as Extents, but with every directory first, in the order of Extents, and
+// then every file in descending order of weight. Files with the same weight are in the order of Extents.
+func (d *Directory) ExtentsByWeight(weight func(*File) int) []RelocatableFileSection {
+	var extents []RelocatableFileSection
+	var files []*File
+	for entry := range d.Extents() {
+		if file, ok := entry.(*File); ok {
+			files = append(files, file)
+		} else {
+			extents = append(extents, entry)
+		}
+	}
+
+	weights := make(map[*File]int, len(files))
+	for _, file := range files {
+		weights[file] = weight(file)
+	}
+
+	slices.SortStableFunc(files, func(a, b *File) int {
+		return cmp.Compare(weights[b], weights[a])
+	})
+
+	for _, file := range files {
+		extents = append(extents, file)
+	}
+
+	return extents
+}
+
 func AllocateAndIncrementBlock(block *uint32, size uint32) uint32 {
 	allocation := *block
 	*block += (size + logicalBlockSize - 1) / logicalBlockSize
 
 	return allocation
 }
+
+// AllocateAlignedAndIncrementBlock is like AllocateAndIncrementBlock, but first skips blocks if necessary so that the
+// allocation starts at a multiple of alignment blocks. Alignments of 0 and 1 have no effect, and nothing is skipped for
+// an empty allocation, since it doesn't occupy any blocks.
+func AllocateAlignedAndIncrementBlock(block *uint32, size uint32, alignment uint32) uint32 {
+	if alignment > 1 && size > 0 {
+		*block = (*block + alignment - 1) / alignment * alignment
+	}
+
+	return AllocateAndIncrementBlock(block, size)
+}
@@ -0,0 +1,77 @@
+package builder_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRelocateTreeByWeight(t *testing.T) {
+	data := func() (io.Reader, error) {
+		return bytes.NewReader([]byte("data")), nil
+	}
+
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+	first := builder.NewFile(spec.FileIdentifier("A.TXT;1"), time.Now(), 4, data)
+	subdir := builder.NewEmptyDirectory(spec.FileIdentifier("DIR"), time.Now(), root)
+	nested := builder.NewFile(spec.FileIdentifier("KERNEL.;1"), time.Now(), 4, data)
+	last := builder.NewFile(spec.FileIdentifier("Z.TXT;1"), time.Now(), 4, data)
+
+	subdir.Add(nested)
+	root.Add(first)
+	root.Add(subdir)
+	root.Add(last)
+
+	weights := map[*builder.File]int{nested: 100, last: -1}
+	weight := func(f *builder.File) int {
+		return weights[f]
+	}
+
+	assert.Equal(t, []builder.RelocatableFileSection{root, subdir, nested, first, last}, root.ExtentsByWeight(weight), "Directories should come first, followed by files in descending order of weight")
+
+	block := uint32(20)
+	builder.RelocateTreeByWeight(root, &block, weight)
+
+	assert.EqualValues(t, 20, root.Location(), "Root directory should be placed first")
+	assert.EqualValues(t, 21, subdir.Location(), "Subdirectories should be placed in hierarchy order")
+	assert.EqualValues(t, 22, nested.Location(), "File with the greatest weight should be placed first, regardless of its directory")
+	assert.EqualValues(t, 23, first.Location(), "Files with no weight should keep their order")
+	assert.EqualValues(t, 24, last.Location(), "Files with negative weights should be placed last")
+	assert.EqualValues(t, 25, block, "RelocateTreeByWeight should allocate every extent")
+}
+
+func TestRelocateExtents_Alignment(t *testing.T) {
+	data := func() (io.Reader, error) {
+		return bytes.NewReader([]byte("data")), nil
+	}
+
+	root := builder.NewEmptyDirectory(spec.FileIdentifierSelf, time.Now(), nil)
+	small := builder.NewFile(spec.FileIdentifier("A.TXT;1"), time.Now(), 4, data)
+	empty := builder.NewFile(spec.FileIdentifier("B.TXT;1"), time.Now(), 0, data)
+	aligned := builder.NewFile(spec.FileIdentifier("C.IMG;1"), time.Now(), 3000, data)
+	last := builder.NewFile(spec.FileIdentifier("D.TXT;1"), time.Now(), 4, data)
+
+	root.Add(small)
+	root.Add(empty)
+	root.Add(aligned)
+	root.Add(last)
+
+	alignments := map[*builder.File]uint32{empty: 16, aligned: 16}
+	alignment := func(f *builder.File) uint32 {
+		return alignments[f]
+	}
+
+	block := uint32(20)
+	builder.RelocateExtents([]builder.RelocatableFileSection{root, small, empty, aligned, last}, &block, alignment)
+
+	assert.EqualValues(t, 20, root.Location(), "Directories should not be aligned")
+	assert.EqualValues(t, 21, small.Location(), "Files without an alignment should not be aligned")
+	assert.EqualValues(t, 22, empty.Location(), "Empty files should not be aligned")
+	assert.EqualValues(t, 32, aligned.Location(), "Files should be aligned to a multiple of their alignment")
+	assert.EqualValues(t, 34, last.Location(), "Files after an aligned file should follow it directly")
+	assert.EqualValues(t, 35, block, "RelocateExtents should allocate every extent")
+}
@@ -9,6 +9,7 @@ import (
 func NewPrimaryVolumeDescriptor(
 	systemIdentifier, volumeIdentifier, volumeSetIdentifier, publisherIdentifier, dataPreparerIdentifier, applicationIdentifier string,
 	volumeSpaceSize uint32,
+	volumeSetSize, volumeSequenceNumber uint16,
 	pathTableSize uint32,
 	pathTableLLocationBlockNumber uint32,
 	pathTableLOptionalLocationBlockNumber uint32,
@@ -16,7 +17,9 @@ func NewPrimaryVolumeDescriptor(
 	pathTableMOptionalLocationBlockNumber uint32,
 	rootDirectory *Directory,
 ) (*spec.PrimaryVolumeDescriptor, error) {
-	rootRecord := rootDirectory.SelfRecord()
+	// The root directory record of a volume descriptor is always 34 bytes, so it can't have the system use field of the
+	// root directory's '.' record
+	rootRecord := rootDirectory.PointerRecord()
 	pvd := &spec.PrimaryVolumeDescriptor{
 		Header: &spec.VolumeDescriptor{
 			Kind:                    spec.VolumeDescriptorTypePrimary,
@@ -26,10 +29,9 @@ func NewPrimaryVolumeDescriptor(
 
 		VolumeSpaceSize: encode.AsUInt32BothByte(volumeSpaceSize),
 
-		// We don't currently support multiple volumes in a volume set
-		// TODO[multivolume]: Add support, if it'd be useful
-		VolumeSetSize:        encode.AsUInt16BothByte(1),
-		VolumeSequenceNumber: encode.AsUInt16BothByte(1),
+		// These are both 1 unless the image is part of a volume set spanning several volumes
+		VolumeSetSize:        encode.AsUInt16BothByte(volumeSetSize),
+		VolumeSequenceNumber: encode.AsUInt16BothByte(volumeSequenceNumber),
 
 		// This is a fixed value to make our implementation simpler;
 		// Most ISOs that I've seen do a similar thing.
@@ -100,3 +102,35 @@ func NewPrimaryVolumeDescriptor(
 
 	return pvd, nil
 }
+
+// NewEnhancedVolumeDescriptor creates an enhanced volume descriptor, which is a supplementary volume descriptor with
+// version 2 that describes a directory hierarchy with relaxed restrictions on identifiers and depth. It describes the
+// same volume as the primary volume descriptor, so copies everything else from it.
+//
+// ISO 9660:1999 §8.5
+func NewEnhancedVolumeDescriptor(
+	primary *spec.PrimaryVolumeDescriptor,
+	pathTableSize uint32,
+	pathTableLLocationBlockNumber uint32,
+	pathTableMLocationBlockNumber uint32,
+	rootDirectory *Directory,
+) *spec.PrimaryVolumeDescriptor {
+	rootRecord := rootDirectory.PointerRecord()
+
+	evd := *primary
+	evd.Header = &spec.VolumeDescriptor{
+		Kind:                    spec.VolumeDescriptorTypeSupplementary,
+		StandardIdentifier:      spec.StandardIdentifier,
+		VolumeDescriptorVersion: spec.FileStructureVersionEnhanced,
+	}
+
+	evd.PathTableSize = encode.AsUInt32BothByte(pathTableSize)
+	evd.LocationTypeLPathTable = pathTableLLocationBlockNumber
+	evd.LocationTypeLOptionalPathTable = 0
+	evd.LocationTypeMPathTable = pathTableMLocationBlockNumber
+	evd.LocationTypeMOptionalPathTable = 0
+	evd.RootDirectoryRecord = &rootRecord
+	evd.FileStructureVersion = spec.FileStructureVersionEnhanced
+
+	return &evd
+}
@@ -0,0 +1,168 @@
+// Package cdrom encodes raw CD-ROM sectors, as defined by ECMA-130. A raw sector is 2352 bytes: besides its 2048
+// bytes of user data, it has a sync pattern, a header giving its address and mode, an error detection code (EDC), and
+// Reed-Solomon error correction codes (ECC). Drives usually compute these themselves, but images of raw sectors are
+// needed to write discs in raw mode and by some emulators.
+package cdrom
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// SectorSize is the size of a raw sector
+	SectorSize = 2352
+	// UserDataSize is the size of the user data in a Mode 1 or Mode 2 Form 1 sector
+	UserDataSize = 2048
+
+	// framesPerSecond is the number of sectors in a second of a disc's address, and pregapFrames is the number of
+	// sectors before the first logical block, which is at 00:02:00
+	framesPerSecond = 75
+	pregapFrames    = 2 * framesPerSecond
+
+	syncSize   = 12
+	headerSize = 4
+
+	// subheaderSize is the size of the subheader of a Mode 2 sector, which is recorded twice
+	subheaderSize = 8
+
+	// submodeData is the submode of a Mode 2 Form 1 sector that contains data (ECMA-130 doesn't define the subheader,
+	// which is from the CD-ROM XA specification)
+	submodeData = 0x08
+
+	// The P and Q parity of the ECC cover the sector from its header, and are at the end of the sector
+	pParityOffset = 0x81C
+	qParityOffset = 0x8C8
+)
+
+var sync = [syncSize]byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// Lookup tables for the ECC and EDC. eccF multiplies by the primitive element of GF(2^8) with the polynomial
+// x^8+x^4+x^3+x^2+1, eccB is its inverse combined with addition, and edc is the CRC table of the EDC polynomial
+// (x^16+x^15+x^2+1)(x^16+x^2+x+1), reversed.
+var eccF, eccB [256]byte
+var edc [256]uint32
+
+func init() {
+	for i := 0; i < 256; i++ {
+		j := i << 1
+		if i&0x80 != 0 {
+			j ^= 0x11D
+		}
+
+		eccF[i] = byte(j)
+		eccB[i^j] = byte(i)
+
+		crc := uint32(i)
+		for k := 0; k < 8; k++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xD8018001
+			} else {
+				crc >>= 1
+			}
+		}
+
+		edc[i] = crc
+	}
+}
+
+// EncodeMode1 encodes a Mode 1 sector with the given logical block address, whose user data is data. sector must be
+// SectorSize bytes, and data UserDataSize bytes.
+func EncodeMode1(sector []byte, lba uint32, data []byte) {
+	encodeHeader(sector, lba, 1)
+	copy(sector[syncSize+headerSize:], data[:UserDataSize])
+
+	const edcOffset = syncSize + headerSize + UserDataSize
+	binary.LittleEndian.PutUint32(sector[edcOffset:], computeEDC(sector[:edcOffset]))
+
+	// The bytes between the EDC and the ECC are zero
+	clear(sector[edcOffset+4 : pParityOffset])
+
+	computeECC(sector)
+}
+
+// EncodeMode2Form1 encodes a Mode 2 Form 1 (CD-ROM XA) sector with the given logical block address, whose user data
+// is data. sector must be SectorSize bytes, and data UserDataSize bytes. The sector's subheader marks it as a data
+// sector.
+func EncodeMode2Form1(sector []byte, lba uint32, data []byte) {
+	encodeHeader(sector, lba, 2)
+
+	subheader := sector[syncSize+headerSize : syncSize+headerSize+subheaderSize]
+	copy(subheader, []byte{0, 0, submodeData, 0, 0, 0, submodeData, 0})
+
+	const dataOffset = syncSize + headerSize + subheaderSize
+	copy(sector[dataOffset:], data[:UserDataSize])
+
+	const edcOffset = dataOffset + UserDataSize
+	binary.LittleEndian.PutUint32(sector[edcOffset:], computeEDC(sector[syncSize+headerSize:edcOffset]))
+
+	// The ECC of a Mode 2 sector is computed as if its header were zero, so that it doesn't depend on its address
+	var header [headerSize]byte
+	copy(header[:], sector[syncSize:])
+	clear(sector[syncSize : syncSize+headerSize])
+	computeECC(sector)
+	copy(sector[syncSize:], header[:])
+}
+
+// encodeHeader writes the sync pattern and header of a sector. The header's address is in minutes, seconds and
+// frames, each in binary-coded decimal.
+func encodeHeader(sector []byte, lba uint32, mode byte) {
+	copy(sector, sync[:])
+
+	frames := lba + pregapFrames
+	sector[syncSize] = bcd(frames / framesPerSecond / 60)
+	sector[syncSize+1] = bcd(frames / framesPerSecond % 60)
+	sector[syncSize+2] = bcd(frames % framesPerSecond)
+	sector[syncSize+3] = mode
+}
+
+func bcd(n uint32) byte {
+	return byte(n/10%10<<4 | n%10)
+}
+
+// MSF formats a logical block address as minutes, seconds and frames, as used by cue sheets. Unlike sector headers,
+// this doesn't include the two second pregap before the first logical block.
+func MSF(lba uint32) string {
+	return fmt.Sprintf("%02d:%02d:%02d", lba/framesPerSecond/60, lba/framesPerSecond%60, lba%framesPerSecond)
+}
+
+func computeEDC(b []byte) uint32 {
+	crc := uint32(0)
+	for _, c := range b {
+		crc = crc>>8 ^ edc[(crc^uint32(c))&0xFF]
+	}
+
+	return crc
+}
+
+// computeECC computes the P and Q parity of a sector, from its header onwards (ECMA-130 Annex A). The bytes covered
+// are treated as two planes of 16-bit words: P parity is computed over their columns, and Q parity over their
+// diagonals, each with a (26,24) or (45,43) Reed-Solomon code.
+func computeECC(sector []byte) {
+	computeECCBlock(sector[syncSize:], 86, 24, 2, 86, sector[pParityOffset:])
+	computeECCBlock(sector[syncSize:], 52, 43, 86, 88, sector[qParityOffset:])
+}
+
+func computeECCBlock(src []byte, majorCount int, minorCount int, majorMult int, minorInc int, dst []byte) {
+	size := majorCount * minorCount
+	for major := 0; major < majorCount; major++ {
+		index := (major>>1)*majorMult + major&1
+
+		var a, b byte
+		for minor := 0; minor < minorCount; minor++ {
+			c := src[index]
+			index += minorInc
+			if index >= size {
+				index -= size
+			}
+
+			a ^= c
+			b ^= c
+			a = eccF[a]
+		}
+
+		a = eccB[eccF[a]^b]
+		dst[major] = a
+		dst[major+majorCount] = a ^ b
+	}
+}
@@ -0,0 +1,118 @@
+package cdrom_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/cdrom"
+	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"testing"
+)
+
+// edc computes the EDC of b a bit at a time, independently of the lookup table used to encode sectors
+func edc(b []byte) uint32 {
+	crc := uint32(0)
+	for _, c := range b {
+		crc ^= uint32(c)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0xD8018001
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// syndromes evaluates a Reed-Solomon codeword at 1 and at the primitive element of GF(2^8), both of which are zero if
+// the codeword's parity is correct
+func syndromes(codeword []byte) (byte, byte) {
+	var s0, s1 byte
+	for _, c := range codeword {
+		s0 ^= c
+
+		if s1&0x80 != 0 {
+			s1 = s1<<1 ^ 0x1D
+		} else {
+			s1 <<= 1
+		}
+
+		s1 ^= c
+	}
+
+	return s0, s1
+}
+
+// assertECC checks every P and Q codeword of a sector, from its header onwards
+func assertECC(t *testing.T, sector []byte) {
+	covered := sector[12:]
+
+	for column := 0; column < 86; column++ {
+		codeword := make([]byte, 26)
+		for i := range codeword {
+			codeword[i] = covered[column+86*i]
+		}
+
+		s0, s1 := syndromes(codeword)
+		assert.Zero(t, s0, "P codeword %d should have no errors", column)
+		assert.Zero(t, s1, "P codeword %d should have no errors", column)
+	}
+
+	for diagonal := 0; diagonal < 52; diagonal++ {
+		codeword := make([]byte, 45)
+		index := (diagonal>>1)*86 + diagonal&1
+		for i := 0; i < 43; i++ {
+			codeword[i] = covered[index]
+			index = (index + 88) % 2236
+		}
+
+		codeword[43] = covered[2236+diagonal]
+		codeword[44] = covered[2236+52+diagonal]
+
+		s0, s1 := syndromes(codeword)
+		assert.Zero(t, s0, "Q codeword %d should have no errors", diagonal)
+		assert.Zero(t, s1, "Q codeword %d should have no errors", diagonal)
+	}
+}
+
+func TestEncodeMode1(t *testing.T) {
+	data := make([]byte, cdrom.UserDataSize)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	sector := make([]byte, cdrom.SectorSize)
+	cdrom.EncodeMode1(sector, 16, data)
+
+	assert.Equal(t, []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}, sector[:12], "Sector should start with the sync pattern")
+	assert.Equal(t, []byte{0x00, 0x02, 0x16, 0x01}, sector[12:16], "Header should address block 16 as 00:02:16 in BCD, in Mode 1")
+	assert.Equal(t, data, sector[16:2064], "Sector should contain the user data")
+	assert.Zero(t, edc(sector[:2068]), "EDC should cover the sync pattern, header and user data")
+	assert.Equal(t, make([]byte, 8), sector[2068:2076], "Sector should have zeros between the EDC and ECC")
+	assertECC(t, sector)
+
+	cdrom.EncodeMode1(sector, 74*60*75, data)
+	assert.Equal(t, []byte{0x74, 0x02, 0x00, 0x01}, sector[12:16], "Header should include the pregap in the address")
+}
+
+func TestEncodeMode2Form1(t *testing.T) {
+	data := bytes.Repeat([]byte("mode 2 "), cdrom.UserDataSize)[:cdrom.UserDataSize]
+
+	sector := make([]byte, cdrom.SectorSize)
+	cdrom.EncodeMode2Form1(sector, 0, data)
+
+	assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x02}, sector[12:16], "Header should address block 0 as 00:02:00, in Mode 2")
+	assert.Equal(t, sector[16:20], sector[20:24], "Subheader should be recorded twice")
+	assert.Equal(t, data, sector[24:2072], "Sector should contain the user data")
+	assert.Zero(t, edc(sector[16:2076]), "EDC should cover the subheader and user data")
+
+	// The ECC is computed with a zero header
+	header := bytes.Clone(sector[12:16])
+	clear(sector[12:16])
+	assertECC(t, sector)
+	copy(sector[12:16], header)
+}
+
+func TestMSF(t *testing.T) {
+	assert.Equal(t, "00:00:00", cdrom.MSF(0), "Block 0 should be at the start of a track")
+	assert.Equal(t, "01:02:03", cdrom.MSF(60*75+2*75+3), "MSF should be in minutes, seconds and frames")
+}
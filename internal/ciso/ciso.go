@@ -0,0 +1,494 @@
+// Package ciso implements the compressed image formats used by emulators: CSO (also known as CISO), in its original
+// form and as extended by maxcso, and ZSO. Each compresses an image in blocks, so that it can be read at random.
+//
+// A compressed image starts with a 24-byte header, followed by an index of the offset of each compressed block and of
+// the end of the last one. The top bit of each index entry is a flag whose meaning depends on the format, and the
+// remaining bits are shifted right by the header's index shift, so that images larger than 2 GiB can be indexed.
+package ciso
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Format is a compressed image format
+type Format int
+
+const (
+	// CSO is the original CSO format, version 1, in which blocks are compressed with deflate
+	CSO Format = iota + 1
+	// CSOv2 is version 2 of the CSO format, as defined by maxcso, in which each block is compressed with deflate or
+	// LZ4, whichever is smaller
+	CSOv2
+	// ZSO is the ZSO format, in which blocks are compressed with LZ4
+	ZSO
+)
+
+func (f Format) String() string {
+	switch f {
+	case CSO:
+		return "CSO"
+	case CSOv2:
+		return "CSOv2"
+	case ZSO:
+		return "ZSO"
+	default:
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+}
+
+const (
+	// BlockSize is the uncompressed size of each block that images are written with, which is the size of a sector
+	BlockSize = 2048
+
+	headerSize = 24
+
+	// indexFlag is the top bit of an index entry. In CSO version 1 and ZSO, it indicates that a block is stored
+	// uncompressed; in CSO version 2, it indicates that a block is compressed with LZ4 rather than deflate.
+	indexFlag = 0x80000000
+
+	// maxIndexEntries limits the size of the index that will be read, so that a corrupt header can't cause a huge
+	// allocation. This is enough for an image of 2 TiB in 2 KiB blocks.
+	maxIndexEntries = 1 << 30
+)
+
+var (
+	magicCSO = [4]uint8{'C', 'I', 'S', 'O'}
+	magicZSO = [4]uint8{'Z', 'I', 'S', 'O'}
+)
+
+var (
+	// ErrInvalidData indicates that data is not a compressed image, or is corrupt
+	ErrInvalidData = errors.New("invalid compressed image")
+	// ErrSizeUnknown indicates that data was written before the size of the image was set with [Writer.SetSize]
+	ErrSizeUnknown = errors.New("size of compressed image has not been set")
+	// ErrTooLarge indicates that more data was written than the size of the image
+	ErrTooLarge = errors.New("data exceeds size of compressed image")
+)
+
+// header is the header at the start of a compressed image
+type header struct {
+	Magic            [4]uint8
+	HeaderSize       uint32
+	UncompressedSize uint64
+	BlockSize        uint32
+	Version          uint8
+	IndexShift       uint8
+	Reserved         [2]uint8
+}
+
+func (h *header) format() (Format, error) {
+	switch {
+	case h.Magic == magicCSO && h.Version <= 1:
+		return CSO, nil
+	case h.Magic == magicCSO && h.Version == 2:
+		return CSOv2, nil
+	case h.Magic == magicZSO:
+		return ZSO, nil
+	case h.Magic == magicCSO:
+		return 0, fmt.Errorf("%w: unsupported CSO version %d", ErrInvalidData, h.Version)
+	default:
+		return 0, fmt.Errorf("%w: header has incorrect magic number", ErrInvalidData)
+	}
+}
+
+// Writer compresses an image as it is written. Since the index precedes the blocks, the size of the image must be
+// known, by a call to [Writer.SetSize], before any data is written. The index is written once all the blocks have
+// been, by seeking back to it when the writer is closed.
+type Writer struct {
+	w      io.WriteSeeker
+	format Format
+
+	// start is the offset in w at which the compressed image starts, which offsets in the index are relative to
+	start int64
+
+	size    int64
+	written int64
+	shift   uint8
+	index   []uint32
+
+	// offset is where the next compressed block will be written, relative to start
+	offset int64
+
+	// block is the block being written, of which buffered bytes have been written so far
+	block    []byte
+	buffered int
+
+	deflated bytes.Buffer
+	deflate  *flate.Writer
+	lz4      []byte
+}
+
+// NewWriter returns a writer that compresses an image in the given format to w, starting at the current offset of w
+func NewWriter(w io.WriteSeeker, format Format) (*Writer, error) {
+	if format < CSO || format > ZSO {
+		return nil, fmt.Errorf("unsupported format %s", format)
+	}
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not find offset of compressed image: %w", err)
+	}
+
+	c := &Writer{w: w, format: format, start: start, size: -1, block: make([]byte, BlockSize)}
+	c.deflate, _ = flate.NewWriter(&c.deflated, flate.BestCompression)
+
+	return c, nil
+}
+
+// SetSize sets the uncompressed size of the image, and writes the header and space for the index. It can only be
+// called once, before any data is written.
+func (c *Writer) SetSize(size int64) error {
+	if c.size >= 0 {
+		return errors.New("size of compressed image has already been set")
+	}
+
+	if size < 0 {
+		return fmt.Errorf("invalid size %d", size)
+	}
+
+	blocks := (size + BlockSize - 1) / BlockSize
+	indexSize := (blocks + 1) * 4
+
+	// Every block is at most BlockSize bytes, plus padding to align the next block, so the shift is chosen so that
+	// the end of an image of uncompressed blocks can still be indexed
+	for c.shift = 0; (headerSize+indexSize+blocks*(BlockSize+1<<c.shift-1))>>c.shift > math.MaxInt32; c.shift++ {
+	}
+
+	h := header{
+		Magic:            magicCSO,
+		HeaderSize:       headerSize,
+		UncompressedSize: uint64(size),
+		BlockSize:        BlockSize,
+		Version:          1,
+		IndexShift:       c.shift,
+	}
+
+	switch c.format {
+	case CSOv2:
+		h.Version = 2
+	case ZSO:
+		h.Magic = magicZSO
+	}
+
+	if err := binary.Write(c.w, binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("could not write header: %w", err)
+	}
+
+	// The index is filled in by Close
+	if _, err := c.w.Write(make([]byte, indexSize)); err != nil {
+		return fmt.Errorf("could not write index: %w", err)
+	}
+
+	c.size = size
+	c.index = make([]uint32, 0, blocks+1)
+	c.offset = headerSize + indexSize
+
+	return c.align()
+}
+
+func (c *Writer) Write(p []byte) (int, error) {
+	if c.size < 0 {
+		return 0, ErrSizeUnknown
+	}
+
+	if int64(len(p)) > c.size-c.written {
+		return 0, fmt.Errorf("%w: writing %d bytes at offset %d exceeds size of %d bytes", ErrTooLarge, len(p), c.written, c.size)
+	}
+
+	n := 0
+	for n < len(p) {
+		copied := copy(c.block[c.buffered:], p[n:])
+		c.buffered += copied
+		n += copied
+
+		if c.buffered == BlockSize {
+			if err := c.writeBlock(); err != nil {
+				return n - copied, err
+			}
+		}
+	}
+
+	c.written += int64(n)
+	return n, nil
+}
+
+// Close writes the last block and the index. If fewer bytes have been written than the size of the image, the rest
+// of the image is zeros. Close doesn't close the underlying writer.
+func (c *Writer) Close() error {
+	if c.size < 0 {
+		return ErrSizeUnknown
+	}
+
+	for c.written < c.size {
+		if _, err := c.Write(make([]byte, min(c.size-c.written, BlockSize))); err != nil {
+			return err
+		}
+	}
+
+	// The last block may be partial, in which case it is padded with zeros
+	if c.buffered > 0 {
+		clear(c.block[c.buffered:])
+		if err := c.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	c.index = append(c.index, uint32(c.offset>>c.shift))
+
+	if _, err := c.w.Seek(c.start+headerSize, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to index: %w", err)
+	}
+
+	if err := binary.Write(c.w, binary.LittleEndian, c.index); err != nil {
+		return fmt.Errorf("could not write index: %w", err)
+	}
+
+	if _, err := c.w.Seek(c.start+c.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("could not seek to end of compressed image: %w", err)
+	}
+
+	return nil
+}
+
+// writeBlock compresses and writes the buffered block. Blocks are stored uncompressed if compressing them (including
+// the padding that aligns the next block) doesn't make them smaller.
+func (c *Writer) writeBlock() error {
+	entry := uint32(c.offset >> c.shift)
+	data := c.block
+
+	switch c.format {
+	case CSO:
+		if deflated, err := c.deflateBlock(); err != nil {
+			return err
+		} else if c.alignedSize(len(deflated)) < BlockSize {
+			data = deflated
+		} else {
+			entry |= indexFlag
+		}
+	case CSOv2:
+		deflated, err := c.deflateBlock()
+		if err != nil {
+			return err
+		}
+
+		// Readers take blocks that are at least a block long to be uncompressed, so there's no flag for this
+		c.lz4 = compressLZ4(c.lz4[:0], c.block)
+		if len(c.lz4) < len(deflated) && c.alignedSize(len(c.lz4)) < BlockSize {
+			data = c.lz4
+			entry |= indexFlag
+		} else if c.alignedSize(len(deflated)) < BlockSize {
+			data = deflated
+		}
+	case ZSO:
+		c.lz4 = compressLZ4(c.lz4[:0], c.block)
+		if c.alignedSize(len(c.lz4)) < BlockSize {
+			data = c.lz4
+		} else {
+			entry |= indexFlag
+		}
+	}
+
+	if _, err := c.w.Write(data); err != nil {
+		return fmt.Errorf("could not write block %d: %w", len(c.index), err)
+	}
+
+	c.index = append(c.index, entry)
+	c.offset += int64(len(data))
+	c.buffered = 0
+
+	return c.align()
+}
+
+func (c *Writer) deflateBlock() ([]byte, error) {
+	c.deflated.Reset()
+	c.deflate.Reset(&c.deflated)
+
+	if _, err := c.deflate.Write(c.block); err != nil {
+		return nil, fmt.Errorf("could not compress block: %w", err)
+	}
+
+	if err := c.deflate.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress block: %w", err)
+	}
+
+	return c.deflated.Bytes(), nil
+}
+
+// alignedSize returns the size that a block of the given size occupies once padded to align the next block
+func (c *Writer) alignedSize(size int) int {
+	alignment := 1 << c.shift
+	return (size + alignment - 1) / alignment * alignment
+}
+
+// align pads the output so that the next block starts at an offset that can be recorded in the index
+func (c *Writer) align() error {
+	padding := int64(c.alignedSize(int(c.offset%(1<<c.shift)))) - c.offset%(1<<c.shift)
+	if padding == 0 {
+		return nil
+	}
+
+	if _, err := c.w.Write(make([]byte, padding)); err != nil {
+		return fmt.Errorf("could not write padding: %w", err)
+	}
+
+	c.offset += padding
+	return nil
+}
+
+// Reader decompresses a compressed image, in any of the supported formats, a block at a time
+type Reader struct {
+	r      io.ReaderAt
+	format Format
+	header header
+	index  []uint32
+
+	// block is the most recently decompressed block, which is cached since reads are usually sequential
+	block      []byte
+	blockIndex int
+}
+
+// NewReader reads the header and index of a compressed image
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	b := make([]byte, headerSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	c := &Reader{r: r, blockIndex: -1}
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &c.header); err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+
+	var err error
+	if c.format, err = c.header.format(); err != nil {
+		return nil, err
+	}
+
+	// Version 1 CSO images written by some tools have a header size of zero, so it isn't checked for them
+	switch {
+	case c.format != CSO && c.header.HeaderSize != headerSize:
+		return nil, fmt.Errorf("%w: unsupported header size %d", ErrInvalidData, c.header.HeaderSize)
+	case c.header.BlockSize == 0 || c.header.BlockSize > 1<<24:
+		return nil, fmt.Errorf("%w: unsupported block size %d", ErrInvalidData, c.header.BlockSize)
+	case c.header.IndexShift > 31:
+		return nil, fmt.Errorf("%w: unsupported index shift %d", ErrInvalidData, c.header.IndexShift)
+	}
+
+	blocks := (c.header.UncompressedSize + uint64(c.header.BlockSize) - 1) / uint64(c.header.BlockSize)
+	if blocks >= maxIndexEntries {
+		return nil, fmt.Errorf("%w: image has too many blocks", ErrInvalidData)
+	}
+
+	b = make([]byte, (blocks+1)*4)
+	if _, err := r.ReadAt(b, headerSize); err != nil {
+		return nil, fmt.Errorf("could not read index: %w", err)
+	}
+
+	c.index = make([]uint32, blocks+1)
+	for i := range c.index {
+		c.index[i] = binary.LittleEndian.Uint32(b[i*4:])
+		if i > 0 && c.index[i]&^indexFlag < c.index[i-1]&^indexFlag {
+			return nil, fmt.Errorf("%w: index is out of order", ErrInvalidData)
+		}
+	}
+
+	c.block = make([]byte, c.header.BlockSize)
+	return c, nil
+}
+
+// Format returns the format of the compressed image
+func (c *Reader) Format() Format {
+	return c.format
+}
+
+// Size returns the uncompressed size of the image
+func (c *Reader) Size() int64 {
+	return int64(c.header.UncompressedSize)
+}
+
+func (c *Reader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("invalid offset %d", off)
+	}
+
+	blockSize := int64(c.header.BlockSize)
+
+	n := 0
+	for n < len(p) && off+int64(n) < c.Size() {
+		position := off + int64(n)
+		if err := c.decompress(int(position / blockSize)); err != nil {
+			return n, err
+		}
+
+		end := min(blockSize, c.Size()-position/blockSize*blockSize)
+		n += copy(p[n:], c.block[position%blockSize:end])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
+
+// decompress decompresses a block into the cached block, if it isn't already there
+func (c *Reader) decompress(block int) error {
+	if block == c.blockIndex {
+		return nil
+	}
+
+	c.blockIndex = -1
+
+	start := int64(c.index[block]&^indexFlag) << c.header.IndexShift
+	end := int64(c.index[block+1]&^indexFlag) << c.header.IndexShift
+	flagged := c.index[block]&indexFlag != 0
+
+	// The last block may be partial, but is decompressed to a whole block if it was padded when it was compressed
+	length := min(int64(c.header.BlockSize), c.Size()-int64(block)*int64(c.header.BlockSize))
+
+	// In CSO version 2, blocks that are at least a block long are always stored uncompressed
+	stored := flagged
+	if c.format == CSOv2 {
+		stored = end-start >= int64(c.header.BlockSize)
+	}
+
+	compressed := make([]byte, min(end-start, int64(c.header.BlockSize)))
+	if stored {
+		compressed = c.block[:min(end-start, length)]
+	}
+
+	if n, err := c.r.ReadAt(compressed, start); err != nil && !(errors.Is(err, io.EOF) && n == len(compressed)) {
+		return fmt.Errorf("could not read block %d: %w", block, err)
+	}
+
+	var decompressed int
+	switch {
+	case stored:
+		decompressed = len(compressed)
+	case c.format == ZSO || c.format == CSOv2 && flagged:
+		var err error
+		if decompressed, err = decompressLZ4(c.block, compressed); err != nil {
+			return fmt.Errorf("could not decompress block %d: %w", block, err)
+		}
+	default:
+		n, err := io.ReadFull(flate.NewReader(bytes.NewReader(compressed)), c.block[:length])
+		if err != nil {
+			return fmt.Errorf("%w: could not decompress block %d: %w", ErrInvalidData, block, err)
+		}
+
+		decompressed = n
+	}
+
+	if int64(decompressed) < length {
+		return fmt.Errorf("%w: block %d decompressed to %d bytes, but should be %d bytes", ErrInvalidData, block, decompressed, length)
+	}
+
+	c.blockIndex = block
+	return nil
+}
@@ -0,0 +1,128 @@
+package ciso_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/ciso"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func compress(t *testing.T, data []byte, format ciso.Format) []byte {
+	f, err := os.Create(filepath.Join(t.TempDir(), "image"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	w, err := ciso.NewWriter(f, format)
+	require.NoError(t, err, "NewWriter should not return an error for valid arguments")
+
+	_, err = w.Write(data)
+	assert.ErrorIs(t, err, ciso.ErrSizeUnknown, "Write should fail before the size is set")
+
+	require.NoError(t, w.SetSize(int64(len(data))), "SetSize should not return an error for a valid size")
+	assert.Error(t, w.SetSize(int64(len(data))), "SetSize should not be allowed twice")
+
+	// Write in uneven pieces, so that writes span blocks
+	for written := 0; written < len(data); {
+		n, err := w.Write(data[written:min(written+3000, len(data))])
+		require.NoError(t, err, "Write should not return an error within the size of the image")
+		written += n
+	}
+
+	_, err = w.Write([]byte{0})
+	assert.ErrorIs(t, err, ciso.ErrTooLarge, "Write should fail beyond the size of the image")
+
+	require.NoError(t, w.Close(), "Close should not return an error")
+
+	compressed, err := os.ReadFile(f.Name())
+	require.NoError(t, err, "Should be able to read output file")
+
+	return compressed
+}
+
+func TestRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 2000)
+
+	random := make([]byte, 3*ciso.BlockSize)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	// Random data doesn't compress, so is stored uncompressed between compressed blocks
+	mixed := append(append(bytes.Repeat([]byte("a"), ciso.BlockSize), random...), make([]byte, ciso.BlockSize)...)
+
+	for name, data := range map[string][]byte{"text": text, "mixed": mixed, "partial": []byte("short"), "empty": {}} {
+		for _, format := range []ciso.Format{ciso.CSO, ciso.CSOv2, ciso.ZSO} {
+			compressed := compress(t, data, format)
+
+			r, err := ciso.NewReader(bytes.NewReader(compressed))
+			require.NoError(t, err, "NewReader should be able to read %s compressed as %s", name, format)
+			assert.Equal(t, format, r.Format(), "Reader should detect the format of %s", name)
+			assert.EqualValues(t, len(data), r.Size(), "Reader should report the uncompressed size of %s", name)
+
+			decompressed, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+			require.NoError(t, err, "Should be able to decompress %s compressed as %s", name, format)
+			assert.Equal(t, data, decompressed, "Decompressed %s should match the original data when compressed as %s", name, format)
+
+			if name == "text" {
+				assert.Less(t, len(compressed), len(data)/4, "Text should compress as %s", format)
+
+				// Reads may start and end in the middle of blocks
+				b := make([]byte, 5000)
+				n, err := r.ReadAt(b, 1000)
+				require.NoError(t, err, "ReadAt should not return an error within the image")
+				assert.Equal(t, data[1000:1000+n], b, "ReadAt should read from the middle of a block")
+			}
+		}
+	}
+}
+
+func TestWriter_Close_Pads(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "image"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	w, err := ciso.NewWriter(f, ciso.CSO)
+	require.NoError(t, err, "NewWriter should not return an error for valid arguments")
+	require.NoError(t, w.SetSize(3*ciso.BlockSize), "SetSize should not return an error for a valid size")
+
+	_, err = w.Write([]byte("data"))
+	require.NoError(t, err, "Write should not return an error within the size of the image")
+	require.NoError(t, w.Close(), "Close should not return an error")
+
+	r, err := ciso.NewReader(f)
+	require.NoError(t, err, "NewReader should be able to read the compressed image")
+
+	decompressed, err := io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	require.NoError(t, err, "Should be able to decompress the image")
+	assert.Equal(t, append([]byte("data"), make([]byte, 3*ciso.BlockSize-4)...), decompressed, "Close should pad the image with zeros to its size")
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	valid := compress(t, bytes.Repeat([]byte("abc"), 10000), ciso.ZSO)
+
+	badMagic := bytes.Clone(valid)
+	copy(badMagic, "NOPE")
+
+	badVersion := bytes.Clone(valid)
+	badVersion[20] = 3
+	copy(badVersion, "CISO")
+
+	for name, data := range map[string][]byte{"magic": badMagic, "version": badVersion, "truncated": valid[:30]} {
+		_, err := ciso.NewReader(bytes.NewReader(data))
+		assert.Error(t, err, "NewReader should reject an image with an invalid %s", name)
+	}
+
+	corrupt := bytes.Clone(valid)
+	for i := 100; i < len(corrupt); i++ {
+		corrupt[i] = 0xFF
+	}
+
+	r, err := ciso.NewReader(bytes.NewReader(corrupt))
+	require.NoError(t, err, "NewReader should only read the header and index")
+
+	_, err = io.ReadAll(io.NewSectionReader(r, 0, r.Size()))
+	assert.ErrorIs(t, err, ciso.ErrInvalidData, "Reading corrupt blocks should fail")
+}
@@ -0,0 +1,157 @@
+package ciso
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZ4 block format constants. A match copies at least minMatch bytes, from at most maxOffset bytes back. The last
+// lastLiterals bytes of a block are always literals, and the last match must start at least matchLimit bytes before the
+// end of the block.
+const (
+	minMatch     = 4
+	maxOffset    = 65535
+	lastLiterals = 5
+	matchLimit   = 12
+
+	hashLog = 12
+)
+
+// compressLZ4 compresses src as a single LZ4 block, appending it to dst. Matches are found greedily with a table of
+// the last position of each 4-byte sequence, which is fast and compresses sectors of an image reasonably.
+func compressLZ4(dst, src []byte) []byte {
+	var table [1 << hashLog]int32
+
+	anchor := 0
+	for i := 0; i < len(src)-matchLimit; {
+		sequence := binary.LittleEndian.Uint32(src[i:])
+		h := (sequence * 2654435761) >> (32 - hashLog)
+
+		// Positions are stored plus one, so that zero means the sequence hasn't been seen
+		candidate := int(table[h]) - 1
+		table[h] = int32(i + 1)
+
+		if candidate < 0 || i-candidate > maxOffset || binary.LittleEndian.Uint32(src[candidate:]) != sequence {
+			i++
+			continue
+		}
+
+		length := minMatch
+		for i+length < len(src)-lastLiterals && src[candidate+length] == src[i+length] {
+			length++
+		}
+
+		dst = appendSequence(dst, src[anchor:i], i-candidate, length)
+		i += length
+		anchor = i
+	}
+
+	return appendSequence(dst, src[anchor:], 0, 0)
+}
+
+// appendSequence appends a sequence of literals followed by a match. The last sequence of a block has no match, which
+// is given by a length of zero.
+func appendSequence(dst []byte, literals []byte, offset int, length int) []byte {
+	token := byte(min(len(literals), 15)) << 4
+	if length > 0 {
+		token |= byte(min(length-minMatch, 15))
+	}
+
+	dst = append(dst, token)
+	dst = appendLength(dst, len(literals))
+	dst = append(dst, literals...)
+
+	if length > 0 {
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(offset))
+		dst = appendLength(dst, length-minMatch)
+	}
+
+	return dst
+}
+
+// appendLength appends the bytes that extend a length of 15 or more in a sequence's token
+func appendLength(dst []byte, length int) []byte {
+	if length < 15 {
+		return dst
+	}
+
+	for length -= 15; length >= 255; length -= 255 {
+		dst = append(dst, 255)
+	}
+
+	return append(dst, byte(length))
+}
+
+// decompressLZ4 decompresses an LZ4 block from src into dst, returning the number of bytes decompressed.
+// Decompression stops once dst is full at the end of a sequence's literals, so src may be followed by padding.
+func decompressLZ4(dst, src []byte) (int, error) {
+	s, d := 0, 0
+	for s < len(src) {
+		token := src[s]
+		s++
+
+		literals, n, err := readLength(src[s:], int(token>>4))
+		if err != nil {
+			return d, err
+		}
+
+		s += n
+		if literals > len(src)-s || literals > len(dst)-d {
+			return d, fmt.Errorf("%w: literals exceed block", ErrInvalidData)
+		}
+
+		d += copy(dst[d:], src[s:s+literals])
+		s += literals
+
+		if s == len(src) || d == len(dst) {
+			break
+		}
+
+		if len(src)-s < 2 {
+			return d, fmt.Errorf("%w: truncated match offset", ErrInvalidData)
+		}
+
+		offset := int(binary.LittleEndian.Uint16(src[s:]))
+		s += 2
+		if offset == 0 || offset > d {
+			return d, fmt.Errorf("%w: invalid match offset %d", ErrInvalidData, offset)
+		}
+
+		length, n, err := readLength(src[s:], int(token&15))
+		if err != nil {
+			return d, err
+		}
+
+		s += n
+		length += minMatch
+		if length > len(dst)-d {
+			return d, fmt.Errorf("%w: match exceeds block", ErrInvalidData)
+		}
+
+		// Matches may overlap the bytes that they produce, so must be copied a byte at a time
+		for i := 0; i < length; i++ {
+			dst[d+i] = dst[d-offset+i]
+		}
+
+		d += length
+	}
+
+	return d, nil
+}
+
+// readLength reads the bytes that extend a length from a sequence's token, returning the length and the number of
+// bytes read
+func readLength(src []byte, length int) (int, int, error) {
+	if length < 15 {
+		return length, 0, nil
+	}
+
+	for n := 0; n < len(src); n++ {
+		length += int(src[n])
+		if src[n] != 255 {
+			return length, n + 1, nil
+		}
+	}
+
+	return 0, 0, fmt.Errorf("%w: truncated length", ErrInvalidData)
+}
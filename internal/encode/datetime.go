@@ -1,6 +1,7 @@
 package encode
 
 import (
+	"fmt"
 	"github.com/davejbax/go-iso9660/internal/spec"
 	"time"
 )
@@ -17,3 +18,25 @@ func AsDateTime(t time.Time) spec.DateTime {
 		GMTOffsetIn15MinIntervals: 0,
 	}
 }
+
+// AsLongDateTime encodes a time as digits, in UTC. The zero time is encoded as [spec.ZeroLongDateTime], which means
+// that the date and time is not specified.
+func AsLongDateTime(t time.Time) spec.LongDateTime {
+	if t.IsZero() {
+		return spec.ZeroLongDateTime
+	}
+
+	t = t.UTC()
+
+	var l spec.LongDateTime
+	digits := fmt.Sprintf("%04d%02d%02d%02d%02d%02d%02d", t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()/int(10*time.Millisecond))
+	copy(l.YearDigits[:], digits[0:4])
+	copy(l.MonthDigits[:], digits[4:6])
+	copy(l.DayDigits[:], digits[6:8])
+	copy(l.HourDigits[:], digits[8:10])
+	copy(l.MinuteDigits[:], digits[10:12])
+	copy(l.SecondDigits[:], digits[12:14])
+	copy(l.CentisecondsDigits[:], digits[14:16])
+
+	return l
+}
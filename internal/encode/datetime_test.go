@@ -3,6 +3,7 @@ package encode_test
 import (
 	"bytes"
 	"github.com/davejbax/go-iso9660/internal/encode"
+	"github.com/davejbax/go-iso9660/internal/spec"
 	"github.com/lunixbochs/struc"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -28,3 +29,12 @@ func TestAsDateTime(t *testing.T) {
 		assert.Equal(t, c.expected[:], buff.Bytes(), "dateTime created from time.Time should encode to correct value")
 	}
 }
+
+func TestAsLongDateTime(t *testing.T) {
+	input := time.Date(2015, 7, 31, 20, 0, 15, 500*int(time.Millisecond), time.FixedZone("UTC+1", 60*60))
+
+	l := encode.AsLongDateTime(input)
+	assert.Equal(t, "2015073119001550", string(l.YearDigits[:])+string(l.MonthDigits[:])+string(l.DayDigits[:])+string(l.HourDigits[:])+string(l.MinuteDigits[:])+string(l.SecondDigits[:])+string(l.CentisecondsDigits[:]), "LongDateTime should have the digits of the time in UTC")
+	assert.True(t, input.Equal(l.Time()), "LongDateTime should decode to the time it was encoded from")
+	assert.Equal(t, spec.ZeroLongDateTime, encode.AsLongDateTime(time.Time{}), "Zero time should encode to the zero LongDateTime")
+}
@@ -15,11 +15,14 @@ const (
 
 var (
 	ErrUnsupportedEncoding = errors.New("unsupported file identifier encoding")
-	ErrInvalidVersion      = errors.New("invalid file version number; must be in the range 1-32767 (inclusive)")
+	ErrInvalidVersion      = errors.New("invalid file version number; must be in the range 1-32767 (inclusive), or 0 to omit it")
 )
 
+// AsFileIdentifier encodes the file identifier of a file, which consists of its name, a period, its extension, a
+// semicolon and its version number (e.g. "KERNEL.;1"). The period is recorded even if the extension is empty. A version
+// of 0 omits the semicolon and version number, which some readers prefer, although ECMA-119 requires them.
 func AsFileIdentifier(filename string, extension string, version int, encoding FileIdentifierEncoding) (spec.FileIdentifier, error) {
-	if version < 1 || version > 32767 {
+	if version < 0 || version > 32767 {
 		return nil, ErrInvalidVersion
 	}
 
@@ -43,14 +46,14 @@ func AsFileIdentifier(filename string, extension string, version int, encoding F
 			fi = append(fi, uint8(v))
 		}
 
-		if extension != "" {
-			// Separator 1 (a period, before file extension)
-			fi = append(fi, uint8('.'))
+		// Separator 1 (a period, before file extension)
+		fi = append(fi, uint8('.'))
 
-			for _, v := range encodedExtension {
-				fi = append(fi, uint8(v))
-			}
+		for _, v := range encodedExtension {
+			fi = append(fi, uint8(v))
+		}
 
+		if version != 0 {
 			// Separator 2 (a semicolon, before version)
 			fi = append(fi, uint8(';'))
 
@@ -64,3 +67,23 @@ func AsFileIdentifier(filename string, extension string, version int, encoding F
 		return nil, ErrUnsupportedEncoding
 	}
 }
+
+// AsDirectoryIdentifier encodes the identifier of a directory, which is just its name
+func AsDirectoryIdentifier(name string, encoding FileIdentifierEncoding) (spec.FileIdentifier, error) {
+	switch encoding {
+	case FileIdentifierEncodingDCharacter:
+		encoded := make([]spec.DCharacter, len(name))
+		if err := AsDCharacters(name, encoded, true, true); err != nil {
+			return nil, fmt.Errorf("could not encode directory name as d-characters: %w", err)
+		}
+
+		di := make(spec.FileIdentifier, len(encoded))
+		for i, v := range encoded {
+			di[i] = uint8(v)
+		}
+
+		return di, nil
+	default:
+		return nil, ErrUnsupportedEncoding
+	}
+}
@@ -0,0 +1,47 @@
+package encode_test
+
+import (
+	"github.com/davejbax/go-iso9660/internal/encode"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAsFileIdentifier(t *testing.T) {
+	cases := []struct {
+		filename  string
+		extension string
+		version   int
+		expected  string
+	}{
+		{"README", "TXT", 1, "README.TXT;1"},
+		{"KERNEL", "", 1, "KERNEL.;1"},
+		{"A", "B", 32767, "A.B;32767"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.expected, func(t *testing.T) {
+			t.Parallel()
+
+			identifier, err := encode.AsFileIdentifier(c.filename, c.extension, c.version, encode.FileIdentifierEncodingDCharacter)
+			require.NoError(t, err, "AsFileIdentifier should not return an error for valid names")
+			assert.Equal(t, c.expected, string(identifier), "Identifier should have both separators, even without an extension")
+		})
+	}
+
+	identifier, err := encode.AsFileIdentifier("KERNEL", "", 0, encode.FileIdentifierEncodingDCharacter)
+	require.NoError(t, err, "AsFileIdentifier should not return an error for version 0")
+	assert.Equal(t, "KERNEL.", string(identifier), "Version 0 should omit the semicolon and version")
+
+	_, err = encode.AsFileIdentifier("A", "B", 32768, encode.FileIdentifierEncodingDCharacter)
+	assert.ErrorIs(t, err, encode.ErrInvalidVersion, "Versions above 32767 should be invalid")
+
+	_, err = encode.AsFileIdentifier("a-b", "", 1, encode.FileIdentifierEncodingDCharacter)
+	assert.Error(t, err, "Names that aren't d-characters should be invalid")
+}
+
+func TestAsDirectoryIdentifier(t *testing.T) {
+	identifier, err := encode.AsDirectoryIdentifier("BOOT", encode.FileIdentifierEncodingDCharacter)
+	require.NoError(t, err, "AsDirectoryIdentifier should not return an error for valid names")
+	assert.Equal(t, "BOOT", string(identifier), "Directory identifiers should have no separators or version")
+}
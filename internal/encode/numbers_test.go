@@ -50,3 +50,16 @@ func TestAsUInt32BothByte(t *testing.T) {
 		})
 	}
 }
+
+func TestBothByte_IsConsistent(t *testing.T) {
+	assert.True(t, encode.AsUInt16BothByte(0xABCD).IsConsistent(), "Encoded 16-bit value should be consistent")
+	assert.True(t, encode.AsUInt32BothByte(0x123456).IsConsistent(), "Encoded 32-bit value should be consistent")
+
+	inconsistent16 := encode.AsUInt16BothByte(0xABCD)
+	inconsistent16.Value ^= 0x01000000
+	assert.False(t, inconsistent16.IsConsistent(), "16-bit value with differing halves should not be consistent")
+
+	inconsistent32 := encode.AsUInt32BothByte(0x123456)
+	inconsistent32.Value ^= 0x0100000000000000
+	assert.False(t, inconsistent32.IsConsistent(), "32-bit value with differing halves should not be consistent")
+}
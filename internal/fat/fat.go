@@ -0,0 +1,605 @@
+// Package fat builds FAT12 and FAT16 filesystem images, such as the EFI system partition images used to boot an image
+// with UEFI.
+//
+// Only what is needed for small, read-mostly images is supported: files and directories are recorded with 8.3 short
+// names, and each file is stored contiguously. Long file names are not written.
+package fat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/lunixbochs/struc"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// SectorSize is the size of a sector of the filesystem
+	SectorSize = 512
+
+	// DirectoryEntrySize is the size of an entry in a directory
+	DirectoryEntrySize = 32
+
+	// MaxFAT12Clusters and MaxFAT16Clusters are the largest numbers of clusters that a FAT12 or FAT16 filesystem can
+	// have. The type of a FAT filesystem is determined solely by how many clusters it has.
+	MaxFAT12Clusters = 4084
+	MaxFAT16Clusters = 65524
+
+	// MediaFixedDisk is the media descriptor for a fixed disk, which is also recorded in the first entry of each FAT
+	MediaFixedDisk = 0xF8
+
+	reservedSectors = 1
+	fatCount        = 2
+
+	// minRootEntries is the number of entries that the root directory has room for, unless more are needed. This is
+	// the value that mkfs.fat uses for small filesystems.
+	minRootEntries = 512
+
+	maxSectorsPerCluster = 64
+	firstCluster         = 2
+	bootSignature        = 0x29
+	volumeIDOffset       = 39
+	sectorSignature      = 0xAA55
+
+	// heads and sectorsPerTrack are the geometry recorded in the BPB. Nothing that reads an EFI system partition uses
+	// them, so we use the same geometry as isohybrid.
+	heads           = 64
+	sectorsPerTrack = 32
+)
+
+// Directory entry attributes
+const (
+	AttributeReadOnly    uint8 = 0x01
+	AttributeHidden      uint8 = 0x02
+	AttributeSystem      uint8 = 0x04
+	AttributeVolumeLabel uint8 = 0x08
+	AttributeDirectory   uint8 = 0x10
+	AttributeArchive     uint8 = 0x20
+)
+
+var (
+	// ErrInvalidName indicates that a file name cannot be recorded as an 8.3 short name
+	ErrInvalidName = errors.New("name cannot be represented as an 8.3 FAT name")
+	// ErrDuplicateName indicates that two files in a directory have the same short name, since short names are
+	// upper case
+	ErrDuplicateName = errors.New("names are the same when converted to 8.3 FAT names")
+	// ErrTooLarge indicates that the contents don't fit in a FAT16 filesystem
+	ErrTooLarge = errors.New("contents are too large for a FAT16 filesystem")
+	// ErrUnsupportedFileType indicates that a file is neither a regular file nor a directory
+	ErrUnsupportedFileType = errors.New("only regular files and directories can be stored in a FAT filesystem")
+)
+
+// bootCode is run if a BIOS tries to boot the filesystem. It invokes INT 18h, which tells the BIOS to try the next boot
+// device, and halts if that returns.
+var bootCode = []byte{0xCD, 0x18, 0xF4, 0xEB, 0xFD}
+
+// BootSector is the first sector of a FAT12 or FAT16 filesystem, which holds the BIOS parameter block (BPB) describing
+// the layout of the filesystem
+type BootSector struct {
+	Jump              [3]uint8
+	OEMName           [8]uint8
+	BytesPerSector    uint16 `struc:"little"`
+	SectorsPerCluster uint8
+	ReservedSectors   uint16 `struc:"little"`
+	FATCount          uint8
+	RootEntries       uint16 `struc:"little"`
+	TotalSectors16    uint16 `struc:"little"`
+	Media             uint8
+	FATSectors        uint16 `struc:"little"`
+	SectorsPerTrack   uint16 `struc:"little"`
+	Heads             uint16 `struc:"little"`
+	HiddenSectors     uint32 `struc:"little"`
+	TotalSectors32    uint32 `struc:"little"`
+
+	DriveNumber    uint8
+	Reserved       uint8
+	BootSignature  uint8
+	VolumeID       uint32 `struc:"little"`
+	VolumeLabel    [11]uint8
+	FileSystemType [8]uint8
+
+	BootCode  [448]uint8
+	Signature uint16 `struc:"little"`
+}
+
+// DirectoryEntry is a 32-byte entry in a directory, describing a file, a subdirectory or the volume label
+type DirectoryEntry struct {
+	Name               [11]uint8
+	Attributes         uint8
+	Reserved           uint8
+	CreationTimeTenths uint8
+	CreationTime       uint16 `struc:"little"`
+	CreationDate       uint16 `struc:"little"`
+	AccessDate         uint16 `struc:"little"`
+	FirstClusterHigh   uint16 `struc:"little"`
+	WriteTime          uint16 `struc:"little"`
+	WriteDate          uint16 `struc:"little"`
+	FirstCluster       uint16 `struc:"little"`
+	Size               uint32 `struc:"little"`
+}
+
+// Options controls the metadata of a filesystem built by [Build]
+type Options struct {
+	// Label is the volume label, which is truncated to 11 characters. If empty, 'NO NAME' is used.
+	Label string
+
+	// VolumeID is the volume serial number. This is conventionally derived from the time at which the filesystem was
+	// created, but that would make images irreproducible, so if it is zero, a checksum of the filesystem is used instead.
+	VolumeID uint32
+}
+
+// node is a file or directory to be written to the filesystem
+type node struct {
+	path    string
+	name    [11]uint8
+	info    fs.FileInfo
+	parent  *node
+	entries []*node
+
+	// cluster is the first cluster of the node's data, or 0 if it has none
+	cluster  uint32
+	clusters uint32
+}
+
+func (n *node) isDir() bool {
+	return n.info.IsDir()
+}
+
+// size is the number of bytes of data that a node occupies
+func (n *node) size() int64 {
+	if n.isDir() {
+		// Every subdirectory starts with '.' and '..' entries
+		return int64(len(n.entries)+2) * DirectoryEntrySize
+	}
+
+	return n.info.Size()
+}
+
+// layout is the geometry of a filesystem
+type layout struct {
+	fat16             bool
+	sectorsPerCluster uint32
+	clusters          uint32
+	rootEntries       uint32
+	fatSectors        uint32
+}
+
+func (l *layout) clusterSize() int64 {
+	return int64(l.sectorsPerCluster) * SectorSize
+}
+
+func (l *layout) rootSectors() uint32 {
+	return l.rootEntries * DirectoryEntrySize / SectorSize
+}
+
+func (l *layout) dataSector() uint32 {
+	return reservedSectors + fatCount*l.fatSectors + l.rootSectors()
+}
+
+func (l *layout) totalSectors() uint32 {
+	return l.dataSector() + l.clusters*l.sectorsPerCluster
+}
+
+func (l *layout) clusterOffset(cluster uint32) int64 {
+	return int64(l.dataSector()+(cluster-firstCluster)*l.sectorsPerCluster) * SectorSize
+}
+
+// Build creates a FAT filesystem image containing the files in fsys. The filesystem is the smallest that holds all of
+// the files, and is FAT12 if that allows few enough clusters, or FAT16 otherwise.
+func Build(fsys fs.FS, opts Options) ([]byte, error) {
+	rootInfo, err := fs.Stat(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not stat root directory: %w", err)
+	}
+
+	root := &node{path: ".", info: rootInfo}
+	if err := readTree(fsys, root); err != nil {
+		return nil, err
+	}
+
+	l, err := newLayout(root)
+	if err != nil {
+		return nil, err
+	}
+
+	image := make([]byte, int64(l.totalSectors())*SectorSize)
+
+	if err := writeBootSector(image, l, opts); err != nil {
+		return nil, err
+	}
+
+	allocate(root, l)
+	writeFATs(image, root, l)
+
+	if err := writeTree(image, fsys, root, l, opts); err != nil {
+		return nil, err
+	}
+
+	if opts.VolumeID == 0 {
+		binary.LittleEndian.PutUint32(image[volumeIDOffset:], crc32.ChecksumIEEE(image))
+	}
+
+	return image, nil
+}
+
+// readTree reads the directory hierarchy below dir
+func readTree(fsys fs.FS, dir *node) error {
+	entries, err := fs.ReadDir(fsys, dir.path)
+	if err != nil {
+		return fmt.Errorf("could not read directory '%s': %w", dir.path, err)
+	}
+
+	names := make(map[[11]uint8]string)
+
+	for _, entry := range entries {
+		entryPath := path.Join(dir.path, entry.Name())
+
+		// Stat rather than using the entry's info, so that symbolic links are followed where the filesystem allows it
+		info, err := fs.Stat(fsys, entryPath)
+		if err != nil {
+			return fmt.Errorf("could not stat '%s': %w", entryPath, err)
+		}
+
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return fmt.Errorf("%w: '%s'", ErrUnsupportedFileType, entryPath)
+		}
+
+		name, err := ShortName(entry.Name())
+		if err != nil {
+			return fmt.Errorf("invalid name '%s': %w", entryPath, err)
+		}
+
+		if other, ok := names[name]; ok {
+			return fmt.Errorf("%w: '%s' and '%s'", ErrDuplicateName, other, entry.Name())
+		}
+		names[name] = entry.Name()
+
+		child := &node{path: entryPath, name: name, info: info, parent: dir}
+		dir.entries = append(dir.entries, child)
+
+		if info.IsDir() {
+			if err := readTree(fsys, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newLayout finds the smallest cluster size for which the files fit in a FAT16 filesystem, and works out the rest of
+// the geometry from that
+func newLayout(root *node) (*layout, error) {
+	// The root directory has a fixed size region of its own, and also holds the volume label
+	rootEntries := max(minRootEntries, (uint32(len(root.entries))+1+15)/16*16)
+	if rootEntries > 0xFFFF {
+		return nil, fmt.Errorf("%w: too many entries in root directory", ErrTooLarge)
+	}
+
+	for sectorsPerCluster := uint32(1); sectorsPerCluster <= maxSectorsPerCluster; sectorsPerCluster *= 2 {
+		l := &layout{sectorsPerCluster: sectorsPerCluster, rootEntries: rootEntries}
+
+		clusters := uint64(0)
+		for n := range walk(root) {
+			if n != root {
+				clusters += uint64((n.size() + l.clusterSize() - 1) / l.clusterSize())
+			}
+		}
+
+		// Leave room for at least one cluster, since an empty data region confuses some readers
+		clusters = max(clusters, 1)
+
+		if clusters > MaxFAT16Clusters {
+			continue
+		}
+
+		l.clusters = uint32(clusters)
+		l.fat16 = clusters > MaxFAT12Clusters
+
+		// Clusters 0 and 1 are reserved, but still have entries in the FAT
+		fatBytes := ((l.clusters+firstCluster)*3 + 1) / 2
+		if l.fat16 {
+			fatBytes = (l.clusters + firstCluster) * 2
+		}
+		l.fatSectors = (fatBytes + SectorSize - 1) / SectorSize
+
+		if uint64(l.totalSectors()) > 0xFFFFFFFF/SectorSize {
+			break
+		}
+
+		return l, nil
+	}
+
+	return nil, ErrTooLarge
+}
+
+// walk returns all nodes in the tree below root, including root itself, depth first
+func walk(root *node) func(yield func(*node) bool) {
+	return func(yield func(*node) bool) {
+		queue := []*node{root}
+		for len(queue) > 0 {
+			n := queue[0]
+			queue = queue[1:]
+
+			if !yield(n) {
+				return
+			}
+
+			queue = slices.Concat(n.entries, queue)
+		}
+	}
+}
+
+// allocate assigns a contiguous run of clusters to every node that has data
+func allocate(root *node, l *layout) {
+	next := uint32(firstCluster)
+
+	for n := range walk(root) {
+		if n == root || n.size() == 0 {
+			continue
+		}
+
+		n.cluster = next
+		n.clusters = uint32((n.size() + l.clusterSize() - 1) / l.clusterSize())
+		next += n.clusters
+	}
+}
+
+func writeBootSector(image []byte, l *layout, opts Options) error {
+	bs := &BootSector{
+		Jump:              [3]uint8{0xEB, 0x3C, 0x90},
+		BytesPerSector:    SectorSize,
+		SectorsPerCluster: uint8(l.sectorsPerCluster),
+		ReservedSectors:   reservedSectors,
+		FATCount:          fatCount,
+		RootEntries:       uint16(l.rootEntries),
+		Media:             MediaFixedDisk,
+		FATSectors:        uint16(l.fatSectors),
+		SectorsPerTrack:   sectorsPerTrack,
+		Heads:             heads,
+		DriveNumber:       0x80,
+		BootSignature:     bootSignature,
+		VolumeID:          opts.VolumeID,
+		Signature:         sectorSignature,
+	}
+
+	// Microsoft recommend this OEM name for compatibility, since some drivers check it
+	copy(bs.OEMName[:], "MSWIN4.1")
+	copy(bs.BootCode[:], bootCode)
+
+	label := volumeLabel(opts.Label)
+	copy(bs.VolumeLabel[:], label[:])
+
+	if l.fat16 {
+		copy(bs.FileSystemType[:], "FAT16   ")
+	} else {
+		copy(bs.FileSystemType[:], "FAT12   ")
+	}
+
+	if total := l.totalSectors(); total <= 0xFFFF {
+		bs.TotalSectors16 = uint16(total)
+	} else {
+		bs.TotalSectors32 = total
+	}
+
+	var buf bytes.Buffer
+	if err := struc.Pack(&buf, bs); err != nil {
+		return fmt.Errorf("could not pack boot sector: %w", err)
+	}
+
+	copy(image, buf.Bytes())
+	return nil
+}
+
+// writeFATs records the cluster chain of every node in each copy of the FAT
+func writeFATs(image []byte, root *node, l *layout) {
+	fat := image[reservedSectors*SectorSize : (reservedSectors+l.fatSectors)*SectorSize]
+
+	endOfChain := uint32(0xFFF)
+	if l.fat16 {
+		endOfChain = 0xFFFF
+	}
+
+	setFATEntry(fat, l, 0, endOfChain&^0xFF|MediaFixedDisk)
+	setFATEntry(fat, l, 1, endOfChain)
+
+	for n := range walk(root) {
+		for i := uint32(0); i < n.clusters; i++ {
+			next := n.cluster + i + 1
+			if i == n.clusters-1 {
+				next = endOfChain
+			}
+
+			setFATEntry(fat, l, n.cluster+i, next)
+		}
+	}
+
+	for i := uint32(1); i < fatCount; i++ {
+		copy(image[(reservedSectors+i*l.fatSectors)*SectorSize:], fat)
+	}
+}
+
+func setFATEntry(fat []byte, l *layout, cluster uint32, value uint32) {
+	if l.fat16 {
+		fat[cluster*2] = uint8(value)
+		fat[cluster*2+1] = uint8(value >> 8)
+		return
+	}
+
+	// FAT12 entries are 12 bits, so two entries share three bytes
+	offset := cluster * 3 / 2
+	if cluster%2 == 0 {
+		fat[offset] = uint8(value)
+		fat[offset+1] = fat[offset+1]&0xF0 | uint8(value>>8)&0x0F
+	} else {
+		fat[offset] = fat[offset]&0x0F | uint8(value<<4)
+		fat[offset+1] = uint8(value >> 4)
+	}
+}
+
+// writeTree writes the directories and file contents of every node
+func writeTree(image []byte, fsys fs.FS, root *node, l *layout, opts Options) error {
+	for n := range walk(root) {
+		switch {
+		case n == root:
+			label := newEntry(volumeLabel(opts.Label), AttributeVolumeLabel, root.info.ModTime(), 0, 0)
+			region := image[int64(l.dataSector()-l.rootSectors())*SectorSize : l.clusterOffset(firstCluster)]
+
+			if err := writeEntries(region, append([]DirectoryEntry{label}, entries(n)...)); err != nil {
+				return err
+			}
+
+		case n.isDir():
+			self := newEntry(dotName("."), AttributeDirectory, n.info.ModTime(), n.cluster, 0)
+
+			// A '..' entry referring to the root directory has cluster 0, since the root directory isn't in a cluster
+			parent := newEntry(dotName(".."), AttributeDirectory, n.parent.info.ModTime(), n.parent.cluster, 0)
+
+			region := image[l.clusterOffset(n.cluster):l.clusterOffset(n.cluster+n.clusters)]
+			if err := writeEntries(region, append([]DirectoryEntry{self, parent}, entries(n)...)); err != nil {
+				return err
+			}
+
+		case n.cluster != 0:
+			if err := writeFile(image[l.clusterOffset(n.cluster):], fsys, n); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// entries returns the directory entries for the contents of a directory
+func entries(dir *node) []DirectoryEntry {
+	result := make([]DirectoryEntry, 0, len(dir.entries))
+
+	for _, n := range dir.entries {
+		if n.isDir() {
+			result = append(result, newEntry(n.name, AttributeDirectory, n.info.ModTime(), n.cluster, 0))
+		} else {
+			result = append(result, newEntry(n.name, AttributeArchive, n.info.ModTime(), n.cluster, uint32(n.info.Size())))
+		}
+	}
+
+	return result
+}
+
+func writeEntries(region []byte, entries []DirectoryEntry) error {
+	var buf bytes.Buffer
+
+	for i := range entries {
+		if err := struc.Pack(&buf, &entries[i]); err != nil {
+			return fmt.Errorf("could not pack directory entry: %w", err)
+		}
+	}
+
+	copy(region, buf.Bytes())
+	return nil
+}
+
+func writeFile(region []byte, fsys fs.FS, n *node) error {
+	f, err := fsys.Open(n.path)
+	if err != nil {
+		return fmt.Errorf("could not open '%s': %w", n.path, err)
+	}
+	defer f.Close()
+
+	if _, err := io.ReadFull(f, region[:n.info.Size()]); err != nil {
+		return fmt.Errorf("could not read '%s': %w", n.path, err)
+	}
+
+	return nil
+}
+
+func newEntry(name [11]uint8, attributes uint8, modTime time.Time, cluster uint32, size uint32) DirectoryEntry {
+	date, clock := Timestamp(modTime)
+
+	return DirectoryEntry{
+		Name:         name,
+		Attributes:   attributes,
+		CreationTime: clock,
+		CreationDate: date,
+		AccessDate:   date,
+		WriteTime:    clock,
+		WriteDate:    date,
+		FirstCluster: uint16(cluster),
+		Size:         size,
+	}
+}
+
+// ShortName converts a file name to an 8.3 short name, padded with spaces as it is in a directory entry. Names are
+// converted to upper case, since short names are case-insensitive; names that don't otherwise fit the 8.3 format
+// result in [ErrInvalidName].
+func ShortName(name string) ([11]uint8, error) {
+	var short [11]uint8
+	for i := range short {
+		short[i] = ' '
+	}
+
+	base, ext := strings.ToUpper(name), ""
+	if i := strings.LastIndexByte(base, '.'); i >= 0 {
+		base, ext = base[:i], base[i+1:]
+	}
+
+	if len(base) == 0 || len(base) > 8 || len(ext) > 3 || !validShortName(base) || !validShortName(ext) {
+		return short, fmt.Errorf("%w: '%s'", ErrInvalidName, name)
+	}
+
+	copy(short[:8], base)
+	copy(short[8:], ext)
+
+	return short, nil
+}
+
+func validShortName(name string) bool {
+	for _, c := range []byte(name) {
+		if !('A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'()-@^_`{}~", c) >= 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// dotName is the name of a '.' or '..' entry, which isn't a valid short name
+func dotName(name string) [11]uint8 {
+	var short [11]uint8
+	copy(short[:], name+strings.Repeat(" ", len(short)-len(name)))
+	return short
+}
+
+// volumeLabel converts a label to upper case, and truncates or pads it to 11 characters
+func volumeLabel(label string) [11]uint8 {
+	if label == "" {
+		label = "NO NAME"
+	}
+
+	var result [11]uint8
+	copy(result[:], strings.ToUpper(label)+strings.Repeat(" ", len(result)))
+
+	return result
+}
+
+// Timestamp converts a time to a FAT date and time, which have a resolution of two seconds. Times outside of the range
+// that FAT can represent (1980 to 2107) are clamped to it.
+func Timestamp(t time.Time) (date uint16, clock uint16) {
+	switch {
+	case t.Year() < 1980:
+		return 1<<5 | 1, 0
+	case t.Year() > 2107:
+		return 127<<9 | 12<<5 | 31, 23<<11 | 59<<5 | 29
+	}
+
+	date = uint16(t.Year()-1980)<<9 | uint16(t.Month())<<5 | uint16(t.Day())
+	clock = uint16(t.Hour())<<11 | uint16(t.Minute())<<5 | uint16(t.Second()/2)
+
+	return date, clock
+}
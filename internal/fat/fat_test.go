@@ -0,0 +1,192 @@
+package fat_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660/internal/fat"
+	"github.com/lunixbochs/struc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fatReader is a minimal FAT12/FAT16 reader, which follows cluster chains rather than assuming that files are
+// contiguous
+type fatReader struct {
+	t     *testing.T
+	image []byte
+	boot  fat.BootSector
+}
+
+func newFATReader(t *testing.T, image []byte) *fatReader {
+	r := &fatReader{t: t, image: image}
+	require.NoError(t, struc.Unpack(bytes.NewReader(image), &r.boot), "Should be able to unpack boot sector")
+	return r
+}
+
+func (r *fatReader) fat16() bool {
+	return strings.TrimSpace(string(r.boot.FileSystemType[:])) == "FAT16"
+}
+
+func (r *fatReader) totalSectors() uint32 {
+	if r.boot.TotalSectors16 != 0 {
+		return uint32(r.boot.TotalSectors16)
+	}
+	return r.boot.TotalSectors32
+}
+
+func (r *fatReader) rootOffset() int {
+	return (int(r.boot.ReservedSectors) + int(r.boot.FATCount)*int(r.boot.FATSectors)) * fat.SectorSize
+}
+
+func (r *fatReader) dataOffset() int {
+	return r.rootOffset() + int(r.boot.RootEntries)*fat.DirectoryEntrySize
+}
+
+func (r *fatReader) clusterCount() int {
+	return (len(r.image) - r.dataOffset()) / (int(r.boot.SectorsPerCluster) * fat.SectorSize)
+}
+
+func (r *fatReader) next(cluster uint16) uint16 {
+	table := r.image[int(r.boot.ReservedSectors)*fat.SectorSize:]
+	if r.fat16() {
+		return binary.LittleEndian.Uint16(table[cluster*2:])
+	}
+
+	value := binary.LittleEndian.Uint16(table[cluster*3/2:])
+	if cluster%2 == 0 {
+		return value & 0xFFF
+	}
+	return value >> 4
+}
+
+func (r *fatReader) chain(first uint16) []byte {
+	var data []byte
+	clusterSize := int(r.boot.SectorsPerCluster) * fat.SectorSize
+
+	endOfChain := uint16(0xFF8)
+	if r.fat16() {
+		endOfChain = 0xFFF8
+	}
+
+	for cluster := first; cluster >= 2 && cluster < endOfChain; cluster = r.next(cluster) {
+		offset := r.dataOffset() + int(cluster-2)*clusterSize
+		require.LessOrEqual(r.t, offset+clusterSize, len(r.image), "Cluster %d should be inside the image", cluster)
+		data = append(data, r.image[offset:offset+clusterSize]...)
+	}
+
+	return data
+}
+
+func (r *fatReader) entries(data []byte) map[string]fat.DirectoryEntry {
+	entries := make(map[string]fat.DirectoryEntry)
+
+	for offset := 0; offset+fat.DirectoryEntrySize <= len(data) && data[offset] != 0; offset += fat.DirectoryEntrySize {
+		var entry fat.DirectoryEntry
+		require.NoError(r.t, struc.Unpack(bytes.NewReader(data[offset:]), &entry), "Should be able to unpack directory entry")
+		entries[string(entry.Name[:])] = entry
+	}
+
+	return entries
+}
+
+func (r *fatReader) root() map[string]fat.DirectoryEntry {
+	return r.entries(r.image[r.rootOffset():r.dataOffset()])
+}
+
+func (r *fatReader) file(entry fat.DirectoryEntry) []byte {
+	return r.chain(entry.FirstCluster)[:entry.Size]
+}
+
+func shortName(t *testing.T, name string) string {
+	short, err := fat.ShortName(name)
+	require.NoError(t, err, "'%s' should be a valid short name", name)
+	return string(short[:])
+}
+
+func TestBuild(t *testing.T) {
+	modTime := time.Date(2024, 6, 1, 12, 30, 10, 0, time.UTC)
+	bootloader := bytes.Repeat([]byte("EFI!"), 100000)
+
+	source := fstest.MapFS{
+		"EFI/BOOT/BOOTX64.EFI": {Data: bootloader, ModTime: modTime},
+		"EFI/BOOT/grub.cfg":    {Data: []byte("set timeout=5\n"), ModTime: modTime},
+		"EMPTY":                {ModTime: modTime},
+	}
+
+	image, err := fat.Build(source, fat.Options{Label: "EFISYS", VolumeID: 0x12345678})
+	require.NoError(t, err, "Build should not return an error")
+
+	r := newFATReader(t, image)
+	assert.EqualValues(t, 0xAA55, r.boot.Signature, "Boot sector should have a signature")
+	assert.EqualValues(t, fat.SectorSize, r.boot.BytesPerSector, "Sector size should be 512 bytes")
+	assert.EqualValues(t, 0x12345678, r.boot.VolumeID, "Volume ID should be recorded")
+	assert.Equal(t, "EFISYS     ", string(r.boot.VolumeLabel[:]), "Volume label should be padded with spaces")
+	assert.Equal(t, len(image), int(r.totalSectors())*fat.SectorSize, "Image should be as large as the BPB says")
+	assert.Equal(t, "FAT12   ", string(r.boot.FileSystemType[:]), "Small filesystems should be FAT12")
+	assert.LessOrEqual(t, r.clusterCount(), fat.MaxFAT12Clusters, "FAT12 filesystems should have few enough clusters to be recognised as FAT12")
+	assert.Equal(t, image[512:512+int(r.boot.FATSectors)*512], image[512+int(r.boot.FATSectors)*512:r.rootOffset()], "Both FATs should be identical")
+
+	root := r.root()
+	require.Contains(t, root, "EFISYS     ", "Root directory should contain the volume label")
+	assert.Equal(t, fat.AttributeVolumeLabel, root["EFISYS     "].Attributes, "Volume label entry should have the volume label attribute")
+	require.Contains(t, root, "EMPTY      ", "Root directory should contain empty file")
+	assert.Zero(t, root["EMPTY      "].FirstCluster, "Empty files should not be allocated clusters")
+
+	require.Contains(t, root, shortName(t, "EFI"), "Root directory should contain EFI directory")
+	efi := r.entries(r.chain(root[shortName(t, "EFI")].FirstCluster))
+	assert.Contains(t, efi, ".          ", "Subdirectory should have a self entry")
+	assert.Zero(t, efi["..         "].FirstCluster, "Parent entry of a directory in the root directory should refer to cluster 0")
+
+	require.Contains(t, efi, shortName(t, "BOOT"), "EFI directory should contain BOOT directory")
+	boot := r.entries(r.chain(efi[shortName(t, "BOOT")].FirstCluster))
+	assert.Equal(t, efi[".          "].FirstCluster, boot["..         "].FirstCluster, "Parent entry should refer to the parent directory")
+
+	require.Contains(t, boot, shortName(t, "BOOTX64.EFI"), "BOOT directory should contain boot loader")
+	assert.Equal(t, bootloader, r.file(boot[shortName(t, "BOOTX64.EFI")]), "Boot loader should have the correct contents")
+	require.Contains(t, boot, shortName(t, "GRUB.CFG"), "Lower case names should be converted to upper case")
+	assert.Equal(t, []byte("set timeout=5\n"), r.file(boot[shortName(t, "GRUB.CFG")]), "Config file should have the correct contents")
+
+	date, clock := fat.Timestamp(modTime)
+	assert.Equal(t, date, boot[shortName(t, "GRUB.CFG")].WriteDate, "Modification date should be recorded")
+	assert.Equal(t, clock, boot[shortName(t, "GRUB.CFG")].WriteTime, "Modification time should be recorded")
+}
+
+func TestBuild_FAT16(t *testing.T) {
+	image, err := fat.Build(fstest.MapFS{"BIG.BIN": {Data: bytes.Repeat([]byte{0xAB}, 3*1024*1024)}}, fat.Options{})
+	require.NoError(t, err, "Build should not return an error")
+
+	r := newFATReader(t, image)
+	assert.Equal(t, "FAT16   ", string(r.boot.FileSystemType[:]), "Filesystems with many clusters should be FAT16")
+	assert.Greater(t, r.clusterCount(), fat.MaxFAT12Clusters, "FAT16 filesystems should have too many clusters to be FAT12")
+	assert.Equal(t, "NO NAME    ", string(r.boot.VolumeLabel[:]), "Default volume label should be used")
+	assert.NotZero(t, r.boot.VolumeID, "Volume ID should be derived from the contents if not given")
+	assert.Equal(t, bytes.Repeat([]byte{0xAB}, 3*1024*1024), r.file(r.root()[shortName(t, "BIG.BIN")]), "Large file should have the correct contents")
+}
+
+func TestBuild_InvalidNames(t *testing.T) {
+	_, err := fat.Build(fstest.MapFS{"a-very-long-name.efi": {}}, fat.Options{})
+	assert.ErrorIs(t, err, fat.ErrInvalidName, "Build should reject names longer than 8.3")
+
+	_, err = fat.Build(fstest.MapFS{"file.text": {}}, fat.Options{})
+	assert.ErrorIs(t, err, fat.ErrInvalidName, "Build should reject extensions longer than 3 characters")
+
+	_, err = fat.Build(fstest.MapFS{"a b": {}}, fat.Options{})
+	assert.ErrorIs(t, err, fat.ErrInvalidName, "Build should reject names with invalid characters")
+
+	_, err = fat.Build(fstest.MapFS{"boot.efi": {}, "BOOT.EFI": {}}, fat.Options{})
+	assert.ErrorIs(t, err, fat.ErrDuplicateName, "Build should reject names that differ only in case")
+}
+
+func TestTimestamp(t *testing.T) {
+	date, clock := fat.Timestamp(time.Date(2024, 6, 1, 12, 30, 11, 0, time.UTC))
+	assert.EqualValues(t, 44<<9|6<<5|1, date, "Date should be encoded relative to 1980")
+	assert.EqualValues(t, 12<<11|30<<5|5, clock, "Time should be encoded with two second resolution")
+
+	date, clock = fat.Timestamp(time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.EqualValues(t, 1<<5|1, date, "Dates before 1980 should be clamped")
+	assert.Zero(t, clock, "Times before 1980 should be clamped")
+}
@@ -0,0 +1,117 @@
+package partition
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/lunixbochs/struc"
+	"io"
+)
+
+const (
+	// APMBlockSize is the block size of an Apple partition map in a hybrid image. Partition locations and sizes are
+	// measured in blocks of this size, which is the same as the logical block size of the image, as is done by
+	// xorriso.
+	APMBlockSize = 2048
+
+	// DriverDescriptorSize is the number of bytes at the start of the disk occupied by the driver descriptor map that
+	// precedes an Apple partition map, as far as is needed to describe a disk without drivers. Boot code in an MBR
+	// must tolerate these bytes being overwritten, as isohybrid-style boot code does.
+	DriverDescriptorSize = 32
+
+	apmEntrySize = 512
+)
+
+// Apple partition map partition types. APMTypeData is a generic type for partitions whose contents a Mac needn't
+// understand.
+const (
+	APMTypePartitionMap = "Apple_partition_map"
+	APMTypeData         = "Apple_UNIX_SVR2"
+)
+
+// APMStatusData is the status of a valid, allocated, readable and writable partition
+const APMStatusData = 0x33
+
+// APMEntry is an entry in an Apple partition map, each of which occupies the start of its own block
+type APMEntry struct {
+	Signature  [2]uint8
+	Reserved   uint16
+	MapBlocks  uint32 // Number of entries in the map, i.e. the number of blocks it occupies
+	FirstBlock uint32
+	Blocks     uint32
+	Name       [32]uint8
+	Type       [32]uint8
+	DataStart  uint32 // First block of the data in the partition, relative to FirstBlock
+	DataBlocks uint32
+	Status     uint32
+	Unused     [420]uint8
+}
+
+// APM is an Apple partition map for a disk of a particular size. The first entry of the map always describes the map
+// itself, and is added automatically.
+type APM struct {
+	Entries []APMEntry
+
+	// Blocks is the size of the whole disk in blocks of [APMBlockSize] bytes
+	Blocks uint32
+}
+
+// NewAPM creates an empty Apple partition map for a disk of the given number of blocks
+func NewAPM(blocks uint32) *APM {
+	return &APM{Blocks: blocks}
+}
+
+// Add adds a partition with the given name and type (e.g. [APMTypeData]), truncating them if they don't fit
+func (a *APM) Add(name string, partitionType string, firstBlock uint32, blocks uint32) {
+	a.Entries = append(a.Entries, newAPMEntry(name, partitionType, firstBlock, blocks))
+}
+
+// MapBlocks returns the number of blocks occupied by the map, including the entry for the map itself
+func (a *APM) MapBlocks() uint32 {
+	return uint32(len(a.Entries)) + 1
+}
+
+// DriverDescriptorMap returns the driver descriptor map, which should be written at the start of the disk, over the
+// first [DriverDescriptorSize] bytes of the MBR
+func (a *APM) DriverDescriptorMap() []byte {
+	ddm := make([]byte, DriverDescriptorSize)
+	copy(ddm, "ER")
+	binary.BigEndian.PutUint16(ddm[2:4], APMBlockSize)
+	binary.BigEndian.PutUint32(ddm[4:8], a.Blocks)
+
+	return ddm
+}
+
+// Map returns the entries of the map, each padded to a whole block, which should be written at the second block of
+// the disk
+func (a *APM) Map() (io.WriterTo, error) {
+	entries := append([]APMEntry{newAPMEntry(APMTypePartitionMap, APMTypePartitionMap, 1, a.MapBlocks())}, a.Entries...)
+
+	var buff bytes.Buffer
+	for _, entry := range entries {
+		entry.MapBlocks = a.MapBlocks()
+		if err := struc.Pack(&buff, &entry); err != nil {
+			return nil, fmt.Errorf("could not pack APM entry: %w", err)
+		}
+
+		buff.Write(make([]byte, APMBlockSize-apmEntrySize))
+	}
+
+	return bytes.NewReader(buff.Bytes()), nil
+}
+
+func newAPMEntry(name string, partitionType string, firstBlock uint32, blocks uint32) APMEntry {
+	entry := APMEntry{
+		Signature:  [2]uint8{'P', 'M'},
+		FirstBlock: firstBlock,
+		Blocks:     blocks,
+		DataBlocks: blocks,
+		Status:     APMStatusData,
+	}
+
+	// Names and types are null-terminated
+	copy(entry.Name[:len(entry.Name)-1], name)
+	copy(entry.Type[:len(entry.Type)-1], partitionType)
+
+	return entry
+}
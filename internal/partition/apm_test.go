@@ -0,0 +1,46 @@
+package partition_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestAPM(t *testing.T) {
+	apm := partition.NewAPM(1000)
+	apm.Add("EFI", partition.APMTypeData, 500, 20)
+	assert.EqualValues(t, 2, apm.MapBlocks(), "Map should occupy a block for itself and one for the partition")
+
+	ddm := apm.DriverDescriptorMap()
+	require.Len(t, ddm, partition.DriverDescriptorSize, "Driver descriptor map should fit in the space reserved for it")
+	assert.Equal(t, []byte{'E', 'R', 0x08, 0x00, 0, 0, 0x03, 0xE8}, ddm[0:8], "Driver descriptor map should record the block size and count")
+
+	m, err := apm.Map()
+	require.NoError(t, err, "Map should not return an error")
+	var buff bytes.Buffer
+	_, err = m.WriteTo(&buff)
+	require.NoError(t, err, "Should be able to write map")
+	require.Equal(t, 2*partition.APMBlockSize, buff.Len(), "Each entry should occupy a whole block")
+
+	self := buff.Bytes()[:512]
+	entry := buff.Bytes()[partition.APMBlockSize : partition.APMBlockSize+512]
+
+	for name, e := range map[string][]byte{"map": self, "partition": entry} {
+		assert.Equal(t, "PM", string(e[0:2]), "%s entry should have the signature", name)
+		assert.EqualValues(t, 2, binary.BigEndian.Uint32(e[4:8]), "%s entry should record the size of the map", name)
+		assert.EqualValues(t, partition.APMStatusData, binary.BigEndian.Uint32(e[88:92]), "%s entry should be valid and allocated", name)
+	}
+
+	assert.Equal(t, partition.APMTypePartitionMap, string(bytes.TrimRight(self[48:80], "\x00")), "First entry should describe the map")
+	assert.EqualValues(t, 1, binary.BigEndian.Uint32(self[8:12]), "Map should start at the second block")
+	assert.EqualValues(t, 2, binary.BigEndian.Uint32(self[12:16]), "Map entry should cover the whole map")
+
+	assert.Equal(t, "EFI", string(bytes.TrimRight(entry[16:48], "\x00")), "Partition should have its name")
+	assert.Equal(t, partition.APMTypeData, string(bytes.TrimRight(entry[48:80], "\x00")), "Partition should have its type")
+	assert.EqualValues(t, 500, binary.BigEndian.Uint32(entry[8:12]), "Partition should have its first block")
+	assert.EqualValues(t, 20, binary.BigEndian.Uint32(entry[12:16]), "Partition should have its size")
+	assert.EqualValues(t, 20, binary.BigEndian.Uint32(entry[84:88]), "Partition data should cover the whole partition")
+}
@@ -0,0 +1,272 @@
+package partition
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/lunixbochs/struc"
+	"hash/crc32"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// EntryCount is the number of entries in a GPT partition entry array. The UEFI spec requires space for at least
+	// 128 entries, which is what almost every implementation uses.
+	EntryCount = 128
+
+	// EntrySize is the size of a GPT partition entry
+	EntrySize = 128
+
+	// EntryArraySectors is the number of sectors occupied by a partition entry array
+	EntryArraySectors = EntryCount * EntrySize / SectorSize
+
+	// DefaultEntryLBA is the usual location of the primary partition entry array, straight after the primary GPT
+	// header
+	DefaultEntryLBA = 2
+
+	// BackupSectors is the number of sectors at the end of a disk occupied by the backup partition entry array and
+	// backup GPT header
+	BackupSectors = EntryArraySectors + 1
+
+	gptHeaderSize = 92
+	gptRevision   = 0x00010000
+
+	// maxNameLength is the length, in UTF-16 code units, of a partition name
+	maxNameLength = 36
+)
+
+// TypeProtective is the MBR partition type of the single partition in a protective MBR, which covers the whole disk so
+// that software that doesn't understand GPT doesn't think the disk is empty
+const TypeProtective uint8 = 0xEE
+
+// ErrInvalidGUID indicates that a GUID could not be parsed
+var ErrInvalidGUID = errors.New("invalid GUID")
+
+// GUID is a globally unique identifier, stored in the mixed-endian form used by GPT: the first three groups are little
+// endian, and the last two are big endian
+type GUID [16]uint8
+
+// Partition type GUIDs
+var (
+	TypeGUIDEFISystem = MustParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	TypeGUIDBasicData = MustParseGUID("EBD0A0A2-B9E5-4433-87C0-68B6B72699C7")
+)
+
+// ParseGUID parses a GUID in its usual textual form, e.g. C12A7328-F81F-11D2-BA4B-00A0C93EC93B
+func ParseGUID(s string) (GUID, error) {
+	var g GUID
+
+	groups := strings.Split(s, "-")
+	if len(groups) != 5 || len(groups[0]) != 8 || len(groups[1]) != 4 || len(groups[2]) != 4 || len(groups[3]) != 4 || len(groups[4]) != 12 {
+		return g, fmt.Errorf("%w: '%s'", ErrInvalidGUID, s)
+	}
+
+	b, err := hex.DecodeString(strings.Join(groups, ""))
+	if err != nil {
+		return g, fmt.Errorf("%w: '%s': %w", ErrInvalidGUID, s, err)
+	}
+
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(b[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(b[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(b[6:8]))
+	copy(g[8:], b[8:])
+
+	return g, nil
+}
+
+// MustParseGUID is like [ParseGUID], but panics if the GUID can't be parsed. It is intended for constants.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return g
+}
+
+// NewRandomGUID creates a random (version 4) GUID
+func NewRandomGUID() (GUID, error) {
+	var g GUID
+	if _, err := rand.Read(g[:]); err != nil {
+		return g, fmt.Errorf("could not generate GUID: %w", err)
+	}
+
+	// The version is in the high bits of the third group, which is little endian
+	g[7] = g[7]&0x0F | 0x40
+	g[8] = g[8]&0x3F | 0x80
+
+	return g, nil
+}
+
+func (g GUID) String() string {
+	return fmt.Sprintf(
+		"%08X-%04X-%04X-%X-%X",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		g[8:10],
+		g[10:16],
+	)
+}
+
+// GPTEntry is an entry in a GPT partition entry array
+type GPTEntry struct {
+	Type       GUID
+	Unique     GUID
+	FirstLBA   uint64                `struc:"little"`
+	LastLBA    uint64                `struc:"little"` // Inclusive
+	Attributes uint64                `struc:"little"`
+	Name       [maxNameLength]uint16 `struc:"little"`
+}
+
+// SetName sets the name of the partition, truncating it if it doesn't fit
+func (e *GPTEntry) SetName(name string) {
+	e.Name = [maxNameLength]uint16{}
+	copy(e.Name[:], utf16.Encode([]rune(name)))
+}
+
+// GPTHeader is the header of a GUID partition table
+type GPTHeader struct {
+	Signature            [8]uint8
+	Revision             uint32 `struc:"little"`
+	HeaderSize           uint32 `struc:"little"`
+	HeaderCRC32          uint32 `struc:"little"`
+	Reserved             uint32 `struc:"little"`
+	MyLBA                uint64 `struc:"little"`
+	AlternateLBA         uint64 `struc:"little"`
+	FirstUsableLBA       uint64 `struc:"little"`
+	LastUsableLBA        uint64 `struc:"little"`
+	DiskGUID             GUID
+	PartitionEntryLBA    uint64 `struc:"little"`
+	NumberOfEntries      uint32 `struc:"little"`
+	SizeOfPartitionEntry uint32 `struc:"little"`
+	EntryArrayCRC32      uint32 `struc:"little"`
+}
+
+// GPT is a GUID partition table for a disk of a particular size. The primary and backup copies of the table are
+// written separately, since they are at opposite ends of the disk.
+type GPT struct {
+	DiskGUID GUID
+	Entries  []GPTEntry
+
+	// EntryLBA is the location of the primary partition entry array. It can be moved further from the primary header
+	// to make room for other structures, such as an Apple partition map.
+	EntryLBA uint64
+
+	// Sectors is the size of the whole disk in sectors
+	Sectors uint64
+}
+
+// NewGPT creates an empty GPT for a disk of the given number of sectors
+func NewGPT(diskGUID GUID, sectors uint64) *GPT {
+	return &GPT{DiskGUID: diskGUID, Sectors: sectors, EntryLBA: DefaultEntryLBA}
+}
+
+// FirstUsableLBA returns the first sector that can be used by a partition, after the protective MBR, the primary GPT
+// header, and the primary partition entry array
+func (g *GPT) FirstUsableLBA() uint64 {
+	return g.EntryLBA + EntryArraySectors
+}
+
+// LastUsableLBA returns the last sector that can be used by a partition, before the backup partition entry array
+func (g *GPT) LastUsableLBA() uint64 {
+	return g.Sectors - BackupSectors - 1
+}
+
+// ProtectiveMBR sets up the partition table of an MBR as a protective MBR, which covers the whole disk apart from the
+// MBR itself with a single partition. Any boot code in the MBR is left unchanged.
+func (g *GPT) ProtectiveMBR(mbr *MBR) {
+	sectors := uint32(0xFFFFFFFF)
+	if g.Sectors-1 < uint64(sectors) {
+		sectors = uint32(g.Sectors - 1)
+	}
+
+	mbr.Partitions = [4]Entry{NewEntry(0, TypeProtective, 1, sectors)}
+}
+
+// Primary returns the primary GPT header followed by the primary partition entry array, which should be written at
+// the second sector of the disk, i.e. straight after the MBR. If [GPT.EntryLBA] isn't straight after the header, the
+// gap between them is not included, and the entry array should be written separately at [GPT.EntryLBA].
+func (g *GPT) Primary() (header io.WriterTo, entries io.WriterTo, err error) {
+	entryArray, err := g.entryArray()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headerData, err := g.header(1, g.Sectors-1, g.EntryLBA, entryArray)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return bytes.NewReader(headerData), bytes.NewReader(entryArray), nil
+}
+
+// Backup returns the backup partition entry array followed by the backup GPT header, which should be written so that
+// it ends at the end of the disk, i.e. at sector [GPT.Sectors] - [BackupSectors]
+func (g *GPT) Backup() (io.WriterTo, error) {
+	entries, err := g.entryArray()
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := g.header(g.Sectors-1, 1, g.Sectors-BackupSectors, entries)
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(append(entries, header...)), nil
+}
+
+func (g *GPT) entryArray() ([]byte, error) {
+	if len(g.Entries) > EntryCount {
+		return nil, fmt.Errorf("GPT has %d partitions, but at most %d are supported", len(g.Entries), EntryCount)
+	}
+
+	var buff bytes.Buffer
+	for _, entry := range g.Entries {
+		if err := struc.Pack(&buff, &entry); err != nil {
+			return nil, fmt.Errorf("could not pack GPT entry: %w", err)
+		}
+	}
+
+	buff.Write(make([]byte, EntryCount*EntrySize-buff.Len()))
+	return buff.Bytes(), nil
+}
+
+// header returns a whole sector containing a GPT header
+func (g *GPT) header(myLBA, alternateLBA, entriesLBA uint64, entries []byte) ([]byte, error) {
+	header := &GPTHeader{
+		Signature:            [8]uint8{'E', 'F', 'I', ' ', 'P', 'A', 'R', 'T'},
+		Revision:             gptRevision,
+		HeaderSize:           gptHeaderSize,
+		MyLBA:                myLBA,
+		AlternateLBA:         alternateLBA,
+		FirstUsableLBA:       g.FirstUsableLBA(),
+		LastUsableLBA:        g.LastUsableLBA(),
+		DiskGUID:             g.DiskGUID,
+		PartitionEntryLBA:    entriesLBA,
+		NumberOfEntries:      EntryCount,
+		SizeOfPartitionEntry: EntrySize,
+		EntryArrayCRC32:      crc32.ChecksumIEEE(entries),
+	}
+
+	// The header CRC is calculated with the CRC field itself set to zero
+	var buff bytes.Buffer
+	if err := struc.Pack(&buff, header); err != nil {
+		return nil, fmt.Errorf("could not pack GPT header: %w", err)
+	}
+
+	header.HeaderCRC32 = crc32.ChecksumIEEE(buff.Bytes())
+	buff.Reset()
+	if err := struc.Pack(&buff, header); err != nil {
+		return nil, fmt.Errorf("could not pack GPT header: %w", err)
+	}
+
+	buff.Write(make([]byte, SectorSize-buff.Len()))
+	return buff.Bytes(), nil
+}
@@ -0,0 +1,84 @@
+package partition_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"hash/crc32"
+	"testing"
+)
+
+func TestParseGUID(t *testing.T) {
+	guid, err := partition.ParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	require.NoError(t, err, "ParseGUID should not return an error for a valid GUID")
+	assert.Equal(t, partition.GUID{0x28, 0x73, 0x2A, 0xC1, 0x1F, 0xF8, 0xD2, 0x11, 0xBA, 0x4B, 0x00, 0xA0, 0xC9, 0x3E, 0xC9, 0x3B}, guid, "GUID should be stored in mixed-endian form")
+	assert.Equal(t, "C12A7328-F81F-11D2-BA4B-00A0C93EC93B", guid.String(), "GUID should format in its usual textual form")
+
+	for _, invalid := range []string{"", "C12A7328F81F11D2BA4B00A0C93EC93B", "G12A7328-F81F-11D2-BA4B-00A0C93EC93B"} {
+		_, err := partition.ParseGUID(invalid)
+		assert.ErrorIs(t, err, partition.ErrInvalidGUID, "ParseGUID should reject '%s'", invalid)
+	}
+}
+
+func TestGPT(t *testing.T) {
+	const sectors = 10000
+
+	gpt := partition.NewGPT(partition.MustParseGUID("01234567-89AB-CDEF-0123-456789ABCDEF"), sectors)
+	entry := partition.GPTEntry{Type: partition.TypeGUIDEFISystem, FirstLBA: 100, LastLBA: 199}
+	entry.SetName("EFI")
+	gpt.Entries = append(gpt.Entries, entry)
+
+	primaryHeader, primaryEntries, err := gpt.Primary()
+	require.NoError(t, err, "Primary should not return an error")
+	var primaryData bytes.Buffer
+	_, err = primaryHeader.WriteTo(&primaryData)
+	require.NoError(t, err, "Should be able to write primary GPT header")
+	_, err = primaryEntries.WriteTo(&primaryData)
+	require.NoError(t, err, "Should be able to write primary GPT entry array")
+
+	backup, err := gpt.Backup()
+	require.NoError(t, err, "Backup should not return an error")
+	var backupData bytes.Buffer
+	_, err = backup.WriteTo(&backupData)
+	require.NoError(t, err, "Should be able to write backup GPT")
+
+	require.Equal(t, partition.BackupSectors*partition.SectorSize, primaryData.Len(), "Primary GPT should be a header sector and the entry array")
+	require.Equal(t, partition.BackupSectors*partition.SectorSize, backupData.Len(), "Backup GPT should be the entry array and a header sector")
+
+	headers := map[string][]byte{
+		"primary": primaryData.Bytes()[:partition.SectorSize],
+		"backup":  backupData.Bytes()[partition.EntryArraySectors*partition.SectorSize:],
+	}
+	entries := primaryData.Bytes()[partition.SectorSize:]
+	assert.Equal(t, entries, backupData.Bytes()[:partition.EntryArraySectors*partition.SectorSize], "Primary and backup entry arrays should be identical")
+
+	for name, header := range headers {
+		assert.Equal(t, "EFI PART", string(header[0:8]), "%s header should have the GPT signature", name)
+
+		headerCopy := bytes.Clone(header[:92])
+		binary.LittleEndian.PutUint32(headerCopy[16:20], 0)
+		assert.Equal(t, crc32.ChecksumIEEE(headerCopy), binary.LittleEndian.Uint32(header[16:20]), "%s header CRC should be valid", name)
+		assert.Equal(t, crc32.ChecksumIEEE(entries), binary.LittleEndian.Uint32(header[88:92]), "%s entry array CRC should be valid", name)
+		assert.EqualValues(t, sectors-partition.BackupSectors-1, binary.LittleEndian.Uint64(header[48:56]), "%s last usable LBA should be before the backup GPT", name)
+	}
+
+	assert.EqualValues(t, 1, binary.LittleEndian.Uint64(headers["primary"][24:32]), "Primary header should be at LBA 1")
+	assert.EqualValues(t, 2, binary.LittleEndian.Uint64(headers["primary"][72:80]), "Primary entry array should follow primary header by default")
+	assert.EqualValues(t, 2+partition.EntryArraySectors, binary.LittleEndian.Uint64(headers["primary"][40:48]), "First usable LBA should follow primary entry array")
+	assert.EqualValues(t, sectors-1, binary.LittleEndian.Uint64(headers["primary"][32:40]), "Primary header should refer to backup header")
+	assert.EqualValues(t, sectors-1, binary.LittleEndian.Uint64(headers["backup"][24:32]), "Backup header should be at the last LBA")
+	assert.EqualValues(t, sectors-partition.BackupSectors, binary.LittleEndian.Uint64(headers["backup"][72:80]), "Backup entry array should precede backup header")
+
+	assert.Equal(t, partition.TypeGUIDEFISystem[:], entries[0:16], "Entry should have its type GUID")
+	assert.EqualValues(t, 100, binary.LittleEndian.Uint64(entries[32:40]), "Entry should have its first LBA")
+	assert.EqualValues(t, 199, binary.LittleEndian.Uint64(entries[40:48]), "Entry should have its last LBA")
+	assert.Equal(t, []byte{'E', 0, 'F', 0, 'I', 0, 0, 0}, entries[56:64], "Entry name should be UTF-16LE")
+
+	mbr, err := partition.NewMBR(nil, 0)
+	require.NoError(t, err, "NewMBR should not return an error")
+	gpt.ProtectiveMBR(mbr)
+	assert.Equal(t, partition.TypeProtective, mbr.Partitions[0].Type, "Protective MBR should have a protective partition")
+	assert.EqualValues(t, sectors-1, mbr.Partitions[0].Sectors, "Protective partition should cover the disk after the MBR")
+}
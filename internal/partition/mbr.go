@@ -0,0 +1,116 @@
+package partition
+
+import (
+	"fmt"
+	"github.com/itchio/headway/counter"
+	"github.com/lunixbochs/struc"
+	"io"
+)
+
+const (
+	// SectorSize is the size of a sector as seen by the BIOS and by partition tables, which is what partition
+	// locations and sizes are measured in. This is distinct from the 2048-byte sectors of the image.
+	SectorSize = 512
+
+	// BootCodeSize is the size of the boot code area at the start of an MBR. Strictly, the boot code area is 440
+	// bytes, but isohybrid-style boot code (e.g. syslinux's isohdpfx.bin) uses the last 8 bytes for the location of the
+	// boot loader, so only 432 bytes are boot code.
+	BootCodeSize = 432
+
+	// Heads and SectorsPerTrack are the disk geometry assumed when calculating CHS addresses. These are the values
+	// used by isohybrid, which are widely accepted by BIOSes booting from USB storage.
+	Heads           = 64
+	SectorsPerTrack = 32
+
+	mbrSignature = 0xAA55
+)
+
+// Partition types used for hybrid images
+const (
+	TypeEmpty     uint8 = 0x00
+	TypeISO9660   uint8 = 0x17
+	TypeEFISystem uint8 = 0xEF
+)
+
+// StatusBootable marks a partition as active, i.e. the partition that legacy boot code should boot from
+const StatusBootable = 0x80
+
+// CHS is a cylinder-head-sector address, packed as it is in a partition entry
+type CHS [3]uint8
+
+// NewCHS converts a logical block address to a CHS address, using the geometry given by [Heads] and
+// [SectorsPerTrack]. Addresses beyond the range of CHS addressing saturate at the maximum address, as is conventional.
+func NewCHS(lba uint32) CHS {
+	cylinder := lba / (Heads * SectorsPerTrack)
+	head := (lba / SectorsPerTrack) % Heads
+	sector := lba%SectorsPerTrack + 1
+
+	if cylinder > 1023 {
+		cylinder, head, sector = 1023, Heads-1, SectorsPerTrack
+	}
+
+	return CHS{uint8(head), uint8(sector) | uint8((cylinder>>8)<<6), uint8(cylinder)}
+}
+
+// Entry is an entry in the partition table of an MBR
+type Entry struct {
+	Status      uint8
+	FirstSector CHS
+	Type        uint8
+	LastSector  CHS
+	FirstLBA    uint32 `struc:"little"`
+	Sectors     uint32 `struc:"little"`
+}
+
+// NewEntry creates a partition entry for the given range of sectors
+func NewEntry(status uint8, partitionType uint8, firstLBA uint32, sectors uint32) Entry {
+	return Entry{
+		Status:      status,
+		FirstSector: NewCHS(firstLBA),
+		Type:        partitionType,
+		LastSector:  NewCHS(firstLBA + sectors - 1),
+		FirstLBA:    firstLBA,
+		Sectors:     sectors,
+	}
+}
+
+// MBR is a master boot record, which occupies the first sector of a disk. In an ISO 9660 image, this is the first 512
+// bytes of the system area.
+//
+// MBR implements [io.WriterTo] for serialization
+type MBR struct {
+	BootCode [BootCodeSize]uint8
+
+	// BootLoaderLBA is the location, in 512-byte sectors, of the boot loader that isohybrid-style boot code loads. It
+	// isn't used by any other boot code.
+	BootLoaderLBA uint64 `struc:"little"`
+
+	DiskSignature uint32 `struc:"little"`
+	Reserved      uint16
+	Partitions    [4]Entry
+	Signature     uint16 `struc:"little"`
+}
+
+var _ io.WriterTo = &MBR{}
+
+// NewMBR creates an MBR with the given boot code, which must be no longer than [BootCodeSize] bytes
+func NewMBR(bootCode []byte, diskSignature uint32) (*MBR, error) {
+	if len(bootCode) > BootCodeSize {
+		return nil, fmt.Errorf("boot code is %d bytes, but must be at most %d bytes", len(bootCode), BootCodeSize)
+	}
+
+	mbr := &MBR{DiskSignature: diskSignature, Signature: mbrSignature}
+	copy(mbr.BootCode[:], bootCode)
+
+	return mbr, nil
+}
+
+func (m *MBR) WriteTo(w io.Writer) (int64, error) {
+	cw := counter.NewWriter(w)
+
+	if err := struc.Pack(cw, m); err != nil {
+		return cw.Count(), fmt.Errorf("could not pack MBR: %w", err)
+	}
+
+	return cw.Count(), nil
+}
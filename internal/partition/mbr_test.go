@@ -0,0 +1,51 @@
+package partition_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestNewCHS(t *testing.T) {
+	cases := []struct {
+		lba      uint32
+		expected partition.CHS
+	}{
+		{0, partition.CHS{0, 1, 0}},
+		{31, partition.CHS{0, 32, 0}},
+		{32, partition.CHS{1, 1, 0}},
+		{2048, partition.CHS{0, 1, 1}},
+		// Cylinder 300 needs the high bits of the sector byte
+		{300 * 2048, partition.CHS{0, 1 | 1<<6, 300 & 0xFF}},
+		// Beyond cylinder 1023, addresses saturate
+		{1024 * 2048, partition.CHS{63, 32 | 3<<6, 0xFF}},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, partition.NewCHS(c.lba), "CHS address of LBA %d should be correct", c.lba)
+	}
+}
+
+func TestMBR_WriteTo(t *testing.T) {
+	mbr, err := partition.NewMBR([]byte{0xFA, 0xEB}, 0x12345678)
+	require.NoError(t, err, "NewMBR should not return an error for short boot code")
+	mbr.Partitions[0] = partition.NewEntry(partition.StatusBootable, partition.TypeISO9660, 0, 400)
+	mbr.BootLoaderLBA = 100
+
+	var buff bytes.Buffer
+	written, err := mbr.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error")
+	require.EqualValues(t, partition.SectorSize, written, "MBR should be exactly one sector")
+
+	data := buff.Bytes()
+	assert.Equal(t, []byte{0xFA, 0xEB}, data[0:2], "Boot code should be at the start of the MBR")
+	assert.Equal(t, []byte{100, 0, 0, 0}, data[432:436], "Boot loader location should be little endian")
+	assert.Equal(t, []byte{0x78, 0x56, 0x34, 0x12}, data[440:444], "Disk signature should be little endian")
+	assert.Equal(t, []byte{0x80, 0, 1, 0, 0x17, 12, 16, 0, 0, 0, 0, 0, 0x90, 1, 0, 0}, data[446:462], "First partition entry should be encoded correctly")
+	assert.Equal(t, []byte{0x55, 0xAA}, data[510:512], "MBR should end with the boot signature")
+
+	_, err = partition.NewMBR(make([]byte, 433), 0)
+	assert.Error(t, err, "NewMBR should reject boot code that overlaps the partition table")
+}
@@ -0,0 +1,281 @@
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/lunixbochs/struc"
+	"io"
+	"strings"
+)
+
+const (
+	logicalBlockSize = 2048
+
+	// firstDescriptorBlock is the block at which the volume descriptor set starts, after the system area
+	firstDescriptorBlock = 16
+
+	// rootRecordOffset and rootRecordLength locate the root directory record in a primary or supplementary volume
+	// descriptor (ECMA-119 5th ed. §9.4.18)
+	rootRecordOffset = 156
+	rootRecordLength = 34
+
+	// maxDescriptors limits how far we'll search for a terminator, so that garbage input can't make us read forever
+	maxDescriptors = 64
+
+	// maxStructureSize limits the size of a directory or path table that we'll read into memory. Their sizes are
+	// recorded in the image, so garbage input could otherwise make us allocate up to 4 GiB for each one.
+	maxStructureSize = 64 << 20
+)
+
+var (
+	// ErrNotISO9660 indicates that the volume descriptor set could not be found or is not valid
+	ErrNotISO9660 = errors.New("not an ISO 9660 image")
+	// ErrNoPrimaryVolumeDescriptor indicates that the volume descriptor set contains no primary volume descriptor
+	ErrNoPrimaryVolumeDescriptor = errors.New("image has no primary volume descriptor")
+	// ErrInvalidRecord indicates that a directory record is malformed
+	ErrInvalidRecord = errors.New("invalid directory record")
+	// ErrStructureTooLarge indicates that a directory or path table is larger than we're willing to read
+	ErrStructureTooLarge = errors.New("directory or path table too large")
+)
+
+// Descriptor is a volume descriptor, as read from an image
+type Descriptor struct {
+	// Block is the logical block at which the descriptor was found
+	Block  uint32
+	Header spec.VolumeDescriptor
+
+	// Data is the whole logical block containing the descriptor, including the header
+	Data []byte
+}
+
+// Image reads the structures of an ISO 9660 image. It does not cache anything beyond the volume descriptor set, so
+// every method reads from the underlying [io.ReaderAt].
+type Image struct {
+	r io.ReaderAt
+
+	// Descriptors is the volume descriptor set, in the order it appears in the image, including the terminator
+	Descriptors []Descriptor
+
+	// Primary is the first primary volume descriptor in the volume descriptor set
+	Primary *spec.PrimaryVolumeDescriptor
+
+	// suspSkip is the number of bytes to skip at the start of each system use field, if the image uses the System Use
+	// Sharing Protocol. hasSUSP is determined lazily when the root directory is first read.
+	suspSkip    int
+	suspChecked bool
+	hasSUSP     bool
+}
+
+// Open reads the volume descriptor set of an image
+func Open(r io.ReaderAt) (*Image, error) {
+	return OpenAt(r, 0)
+}
+
+// OpenAt reads the volume descriptor set of a session that starts at the given block, e.g. the last session of a
+// multi-session image. Block numbers in the session are relative to the start of the image, not the session.
+func OpenAt(r io.ReaderAt, sessionStart uint32) (*Image, error) {
+	img := &Image{r: r}
+
+	for i := uint32(0); i < maxDescriptors; i++ {
+		block := sessionStart + firstDescriptorBlock + i
+		data := make([]byte, logicalBlockSize)
+		if _, err := r.ReadAt(data, int64(block)*logicalBlockSize); err != nil {
+			return nil, fmt.Errorf("%w: could not read volume descriptor at block %d: %w", ErrNotISO9660, block, err)
+		}
+
+		descriptor := Descriptor{Block: block, Data: data}
+		if err := struc.Unpack(bytes.NewReader(data), &descriptor.Header); err != nil {
+			return nil, fmt.Errorf("could not decode volume descriptor header: %w", err)
+		}
+
+		if descriptor.Header.StandardIdentifier != spec.StandardIdentifier {
+			return nil, fmt.Errorf("%w: block %d has invalid standard identifier", ErrNotISO9660, block)
+		}
+
+		img.Descriptors = append(img.Descriptors, descriptor)
+
+		switch descriptor.Header.Kind {
+		case spec.VolumeDescriptorTypePrimary:
+			if img.Primary != nil {
+				continue
+			}
+
+			pvd, err := descriptor.Volume()
+			if err != nil {
+				return nil, err
+			}
+
+			img.Primary = pvd
+
+		case spec.VolumeDescriptorTypeTerminator:
+			if img.Primary == nil {
+				return nil, ErrNoPrimaryVolumeDescriptor
+			}
+
+			return img, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: volume descriptor set is not terminated", ErrNotISO9660)
+}
+
+// ReaderAt returns the underlying reader of the image
+func (i *Image) ReaderAt() io.ReaderAt {
+	return i.r
+}
+
+// Root returns the root directory record of the primary volume descriptor
+func (i *Image) Root() (*Record, error) {
+	for _, descriptor := range i.Descriptors {
+		if descriptor.Header.Kind == spec.VolumeDescriptorTypePrimary {
+			return descriptor.Root()
+		}
+	}
+
+	return nil, ErrNoPrimaryVolumeDescriptor
+}
+
+// Volume decodes a primary or supplementary volume descriptor. Supplementary volume descriptors have the same layout as
+// primary volume descriptors, except that the volume flags and escape sequences are recorded in fields that are unused
+// in a primary volume descriptor.
+func (d *Descriptor) Volume() (*spec.PrimaryVolumeDescriptor, error) {
+	if d.Header.Kind != spec.VolumeDescriptorTypePrimary && d.Header.Kind != spec.VolumeDescriptorTypeSupplementary {
+		return nil, fmt.Errorf("%w: descriptor at block %d is not a primary or supplementary volume descriptor", ErrNotISO9660, d.Block)
+	}
+
+	pvd := &spec.PrimaryVolumeDescriptor{}
+	if err := struc.Unpack(bytes.NewReader(d.Data), pvd); err != nil {
+		return nil, fmt.Errorf("could not decode volume descriptor: %w", err)
+	}
+
+	return pvd, nil
+}
+
+// Identifier converts a fixed-length identifier field, such as the volume identifier, to a string without its trailing
+// filler characters
+func Identifier[T ~uint8](chars []T) string {
+	b := make([]byte, len(chars))
+	for i, c := range chars {
+		b[i] = byte(c)
+	}
+
+	return strings.TrimRight(string(b), string([]byte{spec.FillerByte, 0}))
+}
+
+// Root returns the root directory record of a primary or supplementary volume descriptor, which both keep it at the
+// same offset
+func (d *Descriptor) Root() (*Record, error) {
+	record, err := DecodeRecord(d.Data[rootRecordOffset : rootRecordOffset+rootRecordLength])
+	if err != nil {
+		return nil, fmt.Errorf("could not decode root directory record: %w", err)
+	}
+
+	record.Offset = int64(d.Block)*logicalBlockSize + rootRecordOffset
+	return record, nil
+}
+
+// ReadDir reads all records in a directory, including the records for the directory itself and its parent
+func (i *Image) ReadDir(dir *Record) ([]*Record, error) {
+	if dir.FileFlags&spec.FileFlagDirectory == 0 {
+		return nil, fmt.Errorf("%w: record '%s' is not a directory", ErrInvalidRecord, dir.Name())
+	}
+
+	start := dir.DataOffset()
+	data, err := i.readStructure(start, dir.DataLength.RealValue())
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory extent: %w", err)
+	}
+
+	var records []*Record
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		if length == 0 {
+			// Records never cross sector boundaries; unused space at the end of a sector is zero-filled
+			offset = (offset/logicalBlockSize + 1) * logicalBlockSize
+			continue
+		}
+
+		if offset+length > len(data) {
+			return nil, fmt.Errorf("%w: record at offset %d overruns directory extent", ErrInvalidRecord, offset)
+		}
+
+		record, err := DecodeRecord(data[offset : offset+length])
+		if err != nil {
+			return nil, fmt.Errorf("could not decode record at offset %d: %w", offset, err)
+		}
+
+		record.Offset = start + int64(offset)
+		records = append(records, record)
+		offset += length
+	}
+
+	return records, nil
+}
+
+// ReadPathTable reads the L-type (little endian) or M-type (big endian) path table of the primary volume descriptor
+func (i *Image) ReadPathTable(bigEndian bool) ([]*spec.PathTableRecord, error) {
+	location := i.Primary.LocationTypeLPathTable
+	if bigEndian {
+		location = i.Primary.LocationTypeMPathTable
+	}
+
+	data, err := i.readStructure(int64(location)*logicalBlockSize, i.Primary.PathTableSize.RealValue())
+	if err != nil {
+		return nil, fmt.Errorf("could not read path table: %w", err)
+	}
+
+	return DecodePathTable(data, bigEndian)
+}
+
+// readStructure reads a directory or path table of the given length. The data is read incrementally rather than into a
+// buffer of the recorded length, so a length that runs past the end of the image fails there without allocating memory
+// for the rest.
+func (i *Image) readStructure(offset int64, length uint32) ([]byte, error) {
+	if length > maxStructureSize {
+		return nil, fmt.Errorf("%w: %d bytes is more than the maximum of %d bytes", ErrStructureTooLarge, length, maxStructureSize)
+	}
+
+	data, err := io.ReadAll(io.NewSectionReader(i.r, offset, int64(length)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < int(length) {
+		return nil, fmt.Errorf("%w: read %d of %d bytes", io.ErrUnexpectedEOF, len(data), length)
+	}
+
+	return data, nil
+}
+
+// Open returns a reader for the contents of a file section, i.e. a single record
+func (i *Image) Open(record *Record) *io.SectionReader {
+	return io.NewSectionReader(i.r, record.DataOffset(), int64(record.DataLength.RealValue()))
+}
+
+// DirectoryAt returns the '.' record of the directory whose extent starts at the given block, which describes the
+// directory itself. This is useful when a directory is referred to by location alone, e.g. by a Rock Ridge CL entry.
+func (i *Image) DirectoryAt(location uint32) (*Record, error) {
+	sector := make([]byte, logicalBlockSize)
+	if _, err := i.r.ReadAt(sector, int64(location)*logicalBlockSize); err != nil {
+		return nil, fmt.Errorf("could not read directory at block %d: %w", location, err)
+	}
+
+	length := int(sector[0])
+	if length == 0 {
+		return nil, fmt.Errorf("%w: no directory at block %d", ErrInvalidRecord, location)
+	}
+
+	record, err := DecodeRecord(sector[:length])
+	if err != nil {
+		return nil, err
+	}
+
+	if !record.IsSelf() || !record.IsDir() {
+		return nil, fmt.Errorf("%w: no directory at block %d", ErrInvalidRecord, location)
+	}
+
+	record.Offset = int64(location) * logicalBlockSize
+	return record, nil
+}
@@ -0,0 +1,114 @@
+package reader_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/encode"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+func writeTestImage(t *testing.T) []byte {
+	image, err := iso9660.NewImage(fstest.MapFS{
+		"BOOT/KERNEL.IMG": {Data: []byte("kernel")},
+		"README":          {Data: []byte("readme")},
+	})
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	return buff.Bytes()
+}
+
+func TestOpen(t *testing.T) {
+	img, err := reader.Open(bytes.NewReader(writeTestImage(t)))
+	require.NoError(t, err, "Open should not return an error for an image we wrote")
+	require.NotNil(t, img.Primary, "Image should have a primary volume descriptor")
+
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root directory record")
+	assert.True(t, root.IsDir(), "Root directory record should be a directory")
+
+	records, err := img.ReadDir(root)
+	require.NoError(t, err, "Should be able to read root directory")
+
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Name())
+	}
+	assert.Equal(t, []string{".", "..", "BOOT", "README"}, names, "Root directory should contain self, parent, and source files")
+
+	boot, err := img.ReadDir(records[2])
+	require.NoError(t, err, "Should be able to read subdirectory")
+	require.Len(t, boot, 3, "Subdirectory should contain self, parent, and one file")
+	assert.Equal(t, "KERNEL.IMG", boot[2].Name(), "Name should not include the version number")
+
+	data, err := io.ReadAll(img.Open(boot[2]))
+	require.NoError(t, err, "Should be able to read file contents")
+	assert.Equal(t, "kernel", string(data), "File contents should match source data")
+
+	self, err := img.DirectoryAt(records[2].ExtentLocation.RealValue())
+	require.NoError(t, err, "Should be able to find directory by location")
+	assert.Equal(t, records[2].DataLength.RealValue(), self.DataLength.RealValue(), "Directory found by location should describe the same extent")
+
+	for _, bigEndian := range []bool{false, true} {
+		pathTable, err := img.ReadPathTable(bigEndian)
+		require.NoError(t, err, "Should be able to read path table")
+		require.Len(t, pathTable, 2, "Path table should contain root and one subdirectory")
+		assert.Equal(t, "BOOT", string(pathTable[1].DirectoryIdentifier), "Path table should contain subdirectory")
+		assert.Equal(t, records[2].ExtentLocation.RealValue(), pathTable[1].LocationOfExtent, "Path table location should match directory record")
+	}
+
+	hasSUSP, err := img.HasSUSP()
+	require.NoError(t, err, "Should be able to check for SUSP")
+	assert.False(t, hasSUSP, "Image without Rock Ridge should not use SUSP")
+}
+
+func TestOpen_NotISO9660(t *testing.T) {
+	_, err := reader.Open(bytes.NewReader(make([]byte, 64*1024)))
+	assert.ErrorIs(t, err, reader.ErrNotISO9660, "Open should reject data without a volume descriptor set")
+}
+
+func TestRecord_Version(t *testing.T) {
+	record := &reader.Record{}
+	record.FileIdentifier = []byte("FILE.;12")
+	assert.Equal(t, "FILE", record.Name(), "Name should strip version and empty extension")
+	assert.Equal(t, 12, record.Version(), "Version should be parsed from identifier")
+}
+
+func TestDescriptor_Volume(t *testing.T) {
+	img, err := reader.Open(bytes.NewReader(writeTestImage(t)))
+	require.NoError(t, err, "Open should not return an error for an image we wrote")
+	require.Len(t, img.Descriptors, 2, "Image should have a primary volume descriptor and a terminator")
+
+	pvd, err := img.Descriptors[0].Volume()
+	require.NoError(t, err, "Should be able to decode primary volume descriptor")
+	assert.Equal(t, "TEST", reader.Identifier(pvd.VolumeIdentifier[:]), "Identifier should not include filler characters")
+	assert.EqualValues(t, 2048, pvd.LogicalBlockSize.RealValue(), "Logical block size should be decoded")
+
+	_, err = img.Descriptors[1].Volume()
+	assert.ErrorIs(t, err, reader.ErrNotISO9660, "Terminator should not be decoded as a volume descriptor")
+}
+
+func TestImage_ReadDir_CorruptLength(t *testing.T) {
+	data := writeTestImage(t)
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Open should not return an error for an image we wrote")
+
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root directory record")
+
+	root.DataLength = encode.AsUInt32BothByte(0xFFFFF800)
+	_, err = img.ReadDir(root)
+	assert.ErrorIs(t, err, reader.ErrStructureTooLarge, "Directories larger than the maximum should not be read")
+
+	root.DataLength = encode.AsUInt32BothByte(uint32(len(data)))
+	_, err = img.ReadDir(root)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF, "Directories that run past the end of the image should not be read")
+}
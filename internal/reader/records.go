@@ -0,0 +1,170 @@
+package reader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"strings"
+)
+
+// baseRecordLength is the length of a directory record, excluding its file identifier and system use fields
+const baseRecordLength = 33
+
+// Record is a directory record, as read from an image
+type Record struct {
+	spec.DirectoryRecord
+
+	// Raw is the whole record as it appears in the image
+	Raw []byte
+
+	// Offset is the byte offset of the record in the image
+	Offset int64
+}
+
+// DecodeRecord decodes a single directory record. The slice must be exactly as long as the record.
+//
+// ECMA-119 (5th ed.) §10.1
+func DecodeRecord(b []byte) (*Record, error) {
+	if len(b) < baseRecordLength+1 {
+		return nil, fmt.Errorf("%w: record is only %d bytes", ErrInvalidRecord, len(b))
+	}
+
+	if int(b[0]) != len(b) {
+		return nil, fmt.Errorf("%w: record length %d does not match available data %d", ErrInvalidRecord, b[0], len(b))
+	}
+
+	identifierLength := int(b[32])
+	systemUseStart := baseRecordLength + identifierLength
+	if identifierLength%2 == 0 {
+		systemUseStart += 1 // Padding
+	}
+
+	if systemUseStart > len(b) {
+		return nil, fmt.Errorf("%w: file identifier overruns record", ErrInvalidRecord)
+	}
+
+	r := &Record{
+		DirectoryRecord: spec.DirectoryRecord{
+			Length:                        b[0],
+			ExtendedAttributeRecordLength: b[1],
+			ExtentLocation:                spec.UInt32BothByte{Value: binary.BigEndian.Uint64(b[2:10])},
+			DataLength:                    spec.UInt32BothByte{Value: binary.BigEndian.Uint64(b[10:18])},
+			RecordingDateAndTime: spec.DateTime{
+				YearsSince1900:            b[18],
+				Month:                     b[19],
+				Day:                       b[20],
+				Hour:                      b[21],
+				Minute:                    b[22],
+				Second:                    b[23],
+				GMTOffsetIn15MinIntervals: int8(b[24]),
+			},
+			FileFlags:              spec.FileFlag(b[25]),
+			FileUnitSize:           b[26],
+			InterleaveGapSize:      b[27],
+			VolumeSequenceNumber:   spec.UInt16BothByte{Value: binary.BigEndian.Uint32(b[28:32])},
+			LengthOfFileIdentifier: b[32],
+			FileIdentifier:         spec.FileIdentifier(b[baseRecordLength : baseRecordLength+identifierLength]),
+			SystemUse:              b[systemUseStart:],
+		},
+		Raw: b,
+	}
+
+	return r, nil
+}
+
+// IsDir returns true if the record describes a directory
+func (r *Record) IsDir() bool {
+	return r.FileFlags&spec.FileFlagDirectory != 0
+}
+
+// IsSelf returns true if the record is the '.' record of a directory
+func (r *Record) IsSelf() bool {
+	return len(r.FileIdentifier) == 1 && r.FileIdentifier[0] == spec.FileIdentifierSelf[0]
+}
+
+// IsParent returns true if the record is the '..' record of a directory
+func (r *Record) IsParent() bool {
+	return len(r.FileIdentifier) == 1 && r.FileIdentifier[0] == spec.FileIdentifierParent[0]
+}
+
+// Name returns the file identifier as a string, without its version number, and without the separator that precedes
+// an empty extension. This is the name that most operating systems show for a file.
+func (r *Record) Name() string {
+	switch {
+	case r.IsSelf():
+		return "."
+	case r.IsParent():
+		return ".."
+	}
+
+	name := string(r.FileIdentifier)
+	if r.IsDir() {
+		return name
+	}
+
+	if index := strings.LastIndex(name, ";"); index != -1 {
+		name = name[:index]
+	}
+
+	return strings.TrimSuffix(name, ".")
+}
+
+// Version returns the version number of a file, or 0 if the file identifier doesn't have one
+func (r *Record) Version() int {
+	name := string(r.FileIdentifier)
+	index := strings.LastIndex(name, ";")
+	if r.IsDir() || index == -1 {
+		return 0
+	}
+
+	version := 0
+	for _, c := range name[index+1:] {
+		if c < '0' || c > '9' {
+			return 0
+		}
+
+		version = version*10 + int(c-'0')
+	}
+
+	return version
+}
+
+// DataOffset returns the byte offset of the record's data in the image. This skips any extended attribute record,
+// which precedes the data in the extent.
+func (r *Record) DataOffset() int64 {
+	return (int64(r.ExtentLocation.RealValue()) + int64(r.ExtendedAttributeRecordLength)) * logicalBlockSize
+}
+
+// DecodePathTable decodes an L-type (little endian) or M-type (big endian) path table
+//
+// ECMA-119 (5th ed.) §7.10
+func DecodePathTable(b []byte, bigEndian bool) ([]*spec.PathTableRecord, error) {
+	var byteOrder binary.ByteOrder = binary.LittleEndian
+	if bigEndian {
+		byteOrder = binary.BigEndian
+	}
+
+	var records []*spec.PathTableRecord
+	for offset := 0; offset < len(b); {
+		if offset+8 > len(b) {
+			return nil, fmt.Errorf("path table record at offset %d is truncated", offset)
+		}
+
+		identifierLength := int(b[offset])
+		if identifierLength == 0 || offset+8+identifierLength > len(b) {
+			return nil, fmt.Errorf("path table record at offset %d has invalid identifier length %d", offset, identifierLength)
+		}
+
+		records = append(records, &spec.PathTableRecord{
+			LengthOfDirectoryIdentifier:   b[offset],
+			ExtendedAttributeRecordLength: b[offset+1],
+			LocationOfExtent:              byteOrder.Uint32(b[offset+2 : offset+6]),
+			ParentDirectoryNumber:         byteOrder.Uint16(b[offset+6 : offset+8]),
+			DirectoryIdentifier:           spec.FileIdentifier(b[offset+8 : offset+8+identifierLength]),
+		})
+
+		offset += 8 + identifierLength + identifierLength%2
+	}
+
+	return records, nil
+}
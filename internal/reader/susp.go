@@ -0,0 +1,402 @@
+package reader
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io/fs"
+	"strings"
+	"time"
+)
+
+// maxContinuations limits the number of continuation areas that will be followed for a single record, so that a
+// malicious image can't make us loop forever
+const maxContinuations = 32
+
+// SystemUseEntry is an entry in the system use field of a directory record, as defined by the System Use Sharing
+// Protocol (SUSP, IEEE P1281). Extensions such as Rock Ridge are made up of these entries.
+type SystemUseEntry struct {
+	Signature string
+	Version   uint8
+
+	// Data is the contents of the entry, excluding its four-byte header
+	Data []byte
+}
+
+// HasSUSP returns true if the image uses the System Use Sharing Protocol, which is indicated by an SP entry in the '.'
+// record of the root directory
+func (i *Image) HasSUSP() (bool, error) {
+	if i.suspChecked {
+		return i.hasSUSP, nil
+	}
+
+	root, err := i.Root()
+	if err != nil {
+		return false, err
+	}
+
+	records, err := i.ReadDir(root)
+	if err != nil {
+		return false, fmt.Errorf("could not read root directory: %w", err)
+	}
+
+	i.suspChecked = true
+	if len(records) > 0 && records[0].IsSelf() {
+		su := records[0].SystemUse
+		if len(su) >= 7 && string(su[0:2]) == "SP" && su[2] >= 7 && su[4] == 0xBE && su[5] == 0xEF {
+			i.hasSUSP = true
+			i.suspSkip = int(su[6])
+		}
+	}
+
+	return i.hasSUSP, nil
+}
+
+// SystemUseEntries returns the SUSP entries of a record, following any continuation areas. It returns no entries if
+// the image doesn't use SUSP.
+func (i *Image) SystemUseEntries(r *Record) ([]SystemUseEntry, error) {
+	hasSUSP, err := i.HasSUSP()
+	if err != nil || !hasSUSP {
+		return nil, err
+	}
+
+	field := r.SystemUse
+	if !(r.IsSelf() && r.Offset == i.rootSelfOffset()) && len(field) >= i.suspSkip {
+		field = field[i.suspSkip:]
+	}
+
+	var entries []SystemUseEntry
+	for continuations := 0; ; continuations++ {
+		var next []byte
+
+		for len(field) >= 4 {
+			length := int(field[2])
+			if length < 4 || length > len(field) {
+				break
+			}
+
+			entry := SystemUseEntry{Signature: string(field[0:2]), Version: field[3], Data: field[4:length]}
+			field = field[length:]
+
+			switch entry.Signature {
+			case "ST":
+				field = nil
+				continue
+			case "CE":
+				if len(entry.Data) < 24 {
+					return nil, fmt.Errorf("%w: CE entry is truncated", ErrInvalidRecord)
+				}
+
+				block := bothByte32(entry.Data[0:8])
+				offset := bothByte32(entry.Data[8:16])
+				size := bothByte32(entry.Data[16:24])
+				next = make([]byte, size)
+				if _, err := i.r.ReadAt(next, int64(block)*logicalBlockSize+int64(offset)); err != nil {
+					return nil, fmt.Errorf("could not read continuation area: %w", err)
+				}
+			}
+
+			entries = append(entries, entry)
+		}
+
+		if next == nil {
+			break
+		}
+
+		if continuations >= maxContinuations {
+			return nil, fmt.Errorf("%w: too many continuation areas", ErrInvalidRecord)
+		}
+
+		field = next
+	}
+
+	return entries, nil
+}
+
+// rootSelfOffset returns the offset of the '.' record of the root directory, which is the only record that doesn't
+// have the SP entry's skip length applied
+func (i *Image) rootSelfOffset() int64 {
+	root, err := i.Root()
+	if err != nil {
+		return -1
+	}
+
+	return root.DataOffset()
+}
+
+// RockRidge is the POSIX metadata of a file, as recorded by the Rock Ridge Interchange Protocol
+type RockRidge struct {
+	// HasAttributes is true if the record has a PX entry, in which case Mode, Links, UID and GID are set
+	HasAttributes bool
+	Mode          fs.FileMode
+	Links         uint32
+	UID           uint32
+	GID           uint32
+
+	// Name is the alternate name of the file from NM entries, or empty if there are none
+	Name string
+
+	// SymlinkTarget is the target of a symbolic link from SL entries, or empty if the file is not a symbolic link
+	SymlinkTarget string
+
+	// HasDevice is true if the record has a PN entry, in which case DeviceMajor and DeviceMinor are set
+	HasDevice   bool
+	DeviceMajor uint32
+	DeviceMinor uint32
+
+	// ModTime and AccessTime are from a TF entry, and are zero if not recorded
+	ModTime    time.Time
+	AccessTime time.Time
+
+	// Relocated is true if the record has an RE entry, i.e. it is a directory that was moved to keep the hierarchy
+	// within the depth limit, and should be hidden from its current location
+	Relocated bool
+
+	// ChildLink is the location of the directory that this record stands in for, from a CL entry, or 0 if there is none
+	ChildLink uint32
+
+	// Compressed is true if the record has a ZF entry for the zisofs format, in which case the file's data must be
+	// decompressed to UncompressedSize bytes
+	Compressed       bool
+	UncompressedSize uint32
+}
+
+// RockRidge returns the Rock Ridge metadata of a record, or nil if the record has none
+func (i *Image) RockRidge(r *Record) (*RockRidge, error) {
+	entries, err := i.SystemUseEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var rr *RockRidge
+	var name strings.Builder
+	var symlink strings.Builder
+	symlinkContinues := false
+
+	for _, entry := range entries {
+		data := entry.Data
+
+		switch entry.Signature {
+		case "PX":
+			if len(data) < 32 {
+				return nil, fmt.Errorf("%w: PX entry is truncated", ErrInvalidRecord)
+			}
+
+			rr = ensureRockRidge(rr)
+			rr.HasAttributes = true
+			rr.Mode = posixFileMode(bothByte32(data[0:8]))
+			rr.Links = bothByte32(data[8:16])
+			rr.UID = bothByte32(data[16:24])
+			rr.GID = bothByte32(data[24:32])
+
+		case "NM":
+			if len(data) < 1 {
+				continue
+			}
+
+			rr = ensureRockRidge(rr)
+			switch {
+			case data[0]&0x02 != 0:
+				name.WriteString(".")
+			case data[0]&0x04 != 0:
+				name.WriteString("..")
+			default:
+				name.Write(data[1:])
+			}
+
+		case "SL":
+			if len(data) < 1 {
+				continue
+			}
+
+			rr = ensureRockRidge(rr)
+			for components := data[1:]; len(components) >= 2; {
+				flags, length := components[0], int(components[1])
+				if 2+length > len(components) {
+					return nil, fmt.Errorf("%w: SL component is truncated", ErrInvalidRecord)
+				}
+
+				if symlink.Len() > 0 && !symlinkContinues && !strings.HasSuffix(symlink.String(), "/") {
+					symlink.WriteString("/")
+				}
+
+				switch {
+				case flags&0x02 != 0:
+					symlink.WriteString(".")
+				case flags&0x04 != 0:
+					symlink.WriteString("..")
+				case flags&0x08 != 0:
+					symlink.WriteString("/")
+				default:
+					symlink.Write(components[2 : 2+length])
+				}
+
+				symlinkContinues = flags&0x01 != 0
+				components = components[2+length:]
+			}
+
+		case "PN":
+			if len(data) < 16 {
+				return nil, fmt.Errorf("%w: PN entry is truncated", ErrInvalidRecord)
+			}
+
+			rr = ensureRockRidge(rr)
+			rr.HasDevice = true
+			high, low := bothByte32(data[0:8]), bothByte32(data[8:16])
+			if high == 0 && low&^0xFF != 0 {
+				// Some writers pack the old-style 16-bit device number into the low word
+				rr.DeviceMajor, rr.DeviceMinor = low>>8, low&0xFF
+			} else {
+				rr.DeviceMajor, rr.DeviceMinor = high, low
+			}
+
+		case "TF":
+			if len(data) < 1 {
+				continue
+			}
+
+			rr = ensureRockRidge(rr)
+			if err := decodeTimestamps(rr, data[0], data[1:]); err != nil {
+				return nil, err
+			}
+
+		case "RE":
+			rr = ensureRockRidge(rr)
+			rr.Relocated = true
+
+		case "CL":
+			if len(data) < 8 {
+				return nil, fmt.Errorf("%w: CL entry is truncated", ErrInvalidRecord)
+			}
+
+			rr = ensureRockRidge(rr)
+			rr.ChildLink = bothByte32(data[0:8])
+
+		case "ZF":
+			if len(data) < 12 {
+				return nil, fmt.Errorf("%w: ZF entry is truncated", ErrInvalidRecord)
+			}
+
+			if string(data[0:2]) == "pz" {
+				rr = ensureRockRidge(rr)
+				rr.Compressed = true
+				rr.UncompressedSize = bothByte32(data[4:12])
+			}
+		}
+	}
+
+	if rr != nil {
+		rr.Name = name.String()
+		rr.SymlinkTarget = symlink.String()
+	}
+
+	return rr, nil
+}
+
+func ensureRockRidge(rr *RockRidge) *RockRidge {
+	if rr == nil {
+		return &RockRidge{}
+	}
+
+	return rr
+}
+
+// decodeTimestamps decodes the timestamps of a TF entry, which are recorded in a fixed order for each flag that is set
+func decodeTimestamps(rr *RockRidge, flags uint8, data []byte) error {
+	size := 7
+	if flags&0x80 != 0 {
+		size = 17
+	}
+
+	for bit := 0; bit < 7; bit++ {
+		if flags&(1<<bit) == 0 {
+			continue
+		}
+
+		if len(data) < size {
+			return fmt.Errorf("%w: TF entry is truncated", ErrInvalidRecord)
+		}
+
+		var t time.Time
+		if size == 7 {
+			t = decodeDateTime(data[:size]).Time()
+		} else {
+			t = decodeLongDateTime(data[:size])
+		}
+
+		switch bit {
+		case 1:
+			rr.ModTime = t
+		case 2:
+			rr.AccessTime = t
+		}
+
+		data = data[size:]
+	}
+
+	return nil
+}
+
+func decodeDateTime(b []byte) spec.DateTime {
+	return spec.DateTime{
+		YearsSince1900:            b[0],
+		Month:                     b[1],
+		Day:                       b[2],
+		Hour:                      b[3],
+		Minute:                    b[4],
+		Second:                    b[5],
+		GMTOffsetIn15MinIntervals: int8(b[6]),
+	}
+}
+
+// decodeLongDateTime decodes the 17-byte digit representation of a date and time
+func decodeLongDateTime(b []byte) time.Time {
+	var l spec.LongDateTime
+	copy(l.YearDigits[:], b[0:4])
+	copy(l.MonthDigits[:], b[4:6])
+	copy(l.DayDigits[:], b[6:8])
+	copy(l.HourDigits[:], b[8:10])
+	copy(l.MinuteDigits[:], b[10:12])
+	copy(l.SecondDigits[:], b[12:14])
+	copy(l.CentisecondsDigits[:], b[14:16])
+	l.GMTOffsetIn15MinIntervals = b[16]
+
+	return l.Time()
+}
+
+// bothByte32 decodes the 'real' (big endian) value of an unsigned 32-bit both-byte integer
+func bothByte32(b []byte) uint32 {
+	return spec.UInt32BothByte{Value: binary.BigEndian.Uint64(b)}.RealValue()
+}
+
+// posixFileMode converts a POSIX file mode (st_mode) to an [fs.FileMode]
+func posixFileMode(mode uint32) fs.FileMode {
+	result := fs.FileMode(mode & 0o777)
+
+	switch mode & 0o170000 {
+	case 0o040000:
+		result |= fs.ModeDir
+	case 0o120000:
+		result |= fs.ModeSymlink
+	case 0o020000:
+		result |= fs.ModeDevice | fs.ModeCharDevice
+	case 0o060000:
+		result |= fs.ModeDevice
+	case 0o010000:
+		result |= fs.ModeNamedPipe
+	case 0o140000:
+		result |= fs.ModeSocket
+	}
+
+	if mode&0o4000 != 0 {
+		result |= fs.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		result |= fs.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		result |= fs.ModeSticky
+	}
+
+	return result
+}
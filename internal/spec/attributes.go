@@ -0,0 +1,109 @@
+package spec
+
+import (
+	"fmt"
+	"github.com/itchio/headway/counter"
+	"github.com/lunixbochs/struc"
+	"io"
+)
+
+// Permission is a bit of the permissions field of an [ExtendedAttributeRecord]. Each bit that is set denies a class of
+// users a kind of access to a file; bits that are clear allow it. Users in the system class are those with special
+// privileges, such as root.
+//
+// ECMA-119 (5th ed.) §10.5.3
+type Permission uint16
+
+const (
+	PermissionSystemRead    Permission = 0x0001
+	PermissionSystemExecute Permission = 0x0004
+	PermissionOwnerRead     Permission = 0x0010
+	PermissionOwnerExecute  Permission = 0x0040
+	PermissionGroupRead     Permission = 0x0100
+	PermissionGroupExecute  Permission = 0x0400
+	PermissionOtherRead     Permission = 0x1000
+	PermissionOtherExecute  Permission = 0x4000
+
+	// PermissionsReserved are the odd-numbered bits of the permissions field, which must always be set
+	PermissionsReserved Permission = 0xAAAA
+)
+
+// RecordFormat is the structure of the records of a file, given in an [ExtendedAttributeRecord]
+//
+// ECMA-119 (5th ed.) §10.5.8
+type RecordFormat uint8
+
+const (
+	// RecordFormatNone means that the structure of the file's records isn't specified
+	RecordFormatNone RecordFormat = iota
+	RecordFormatFixedLength
+	RecordFormatVariableLengthLSB
+	RecordFormatVariableLengthMSB
+)
+
+// extendedAttributeRecordBaseSize is the size of an extended attribute record without its application use field or
+// escape sequences
+const extendedAttributeRecordBaseSize = 250
+
+// ExtendedAttributeRecord records attributes of a file or directory that don't fit in its directory record, such as
+// its owner and permissions. It is recorded in the logical blocks at the start of the file's extent, before its data,
+// and the number of blocks is given by the ExtendedAttributeRecordLength of the file's directory record.
+//
+// ExtendedAttributeRecord implements [io.WriterTo] for serialization
+//
+// ECMA-119 (5th ed.) §10.5
+type ExtendedAttributeRecord struct {
+	OwnerIdentification            UInt16BothByte
+	GroupIdentification            UInt16BothByte
+	Permissions                    Permission
+	FileCreationDateTime           LongDateTime
+	FileModificationDateTime       LongDateTime
+	FileExpirationDateTime         LongDateTime
+	FileEffectiveDateTime          LongDateTime
+	RecordFormat                   RecordFormat
+	RecordAttributes               uint8
+	RecordLength                   UInt16BothByte
+	SystemIdentifier               [32]ACharacter
+	SystemUse                      [64]uint8
+	ExtendedAttributeRecordVersion uint8
+	LengthOfEscapeSequences        uint8
+	Reserved183                    [64]uint8
+	LengthOfApplicationUse         UInt16BothByte
+
+	// ApplicationUse and EscapeSequences follow the fixed part of the record, in that order. They are not packed by
+	// [struc], since their lengths are recorded before the reserved field and in both-byte order respectively;
+	// [ExtendedAttributeRecord.WriteTo] writes them instead.
+	ApplicationUse  []byte `struc:"skip"`
+	EscapeSequences []byte `struc:"skip"`
+}
+
+// Ensure ExtendedAttributeRecord implements [io.WriterTo]
+var _ io.WriterTo = &ExtendedAttributeRecord{}
+
+func (e *ExtendedAttributeRecord) WriteTo(w io.Writer) (int64, error) {
+	cw := counter.NewWriter(w)
+	if err := struc.Pack(cw, e); err != nil {
+		return cw.Count(), fmt.Errorf("failed to pack extended attribute record: %w", err)
+	}
+
+	if _, err := cw.Write(e.ApplicationUse); err != nil {
+		return cw.Count(), fmt.Errorf("failed to write application use field: %w", err)
+	}
+
+	if _, err := cw.Write(e.EscapeSequences); err != nil {
+		return cw.Count(), fmt.Errorf("failed to write escape sequences: %w", err)
+	}
+
+	return cw.Count(), nil
+}
+
+// Size returns the length of the record in bytes
+func (e *ExtendedAttributeRecord) Size() int {
+	return extendedAttributeRecordBaseSize + len(e.ApplicationUse) + len(e.EscapeSequences)
+}
+
+// Blocks returns the number of logical blocks that the record occupies, which is recorded as the
+// ExtendedAttributeRecordLength of directory and path table records
+func (e *ExtendedAttributeRecord) Blocks() uint8 {
+	return uint8((e.Size() + LogicalSectorSize - 1) / LogicalSectorSize)
+}
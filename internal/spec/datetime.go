@@ -55,3 +55,38 @@ var ZeroLongDateTime = LongDateTime{
 	CentisecondsDigits:        [2]uint8{'0', '0'},
 	GMTOffsetIn15MinIntervals: 0,
 }
+
+// Time converts the digits to a [time.Time]. The zero time is returned if the date and time is not specified, i.e. it
+// is [ZeroLongDateTime], or if any of the digits are not valid.
+func (l LongDateTime) Time() time.Time {
+	digits := func(s []uint8) int {
+		value := 0
+		for _, c := range s {
+			if c < '0' || c > '9' {
+				return -1
+			}
+
+			value = value*10 + int(c-'0')
+		}
+
+		return value
+	}
+
+	year, month, day := digits(l.YearDigits[:]), digits(l.MonthDigits[:]), digits(l.DayDigits[:])
+	hour, minute, second := digits(l.HourDigits[:]), digits(l.MinuteDigits[:]), digits(l.SecondDigits[:])
+	centiseconds := digits(l.CentisecondsDigits[:])
+	if year <= 0 || month <= 0 || day <= 0 || hour < 0 || minute < 0 || second < 0 || centiseconds < 0 {
+		return time.Time{}
+	}
+
+	return time.Date(
+		year,
+		time.Month(month),
+		day,
+		hour,
+		minute,
+		second,
+		centiseconds*int(10*time.Millisecond),
+		time.FixedZone("", int(int8(l.GMTOffsetIn15MinIntervals))*15*60),
+	)
+}
@@ -0,0 +1,25 @@
+package spec_test
+
+import (
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestLongDateTime_Time(t *testing.T) {
+	l := spec.LongDateTime{
+		YearDigits:                [4]uint8{'2', '0', '1', '5'},
+		MonthDigits:               [2]uint8{'0', '7'},
+		DayDigits:                 [2]uint8{'3', '1'},
+		HourDigits:                [2]uint8{'1', '9'},
+		MinuteDigits:              [2]uint8{'0', '0'},
+		SecondDigits:              [2]uint8{'1', '5'},
+		CentisecondsDigits:        [2]uint8{'5', '0'},
+		GMTOffsetIn15MinIntervals: 4,
+	}
+
+	expected := time.Date(2015, 7, 31, 19, 0, 15, 500*int(time.Millisecond), time.FixedZone("UTC+1", 60*60))
+	assert.True(t, expected.Equal(l.Time()), "LongDateTime should decode to the correct time")
+	assert.True(t, spec.ZeroLongDateTime.Time().IsZero(), "Zero LongDateTime should decode to the zero time")
+}
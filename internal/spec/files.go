@@ -2,11 +2,13 @@ package spec
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/itchio/headway/counter"
 	"github.com/lunixbochs/struc"
 	"io"
 	"iter"
+	"math"
 	"strings"
 )
 
@@ -62,7 +64,11 @@ type DirectoryRecord struct {
 	// TODO: Joliet support
 	FileIdentifier FileIdentifier
 
-	// TODO system use?
+	// SystemUse is the system use field, which follows the file identifier and its padding byte. This is not packed
+	// by [struc], since the padding byte depends on the length of the file identifier; [DirectoryRecord.WriteTo] writes
+	// it instead. Extensions such as Rock Ridge record System Use Sharing Protocol entries here (see
+	// [PackSystemUse]).
+	SystemUse []byte `struc:"skip"`
 }
 
 // Ensure DirectoryRecord implements [io.WriterTo]
@@ -75,6 +81,18 @@ func (d DirectoryRecord) WriteTo(w io.Writer) (int64, error) {
 	}
 
 	// We don't have a magical 'padding' field, so we need to pad ourselves
+	if len(d.SystemUse) > 0 {
+		if d.LengthOfFileIdentifier%2 == 0 {
+			if _, err := cw.Write([]byte{0}); err != nil {
+				return cw.Count(), fmt.Errorf("failed to pad file identifier: %w", err)
+			}
+		}
+
+		if _, err := cw.Write(d.SystemUse); err != nil {
+			return cw.Count(), fmt.Errorf("failed to write system use field: %w", err)
+		}
+	}
+
 	if remainder := int64(d.Length) - cw.Count(); remainder > 0 {
 		if _, err := cw.Write(make([]byte, remainder)); err != nil {
 			return cw.Count(), fmt.Errorf("failed to pad directory record: %w", err)
@@ -87,13 +105,39 @@ func (d DirectoryRecord) WriteTo(w io.Writer) (int64, error) {
 // Directory records are 33 bytes
 const baseDirectoryRecordSize = 33
 
-// DirectoryRecordLength calculates the length of a [DirectoryRecord] given the length of its file identifier.
-// Note that it is assumed in this implementation (and by the [DirectoryRecord] struct) that there are no system use
-// bytes, i.e. LEN_SU in the spec is assumed to be zero in all cases.
+// maxDirectoryRecordLength is the length of the longest directory record, since the length is recorded in one byte
+const maxDirectoryRecordLength = math.MaxUint8
+
+// ErrDirectoryRecordTooLong indicates that a file identifier and system use field don't fit in a directory record
+var ErrDirectoryRecordTooLong = errors.New("directory record too long")
+
+// DirectoryRecordLength calculates the length of a [DirectoryRecord] given the length of its file identifier, for a
+// record with no system use field, i.e. where LEN_SU in the spec is zero. The identifier must fit in a record, as the
+// identifiers of '.' and '..', and any identifier of up to 222 bytes, do.
 //
 // ECMA-119 (5th ed.) §10.1
 func DirectoryRecordLength(fileIdentifierLength int) uint8 {
-	// TODO system use?
+	return uint8(directoryRecordLength(fileIdentifierLength, 0))
+}
+
+// DirectoryRecordLengthWithSystemUse calculates the length of a [DirectoryRecord] given the length of its file
+// identifier and of its system use field. The system use field is padded to an even number of bytes, so that the
+// record is too. It returns [ErrDirectoryRecordTooLong] if the record would be longer than 255 bytes.
+//
+// ECMA-119 (5th ed.) §10.1
+func DirectoryRecordLengthWithSystemUse(fileIdentifierLength int, systemUseLength int) (uint8, error) {
+	length := directoryRecordLength(fileIdentifierLength, systemUseLength)
+	if length > maxDirectoryRecordLength {
+		return 0, fmt.Errorf(
+			"%w: %d byte file identifier and %d byte system use field need %d bytes, but at most %d bytes are allowed",
+			ErrDirectoryRecordTooLong, fileIdentifierLength, systemUseLength, length, maxDirectoryRecordLength,
+		)
+	}
+
+	return uint8(length), nil
+}
+
+func directoryRecordLength(fileIdentifierLength int, systemUseLength int) int {
 	padding := 0
 
 	// When the name is an even number of bytes, the record would end up being an odd number of bytes. Hence, we pad
@@ -102,7 +146,27 @@ func DirectoryRecordLength(fileIdentifierLength int) uint8 {
 		padding = 1
 	}
 
-	return uint8(baseDirectoryRecordSize + fileIdentifierLength + padding)
+	return baseDirectoryRecordSize + fileIdentifierLength + padding + (systemUseLength+1)/2*2
+}
+
+// LogicalSectorSize is the size of a logical sector. The spec allows for larger sectors, but 2048 bytes is the only size
+// in practical use, and is the only size supported here.
+//
+// ECMA-119 (5th ed.) §6.1.2
+const LogicalSectorSize = 2048
+
+// DirectoryRecordOffset returns the offset in a directory's data at which a record of the given length should be
+// recorded, given the offset at which the previous record ended. A directory record must end in the logical sector in
+// which it begins, so a record that doesn't fit in the remainder of a sector is recorded at the start of the next
+// sector instead, and the remainder is left as zero bytes.
+//
+// ECMA-119 (5th ed.) §7.8.1.1
+func DirectoryRecordOffset(end uint32, recordLength uint8) uint32 {
+	if end%LogicalSectorSize+uint32(recordLength) > LogicalSectorSize {
+		return (end/LogicalSectorSize + 1) * LogicalSectorSize
+	}
+
+	return end
 }
 
 type PointedTo interface {
@@ -172,7 +236,16 @@ func (d *DirectoryWriter) WriteTo(w io.Writer) (int64, error) {
 	}
 
 	for _, entry := range d.Directory.Entries() {
-		if _, err := entry.PointerRecord().WriteTo(cw); err != nil {
+		record := entry.PointerRecord()
+
+		offset := DirectoryRecordOffset(uint32(cw.Count()), record.Length)
+		if padding := int64(offset) - cw.Count(); padding > 0 {
+			if _, err := cw.Write(make([]byte, padding)); err != nil {
+				return cw.Count(), fmt.Errorf("failed to pad directory to sector boundary: %w", err)
+			}
+		}
+
+		if _, err := record.WriteTo(cw); err != nil {
 			return cw.Count(), fmt.Errorf("failed to write Directory entry: %w", err)
 		}
 	}
@@ -203,6 +276,9 @@ type DirectoryEntry interface {
 	// IsDir returns true if the entry represents a directory, and false if it represents a file
 	IsDir() bool
 
+	// IsAssociated returns true if the entry is an associated file, i.e. its record has the associated file bit set
+	IsAssociated() bool
+
 	// FileSectionIndex is the number of the file section represented by the directory record. In a directory,
 	// successive directory records for the same file represent contiguous, ascending file section numbers.
 	FileSectionIndex() int
@@ -213,11 +289,15 @@ type DirectoryEntry interface {
 // (in descending order of significance):
 //   - Ascending by file name
 //   - Ascending by file extension
-//   - Descending by file version number (string-wise), where the shorter version number is padded with the '0' character.
-//   - Descending according to the value of the associated file bit of the file flags field, i.e. directories come before
-//     files.
+//   - Descending by file version number (string-wise), where the shorter version number is padded with leading '0'
+//     characters.
+//   - Descending according to the value of the associated file bit of the file flags field, i.e. an associated file
+//     comes before the file it is associated with.
 //   - The order of the file sections of the file
 //
+// Directories are sorted before files if everything else is equal, although this can only happen if a file and a
+// directory are recorded under the same name.
+//
 // Note that a [DirectoryRecord] is not directly comparable, because [FileIdentifier] comparison is
 // implementation-specific: the spec itself does not specify how to compare file identifiers, except that they must
 // be compared character-wise, and that the characters are d1-characters which can be from any coded graphic character
@@ -241,7 +321,26 @@ func CompareDirectoryEntries(a, b DirectoryEntry) int {
 		return cmp
 	}
 
-	// TODO: version and file section comparisons!
+	// Then by version, in descending order, so that the highest version of a file comes first. Directories have no
+	// versions.
+	if !a.IsDir() && !b.IsDir() {
+		if cmp := compareVersions(b.Version(), a.Version()); cmp != 0 {
+			return cmp
+		}
+	}
+
+	// Associated files have the same identifier as the file they are associated with, and come first
+	if a.IsAssociated() != b.IsAssociated() {
+		if a.IsAssociated() {
+			return -1
+		}
+
+		return 1
+	}
+
+	if cmp := a.FileSectionIndex() - b.FileSectionIndex(); cmp != 0 {
+		return cmp
+	}
 
 	aIsDir := a.IsDir()
 	bIsDir := b.IsDir()
@@ -256,6 +355,18 @@ func CompareDirectoryEntries(a, b DirectoryEntry) int {
 	return 0
 }
 
+// compareVersions compares two version numbers as strings of digits, padding the shorter one with leading '0'
+// characters so that they compare by their numerical values
+func compareVersions(a, b string) int {
+	if len(a) < len(b) {
+		a = strings.Repeat("0", len(b)-len(a)) + a
+	} else {
+		b = strings.Repeat("0", len(a)-len(b)) + b
+	}
+
+	return strings.Compare(a, b)
+}
+
 // PathTableRecord is a record in a path table, which indicates where to find a given directory on the disc by its
 // extent number. This can be used by software to quickly find a given directory, rather than having to scan through
 // the whole directory tree.
@@ -1,5 +1,7 @@
 package spec
 
+import "math/bits"
+
 // UInt16BothByte is an unsigned 16-bit integer represented in both big endian and little endian, in a 32-bit
 // integer container.
 //
@@ -14,6 +16,12 @@ func (u UInt16BothByte) RealValue() uint16 {
 	return uint16(u.Value & 0xFFFF)
 }
 
+// IsConsistent returns true if the little endian and big endian halves of the value agree. This is always true for
+// values that we encode, but may not be for values read from an image.
+func (u UInt16BothByte) IsConsistent() bool {
+	return bits.ReverseBytes16(uint16(u.Value>>16)) == u.RealValue()
+}
+
 // UInt32BothByte is an unsigned 32-bit integer represented in both big endian and little endian, in a 64-bit
 // integer container.
 //
@@ -27,3 +35,9 @@ type UInt32BothByte struct {
 func (u UInt32BothByte) RealValue() uint32 {
 	return uint32(u.Value & 0xFFFFFFFF)
 }
+
+// IsConsistent returns true if the little endian and big endian halves of the value agree. This is always true for
+// values that we encode, but may not be for values read from an image.
+func (u UInt32BothByte) IsConsistent() bool {
+	return bits.ReverseBytes32(uint32(u.Value>>32)) == u.RealValue()
+}
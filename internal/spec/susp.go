@@ -0,0 +1,83 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/lunixbochs/struc"
+)
+
+// SharingProtocolIndicator is the SP entry, which indicates that the System Use Sharing Protocol (SUSP) is used in a
+// volume. It is recorded at the start of the system use field of the '.' record of the root directory.
+//
+// IEEE P1281 (SUSP 1.12) §5.3
+type SharingProtocolIndicator struct {
+	Signature  [2]uint8
+	Length     uint8
+	Version    uint8
+	CheckBytes [2]uint8
+
+	// LengthSkipped is the number of bytes at the start of the system use field of every other record that aren't
+	// SUSP entries
+	LengthSkipped uint8
+}
+
+// NewSharingProtocolIndicator returns an SP entry for a volume in which SUSP entries start at the beginning of the
+// system use field of every record
+func NewSharingProtocolIndicator() SharingProtocolIndicator {
+	return SharingProtocolIndicator{
+		Signature:  [2]uint8{'S', 'P'},
+		Length:     7,
+		Version:    1,
+		CheckBytes: [2]uint8{0xBE, 0xEF},
+	}
+}
+
+// PaddingField is the PD entry, which has no meaning and is ignored by readers. A padding field with no padding bytes
+// can be recorded in records that have no other SUSP entries, since some readers expect every record of a volume that
+// uses SUSP to have at least one entry.
+//
+// IEEE P1281 (SUSP 1.12) §5.2
+type PaddingField struct {
+	Signature [2]uint8
+	Length    uint8
+	Version   uint8
+}
+
+// NewPaddingField returns a PD entry with no padding bytes
+func NewPaddingField() PaddingField {
+	return PaddingField{Signature: [2]uint8{'P', 'D'}, Length: 4, Version: 1}
+}
+
+// ZisofsEntry is the ZF entry, which indicates that the data of a file is compressed, and must be decompressed when
+// it is read. This is defined by zisofs-tools as an extension to Rock Ridge, rather than by RRIP itself; Linux reads
+// files with ZF entries transparently.
+type ZisofsEntry struct {
+	Signature [2]uint8
+	Length    uint8
+	Version   uint8
+
+	// Algorithm is 'pz' for the zisofs format
+	Algorithm [2]uint8
+
+	// HeaderSize is the size of the header at the start of the compressed data, in units of 4 bytes
+	HeaderSize uint8
+
+	// BlockSizeLog2 is the base 2 logarithm of the size of the blocks in which the data is compressed
+	BlockSizeLog2 uint8
+
+	// UncompressedSize is the size of the file once it has been decompressed
+	UncompressedSize UInt32BothByte
+}
+
+// PackSystemUse packs SUSP entries, given as pointers to structures such as [SharingProtocolIndicator] and
+// [ZisofsEntry], into a system use field
+func PackSystemUse(entries ...any) ([]byte, error) {
+	var buff bytes.Buffer
+	for _, entry := range entries {
+		if err := struc.Pack(&buff, entry); err != nil {
+			return nil, fmt.Errorf("failed to pack system use entry: %w", err)
+		}
+	}
+
+	return buff.Bytes(), nil
+}
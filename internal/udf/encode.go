@@ -0,0 +1,100 @@
+package udf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/lunixbochs/struc"
+)
+
+const (
+	// descriptorVersion is the version of descriptor tags for UDF revisions before 2.00, i.e. volumes recognised by
+	// an NSR02 descriptor
+	descriptorVersion = 2
+
+	// tagSerialNumber is recorded in every tag. UDF requires all tags in a volume to have the same serial number.
+	tagSerialNumber = 1
+
+	tagSize = 16
+)
+
+var options = &struc.Options{Order: binary.LittleEndian}
+
+// Pack serializes a structure with the little endian byte order that UDF uses throughout
+func Pack(v any) ([]byte, error) {
+	var buff bytes.Buffer
+	if err := struc.PackWithOptions(&buff, v, options); err != nil {
+		return nil, fmt.Errorf("could not pack structure: %w", err)
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Unpack deserializes a structure with the little endian byte order that UDF uses throughout
+func Unpack(b []byte, v any) error {
+	if err := struc.UnpackWithOptions(bytes.NewReader(b), v, options); err != nil {
+		return fmt.Errorf("could not unpack structure: %w", err)
+	}
+
+	return nil
+}
+
+// Encode serializes a descriptor whose first field is a [Tag], and fills in the tag: its identifier, its location,
+// and the CRC of the rest of the descriptor and the checksum of the tag itself. location is the sector of the
+// descriptor for volume structures, or its logical block in the partition for file structures.
+//
+// ECMA-167 (3rd ed.) 3/7.2
+func Encode(descriptor any, identifier TagIdentifier, location uint32) ([]byte, error) {
+	b, err := Pack(descriptor)
+	if err != nil {
+		return nil, err
+	}
+
+	fillTag(b, identifier, location)
+	return b, nil
+}
+
+// fillTag fills in the tag at the start of an encoded descriptor. The CRC covers everything after the tag.
+func fillTag(b []byte, identifier TagIdentifier, location uint32) {
+	binary.LittleEndian.PutUint16(b[0:], uint16(identifier))
+	binary.LittleEndian.PutUint16(b[2:], descriptorVersion)
+	b[5] = 0
+	binary.LittleEndian.PutUint16(b[6:], tagSerialNumber)
+	binary.LittleEndian.PutUint16(b[8:], CRC(b[tagSize:]))
+	binary.LittleEndian.PutUint16(b[10:], uint16(len(b)-tagSize))
+	binary.LittleEndian.PutUint32(b[12:], location)
+	b[4] = TagChecksum(b)
+}
+
+// TagChecksum is the sum, modulo 256, of the bytes of a tag other than the checksum itself
+//
+// ECMA-167 (3rd ed.) 3/7.2.3
+func TagChecksum(b []byte) uint8 {
+	sum := uint8(0)
+	for i := 0; i < tagSize; i++ {
+		if i != 4 {
+			sum += b[i]
+		}
+	}
+
+	return sum
+}
+
+// CRC is the CRC-ITU-T (polynomial 0x1021, initial value 0) of the bytes that follow a tag
+//
+// ECMA-167 (3rd ed.) 1/7.2.6
+func CRC(b []byte) uint16 {
+	crc := uint16(0)
+	for _, c := range b {
+		crc ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
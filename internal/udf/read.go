@@ -0,0 +1,214 @@
+package udf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrInvalidDescriptor indicates that a descriptor's tag doesn't match its contents or its location
+var ErrInvalidDescriptor = errors.New("invalid UDF descriptor")
+
+// fileIdentifierDescriptorHeaderSize is the size of a file identifier descriptor before its implementation use and
+// file identifier
+const fileIdentifierDescriptorHeaderSize = 38
+
+// Reader reads the file set of a UDF volume that has a single partition, such as a UDF bridge volume written by this
+// package
+type Reader struct {
+	r io.ReaderAt
+
+	// PartitionStart is the sector at which the partition starts
+	PartitionStart uint32
+
+	// FileSet is the file set descriptor of the volume
+	FileSet FileSetDescriptor
+}
+
+// DirectoryEntry is a file or directory in a directory
+type DirectoryEntry struct {
+	Name            string
+	Characteristics uint8
+	Entry           *FileEntry
+}
+
+// Open reads the anchor and main volume descriptor sequence of a volume, and the file set descriptor that they locate
+func Open(r io.ReaderAt) (*Reader, error) {
+	var anchor AnchorVolumeDescriptorPointer
+	if err := ReadDescriptor(r, AnchorLocation, TagAnchorVolumeDescriptorPointer, AnchorLocation, &anchor); err != nil {
+		return nil, fmt.Errorf("could not read anchor: %w", err)
+	}
+
+	reader := &Reader{r: r}
+	var fileSet *LongAD
+
+	sequence := anchor.MainVolumeDescriptorSequence
+	for sector := sequence.Location; sector < sequence.Location+sequence.Length/SectorSize; sector++ {
+		var tag Tag
+		if err := ReadDescriptor(r, sector, 0, sector, &tag); err != nil {
+			return nil, fmt.Errorf("could not read volume descriptor: %w", err)
+		}
+
+		switch tag.Identifier {
+		case TagPartitionDescriptor:
+			var pd PartitionDescriptor
+			if err := ReadDescriptor(r, sector, TagPartitionDescriptor, sector, &pd); err != nil {
+				return nil, fmt.Errorf("could not read partition descriptor: %w", err)
+			}
+
+			reader.PartitionStart = pd.PartitionStartingLocation
+		case TagLogicalVolumeDescriptor:
+			var lvd LogicalVolumeDescriptor
+			if err := ReadDescriptor(r, sector, TagLogicalVolumeDescriptor, sector, &lvd); err != nil {
+				return nil, fmt.Errorf("could not read logical volume descriptor: %w", err)
+			}
+
+			fileSet = &lvd.LogicalVolumeContentsUse
+		}
+
+		if tag.Identifier == TagTerminatingDescriptor {
+			break
+		}
+	}
+
+	if fileSet == nil {
+		return nil, fmt.Errorf("%w: volume descriptor sequence has no logical volume descriptor", ErrInvalidDescriptor)
+	}
+
+	if err := reader.read(fileSet.Location.LogicalBlockNumber, TagFileSetDescriptor, &reader.FileSet); err != nil {
+		return nil, fmt.Errorf("could not read file set descriptor: %w", err)
+	}
+
+	return reader, nil
+}
+
+// ReadDescriptor reads the descriptor at a sector, checks that its tag is valid, and unpacks it into v. The tag must
+// have the given identifier, unless identifier is zero, and must record the given location.
+func ReadDescriptor(r io.ReaderAt, sector uint32, identifier TagIdentifier, location uint32, v any) error {
+	b := make([]byte, SectorSize)
+	if _, err := r.ReadAt(b, int64(sector)*SectorSize); err != nil {
+		return fmt.Errorf("could not read sector %d: %w", sector, err)
+	}
+
+	if err := checkTag(b, identifier, location); err != nil {
+		return fmt.Errorf("descriptor at sector %d: %w", sector, err)
+	}
+
+	return Unpack(b, v)
+}
+
+func checkTag(b []byte, identifier TagIdentifier, location uint32) error {
+	var tag Tag
+	if err := Unpack(b, &tag); err != nil {
+		return err
+	}
+
+	switch {
+	case tag.Checksum != TagChecksum(b):
+		return fmt.Errorf("%w: tag checksum mismatch", ErrInvalidDescriptor)
+	case identifier != 0 && tag.Identifier != identifier:
+		return fmt.Errorf("%w: expected tag identifier %d, but got %d", ErrInvalidDescriptor, identifier, tag.Identifier)
+	case tag.Location != location:
+		return fmt.Errorf("%w: tag records location %d, but descriptor is at %d", ErrInvalidDescriptor, tag.Location, location)
+	case tagSize+int(tag.DescriptorCRCLength) > len(b):
+		return fmt.Errorf("%w: CRC length %d overruns descriptor", ErrInvalidDescriptor, tag.DescriptorCRCLength)
+	case tag.DescriptorCRC != CRC(b[tagSize:tagSize+int(tag.DescriptorCRCLength)]):
+		return fmt.Errorf("%w: CRC mismatch", ErrInvalidDescriptor)
+	}
+
+	return nil
+}
+
+// read reads a descriptor at a logical block of the partition
+func (r *Reader) read(block uint32, identifier TagIdentifier, v any) error {
+	return ReadDescriptor(r.r, r.PartitionStart+block, identifier, block, v)
+}
+
+// Root reads the file entry of the root directory
+func (r *Reader) Root() (*FileEntry, error) {
+	var entry FileEntry
+	if err := r.read(r.FileSet.RootDirectoryICB.Location.LogicalBlockNumber, TagFileEntry, &entry); err != nil {
+		return nil, fmt.Errorf("could not read root directory: %w", err)
+	}
+
+	return &entry, nil
+}
+
+// ReadFile reads the data of a file or directory
+func (r *Reader) ReadFile(entry *FileEntry) ([]byte, error) {
+	if entry.ICBTag.Flags&0x7 != 0 {
+		return nil, fmt.Errorf("%w: only short allocation descriptors are supported", ErrInvalidDescriptor)
+	}
+
+	data := make([]byte, 0, entry.InformationLength)
+	for offset := 0; offset+8 <= len(entry.AllocationDescriptors); offset += 8 {
+		var descriptor ShortAD
+		if err := Unpack(entry.AllocationDescriptors[offset:], &descriptor); err != nil {
+			return nil, err
+		}
+
+		extent := make([]byte, descriptor.Length&(1<<30-1))
+		if _, err := r.r.ReadAt(extent, int64(r.PartitionStart+descriptor.Position)*SectorSize); err != nil {
+			return nil, fmt.Errorf("could not read extent: %w", err)
+		}
+
+		data = append(data, extent...)
+	}
+
+	if uint64(len(data)) != entry.InformationLength {
+		return nil, fmt.Errorf("%w: extents hold %d bytes, but file is %d bytes", ErrInvalidDescriptor, len(data), entry.InformationLength)
+	}
+
+	return data, nil
+}
+
+// ReadDir reads the entries of a directory, including its parent
+func (r *Reader) ReadDir(dir *FileEntry) ([]DirectoryEntry, error) {
+	data, err := r.ReadFile(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read directory: %w", err)
+	}
+
+	// Directories are written contiguously, so the logical block of each descriptor follows from the first
+	var descriptor ShortAD
+	if err := Unpack(dir.AllocationDescriptors, &descriptor); err != nil {
+		return nil, err
+	}
+
+	var entries []DirectoryEntry
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < fileIdentifierDescriptorHeaderSize {
+			return nil, fmt.Errorf("%w: truncated file identifier descriptor", ErrInvalidDescriptor)
+		}
+
+		header := data[offset:]
+		identifierLength := int(header[19])
+		implementationUseLength := int(binary.LittleEndian.Uint16(header[36:]))
+		length := int(fileIdentifierDescriptorSize(implementationUseLength + identifierLength))
+		if length > len(header) {
+			return nil, fmt.Errorf("%w: file identifier descriptor overruns directory", ErrInvalidDescriptor)
+		}
+
+		if err := checkTag(header[:length], TagFileIdentifierDescriptor, descriptor.Position+uint32(offset)/SectorSize); err != nil {
+			return nil, err
+		}
+
+		start := fileIdentifierDescriptorHeaderSize + implementationUseLength
+		entry := DirectoryEntry{
+			Name:            DecodeCompressedUnicode(header[start : start+identifierLength]),
+			Characteristics: header[18],
+			Entry:           &FileEntry{},
+		}
+
+		icb := binary.LittleEndian.Uint32(header[24:])
+		if err := r.read(icb, TagFileEntry, entry.Entry); err != nil {
+			return nil, fmt.Errorf("could not read file entry of '%s': %w", entry.Name, err)
+		}
+
+		entries = append(entries, entry)
+		offset += length
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,482 @@
+package udf
+
+import (
+	"time"
+	"unicode/utf16"
+)
+
+// TagIdentifier identifies the type of a descriptor
+//
+// ECMA-167 (3rd ed.) 3/7.2.1, 4/7.2.1
+type TagIdentifier uint16
+
+const (
+	TagPrimaryVolumeDescriptor           TagIdentifier = 1
+	TagAnchorVolumeDescriptorPointer     TagIdentifier = 2
+	TagImplementationUseVolumeDescriptor TagIdentifier = 4
+	TagPartitionDescriptor               TagIdentifier = 5
+	TagLogicalVolumeDescriptor           TagIdentifier = 6
+	TagUnallocatedSpaceDescriptor        TagIdentifier = 7
+	TagTerminatingDescriptor             TagIdentifier = 8
+	TagLogicalVolumeIntegrityDescriptor  TagIdentifier = 9
+	TagFileSetDescriptor                 TagIdentifier = 256
+	TagFileIdentifierDescriptor          TagIdentifier = 257
+	TagFileEntry                         TagIdentifier = 261
+)
+
+// File types recorded in the ICB tag of a file entry
+//
+// ECMA-167 (3rd ed.) 4/14.6.6
+const (
+	FileTypeDirectory uint8 = 4
+	FileTypeRegular   uint8 = 5
+)
+
+// File characteristics recorded in a file identifier descriptor
+//
+// ECMA-167 (3rd ed.) 4/14.4.3
+const (
+	FileCharacteristicHidden    uint8 = 0x01
+	FileCharacteristicDirectory uint8 = 0x02
+	FileCharacteristicDeleted   uint8 = 0x04
+	FileCharacteristicParent    uint8 = 0x08
+)
+
+// Tag is the descriptor tag at the start of every descriptor, which identifies it and protects it with a checksum and
+// CRC. Tags are filled in by [Encode], so descriptors can be built with a zero Tag.
+//
+// ECMA-167 (3rd ed.) 3/7.2
+type Tag struct {
+	Identifier          TagIdentifier
+	DescriptorVersion   uint16
+	Checksum            uint8
+	Reserved            uint8
+	SerialNumber        uint16
+	DescriptorCRC       uint16
+	DescriptorCRCLength uint16
+	Location            uint32
+}
+
+// ExtentAD locates an extent of sectors on the volume
+//
+// ECMA-167 (3rd ed.) 3/7.1
+type ExtentAD struct {
+	Length   uint32
+	Location uint32
+}
+
+// LBAddr is the address of a logical block within a partition
+//
+// ECMA-167 (3rd ed.) 4/7.1
+type LBAddr struct {
+	LogicalBlockNumber       uint32
+	PartitionReferenceNumber uint16
+}
+
+// ShortAD is an allocation descriptor for an extent in the same partition as the descriptor. The top two bits of
+// Length give the type of the extent; zero means recorded and allocated.
+//
+// ECMA-167 (3rd ed.) 4/14.14.1
+type ShortAD struct {
+	Length   uint32
+	Position uint32
+}
+
+// LongAD is an allocation descriptor for an extent in any partition
+//
+// ECMA-167 (3rd ed.) 4/14.14.2
+type LongAD struct {
+	Length            uint32
+	Location          LBAddr
+	ImplementationUse [6]uint8
+}
+
+// RegID is an entity identifier, which identifies the implementation or standard that recorded or governs a structure
+//
+// ECMA-167 (3rd ed.) 1/7.4, UDF 2.1.5
+type RegID struct {
+	Flags            uint8
+	Identifier       [23]uint8
+	IdentifierSuffix [8]uint8
+}
+
+// CharSpec identifies the character set of strings in a descriptor. UDF only allows the OSTA Compressed Unicode set.
+//
+// ECMA-167 (3rd ed.) 1/7.2.1, UDF 2.1.2
+type CharSpec struct {
+	Type        uint8
+	Information [63]uint8
+}
+
+// Timestamp is a date and time with a time zone
+//
+// ECMA-167 (3rd ed.) 1/7.3
+type Timestamp struct {
+	TypeAndTimezone        uint16
+	Year                   int16
+	Month                  uint8
+	Day                    uint8
+	Hour                   uint8
+	Minute                 uint8
+	Second                 uint8
+	Centiseconds           uint8
+	HundredsOfMicroseconds uint8
+	Microseconds           uint8
+}
+
+// ICBTag describes the file that an information control block (in our case, always a single file entry) belongs to
+//
+// ECMA-167 (3rd ed.) 4/14.6
+type ICBTag struct {
+	PriorRecordedNumberOfDirectEntries uint32
+	StrategyType                       uint16
+	StrategyParameter                  [2]uint8
+	MaximumNumberOfEntries             uint16
+	Reserved                           uint8
+	FileType                           uint8
+	ParentICBLocation                  LBAddr
+	Flags                              uint16
+}
+
+// VolumeStructureDescriptor is a descriptor in the volume recognition sequence, which follows the ISO 9660 volume
+// descriptor set and tells readers that the volume also contains UDF structures
+//
+// ECMA-167 (3rd ed.) 2/9.1
+type VolumeStructureDescriptor struct {
+	Type               uint8
+	StandardIdentifier [5]uint8
+	Version            uint8
+	Data               [2041]uint8
+}
+
+// PrimaryVolumeDescriptor identifies the volume
+//
+// ECMA-167 (3rd ed.) 3/10.1
+type PrimaryVolumeDescriptor struct {
+	Tag                                         Tag
+	VolumeDescriptorSequenceNumber              uint32
+	PrimaryVolumeDescriptorNumber               uint32
+	VolumeIdentifier                            [32]uint8
+	VolumeSequenceNumber                        uint16
+	MaximumVolumeSequenceNumber                 uint16
+	InterchangeLevel                            uint16
+	MaximumInterchangeLevel                     uint16
+	CharacterSetList                            uint32
+	MaximumCharacterSetList                     uint32
+	VolumeSetIdentifier                         [128]uint8
+	DescriptorCharacterSet                      CharSpec
+	ExplanatoryCharacterSet                     CharSpec
+	VolumeAbstract                              ExtentAD
+	VolumeCopyrightNotice                       ExtentAD
+	ApplicationIdentifier                       RegID
+	RecordingDateAndTime                        Timestamp
+	ImplementationIdentifier                    RegID
+	ImplementationUse                           [64]uint8
+	PredecessorVolumeDescriptorSequenceLocation uint32
+	Flags                                       uint16
+	Reserved                                    [22]uint8
+}
+
+// AnchorVolumeDescriptorPointer locates the volume descriptor sequences. It is recorded at sector 256 and at the last
+// sector of the volume.
+//
+// ECMA-167 (3rd ed.) 3/10.2
+type AnchorVolumeDescriptorPointer struct {
+	Tag                             Tag
+	MainVolumeDescriptorSequence    ExtentAD
+	ReserveVolumeDescriptorSequence ExtentAD
+	Reserved                        [480]uint8
+}
+
+// ImplementationUseVolumeDescriptor records the logical volume information that UDF requires
+//
+// ECMA-167 (3rd ed.) 3/10.4, UDF 2.2.7
+type ImplementationUseVolumeDescriptor struct {
+	Tag                            Tag
+	VolumeDescriptorSequenceNumber uint32
+	ImplementationIdentifier       RegID
+	LVICharset                     CharSpec
+	LogicalVolumeIdentifier        [128]uint8
+	LVInfo1                        [36]uint8
+	LVInfo2                        [36]uint8
+	LVInfo3                        [36]uint8
+	ImplementationID               RegID
+	ImplementationUse              [128]uint8
+}
+
+// PartitionDescriptor describes the partition in which the file set and file data are recorded
+//
+// ECMA-167 (3rd ed.) 3/10.5
+type PartitionDescriptor struct {
+	Tag                            Tag
+	VolumeDescriptorSequenceNumber uint32
+	PartitionFlags                 uint16
+	PartitionNumber                uint16
+	PartitionContents              RegID
+	PartitionContentsUse           [128]uint8
+	AccessType                     uint32
+	PartitionStartingLocation      uint32
+	PartitionLength                uint32
+	ImplementationIdentifier       RegID
+	ImplementationUse              [128]uint8
+	Reserved                       [156]uint8
+}
+
+// PartitionMap is a type 1 partition map, which maps a logical volume's partition reference number to a partition on
+// the volume
+//
+// ECMA-167 (3rd ed.) 3/10.7.2
+type PartitionMap struct {
+	Type                 uint8
+	Length               uint8
+	VolumeSequenceNumber uint16
+	PartitionNumber      uint16
+}
+
+// LogicalVolumeDescriptor describes the logical volume, and locates its file set
+//
+// ECMA-167 (3rd ed.) 3/10.6
+type LogicalVolumeDescriptor struct {
+	Tag                            Tag
+	VolumeDescriptorSequenceNumber uint32
+	DescriptorCharacterSet         CharSpec
+	LogicalVolumeIdentifier        [128]uint8
+	LogicalBlockSize               uint32
+	DomainIdentifier               RegID
+	LogicalVolumeContentsUse       LongAD
+	MapTableLength                 uint32
+	NumberOfPartitionMaps          uint32
+	ImplementationIdentifier       RegID
+	ImplementationUse              [128]uint8
+	IntegritySequenceExtent        ExtentAD
+	PartitionMap                   PartitionMap
+}
+
+// UnallocatedSpaceDescriptor lists the unallocated space on the volume, of which there is none
+//
+// ECMA-167 (3rd ed.) 3/10.8
+type UnallocatedSpaceDescriptor struct {
+	Tag                            Tag
+	VolumeDescriptorSequenceNumber uint32
+	NumberOfAllocationDescriptors  uint32
+}
+
+// TerminatingDescriptor ends a descriptor sequence
+//
+// ECMA-167 (3rd ed.) 3/10.9, 4/14.2
+type TerminatingDescriptor struct {
+	Tag      Tag
+	Reserved [496]uint8
+}
+
+// LogicalVolumeIntegrityDescriptor records whether the logical volume is in a consistent state, along with the
+// number of files and directories in it
+//
+// ECMA-167 (3rd ed.) 3/10.10, UDF 2.2.6
+type LogicalVolumeIntegrityDescriptor struct {
+	Tag                       Tag
+	RecordingDateAndTime      Timestamp
+	IntegrityType             uint32
+	NextIntegrityExtent       ExtentAD
+	NextUniqueID              uint64
+	LogicalVolumeContentsUse  [24]uint8
+	NumberOfPartitions        uint32
+	LengthOfImplementationUse uint32
+	FreeSpaceTable            uint32
+	SizeTable                 uint32
+	ImplementationID          RegID
+	NumberOfFiles             uint32
+	NumberOfDirectories       uint32
+	MinimumUDFReadRevision    uint16
+	MinimumUDFWriteRevision   uint16
+	MaximumUDFWriteRevision   uint16
+}
+
+// FileSetDescriptor locates the root directory of the file set
+//
+// ECMA-167 (3rd ed.) 4/14.1
+type FileSetDescriptor struct {
+	Tag                                 Tag
+	RecordingDateAndTime                Timestamp
+	InterchangeLevel                    uint16
+	MaximumInterchangeLevel             uint16
+	CharacterSetList                    uint32
+	MaximumCharacterSetList             uint32
+	FileSetNumber                       uint32
+	FileSetDescriptorNumber             uint32
+	LogicalVolumeIdentifierCharacterSet CharSpec
+	LogicalVolumeIdentifier             [128]uint8
+	FileSetCharacterSet                 CharSpec
+	FileSetIdentifier                   [32]uint8
+	CopyrightFileIdentifier             [32]uint8
+	AbstractFileIdentifier              [32]uint8
+	RootDirectoryICB                    LongAD
+	DomainIdentifier                    RegID
+	NextExtent                          LongAD
+	Reserved                            [48]uint8
+}
+
+// FileEntry describes a file or directory, and locates its data with allocation descriptors, which follow it
+//
+// ECMA-167 (3rd ed.) 4/14.9
+type FileEntry struct {
+	Tag                           Tag
+	ICBTag                        ICBTag
+	UID                           uint32
+	GID                           uint32
+	Permissions                   uint32
+	FileLinkCount                 uint16
+	RecordFormat                  uint8
+	RecordDisplayAttributes       uint8
+	RecordLength                  uint32
+	InformationLength             uint64
+	LogicalBlocksRecorded         uint64
+	AccessTime                    Timestamp
+	ModificationTime              Timestamp
+	AttributeTime                 Timestamp
+	Checkpoint                    uint32
+	ExtendedAttributeICB          LongAD
+	ImplementationIdentifier      RegID
+	UniqueID                      uint64
+	LengthOfExtendedAttributes    uint32
+	LengthOfAllocationDescriptors uint32 `struc:"sizeof=AllocationDescriptors"`
+	AllocationDescriptors         []uint8
+}
+
+// FileIdentifierDescriptor is an entry in a directory, which names a file or directory and locates its file entry
+//
+// ECMA-167 (3rd ed.) 4/14.4
+type FileIdentifierDescriptor struct {
+	Tag                       Tag
+	FileVersionNumber         uint16
+	FileCharacteristics       uint8
+	LengthOfFileIdentifier    uint8 `struc:"sizeof=FileIdentifier"`
+	ICB                       LongAD
+	LengthOfImplementationUse uint16
+	FileIdentifier            []uint8
+}
+
+// NewTimestamp converts a time to a timestamp in the time's own time zone
+func NewTimestamp(t time.Time) Timestamp {
+	_, offset := t.Zone()
+	nanoseconds := t.Nanosecond()
+
+	return Timestamp{
+		// Type 1 is local time, and the time zone is a 12-bit signed offset from UTC in minutes
+		TypeAndTimezone:        1<<12 | uint16(offset/60)&0x0FFF,
+		Year:                   int16(t.Year()),
+		Month:                  uint8(t.Month()),
+		Day:                    uint8(t.Day()),
+		Hour:                   uint8(t.Hour()),
+		Minute:                 uint8(t.Minute()),
+		Second:                 uint8(t.Second()),
+		Centiseconds:           uint8(nanoseconds / 10_000_000),
+		HundredsOfMicroseconds: uint8(nanoseconds / 100_000 % 100),
+		Microseconds:           uint8(nanoseconds / 1000 % 100),
+	}
+}
+
+// Time converts a timestamp to a time
+func (t Timestamp) Time() time.Time {
+	offset := int(t.TypeAndTimezone & 0x0FFF)
+	if offset >= 0x800 {
+		offset -= 0x1000
+	}
+
+	nanoseconds := int(t.Centiseconds)*10_000_000 + int(t.HundredsOfMicroseconds)*100_000 + int(t.Microseconds)*1000
+	zone := time.FixedZone("", offset*60)
+
+	return time.Date(int(t.Year), time.Month(t.Month), int(t.Day), int(t.Hour), int(t.Minute), int(t.Second), nanoseconds, zone)
+}
+
+// CompressedUnicode encodes a string in the OSTA Compressed Unicode character set: a compression ID followed by either
+// one byte per character, if every character fits in a byte, or UTF-16BE otherwise
+//
+// UDF 2.1.1
+func CompressedUnicode(s string) []uint8 {
+	runes := []rune(s)
+
+	wide := false
+	for _, r := range runes {
+		if r > 0xFF {
+			wide = true
+			break
+		}
+	}
+
+	if !wide {
+		encoded := make([]uint8, 0, len(runes)+1)
+		encoded = append(encoded, 8)
+		for _, r := range runes {
+			encoded = append(encoded, uint8(r))
+		}
+
+		return encoded
+	}
+
+	units := utf16.Encode(runes)
+	encoded := make([]uint8, 0, 2*len(units)+1)
+	encoded = append(encoded, 16)
+	for _, unit := range units {
+		encoded = append(encoded, uint8(unit>>8), uint8(unit))
+	}
+
+	return encoded
+}
+
+// DecodeCompressedUnicode decodes a string in the OSTA Compressed Unicode character set
+func DecodeCompressedUnicode(b []uint8) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	switch b[0] {
+	case 8:
+		runes := make([]rune, len(b)-1)
+		for i, c := range b[1:] {
+			runes[i] = rune(c)
+		}
+
+		return string(runes)
+	case 16:
+		units := make([]uint16, (len(b)-1)/2)
+		for i := range units {
+			units[i] = uint16(b[1+2*i])<<8 | uint16(b[2+2*i])
+		}
+
+		return string(utf16.Decode(units))
+	default:
+		return ""
+	}
+}
+
+// DString encodes a string as a fixed-length dstring: OSTA Compressed Unicode, truncated to whole characters that fit,
+// with the length of the encoded string in the last byte. An empty string is recorded as all zeros.
+//
+// ECMA-167 (3rd ed.) 1/7.2.12
+func DString(s string, output []uint8) {
+	clear(output)
+	if s == "" {
+		return
+	}
+
+	runes := []rune(s)
+	encoded := CompressedUnicode(s)
+	for len(encoded) > len(output)-1 {
+		runes = runes[:len(runes)-1]
+		encoded = CompressedUnicode(string(runes))
+	}
+
+	copy(output, encoded)
+	output[len(output)-1] = uint8(len(encoded))
+}
+
+// DecodeDString decodes a fixed-length dstring
+func DecodeDString(b []uint8) string {
+	if len(b) == 0 {
+		return ""
+	}
+
+	length := min(int(b[len(b)-1]), len(b)-1)
+	return DecodeCompressedUnicode(b[:length])
+}
@@ -0,0 +1,571 @@
+// Package udf builds the structures of a UDF bridge volume, which describe the same files as the ISO 9660 structures of
+// an image, for readers that only understand UDF.
+//
+// The structures follow UDF 1.02 (as recognised by an NSR02 descriptor) on a single read-only partition. File data
+// isn't written by this package: file entries refer to extents that are laid out and written along with the ISO 9660
+// structures, which must lie within the partition.
+package udf
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+const (
+	// SectorSize is the size of a sector, and of a logical block in the partition
+	SectorSize = 2048
+
+	// MainSequenceLocation, ReserveSequenceLocation and IntegritySequenceLocation are the sectors at which the volume
+	// descriptor sequences and the logical volume integrity sequence are recorded. These are the locations that
+	// mkisofs uses, between the ISO 9660 volume descriptor set and the anchor.
+	MainSequenceLocation      = 32
+	ReserveSequenceLocation   = 48
+	IntegritySequenceLocation = 64
+
+	// sequenceLength is the number of sectors reserved for each volume descriptor sequence, which UDF requires to be
+	// at least 16
+	sequenceLength = 16
+
+	// AnchorLocation is the sector of the first anchor volume descriptor pointer
+	AnchorLocation = 256
+
+	// PartitionStart is the first sector of the partition, which directly follows the first anchor
+	PartitionStart = AnchorLocation + 1
+
+	// RecognitionSequenceLength is the number of sectors in the volume recognition sequence
+	RecognitionSequenceLength = 3
+
+	// MaxNameLength is the longest name, in bytes of OSTA Compressed Unicode, that can be recorded
+	MaxNameLength = 255
+
+	// udfRevision is the UDF revision that the volume complies with, as binary coded decimal
+	udfRevision = 0x0102
+
+	// maxExtentLength is the largest extent that an allocation descriptor can describe, rounded down to whole blocks,
+	// since the top two bits of the length are the extent type
+	maxExtentLength = (1<<30 - 1) / SectorSize * SectorSize
+
+	// firstUniqueID is the unique ID of the first file after the root directory. UDF reserves 1-15.
+	firstUniqueID = 16
+
+	// invalidID is recorded as the owner and group of files, since there are no meaningful values
+	invalidID = 0xFFFFFFFF
+
+	// Permissions of files and directories: read for everyone, and execute (search) for directories
+	permissionsFile      = 0x04 | 0x04<<5 | 0x04<<10
+	permissionsDirectory = permissionsFile | 0x01 | 0x01<<5 | 0x01<<10
+)
+
+var (
+	// ErrNameTooLong indicates that a name is longer than [MaxNameLength] when encoded
+	ErrNameTooLong = errors.New("name too long for UDF")
+	// ErrOutsidePartition indicates that a file's data isn't within the partition, so can't be referred to
+	ErrOutsidePartition = errors.New("file data lies outside UDF partition")
+)
+
+// Node is a file or directory in the file set
+type Node struct {
+	Name    string
+	ModTime time.Time
+	IsDir   bool
+
+	// Hidden sets the existence bit of the node's file identifier descriptor, so that readers don't show it unless
+	// asked to
+	Hidden bool
+
+	// Children are the entries of a directory
+	Children []*Node
+
+	// Location is the sector at which a file's data starts, and Size is its length in bytes. These are set once the
+	// data has been laid out.
+	Location uint32
+	Size     uint64
+
+	// entry and data are the logical blocks of the node's file entry and, for directories, its file identifier
+	// descriptors
+	entry    uint32
+	data     uint32
+	uniqueID uint64
+	parent   *Node
+}
+
+// Volume is a UDF bridge volume
+type Volume struct {
+	identifier string
+	recordedAt time.Time
+	root       *Node
+
+	// nodes are all nodes in the file set in breadth-first order, starting with the root directory
+	nodes []*Node
+
+	// blocks is the number of blocks that the file set uses at the start of the partition, and end is the sector of
+	// the second anchor, after the partition
+	blocks uint32
+	end    uint32
+}
+
+// NewVolume creates a volume for a file set with the given root directory
+func NewVolume(identifier string, recordedAt time.Time, root *Node) (*Volume, error) {
+	v := &Volume{identifier: identifier, recordedAt: recordedAt, root: root}
+
+	root.parent = root
+	v.nodes = []*Node{root}
+	for i := 0; i < len(v.nodes); i++ {
+		node := v.nodes[i]
+		node.uniqueID = uint64(firstUniqueID + i - 1)
+
+		for _, child := range node.Children {
+			if length := len(CompressedUnicode(child.Name)); length > MaxNameLength {
+				return nil, fmt.Errorf("%w: '%s' is %d bytes, but at most %d bytes are allowed", ErrNameTooLong, child.Name, length, MaxNameLength)
+			}
+
+			child.parent = node
+			v.nodes = append(v.nodes, child)
+		}
+	}
+
+	// UDF reserves unique ID 0 for the root directory
+	root.uniqueID = 0
+
+	return v, nil
+}
+
+// Allocate allocates blocks for the file set at the start of the partition: the file set descriptor, a file entry for
+// every file and directory, and the contents of every directory. block must be [PartitionStart], and is advanced past
+// the file set, which is where file data can start.
+func (v *Volume) Allocate(block *uint32) {
+	// Blocks 0 and 1 of the partition are the file set descriptor and the descriptor that terminates the file set
+	// descriptor sequence
+	next := uint32(2)
+
+	for _, node := range v.nodes {
+		node.entry = next
+		next++
+
+		if node.IsDir {
+			node.data = next
+			next += (directorySize(node) + SectorSize - 1) / SectorSize
+		}
+	}
+
+	v.blocks = next
+	*block += next
+}
+
+// AllocateAnchor allocates the sector of the second anchor, which is the last sector of the volume. This must be
+// called once everything in the partition has been allocated, since the partition ends just before the anchor.
+func (v *Volume) AllocateAnchor(block *uint32) {
+	v.end = *block
+	*block++
+}
+
+// Extent is a structure to be written at a particular sector
+type Extent struct {
+	Location uint32
+	Data     []byte
+}
+
+// Extents returns every structure of the volume, in ascending order of sector. This includes the volume recognition
+// sequence, which starts at recognitionSequence, directly after the ISO 9660 volume descriptor set.
+func (v *Volume) Extents(recognitionSequence uint32) ([]Extent, error) {
+	var extents []Extent
+	add := func(location uint32, data []byte, err error) error {
+		if err != nil {
+			return err
+		}
+
+		extents = append(extents, Extent{Location: location, Data: data})
+		return nil
+	}
+
+	for i, identifier := range []string{"BEA01", "NSR02", "TEA01"} {
+		descriptor := &VolumeStructureDescriptor{Version: 1}
+		copy(descriptor.StandardIdentifier[:], identifier)
+
+		data, err := Pack(descriptor)
+		if err := add(recognitionSequence+uint32(i), data, err); err != nil {
+			return nil, fmt.Errorf("could not encode volume recognition sequence: %w", err)
+		}
+	}
+
+	for _, start := range []uint32{MainSequenceLocation, ReserveSequenceLocation} {
+		for i, descriptor := range v.volumeDescriptors() {
+			location := start + uint32(i)
+			data, err := Encode(descriptor.value, descriptor.identifier, location)
+			if err := add(location, data, err); err != nil {
+				return nil, fmt.Errorf("could not encode volume descriptor: %w", err)
+			}
+		}
+	}
+
+	data, err := Encode(v.integrityDescriptor(), TagLogicalVolumeIntegrityDescriptor, IntegritySequenceLocation)
+	if err := add(IntegritySequenceLocation, data, err); err != nil {
+		return nil, fmt.Errorf("could not encode logical volume integrity descriptor: %w", err)
+	}
+
+	data, err = Encode(&TerminatingDescriptor{}, TagTerminatingDescriptor, IntegritySequenceLocation+1)
+	if err := add(IntegritySequenceLocation+1, data, err); err != nil {
+		return nil, fmt.Errorf("could not encode terminating descriptor: %w", err)
+	}
+
+	data, err = Encode(v.anchor(), TagAnchorVolumeDescriptorPointer, AnchorLocation)
+	if err := add(AnchorLocation, data, err); err != nil {
+		return nil, fmt.Errorf("could not encode anchor: %w", err)
+	}
+
+	fileSet, err := v.fileSet()
+	if err != nil {
+		return nil, err
+	}
+
+	extents = append(extents, fileSet...)
+
+	data, err = Encode(v.anchor(), TagAnchorVolumeDescriptorPointer, v.end)
+	if err := add(v.end, data, err); err != nil {
+		return nil, fmt.Errorf("could not encode anchor: %w", err)
+	}
+
+	return extents, nil
+}
+
+// fileSet returns the structures in the partition: the file set descriptor, and the file entries and contents of
+// every file and directory
+func (v *Volume) fileSet() ([]Extent, error) {
+	var extents []Extent
+
+	fsd, err := Encode(v.fileSetDescriptor(), TagFileSetDescriptor, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode file set descriptor: %w", err)
+	}
+
+	terminator, err := Encode(&TerminatingDescriptor{}, TagTerminatingDescriptor, 1)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode terminating descriptor: %w", err)
+	}
+
+	extents = append(extents, Extent{Location: PartitionStart, Data: fsd}, Extent{Location: PartitionStart + 1, Data: terminator})
+
+	for _, node := range v.nodes {
+		entry, err := v.fileEntry(node)
+		if err != nil {
+			return nil, fmt.Errorf("could not create file entry for '%s': %w", node.Name, err)
+		}
+
+		data, err := Encode(entry, TagFileEntry, node.entry)
+		if err != nil {
+			return nil, fmt.Errorf("could not encode file entry for '%s': %w", node.Name, err)
+		}
+
+		extents = append(extents, Extent{Location: PartitionStart + node.entry, Data: data})
+
+		if node.IsDir {
+			data, err := directory(node)
+			if err != nil {
+				return nil, fmt.Errorf("could not encode directory '%s': %w", node.Name, err)
+			}
+
+			extents = append(extents, Extent{Location: PartitionStart + node.data, Data: data})
+		}
+	}
+
+	// File entries and directories are allocated in the same order, except that a directory's contents follow its
+	// file entry, so they are already nearly sorted
+	slices.SortStableFunc(extents, func(a, b Extent) int {
+		return cmp.Compare(a.Location, b.Location)
+	})
+
+	return extents, nil
+}
+
+type volumeDescriptor struct {
+	value      any
+	identifier TagIdentifier
+}
+
+// volumeDescriptors returns the descriptors of a volume descriptor sequence
+func (v *Volume) volumeDescriptors() []volumeDescriptor {
+	pvd := &PrimaryVolumeDescriptor{
+		VolumeDescriptorSequenceNumber: 0,
+		PrimaryVolumeDescriptorNumber:  0,
+		VolumeSequenceNumber:           1,
+		MaximumVolumeSequenceNumber:    1,
+		InterchangeLevel:               2,
+		MaximumInterchangeLevel:        2,
+		CharacterSetList:               1,
+		MaximumCharacterSetList:        1,
+		DescriptorCharacterSet:         osta(),
+		ExplanatoryCharacterSet:        osta(),
+		RecordingDateAndTime:           NewTimestamp(v.recordedAt),
+		ImplementationIdentifier:       implementation(),
+	}
+	DString(v.identifier, pvd.VolumeIdentifier[:])
+
+	// UDF requires the first 16 characters of the volume set identifier to be unique, so we use the recording time
+	DString(fmt.Sprintf("%016x%s", v.recordedAt.Unix(), v.identifier), pvd.VolumeSetIdentifier[:])
+
+	iuvd := &ImplementationUseVolumeDescriptor{
+		VolumeDescriptorSequenceNumber: 1,
+		ImplementationIdentifier:       regID("*UDF LV Info", udfSuffix()),
+		LVICharset:                     osta(),
+		ImplementationID:               implementation(),
+	}
+	DString(v.identifier, iuvd.LogicalVolumeIdentifier[:])
+
+	pd := &PartitionDescriptor{
+		VolumeDescriptorSequenceNumber: 2,
+		PartitionFlags:                 1, // Space is allocated
+		PartitionNumber:                0,
+		PartitionContents:              regID("+NSR02", [8]uint8{}),
+		AccessType:                     1, // Read only
+		PartitionStartingLocation:      PartitionStart,
+		PartitionLength:                v.end - PartitionStart,
+		ImplementationIdentifier:       implementation(),
+	}
+
+	lvd := &LogicalVolumeDescriptor{
+		VolumeDescriptorSequenceNumber: 3,
+		DescriptorCharacterSet:         osta(),
+		LogicalBlockSize:               SectorSize,
+		DomainIdentifier:               domain(),
+		LogicalVolumeContentsUse:       LongAD{Length: SectorSize, Location: LBAddr{LogicalBlockNumber: 0}},
+		MapTableLength:                 6,
+		NumberOfPartitionMaps:          1,
+		ImplementationIdentifier:       implementation(),
+		IntegritySequenceExtent:        ExtentAD{Length: 2 * SectorSize, Location: IntegritySequenceLocation},
+		PartitionMap:                   PartitionMap{Type: 1, Length: 6, VolumeSequenceNumber: 1, PartitionNumber: 0},
+	}
+	DString(v.identifier, lvd.LogicalVolumeIdentifier[:])
+
+	usd := &UnallocatedSpaceDescriptor{VolumeDescriptorSequenceNumber: 4}
+
+	return []volumeDescriptor{
+		{pvd, TagPrimaryVolumeDescriptor},
+		{iuvd, TagImplementationUseVolumeDescriptor},
+		{pd, TagPartitionDescriptor},
+		{lvd, TagLogicalVolumeDescriptor},
+		{usd, TagUnallocatedSpaceDescriptor},
+		{&TerminatingDescriptor{}, TagTerminatingDescriptor},
+	}
+}
+
+func (v *Volume) anchor() *AnchorVolumeDescriptorPointer {
+	return &AnchorVolumeDescriptorPointer{
+		MainVolumeDescriptorSequence:    ExtentAD{Length: sequenceLength * SectorSize, Location: MainSequenceLocation},
+		ReserveVolumeDescriptorSequence: ExtentAD{Length: sequenceLength * SectorSize, Location: ReserveSequenceLocation},
+	}
+}
+
+func (v *Volume) integrityDescriptor() *LogicalVolumeIntegrityDescriptor {
+	files, directories := uint32(0), uint32(0)
+	for _, node := range v.nodes {
+		if node.IsDir {
+			directories++
+		} else {
+			files++
+		}
+	}
+
+	return &LogicalVolumeIntegrityDescriptor{
+		RecordingDateAndTime:      NewTimestamp(v.recordedAt),
+		IntegrityType:             1, // Close integrity descriptor
+		NextUniqueID:              uint64(firstUniqueID + len(v.nodes)),
+		NumberOfPartitions:        1,
+		LengthOfImplementationUse: 46,
+		FreeSpaceTable:            0,
+		SizeTable:                 v.end - PartitionStart,
+		ImplementationID:          implementation(),
+		NumberOfFiles:             files,
+		NumberOfDirectories:       directories,
+		MinimumUDFReadRevision:    udfRevision,
+		MinimumUDFWriteRevision:   udfRevision,
+		MaximumUDFWriteRevision:   udfRevision,
+	}
+}
+
+func (v *Volume) fileSetDescriptor() *FileSetDescriptor {
+	fsd := &FileSetDescriptor{
+		RecordingDateAndTime:                NewTimestamp(v.recordedAt),
+		InterchangeLevel:                    3,
+		MaximumInterchangeLevel:             3,
+		CharacterSetList:                    1,
+		MaximumCharacterSetList:             1,
+		LogicalVolumeIdentifierCharacterSet: osta(),
+		FileSetCharacterSet:                 osta(),
+		RootDirectoryICB:                    LongAD{Length: SectorSize, Location: LBAddr{LogicalBlockNumber: v.root.entry}},
+		DomainIdentifier:                    domain(),
+	}
+	DString(v.identifier, fsd.LogicalVolumeIdentifier[:])
+	DString(v.identifier, fsd.FileSetIdentifier[:])
+
+	return fsd
+}
+
+func (v *Volume) fileEntry(node *Node) (*FileEntry, error) {
+	entry := &FileEntry{
+		ICBTag: ICBTag{
+			StrategyType:           4,
+			MaximumNumberOfEntries: 1,
+			FileType:               FileTypeRegular,
+			Flags:                  0, // Allocation descriptors are short_ad
+		},
+		UID:                      invalidID,
+		GID:                      invalidID,
+		Permissions:              permissionsFile,
+		FileLinkCount:            1,
+		AccessTime:               NewTimestamp(node.ModTime),
+		ModificationTime:         NewTimestamp(node.ModTime),
+		AttributeTime:            NewTimestamp(node.ModTime),
+		Checkpoint:               1,
+		ImplementationIdentifier: implementation(),
+		UniqueID:                 node.uniqueID,
+	}
+
+	var descriptors []ShortAD
+
+	if node.IsDir {
+		entry.ICBTag.FileType = FileTypeDirectory
+		entry.Permissions = permissionsDirectory
+		entry.InformationLength = uint64(directorySize(node))
+
+		// A directory is referred to by its entry in its parent, and by the parent entry of each subdirectory
+		for _, child := range node.Children {
+			if child.IsDir {
+				entry.FileLinkCount++
+			}
+		}
+
+		descriptors = []ShortAD{{Length: directorySize(node), Position: node.data}}
+	} else {
+		entry.InformationLength = node.Size
+
+		if node.Size > 0 && node.Location < PartitionStart+v.blocks {
+			return nil, fmt.Errorf("%w: data starts at sector %d, but files must start after sector %d", ErrOutsidePartition, node.Location, PartitionStart+v.blocks-1)
+		}
+
+		position := node.Location - PartitionStart
+		for remaining := node.Size; remaining > 0; {
+			length := min(remaining, maxExtentLength)
+			descriptors = append(descriptors, ShortAD{Length: uint32(length), Position: position})
+
+			remaining -= length
+			position += uint32(length / SectorSize)
+		}
+	}
+
+	for _, descriptor := range descriptors {
+		entry.LogicalBlocksRecorded += uint64((descriptor.Length + SectorSize - 1) / SectorSize)
+
+		b, err := Pack(&descriptor)
+		if err != nil {
+			return nil, err
+		}
+
+		entry.AllocationDescriptors = append(entry.AllocationDescriptors, b...)
+	}
+
+	return entry, nil
+}
+
+// directory encodes the file identifier descriptors of a directory: one for its parent, and one for each child
+func directory(node *Node) ([]byte, error) {
+	var data []byte
+
+	parent := fileIdentifierDescriptor(node.parent, nil, FileCharacteristicDirectory|FileCharacteristicParent)
+	for _, child := range append([]*Node{nil}, node.Children...) {
+		descriptor := parent
+		if child != nil {
+			characteristics := uint8(0)
+			if child.IsDir {
+				characteristics = FileCharacteristicDirectory
+			}
+
+			if child.Hidden {
+				characteristics |= FileCharacteristicHidden
+			}
+
+			descriptor = fileIdentifierDescriptor(child, CompressedUnicode(child.Name), characteristics)
+		}
+
+		encoded, err := Pack(descriptor)
+		if err != nil {
+			return nil, err
+		}
+
+		// Descriptors are padded to a multiple of 4 bytes, and may span logical blocks, in which case the tag records
+		// the block in which the descriptor starts
+		encoded = append(encoded, make([]byte, fileIdentifierDescriptorSize(len(descriptor.FileIdentifier))-uint32(len(encoded)))...)
+		fillTag(encoded, TagFileIdentifierDescriptor, node.data+uint32(len(data))/SectorSize)
+
+		data = append(data, encoded...)
+	}
+
+	return data, nil
+}
+
+func fileIdentifierDescriptor(target *Node, identifier []uint8, characteristics uint8) *FileIdentifierDescriptor {
+	descriptor := &FileIdentifierDescriptor{
+		FileVersionNumber:   1,
+		FileCharacteristics: characteristics,
+		ICB:                 LongAD{Length: SectorSize, Location: LBAddr{LogicalBlockNumber: target.entry}},
+		FileIdentifier:      identifier,
+	}
+
+	// UDF records the unique ID of the target in the implementation use of the ICB
+	descriptor.ICB.ImplementationUse[2] = uint8(target.uniqueID)
+	descriptor.ICB.ImplementationUse[3] = uint8(target.uniqueID >> 8)
+	descriptor.ICB.ImplementationUse[4] = uint8(target.uniqueID >> 16)
+	descriptor.ICB.ImplementationUse[5] = uint8(target.uniqueID >> 24)
+
+	return descriptor
+}
+
+// fileIdentifierDescriptorSize is the size of a file identifier descriptor with an identifier of the given length,
+// including padding
+//
+// ECMA-167 (3rd ed.) 4/14.4
+func fileIdentifierDescriptorSize(identifierLength int) uint32 {
+	return uint32(38+identifierLength+3) / 4 * 4
+}
+
+// directorySize is the size of the file identifier descriptors of a directory
+func directorySize(node *Node) uint32 {
+	size := fileIdentifierDescriptorSize(0)
+	for _, child := range node.Children {
+		size += fileIdentifierDescriptorSize(len(CompressedUnicode(child.Name)))
+	}
+
+	return size
+}
+
+func osta() CharSpec {
+	c := CharSpec{Type: 0}
+	copy(c.Information[:], "OSTA Compressed Unicode")
+	return c
+}
+
+func regID(identifier string, suffix [8]uint8) RegID {
+	r := RegID{IdentifierSuffix: suffix}
+	copy(r.Identifier[:], identifier)
+	return r
+}
+
+// udfSuffix is the identifier suffix of UDF entity identifiers, which gives the UDF revision
+//
+// UDF 2.1.5.3
+func udfSuffix() [8]uint8 {
+	return [8]uint8{udfRevision & 0xFF, udfRevision >> 8}
+}
+
+func domain() RegID {
+	// The domain flags, which follow the revision, say whether the volume and file set are write protected
+	suffix := udfSuffix()
+	suffix[2] = 0x03
+	return regID("*OSTA UDF Compliant", suffix)
+}
+
+func implementation() RegID {
+	return regID("*go-iso9660", [8]uint8{})
+}
@@ -0,0 +1,172 @@
+package udf_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/udf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCRC(t *testing.T) {
+	assert.Equal(t, uint16(0x31C3), udf.CRC([]byte("123456789")), "CRC should match the CRC-ITU-T check value")
+}
+
+func TestDString(t *testing.T) {
+	for _, s := range []string{"", "VOLUME", "café", "日本語", strings.Repeat("x", 40)} {
+		output := make([]uint8, 32)
+		udf.DString(s, output)
+
+		// The compression ID and length take two of the 32 bytes
+		expected := s
+		if len(s) > 30 {
+			expected = s[:30]
+		}
+		assert.Equal(t, expected, udf.DecodeDString(output), "'%s' should survive encoding as a dstring, truncated to fit", s)
+	}
+
+	assert.Equal(t, uint8(16), udf.CompressedUnicode("日本語")[0], "Characters beyond Latin-1 should be encoded as UTF-16")
+	assert.Equal(t, uint8(8), udf.CompressedUnicode("café")[0], "Latin-1 characters should be encoded with a byte each")
+}
+
+func TestNewTimestamp(t *testing.T) {
+	for _, zone := range []*time.Location{time.UTC, time.FixedZone("", -5*3600), time.FixedZone("", 9*3600+30*60)} {
+		original := time.Date(2024, time.March, 9, 13, 45, 30, 123456000, zone)
+		converted := udf.NewTimestamp(original).Time()
+		assert.True(t, original.Equal(converted), "Timestamp should represent %v, but got %v", original, converted)
+	}
+}
+
+// writeVolume writes a volume with the given file set to a buffer, placing each file's data (given by node) after the
+// file set, in the same way as data laid out alongside ISO 9660 structures
+func writeVolume(t *testing.T, root *udf.Node, data map[*udf.Node][]byte) []byte {
+	volume, err := udf.NewVolume("VOLUME", time.Date(2024, time.March, 9, 13, 45, 30, 0, time.UTC), root)
+	require.NoError(t, err, "NewVolume should not return an error for valid arguments")
+
+	block := uint32(udf.PartitionStart)
+	volume.Allocate(&block)
+
+	for node, contents := range data {
+		node.Location = block
+		node.Size = uint64(len(contents))
+		block += uint32(len(contents)+udf.SectorSize-1) / udf.SectorSize
+	}
+
+	volume.AllocateAnchor(&block)
+
+	image := make([]byte, int(block)*udf.SectorSize)
+	for node, contents := range data {
+		copy(image[int(node.Location)*udf.SectorSize:], contents)
+	}
+
+	extents, err := volume.Extents(17)
+	require.NoError(t, err, "Extents should not return an error for valid arguments")
+
+	for i, extent := range extents {
+		if i > 0 {
+			previous := extents[i-1]
+			require.GreaterOrEqual(t, extent.Location, previous.Location+uint32(len(previous.Data)+udf.SectorSize-1)/udf.SectorSize, "Extents should be in order and not overlap")
+		}
+
+		copy(image[int(extent.Location)*udf.SectorSize:], extent.Data)
+	}
+
+	return image
+}
+
+func TestVolume(t *testing.T) {
+	modTime := time.Date(2023, time.July, 1, 12, 0, 0, 0, time.UTC)
+	readme := &udf.Node{Name: "Read Me.txt", ModTime: modTime}
+	large := &udf.Node{Name: "日本語.bin", ModTime: modTime}
+	empty := &udf.Node{Name: "empty", ModTime: modTime}
+	sub := &udf.Node{Name: "sub dir", ModTime: modTime, IsDir: true, Children: []*udf.Node{large, empty}}
+	root := &udf.Node{Name: "", ModTime: modTime, IsDir: true, Children: []*udf.Node{readme, sub}}
+
+	// Enough children to need several blocks of file identifier descriptors, some of which span blocks
+	var many []*udf.Node
+	for i := 0; i < 100; i++ {
+		many = append(many, &udf.Node{Name: strings.Repeat("n", i+1), ModTime: modTime})
+	}
+	sub.Children = append(sub.Children, &udf.Node{Name: "many", ModTime: modTime, IsDir: true, Children: many})
+
+	data := map[*udf.Node][]byte{
+		readme: []byte("hello"),
+		large:  bytes.Repeat([]byte{0xAB}, 5000),
+		empty:  {},
+	}
+
+	image := writeVolume(t, root, data)
+
+	recognition := image[17*udf.SectorSize:]
+	assert.Equal(t, "BEA01", string(recognition[1:6]), "Volume recognition sequence should start with BEA01")
+	assert.Equal(t, "NSR02", string(recognition[udf.SectorSize+1:udf.SectorSize+6]), "Volume recognition sequence should identify UDF 1.02")
+	assert.Equal(t, "TEA01", string(recognition[2*udf.SectorSize+1:2*udf.SectorSize+6]), "Volume recognition sequence should end with TEA01")
+
+	var anchor udf.AnchorVolumeDescriptorPointer
+	last := uint32(len(image)/udf.SectorSize - 1)
+	require.NoError(t, udf.ReadDescriptor(bytes.NewReader(image), last, udf.TagAnchorVolumeDescriptorPointer, last, &anchor), "Last sector should be an anchor")
+
+	var pd udf.PartitionDescriptor
+	require.NoError(t, udf.ReadDescriptor(bytes.NewReader(image), udf.ReserveSequenceLocation+2, udf.TagPartitionDescriptor, udf.ReserveSequenceLocation+2, &pd), "Reserve sequence should be recorded")
+	assert.Equal(t, last, pd.PartitionStartingLocation+pd.PartitionLength, "Partition should end at the last anchor")
+
+	var lvid udf.LogicalVolumeIntegrityDescriptor
+	require.NoError(t, udf.ReadDescriptor(bytes.NewReader(image), udf.IntegritySequenceLocation, udf.TagLogicalVolumeIntegrityDescriptor, udf.IntegritySequenceLocation, &lvid), "Integrity sequence should be recorded")
+	assert.EqualValues(t, 103, lvid.NumberOfFiles, "Integrity descriptor should count files")
+	assert.EqualValues(t, 3, lvid.NumberOfDirectories, "Integrity descriptor should count directories")
+
+	reader, err := udf.Open(bytes.NewReader(image))
+	require.NoError(t, err, "Volume should be readable")
+	assert.Equal(t, "VOLUME", udf.DecodeDString(reader.FileSet.LogicalVolumeIdentifier[:]), "File set should record the volume identifier")
+
+	rootEntry, err := reader.Root()
+	require.NoError(t, err, "Root directory should be readable")
+
+	entries, err := reader.ReadDir(rootEntry)
+	require.NoError(t, err, "Root directory entries should be readable")
+	require.Len(t, entries, 3, "Root directory should have a parent entry and two children")
+	assert.Equal(t, udf.FileCharacteristicParent|udf.FileCharacteristicDirectory, entries[0].Characteristics, "First entry should be the parent")
+	assert.Equal(t, "Read Me.txt", entries[1].Name, "Names should be recorded unchanged")
+	assert.Equal(t, udf.FileCharacteristicDirectory, entries[2].Characteristics, "Subdirectories should be marked as directories")
+
+	contents, err := reader.ReadFile(entries[1].Entry)
+	require.NoError(t, err, "File should be readable")
+	assert.Equal(t, data[readme], contents, "File should have the correct contents")
+	assert.True(t, modTime.Equal(entries[1].Entry.ModificationTime.Time()), "File should have the correct modification time")
+
+	subEntries, err := reader.ReadDir(entries[2].Entry)
+	require.NoError(t, err, "Subdirectory entries should be readable")
+	require.Len(t, subEntries, 4, "Subdirectory should have a parent entry and three children")
+	assert.Equal(t, rootEntry.UniqueID, subEntries[0].Entry.UniqueID, "Parent entry of subdirectory should refer to the root")
+
+	for _, entry := range subEntries[1:3] {
+		contents, err := reader.ReadFile(entry.Entry)
+		require.NoError(t, err, "Should be able to read '%s'", entry.Name)
+		assert.Equal(t, map[string][]byte{"日本語.bin": data[large], "empty": {}}[entry.Name], contents, "'%s' should have the correct contents", entry.Name)
+	}
+
+	manyEntries, err := reader.ReadDir(subEntries[3].Entry)
+	require.NoError(t, err, "Directory spanning several blocks should be readable")
+	require.Len(t, manyEntries, 101, "Directory spanning several blocks should have every entry")
+	for i, entry := range manyEntries[1:] {
+		assert.Equal(t, strings.Repeat("n", i+1), entry.Name, "Entries should be in order")
+	}
+}
+
+func TestVolume_Errors(t *testing.T) {
+	root := &udf.Node{IsDir: true, Children: []*udf.Node{{Name: strings.Repeat("x", 255)}}}
+	_, err := udf.NewVolume("VOLUME", time.Now(), root)
+	assert.ErrorIs(t, err, udf.ErrNameTooLong, "NewVolume should not allow names longer than 254 characters")
+
+	file := &udf.Node{Name: "file", Location: udf.PartitionStart, Size: 10}
+	volume, err := udf.NewVolume("VOLUME", time.Now(), &udf.Node{IsDir: true, Children: []*udf.Node{file}})
+	require.NoError(t, err, "NewVolume should not return an error for valid arguments")
+
+	block := uint32(udf.PartitionStart)
+	volume.Allocate(&block)
+	volume.AllocateAnchor(&block)
+	_, err = volume.Extents(17)
+	assert.ErrorIs(t, err, udf.ErrOutsidePartition, "Extents should fail if file data overlaps the file set")
+}
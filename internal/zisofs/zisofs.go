@@ -0,0 +1,335 @@
+// Package zisofs implements the zisofs compressed file format, in which a file's data is compressed in blocks with
+// zlib so that it can be read at random. This is the format recorded in images with ZF entries (see
+// [spec.ZisofsEntry]), and produced by mkzftree from zisofs-tools.
+//
+// Compressed data starts with a 16-byte header, followed by a table of pointers to the start of each compressed block
+// and to the end of the last one. A block that is entirely zero bytes may be recorded with no data at all.
+package zisofs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/encode"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+)
+
+const (
+	// DefaultBlockSizeLog2 is the base 2 logarithm of the block size used by mkzftree, i.e. 32 KiB blocks
+	DefaultBlockSizeLog2 = 15
+
+	// MinBlockSizeLog2 and MaxBlockSizeLog2 bound the block sizes that Linux can read
+	MinBlockSizeLog2 = 15
+	MaxBlockSizeLog2 = 17
+
+	// headerSize is the size of the header before the block pointers, which is always 16 bytes
+	headerSize  = 16
+	pointerSize = 4
+)
+
+// magic identifies zisofs compressed data, at the start of its header
+var magic = [8]uint8{0x37, 0xE4, 0x53, 0x96, 0xC9, 0xDB, 0xD6, 0x07}
+
+var (
+	// ErrInvalidData indicates that compressed data is not in the zisofs format, or is corrupt
+	ErrInvalidData = errors.New("invalid zisofs data")
+	// ErrChanged indicates that data compressed differently from when its [Layout] was measured, which happens if
+	// a file changes while an image is being written
+	ErrChanged = errors.New("data changed since it was measured")
+)
+
+// header is the header at the start of compressed data
+type header struct {
+	Magic            [8]uint8
+	UncompressedSize uint32
+
+	// HeaderSize is the size of the header in units of 4 bytes
+	HeaderSize    uint8
+	BlockSizeLog2 uint8
+	Reserved      [2]uint8
+}
+
+// Layout describes the compressed form of some data: its size, and the locations of its compressed blocks. Since
+// the block pointers precede the blocks, data is compressed twice: once by [Measure] to find its layout, and again by
+// [Layout.NewReader] when it is written.
+type Layout struct {
+	uncompressedSize uint32
+	blockSizeLog2    uint8
+
+	// pointers are the offsets of each block, and of the end of the last block
+	pointers []uint32
+}
+
+// Measure compresses size bytes of data from r with the given block size, to find the layout of the compressed data
+func Measure(r io.Reader, size uint32, blockSizeLog2 uint8) (*Layout, error) {
+	if blockSizeLog2 < MinBlockSizeLog2 || blockSizeLog2 > MaxBlockSizeLog2 {
+		return nil, fmt.Errorf("block size must be between 2^%d and 2^%d bytes, but got 2^%d", MinBlockSizeLog2, MaxBlockSizeLog2, blockSizeLog2)
+	}
+
+	l := &Layout{uncompressedSize: size, blockSizeLog2: blockSizeLog2}
+	blockCount := l.blockCount()
+
+	l.pointers = make([]uint32, 0, blockCount+1)
+	offset := uint32(headerSize + pointerSize*(blockCount+1))
+	l.pointers = append(l.pointers, offset)
+
+	c := newBlockCompressor(blockSizeLog2)
+	for block := 0; block < blockCount; block++ {
+		compressed, err := c.compress(r, l.blockLength(block))
+		if err != nil {
+			return nil, err
+		}
+
+		offset += uint32(len(compressed))
+		l.pointers = append(l.pointers, offset)
+	}
+
+	return l, nil
+}
+
+// Size is the size of the compressed data, including its header and block pointers
+func (l *Layout) Size() uint32 {
+	return l.pointers[len(l.pointers)-1]
+}
+
+// UncompressedSize is the size of the data before it was compressed
+func (l *Layout) UncompressedSize() uint32 {
+	return l.uncompressedSize
+}
+
+// Entry returns the ZF entry that records the compressed data in a directory record
+func (l *Layout) Entry() spec.ZisofsEntry {
+	return spec.ZisofsEntry{
+		Signature:        [2]uint8{'Z', 'F'},
+		Length:           16,
+		Version:          1,
+		Algorithm:        [2]uint8{'p', 'z'},
+		HeaderSize:       headerSize / 4,
+		BlockSizeLog2:    l.blockSizeLog2,
+		UncompressedSize: encode.AsUInt32BothByte(l.uncompressedSize),
+	}
+}
+
+// NewReader returns a reader of the compressed form of the data in r, which must be the same data that the layout
+// was measured from. Blocks are compressed as they are read. If a block doesn't compress to the same size as when it
+// was measured, reading fails with [ErrChanged].
+func (l *Layout) NewReader(r io.Reader) io.Reader {
+	var buff bytes.Buffer
+	_ = binary.Write(&buff, binary.LittleEndian, header{
+		Magic:            magic,
+		UncompressedSize: l.uncompressedSize,
+		HeaderSize:       headerSize / 4,
+		BlockSizeLog2:    l.blockSizeLog2,
+	})
+	_ = binary.Write(&buff, binary.LittleEndian, l.pointers)
+
+	return &compressingReader{
+		layout:     l,
+		r:          r,
+		pending:    buff.Bytes(),
+		compressor: newBlockCompressor(l.blockSizeLog2),
+	}
+}
+
+func (l *Layout) blockCount() int {
+	blockSize := uint64(1) << l.blockSizeLog2
+	return int((uint64(l.uncompressedSize) + blockSize - 1) / blockSize)
+}
+
+// blockLength returns the uncompressed length of a block, which is the block size for all blocks but the last
+func (l *Layout) blockLength(block int) int {
+	blockSize := uint64(1) << l.blockSizeLog2
+	return int(min(blockSize, uint64(l.uncompressedSize)-uint64(block)*blockSize))
+}
+
+// blockCompressor compresses blocks of data, each as a separate zlib stream
+type blockCompressor struct {
+	block      []byte
+	compressed bytes.Buffer
+	zw         *zlib.Writer
+}
+
+func newBlockCompressor(blockSizeLog2 uint8) *blockCompressor {
+	c := &blockCompressor{block: make([]byte, 1<<blockSizeLog2)}
+	c.zw, _ = zlib.NewWriterLevel(&c.compressed, zlib.BestCompression)
+	return c
+}
+
+// compress reads a block of the given length from r and compresses it. The returned slice is only valid until the
+// next call. Blocks of zero bytes compress to nothing.
+func (c *blockCompressor) compress(r io.Reader, length int) ([]byte, error) {
+	block := c.block[:length]
+	if _, err := io.ReadFull(r, block); err != nil {
+		return nil, fmt.Errorf("could not read block: %w", err)
+	}
+
+	c.compressed.Reset()
+	if isZero(block) {
+		return nil, nil
+	}
+
+	c.zw.Reset(&c.compressed)
+	if _, err := c.zw.Write(block); err != nil {
+		return nil, fmt.Errorf("could not compress block: %w", err)
+	}
+
+	if err := c.zw.Close(); err != nil {
+		return nil, fmt.Errorf("could not compress block: %w", err)
+	}
+
+	return c.compressed.Bytes(), nil
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// compressingReader reads the compressed form of data, compressing a block at a time
+type compressingReader struct {
+	layout     *Layout
+	r          io.Reader
+	compressor *blockCompressor
+
+	// pending is compressed data that hasn't been read yet, and block is the next block to compress
+	pending []byte
+	block   int
+}
+
+func (c *compressingReader) Read(p []byte) (int, error) {
+	for len(c.pending) == 0 {
+		if c.block == c.layout.blockCount() {
+			return 0, io.EOF
+		}
+
+		compressed, err := c.compressor.compress(c.r, c.layout.blockLength(c.block))
+		if err != nil {
+			return 0, err
+		}
+
+		if expected := c.layout.pointers[c.block+1] - c.layout.pointers[c.block]; uint32(len(compressed)) != expected {
+			return 0, fmt.Errorf("%w: block %d compressed to %d bytes, but was measured as %d bytes", ErrChanged, c.block, len(compressed), expected)
+		}
+
+		c.pending = compressed
+		c.block++
+	}
+
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Reader decompresses zisofs data
+type Reader struct {
+	r        io.ReaderAt
+	header   header
+	pointers []uint32
+
+	// pending is decompressed data that hasn't been read yet, and block is the next block to decompress
+	pending []byte
+	block   int
+}
+
+// NewReader reads the header and block pointers of compressed data
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	b := make([]byte, headerSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("could not read header: %w", err)
+	}
+
+	z := &Reader{r: r}
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, &z.header); err != nil {
+		return nil, fmt.Errorf("could not decode header: %w", err)
+	}
+
+	switch {
+	case z.header.Magic != magic:
+		return nil, fmt.Errorf("%w: header has incorrect magic number", ErrInvalidData)
+	case z.header.HeaderSize*4 != headerSize:
+		return nil, fmt.Errorf("%w: unsupported header size %d", ErrInvalidData, int(z.header.HeaderSize)*4)
+	case z.header.BlockSizeLog2 < MinBlockSizeLog2 || z.header.BlockSizeLog2 > MaxBlockSizeLog2:
+		return nil, fmt.Errorf("%w: unsupported block size 2^%d", ErrInvalidData, z.header.BlockSizeLog2)
+	}
+
+	l := &Layout{uncompressedSize: z.header.UncompressedSize, blockSizeLog2: z.header.BlockSizeLog2}
+	b = make([]byte, pointerSize*(l.blockCount()+1))
+	if _, err := r.ReadAt(b, headerSize); err != nil {
+		return nil, fmt.Errorf("could not read block pointers: %w", err)
+	}
+
+	z.pointers = make([]uint32, l.blockCount()+1)
+	for i := range z.pointers {
+		z.pointers[i] = binary.LittleEndian.Uint32(b[i*pointerSize:])
+		if i > 0 && z.pointers[i] < z.pointers[i-1] {
+			return nil, fmt.Errorf("%w: block pointers are out of order", ErrInvalidData)
+		}
+	}
+
+	return z, nil
+}
+
+// Size is the size of the decompressed data
+func (z *Reader) Size() uint32 {
+	return z.header.UncompressedSize
+}
+
+func (z *Reader) Read(p []byte) (int, error) {
+	for len(z.pending) == 0 {
+		if z.block == len(z.pointers)-1 {
+			return 0, io.EOF
+		}
+
+		if err := z.decompress(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, z.pending)
+	z.pending = z.pending[n:]
+	return n, nil
+}
+
+// decompress decompresses the next block into pending
+func (z *Reader) decompress() error {
+	l := &Layout{uncompressedSize: z.header.UncompressedSize, blockSizeLog2: z.header.BlockSizeLog2}
+	length := l.blockLength(z.block)
+
+	compressed := make([]byte, z.pointers[z.block+1]-z.pointers[z.block])
+	if len(compressed) == 0 {
+		z.block++
+		z.pending = make([]byte, length)
+		return nil
+	}
+
+	if _, err := z.r.ReadAt(compressed, int64(z.pointers[z.block])); err != nil {
+		return fmt.Errorf("could not read block %d: %w", z.block, err)
+	}
+
+	z.block++
+
+	zr, err := zlib.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return fmt.Errorf("%w: block %d: %w", ErrInvalidData, z.block-1, err)
+	}
+
+	// Read one byte more than the block should hold, so that blocks that are too long are detected
+	z.pending, err = io.ReadAll(io.LimitReader(zr, int64(length)+1))
+	if err != nil {
+		return fmt.Errorf("%w: block %d: %w", ErrInvalidData, z.block-1, err)
+	}
+
+	if len(z.pending) != length {
+		return fmt.Errorf("%w: block %d decompressed to %d bytes, but should be %d bytes", ErrInvalidData, z.block-1, len(z.pending), length)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package zisofs_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+)
+
+func compress(t *testing.T, data []byte, blockSizeLog2 uint8) (*zisofs.Layout, []byte) {
+	layout, err := zisofs.Measure(bytes.NewReader(data), uint32(len(data)), blockSizeLog2)
+	require.NoError(t, err, "Measure should not return an error for valid arguments")
+
+	compressed, err := io.ReadAll(layout.NewReader(bytes.NewReader(data)))
+	require.NoError(t, err, "Compressing the same data again should not return an error")
+	assert.EqualValues(t, layout.Size(), len(compressed), "Compressed data should have the measured size")
+
+	return layout, compressed
+}
+
+func TestRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog\n"), 3000)
+
+	// Zero blocks are recorded with no data, so the middle of this compresses to nothing
+	sparse := append(append(bytes.Repeat([]byte("a"), 100), make([]byte, 1<<17)...), 'z')
+
+	// Zero blocks at the end of the data have no data at all, and so are at the very end of the compressed data
+	trailing := append(bytes.Repeat([]byte("a"), 1<<17), make([]byte, 1<<17)...)
+
+	for name, data := range map[string][]byte{"text": text, "sparse": sparse, "trailing": trailing, "tiny": []byte("x")} {
+		for _, blockSizeLog2 := range []uint8{15, 17} {
+			layout, compressed := compress(t, data, blockSizeLog2)
+			assert.EqualValues(t, len(data), layout.UncompressedSize(), "Layout should record the uncompressed size of %s", name)
+
+			entry := layout.Entry()
+			assert.Equal(t, "ZF", string(entry.Signature[:]), "Entry should be a ZF entry")
+			assert.Equal(t, blockSizeLog2, entry.BlockSizeLog2, "Entry should record the block size")
+			assert.EqualValues(t, len(data), entry.UncompressedSize.RealValue(), "Entry should record the uncompressed size")
+
+			r, err := zisofs.NewReader(bytes.NewReader(compressed))
+			require.NoError(t, err, "NewReader should be able to read the compressed %s", name)
+			assert.EqualValues(t, len(data), r.Size(), "Reader should report the uncompressed size of %s", name)
+
+			decompressed, err := io.ReadAll(r)
+			require.NoError(t, err, "Should be able to decompress %s", name)
+			assert.Equal(t, data, decompressed, "Decompressed %s should match the original data", name)
+		}
+	}
+
+	_, compressed := compress(t, sparse, 15)
+	assert.Less(t, len(compressed), 200, "Zero blocks should not be recorded")
+}
+
+func TestLayout_NewReader_Changed(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefgh"), 10000)
+	layout, err := zisofs.Measure(bytes.NewReader(data), uint32(len(data)), zisofs.DefaultBlockSizeLog2)
+	require.NoError(t, err, "Measure should not return an error for valid arguments")
+
+	changed := bytes.Clone(data)
+	copy(changed[100:], "different data that compresses differently")
+
+	_, err = io.ReadAll(layout.NewReader(bytes.NewReader(changed)))
+	assert.ErrorIs(t, err, zisofs.ErrChanged, "Compressing different data should fail")
+
+	_, err = zisofs.Measure(bytes.NewReader(data[:10]), uint32(len(data)), zisofs.DefaultBlockSizeLog2)
+	assert.Error(t, err, "Measure should fail if there is less data than expected")
+
+	_, err = zisofs.Measure(bytes.NewReader(data), uint32(len(data)), 12)
+	assert.Error(t, err, "Measure should not allow block sizes that Linux can't read")
+}
+
+func TestNewReader_Invalid(t *testing.T) {
+	_, compressed := compress(t, bytes.Repeat([]byte("abc"), 50000), zisofs.DefaultBlockSizeLog2)
+
+	badMagic := bytes.Clone(compressed)
+	badMagic[0] ^= 0xFF
+	_, err := zisofs.NewReader(bytes.NewReader(badMagic))
+	assert.ErrorIs(t, err, zisofs.ErrInvalidData, "NewReader should reject data without the zisofs magic number")
+
+	corrupt := bytes.Clone(compressed)
+	for i := len(corrupt) - 20; i < len(corrupt); i++ {
+		corrupt[i] ^= 0xFF
+	}
+
+	r, err := zisofs.NewReader(bytes.NewReader(corrupt))
+	require.NoError(t, err, "NewReader should only read the header and block pointers")
+	_, err = io.ReadAll(r)
+	assert.ErrorIs(t, err, zisofs.ErrInvalidData, "Reading corrupt blocks should fail")
+}
@@ -0,0 +1,332 @@
+package iso9660
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"hash"
+	"io"
+	"io/fs"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultManifestName is the name of the manifest added by [WithManifest] if no other name is given
+const DefaultManifestName = "SHA256SUMS"
+
+var (
+	// ErrManifestOptions indicates that a manifest was requested along with options that it can't be used with
+	ErrManifestOptions = errors.New("a manifest cannot be used with volume sets")
+	// ErrManifestDigest indicates that the digest of a file in a manifest couldn't be found, because the file wasn't
+	// read in full when it was written
+	ErrManifestDigest = errors.New("file was not read in full, so its digest is unknown")
+)
+
+// Manifest configures the manifest of file digests added to an image, see [WithManifest]
+type Manifest struct {
+	// Name is the name of the manifest, which is added to the root directory. If empty, [DefaultManifestName] is used.
+	Name string
+
+	// Digests are the SHA-256 digests of files, by their path in the image's contents, that are already known. These
+	// files aren't hashed, so their digests should be correct.
+	Digests map[string][sha256.Size]byte
+
+	// PreHash hashes every file before the image is laid out, rather than as files are written. This reads each file
+	// twice, but allows the manifest to be placed with the other files in the root directory rather than after them.
+	PreHash bool
+}
+
+// WithManifest adds a manifest to the root directory of the image, listing the SHA-256 digest of every file in the
+// image in the format of sha256sum, so that the contents of a mounted image can be checked with 'sha256sum -c'. Files
+// are listed by their path in the image's contents, which may differ from the identifiers they are recorded under.
+// The manifest replaces any file of the same name in the contents.
+//
+// The size of the manifest depends only on the paths of the files it lists, so it is known when the image is laid out.
+// Unless [Manifest.PreHash] is set, each file is hashed as it is written, and the manifest's extent is placed after
+// those of every other file, so that it is written last, once every digest is known. Files that aren't written, such
+// as files from a previous session, are hashed before the image is laid out.
+func WithManifest(m Manifest) ImageOption {
+	return func(i *Image) error {
+		if m.Name == "" {
+			m.Name = DefaultManifestName
+		}
+
+		if !fs.ValidPath(m.Name) || m.Name == "." || strings.Contains(m.Name, "/") {
+			return fmt.Errorf("invalid manifest name '%s'", m.Name)
+		}
+
+		i.manifest = &m
+		return nil
+	}
+}
+
+// manifestBuilder collects the digests of the files listed in a manifest while an image is written
+type manifestBuilder struct {
+	name string
+
+	// paths are the files listed in the manifest, in the order they are listed
+	paths []string
+
+	// digests contains the digests known so far, by path. Digests of files that are hashed as they are written are
+	// added once they have been read in full, possibly by several goroutines at once (see [Image.WriteToWriterAt]).
+	mu      sync.Mutex
+	digests map[string][sha256.Size]byte
+
+	// streamed is true if files are hashed as they are written, rather than beforehand
+	streamed bool
+
+	// files contains every file in the directory tree by its path, so that links can be listed with the digest of the
+	// file whose extent they share
+	files map[string]*builder.File
+}
+
+// newManifestBuilder finds the files in source to list in the manifest, and hashes any that must be hashed before the
+// image is laid out
+func (m *Manifest) newManifestBuilder(source fs.ReadDirFS) (*manifestBuilder, error) {
+	b := &manifestBuilder{
+		name:     m.Name,
+		digests:  make(map[string][sha256.Size]byte),
+		streamed: !m.PreHash,
+	}
+
+	maps.Copy(b.digests, m.Digests)
+
+	err := fs.WalkDir(source, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filePath == m.Name {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat '%s': %w", filePath, err)
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Symbolic links to files are followed when building the directory tree, and other links are skipped
+			if info, err = fs.Stat(source, filePath); err != nil || info.IsDir() {
+				return nil
+			}
+		}
+
+		b.paths = append(b.paths, filePath)
+
+		if _, known := b.digests[filePath]; known {
+			return nil
+		}
+
+		if _, placed := info.(placedFileInfo); placed || !b.streamed {
+			digest, err := hashFile(source, filePath)
+			if err != nil {
+				return err
+			}
+
+			b.digests[filePath] = digest
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not hash files for manifest: %w", err)
+	}
+
+	return b, nil
+}
+
+func hashFile(source fs.FS, filePath string) ([sha256.Size]byte, error) {
+	f, err := source.Open(filePath)
+	if err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("could not read input file '%s': %w", filePath, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return [sha256.Size]byte{}, fmt.Errorf("could not read input file '%s': %w", filePath, err)
+	}
+
+	return [sha256.Size]byte(h.Sum(nil)), nil
+}
+
+// digest returns the digest of the file at the given path, if it is known
+func (b *manifestBuilder) digest(filePath string) ([sha256.Size]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	digest, ok := b.digests[filePath]
+	return digest, ok
+}
+
+// size returns the size of the manifest, which doesn't depend on the digests in it
+func (b *manifestBuilder) size() int64 {
+	size := 0
+	for _, filePath := range b.paths {
+		size += len(manifestLine([sha256.Size]byte{}, filePath))
+	}
+
+	return int64(size)
+}
+
+// contents returns the manifest, once the digest of every file in it is known
+func (b *manifestBuilder) contents() ([]byte, error) {
+	// Links that share the extent of another file aren't read, so are listed with the digest of that file
+	owners := make(map[*builder.File]string, len(b.files))
+	for filePath, file := range b.files {
+		if file.Owner() == file {
+			owners[file] = filePath
+		}
+	}
+
+	var manifest bytes.Buffer
+	for _, filePath := range b.paths {
+		digest, ok := b.digest(filePath)
+		if file, inTree := b.files[filePath]; !ok && inTree {
+			digest, ok = b.digest(owners[file.Owner()])
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("could not list '%s' in manifest: %w", filePath, ErrManifestDigest)
+		}
+
+		manifest.WriteString(manifestLine(digest, filePath))
+	}
+
+	return manifest.Bytes(), nil
+}
+
+// manifestEscaper escapes the characters that sha256sum escapes in file names
+var manifestEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+
+// manifestLine formats a line of a manifest in the format of sha256sum. As with sha256sum, lines for files whose names
+// contain escaped characters start with a backslash.
+func manifestLine(digest [sha256.Size]byte, filePath string) string {
+	line := hex.EncodeToString(digest[:]) + "  " + manifestEscaper.Replace(filePath) + "\n"
+	if strings.ContainsAny(filePath, "\\\n\r") {
+		return `\` + line
+	}
+
+	return line
+}
+
+// filesystem returns source with the manifest added to its root directory. If files are hashed as they are written,
+// files opened from the returned filesystem are hashed as they are read.
+func (b *manifestBuilder) filesystem(source fs.ReadDirFS, modTime time.Time) fs.ReadDirFS {
+	return &manifestFS{
+		ReadDirFS: source,
+		manifest:  b,
+		info:      &syntheticFileInfo{name: b.name, size: b.size(), modTime: modTime},
+	}
+}
+
+// manifestFS adds a manifest to the root directory of a filesystem
+type manifestFS struct {
+	fs.ReadDirFS
+
+	manifest *manifestBuilder
+	info     fs.FileInfo
+}
+
+var _ fs.ReadDirFS = &manifestFS{}
+var _ fs.StatFS = &manifestFS{}
+
+func (m *manifestFS) Open(name string) (fs.File, error) {
+	if name == m.manifest.name {
+		contents, err := m.manifest.contents()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+
+		return &treeFile{ReadCloser: io.NopCloser(bytes.NewReader(contents)), info: m.info}, nil
+	}
+
+	f, err := m.ReadDirFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, known := m.manifest.digest(name); known || !m.manifest.streamed {
+		return f, nil
+	}
+
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return f, nil
+	}
+
+	hf := &hashingFile{File: f, manifest: m.manifest, name: name, hash: sha256.New(), remaining: info.Size()}
+	if hf.remaining == 0 {
+		hf.record()
+	}
+
+	return hf, nil
+}
+
+func (m *manifestFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := m.ReadDirFS.ReadDir(name)
+	if err != nil || name != "." {
+		return entries, err
+	}
+
+	entries = slices.DeleteFunc(entries, func(entry fs.DirEntry) bool {
+		return entry.Name() == m.manifest.name
+	})
+
+	return append(entries, fs.FileInfoToDirEntry(m.info)), nil
+}
+
+func (m *manifestFS) Stat(name string) (fs.FileInfo, error) {
+	if name == m.manifest.name {
+		return m.info, nil
+	}
+
+	return fs.Stat(m.ReadDirFS, name)
+}
+
+// hashingFile records the digest of a file in a manifest once it has been read in full
+type hashingFile struct {
+	fs.File
+
+	manifest *manifestBuilder
+	name     string
+	hash     hash.Hash
+
+	// remaining is the number of bytes of the file that haven't been read yet
+	remaining int64
+}
+
+func (h *hashingFile) Read(p []byte) (int, error) {
+	n, err := h.File.Read(p)
+	h.hash.Write(p[:n])
+	h.remaining -= int64(n)
+
+	// Readers of compressed files stop once they have read the file's size, without waiting for the end of the file
+	if h.remaining == 0 || errors.Is(err, io.EOF) {
+		h.record()
+	}
+
+	return n, err
+}
+
+// WriteTo writes the contents of the file, skipping holes in the underlying file if it has any (see [copyFile]). The
+// zeros written in place of holes are hashed along with the rest of the file.
+func (h *hashingFile) WriteTo(w io.Writer) (int64, error) {
+	n, err := copyFile(io.MultiWriter(w, h.hash), h.File)
+	h.remaining -= n
+	if err == nil {
+		h.record()
+	}
+
+	return n, err
+}
+
+func (h *hashingFile) record() {
+	h.manifest.mu.Lock()
+	defer h.manifest.mu.Unlock()
+
+	h.manifest.digests[h.name] = [sha256.Size]byte(h.hash.Sum(nil))
+}
@@ -0,0 +1,106 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+func manifestLine(data []byte, name string) string {
+	return fmt.Sprintf("%x  %s\n", sha256.Sum256(data), name)
+}
+
+func TestWithManifest(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT":       {Data: []byte("audit me")},
+		"LIVE/FILESYS.IMG": {Data: bytes.Repeat([]byte("compressible "), 20000)},
+		"SHA256SUMS":       {Data: []byte("replaced")},
+		"ZZZ/LAST.TXT":     {Data: []byte("last")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithManifest(iso9660.Manifest{}), iso9660.WithZisofs(iso9660.Zisofs{}), iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with a manifest should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	// Compressed files are listed with the digest of their original contents
+	expected := manifestLine(source["LIVE/FILESYS.IMG"].Data, "LIVE/FILESYS.IMG") +
+		manifestLine(source["README.TXT"].Data, "README.TXT") +
+		manifestLine(source["ZZZ/LAST.TXT"].Data, "ZZZ/LAST.TXT")
+	assert.Equal(t, expected, readRecord(t, img, "SHA256SUMS"), "Manifest should list the digest of every other file")
+
+	manifest := findRecord(t, img, "SHA256SUMS").ExtentLocation.RealValue()
+	for _, name := range []string{"LIVE/FILESYS.IMG", "README.TXT", "ZZZ/LAST.TXT"} {
+		assert.Less(t, findRecord(t, img, name).ExtentLocation.RealValue(), manifest, "Manifest should be written after '%s'", name)
+	}
+}
+
+func TestWithManifest_PreHash(t *testing.T) {
+	source := fstest.MapFS{
+		"X.TXT": {Data: []byte("x")},
+		"Y.TXT": {Data: []byte("y")},
+	}
+
+	// Digests given by the caller are trusted, so a wrong digest shows that Y.TXT wasn't hashed
+	provided := sha256.Sum256([]byte("provided"))
+
+	image, err := iso9660.NewImage(source, iso9660.WithManifest(iso9660.Manifest{
+		Name:    "CHECKSUMS.TXT",
+		Digests: map[string][sha256.Size]byte{"Y.TXT": provided},
+		PreHash: true,
+	}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	assert.Equal(t, manifestLine([]byte("x"), "X.TXT")+manifestLine([]byte("provided"), "Y.TXT"), readRecord(t, img, "CHECKSUMS.TXT"), "Manifest should list computed and provided digests")
+	assert.Less(t, findRecord(t, img, "CHECKSUMS.TXT").ExtentLocation.RealValue(), findRecord(t, img, "X.TXT").ExtentLocation.RealValue(), "Manifest should be placed in directory order when files are hashed beforehand")
+}
+
+func TestWithManifest_PreviousSession(t *testing.T) {
+	first := writeImage(t, fstest.MapFS{"OLD.TXT": {Data: []byte("old")}})
+	start := uint32(len(first) / 2048)
+
+	image, err := iso9660.NewImage(
+		fstest.MapFS{"NEW.TXT": {Data: []byte("new")}},
+		iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first)}),
+		iso9660.WithManifest(iso9660.Manifest{}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	img, err := reader.OpenAt(bytes.NewReader(appendSession(t, first, image, start)), start)
+	require.NoError(t, err, "New session should be readable")
+
+	assert.Equal(t, manifestLine([]byte("new"), "NEW.TXT")+manifestLine([]byte("old"), "OLD.TXT"), readRecord(t, img, "SHA256SUMS"), "Manifest should list files from the previous session")
+}
+
+func TestWithManifest_Options(t *testing.T) {
+	source := fstest.MapFS{"A.TXT": {Data: []byte("a")}}
+
+	_, err := iso9660.NewImage(source, iso9660.WithManifest(iso9660.Manifest{Name: "DIR/SHA256SUMS"}))
+	assert.Error(t, err, "WithManifest should only allow a manifest in the root directory")
+
+	image, err := iso9660.NewImage(source, iso9660.WithManifest(iso9660.Manifest{}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteVolumeSet(1000*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrManifestOptions, "WriteVolumeSet should not allow a manifest")
+}
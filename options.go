@@ -0,0 +1,4 @@
+package iso9660
+
+// ImageOption configures an [Image]. Options are passed to [NewImage].
+type ImageOption func(i *Image) error
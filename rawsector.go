@@ -0,0 +1,107 @@
+package iso9660
+
+import (
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/cdrom"
+	"io"
+)
+
+// RawSectorMode is the mode of the raw sectors written by [RawSectorWriter]
+type RawSectorMode int
+
+const (
+	// RawSectorMode1 is Mode 1, the usual mode of CD-ROM data tracks
+	RawSectorMode1 RawSectorMode = iota + 1
+	// RawSectorMode2Form1 is Mode 2 Form 1, as used by CD-ROM XA discs
+	RawSectorMode2Form1
+)
+
+// cueTrackMode returns the mode of a data track of this sector mode in a cue sheet
+func (m RawSectorMode) cueTrackMode() string {
+	if m == RawSectorMode2Form1 {
+		return "MODE2/2352"
+	}
+
+	return "MODE1/2352"
+}
+
+// RawSectorWriter converts an image into raw 2352-byte CD-ROM sectors as it is written, with the sync pattern, header,
+// EDC and ECC of each sector computed from its 2048 bytes of user data. This is the form of image (often with a .bin
+// extension) used to write discs in raw mode and by some emulators, alongside a cue sheet from [CueSheet].
+//
+// Sectors are addressed from logical block 0, so RawSectorWriter can't be used to write a session other than the
+// first.
+type RawSectorWriter struct {
+	w    io.Writer
+	mode RawSectorMode
+	lba  uint32
+
+	// block is the user data of the sector being written, of which buffered bytes have been written so far
+	block    []byte
+	buffered int
+	sector   []byte
+}
+
+// NewRawSectorWriter returns a writer that writes an image to w as raw sectors of the given mode
+func NewRawSectorWriter(w io.Writer, mode RawSectorMode) (*RawSectorWriter, error) {
+	if mode != RawSectorMode1 && mode != RawSectorMode2Form1 {
+		return nil, fmt.Errorf("unsupported sector mode %d", mode)
+	}
+
+	return &RawSectorWriter{
+		w:      w,
+		mode:   mode,
+		block:  make([]byte, cdrom.UserDataSize),
+		sector: make([]byte, cdrom.SectorSize),
+	}, nil
+}
+
+func (r *RawSectorWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		copied := copy(r.block[r.buffered:], p[n:])
+		r.buffered += copied
+		n += copied
+
+		if r.buffered == len(r.block) {
+			if err := r.writeSector(); err != nil {
+				return n - copied, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// Close writes the last sector, padded with zeros if less than a sector of data has been written since the previous
+// one. Close doesn't close the underlying writer.
+func (r *RawSectorWriter) Close() error {
+	if r.buffered == 0 {
+		return nil
+	}
+
+	clear(r.block[r.buffered:])
+	return r.writeSector()
+}
+
+func (r *RawSectorWriter) writeSector() error {
+	if r.mode == RawSectorMode2Form1 {
+		cdrom.EncodeMode2Form1(r.sector, r.lba, r.block)
+	} else {
+		cdrom.EncodeMode1(r.sector, r.lba, r.block)
+	}
+
+	if _, err := r.w.Write(r.sector); err != nil {
+		return fmt.Errorf("could not write sector %d: %w", r.lba, err)
+	}
+
+	r.lba++
+	r.buffered = 0
+	return nil
+}
+
+// CueSheet returns a cue sheet describing an image of raw sectors written by [RawSectorWriter] as a single data
+// track. binFile is the name of the image, which is usually in the same directory as the cue sheet.
+func CueSheet(binFile string, mode RawSectorMode) string {
+	return fmt.Sprintf("FILE \"%s\" BINARY\n  TRACK 01 %s\n    INDEX 01 %s\n", binFile, mode.cueTrackMode(), cdrom.MSF(0))
+}
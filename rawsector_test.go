@@ -0,0 +1,62 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestRawSectorWriter(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT": {Data: []byte("raw sectors")},
+	}
+
+	image, err := iso9660.NewImage(source)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	for mode, userDataOffset := range map[iso9660.RawSectorMode]int{iso9660.RawSectorMode1: 16, iso9660.RawSectorMode2Form1: 24} {
+		var raw bytes.Buffer
+		w, err := iso9660.NewRawSectorWriter(&raw, mode)
+		require.NoError(t, err, "NewRawSectorWriter should not return an error for a valid mode")
+
+		written, err := image.WriteTo(w)
+		require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+		require.NoError(t, w.Close(), "Close should not return an error")
+		require.Zero(t, written%2048, "Image should be a whole number of blocks")
+		require.EqualValues(t, written/2048*2352, raw.Len(), "Every block should be written as a raw sector")
+
+		var cooked bytes.Buffer
+		for sector := 0; sector < raw.Len()/2352; sector++ {
+			offset := sector*2352 + userDataOffset
+			cooked.Write(raw.Bytes()[offset : offset+2048])
+		}
+
+		assert.Empty(t, iso9660.Validate(bytes.NewReader(cooked.Bytes())), "User data of the raw sectors should be a valid image")
+		assert.Equal(t, []byte{0x00, 0x02, 0x16}, raw.Bytes()[16*2352+12:16*2352+15], "Sector 16 should be addressed as 00:02:16")
+	}
+
+	_, err = iso9660.NewRawSectorWriter(&bytes.Buffer{}, 0)
+	assert.Error(t, err, "NewRawSectorWriter should not allow an invalid mode")
+}
+
+func TestRawSectorWriter_Close(t *testing.T) {
+	var raw bytes.Buffer
+	w, err := iso9660.NewRawSectorWriter(&raw, iso9660.RawSectorMode1)
+	require.NoError(t, err, "NewRawSectorWriter should not return an error for a valid mode")
+
+	_, err = w.Write(bytes.Repeat([]byte("a"), 3000))
+	require.NoError(t, err, "Write should not return an error")
+	assert.Equal(t, 2352, raw.Len(), "Only complete sectors should be written before Close")
+
+	require.NoError(t, w.Close(), "Close should not return an error")
+	assert.Equal(t, 2*2352, raw.Len(), "Close should write the partial last sector")
+	assert.Equal(t, append(bytes.Repeat([]byte("a"), 952), make([]byte, 2048-952)...), raw.Bytes()[2352+16:2352+16+2048], "Last sector should be padded with zeros")
+}
+
+func TestCueSheet(t *testing.T) {
+	assert.Equal(t, "FILE \"image.bin\" BINARY\n  TRACK 01 MODE1/2352\n    INDEX 01 00:00:00\n", iso9660.CueSheet("image.bin", iso9660.RawSectorMode1), "Cue sheet should describe a single Mode 1 track")
+	assert.Contains(t, iso9660.CueSheet("image.bin", iso9660.RawSectorMode2Form1), "TRACK 01 MODE2/2352", "Cue sheet should describe a Mode 2 track")
+}
@@ -0,0 +1,291 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrSessionOverlap indicates that a new session would start before the end of the previous session
+	ErrSessionOverlap = errors.New("new session overlaps the previous session")
+	// ErrSessionSystemArea indicates that options which write to the system area were used along with
+	// [WithPreviousSession]. The system area that is used when booting is the one in the first session, which a new
+	// session can't change.
+	ErrSessionSystemArea = errors.New("system area options cannot be used when appending a session")
+	// ErrUnsupportedSessionFile indicates that the previous session contains a file that can't be carried over to the
+	// new session
+	ErrUnsupportedSessionFile = errors.New("previous session contains an unsupported file")
+)
+
+// PreviousSession describes the existing session of a multi-session image that a new session is appended to. This is
+// the equivalent of the -M and -C options of mkisofs.
+type PreviousSession struct {
+	// Image is the existing image, e.g. an [*os.File]. It must remain valid until the new session has been written.
+	Image io.ReaderAt
+
+	// Start is the block at which the last session of Image starts. This is 0 if Image has a single session.
+	Start uint32
+
+	// NextStart is the block at which the new session will be written. If zero, the new session starts directly after
+	// the end of the previous session, which is appropriate for image files. Discs usually need a gap between sessions,
+	// in which case NextStart should be the next writable address of the disc.
+	NextStart uint32
+}
+
+// sessionFileInfo describes a file in a previous session, whose data is already in the image
+type sessionFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+
+	// location is the block at which the file's extent starts, on the volume with the given sequence number
+	location uint32
+	volume   uint16
+
+	// systemUse is the ZF entry of a compressed file, or nil if the file isn't compressed
+	systemUse []byte
+}
+
+var _ fs.FileInfo = &sessionFileInfo{}
+var _ placedFileInfo = &sessionFileInfo{}
+var _ systemUseFileInfo = &sessionFileInfo{}
+
+func (s *sessionFileInfo) Name() string       { return s.name }
+func (s *sessionFileInfo) Size() int64        { return s.size }
+func (s *sessionFileInfo) Mode() fs.FileMode  { return s.mode }
+func (s *sessionFileInfo) ModTime() time.Time { return s.modTime }
+func (s *sessionFileInfo) IsDir() bool        { return s.mode.IsDir() }
+func (s *sessionFileInfo) Sys() any           { return nil }
+
+func (s *sessionFileInfo) extentLocation() uint32 {
+	return s.location
+}
+
+func (s *sessionFileInfo) extentVolume() uint16 {
+	return s.volume
+}
+
+func (s *sessionFileInfo) recordSystemUse() []byte {
+	return s.systemUse
+}
+
+// WithPreviousSession appends a new session to an existing image, rather than creating a new image. The directory tree
+// of the new session contains everything from the last session of the existing image, along with the files in the
+// image's contents, which replace files at the same path. Files carried over from the previous session refer to their
+// existing extents, so only new files and the directory hierarchy are written.
+//
+// When an image has a previous session, [Image.WriteTo] writes only the new session, which must then be written to the
+// medium (or the end of the image file) at block NextStart. The volume descriptors of the new session describe the
+// whole volume, including previous sessions.
+//
+// Files in the previous session are recorded with version 1 in the new session, and associated files are not carried
+// over. Files compressed with zisofs keep their ZF entries, and so remain compressed (see [WithZisofs]). Files recorded
+// in more than one extent result in [ErrUnsupportedSessionFile].
+func WithPreviousSession(previous PreviousSession) ImageOption {
+	return func(i *Image) error {
+		if previous.Image == nil {
+			return errors.New("previous session has no image")
+		}
+
+		i.previous = &previous
+		return nil
+	}
+}
+
+// start returns the block at which the new session starts, once the previous session has been read
+func (p *PreviousSession) start(img *reader.Image) (uint32, error) {
+	end := img.Primary.VolumeSpaceSize.RealValue()
+
+	if p.NextStart == 0 {
+		return end, nil
+	}
+
+	if p.NextStart < end {
+		return 0, fmt.Errorf("%w: session would start at block %d, but previous session ends at block %d", ErrSessionOverlap, p.NextStart, end)
+	}
+
+	return p.NextStart, nil
+}
+
+// merge reads the directory tree of the previous session, and adds contents to it. It returns the merged tree, the
+// block at which the new session starts, and whether any files carried over from the previous session are compressed.
+func (p *PreviousSession) merge(contents fs.ReadDirFS) (fs.ReadDirFS, uint32, bool, error) {
+	img, err := reader.OpenAt(p.Image, p.Start)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("could not read previous session: %w", err)
+	}
+
+	start, err := p.start(img)
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	root, err := img.Root()
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("could not read root directory of previous session: %w", err)
+	}
+
+	tree := newTreeFS(root.RecordingDateAndTime.Time())
+	compressed, err := readSession(img, root, tree.root, make(map[uint32]bool))
+	if err != nil {
+		return nil, 0, false, err
+	}
+
+	if err := addToSession(tree, contents); err != nil {
+		return nil, 0, false, err
+	}
+
+	return tree, start, compressed, nil
+}
+
+// readSession adds the contents of a directory in the previous session to a tree. It returns true if any of the files
+// it adds are compressed.
+func readSession(img *reader.Image, dir *reader.Record, node *treeNode, visited map[uint32]bool) (bool, error) {
+	location := dir.ExtentLocation.RealValue()
+	if visited[location] {
+		return false, fmt.Errorf("%w: directory at block %d", ErrDirectoryCycle, location)
+	}
+	visited[location] = true
+
+	records, err := img.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("could not read directory in previous session: %w", err)
+	}
+
+	compressed := false
+
+	for _, record := range records {
+		name := record.Name()
+
+		switch {
+		case record.IsSelf() || record.IsParent() || record.FileFlags&spec.FileFlagAssociatedFile != 0:
+			continue
+		case record.FileFlags&spec.FileFlagMultiExtent != 0:
+			return false, fmt.Errorf("%w: '%s' is recorded in more than one extent", ErrUnsupportedSessionFile, name)
+		case node.children[name] != nil:
+			// Only the first, i.e. highest, version of a file is carried over
+			continue
+		}
+
+		// Extended attribute records aren't carried over, so files are recorded with the location of their data
+		info := &sessionFileInfo{
+			name:     name,
+			size:     int64(record.DataLength.RealValue()),
+			mode:     0o444,
+			modTime:  record.RecordingDateAndTime.Time(),
+			location: uint32(record.DataOffset() / spec.LogicalSectorSize),
+			volume:   record.VolumeSequenceNumber.RealValue(),
+		}
+
+		if !record.IsDir() {
+			if info.systemUse, err = zisofsEntry(img, record); err != nil {
+				return false, fmt.Errorf("could not read system use entries of '%s' in previous session: %w", name, err)
+			}
+			compressed = compressed || info.systemUse != nil
+
+			node.children[name] = &treeNode{
+				info: info,
+				open: func() (io.ReadCloser, error) {
+					return io.NopCloser(img.Open(record)), nil
+				},
+			}
+
+			continue
+		}
+
+		info.mode = fs.ModeDir | 0o555
+		info.size = 0
+
+		child := newTreeDir(info)
+		node.children[name] = child
+
+		childCompressed, err := readSession(img, record, child, visited)
+		if err != nil {
+			return false, err
+		}
+		compressed = compressed || childCompressed
+	}
+
+	return compressed, nil
+}
+
+// zisofsEntry returns the ZF entry of a record in the previous session, or nil if the file isn't compressed. Other
+// system use entries, such as the PD entries that we record along with ZF entries, aren't carried over.
+func zisofsEntry(img *reader.Image, record *reader.Record) ([]byte, error) {
+	entries, err := img.SystemUseEntries(record)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Signature == "ZF" {
+			return append([]byte{entry.Signature[0], entry.Signature[1], uint8(4 + len(entry.Data)), entry.Version}, entry.Data...), nil
+		}
+	}
+
+	return nil, nil
+}
+
+// addToSession adds the contents of a new session to the tree of the previous session. Names are matched regardless
+// of case, since they are converted to upper case in the image.
+func addToSession(tree *treeFS, contents fs.ReadDirFS) error {
+	nodes := map[string]*treeNode{".": tree.root}
+
+	return fs.WalkDir(contents, ".", func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entryPath == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not get info for '%s': %w", entryPath, err)
+		}
+
+		parent := nodes[path.Dir(entryPath)]
+		name := d.Name()
+
+		for existingName, existing := range parent.children {
+			if !strings.EqualFold(existingName, name) {
+				continue
+			}
+
+			delete(parent.children, existingName)
+
+			if existing.isDir() && d.IsDir() {
+				// Keep the contents of the existing directory, and merge the new directory into it
+				existing.info = renameFileInfo(info, existingName)
+				parent.children[existingName] = existing
+				nodes[entryPath] = existing
+				return nil
+			}
+		}
+
+		node := &treeNode{
+			info: info,
+			open: func() (io.ReadCloser, error) {
+				return contents.Open(entryPath)
+			},
+		}
+
+		if d.IsDir() {
+			node = newTreeDir(info)
+		}
+
+		parent.children[name] = node
+		nodes[entryPath] = node
+
+		return nil
+	})
+}
@@ -0,0 +1,184 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// findRecord finds the record at a slash-separated path in an image, or returns nil if there is no such record
+func findRecord(t *testing.T, img *reader.Image, name string) *reader.Record {
+	record, err := img.Root()
+	require.NoError(t, err, "Should be able to read root directory")
+
+	for _, part := range strings.Split(name, "/") {
+		records, err := img.ReadDir(record)
+		require.NoError(t, err, "Should be able to read directory")
+
+		record = nil
+		for _, candidate := range records {
+			if !candidate.IsSelf() && !candidate.IsParent() && candidate.Name() == part {
+				record = candidate
+				break
+			}
+		}
+
+		if record == nil {
+			return nil
+		}
+	}
+
+	return record
+}
+
+func readRecord(t *testing.T, img *reader.Image, name string) string {
+	record := findRecord(t, img, name)
+	require.NotNil(t, record, "Image should contain '%s'", name)
+
+	data, err := io.ReadAll(img.Open(record))
+	require.NoError(t, err, "Should be able to read '%s'", name)
+
+	return string(data)
+}
+
+// appendSession writes a new session, and returns the whole image with the session at the given block
+func appendSession(t *testing.T, previous []byte, image *iso9660.Image, start uint32) []byte {
+	var session bytes.Buffer
+	_, err := image.WriteTo(&session)
+	require.NoError(t, err, "WriteTo should not return an error when appending a session")
+
+	combined := make([]byte, int(start)*2048, int(start)*2048+session.Len())
+	copy(combined, previous)
+
+	return append(combined, session.Bytes()...)
+}
+
+func TestWithPreviousSession(t *testing.T) {
+	first := writeImage(t, fstest.MapFS{
+		"OLD.TXT":      {Data: []byte("old")},
+		"REPLACE.TXT":  {Data: []byte("before")},
+		"DIR/KEEP.TXT": {Data: []byte("keep")},
+	})
+	firstImg, err := reader.Open(bytes.NewReader(first))
+	require.NoError(t, err, "Should be able to read first session")
+	end := uint32(len(first) / 2048)
+
+	for name, nextStart := range map[string]uint32{"contiguous": 0, "with gap": end + 150} {
+		t.Run(name, func(t *testing.T) {
+			image, err := iso9660.NewImage(
+				fstest.MapFS{
+					"replace.txt": {Data: []byte("after")},
+					"dir/new.txt": {Data: []byte("new")},
+				},
+				iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first), NextStart: nextStart}),
+			)
+			require.NoError(t, err, "NewImage should not return an error for a valid previous session")
+
+			start := max(nextStart, end)
+			combined := appendSession(t, first, image, start)
+
+			img, err := reader.OpenAt(bytes.NewReader(combined), start)
+			require.NoError(t, err, "New session should be readable")
+			assert.EqualValues(t, len(combined)/2048, img.Primary.VolumeSpaceSize.RealValue(), "New session should describe the whole volume")
+
+			assert.Equal(t, "old", readRecord(t, img, "OLD.TXT"), "Files from the previous session should be carried over")
+			assert.Equal(t, findRecord(t, firstImg, "OLD.TXT").ExtentLocation, findRecord(t, img, "OLD.TXT").ExtentLocation, "Files from the previous session should refer to their existing extents")
+			assert.Equal(t, "keep", readRecord(t, img, "DIR/KEEP.TXT"), "Files in directories from the previous session should be carried over")
+			assert.Equal(t, "new", readRecord(t, img, "DIR/NEW.TXT"), "New files should be merged into existing directories regardless of case")
+			assert.Equal(t, "after", readRecord(t, img, "REPLACE.TXT"), "New files should replace files from the previous session regardless of case")
+			assert.GreaterOrEqual(t, findRecord(t, img, "REPLACE.TXT").ExtentLocation.RealValue(), start, "New files should be written in the new session")
+
+			original, err := reader.Open(bytes.NewReader(combined))
+			require.NoError(t, err, "First session should still be readable")
+			assert.Equal(t, "before", readRecord(t, original, "REPLACE.TXT"), "First session should be unchanged")
+			assert.Nil(t, findRecord(t, original, "DIR/NEW.TXT"), "First session should not contain new files")
+		})
+	}
+}
+
+func TestWithPreviousSession_Compressed(t *testing.T) {
+	big := bytes.Repeat([]byte("compressible "), 40000)
+	first := writeImage(t, fstest.MapFS{"BIG.TXT": {Data: big}}, iso9660.WithZisofs(iso9660.Zisofs{}))
+	end := uint32(len(first) / 2048)
+
+	image, err := iso9660.NewImage(
+		fstest.MapFS{"NEW.TXT": {Data: []byte("new")}},
+		iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first)}),
+	)
+	require.NoError(t, err, "NewImage should not return an error for a valid previous session")
+
+	combined := appendSession(t, first, image, end)
+	img, err := reader.OpenAt(bytes.NewReader(combined), end)
+	require.NoError(t, err, "New session should be readable")
+
+	hasSUSP, err := img.HasSUSP()
+	require.NoError(t, err, "Should be able to read root directory")
+	assert.True(t, hasSUSP, "New session should use SUSP, since it has compressed files")
+
+	record := findRecord(t, img, "BIG.TXT")
+	require.NotNil(t, record, "Compressed files from the previous session should be carried over")
+	rr, err := img.RockRidge(record)
+	require.NoError(t, err, "Should be able to read system use entries")
+	require.NotNil(t, rr, "Compressed file should keep its ZF entry")
+	assert.True(t, rr.Compressed, "Compressed file should still be compressed")
+	assert.EqualValues(t, len(big), rr.UncompressedSize, "ZF entry should record the original size")
+
+	decompressed, err := zisofs.NewReader(img.Open(record))
+	require.NoError(t, err, "Compressed file should have a valid zisofs header")
+	data, err := io.ReadAll(decompressed)
+	require.NoError(t, err, "Should be able to decompress file from the previous session")
+	assert.Equal(t, big, data, "Compressed file should be readable through the new session")
+
+	assert.Equal(t, "new", readRecord(t, img, "NEW.TXT"), "New files should not be compressed")
+}
+
+func TestWithPreviousSession_ExtendedAttributes(t *testing.T) {
+	first := writeImage(t, fstest.MapFS{"OLD.TXT": {Data: []byte("old")}})
+	end := uint32(len(first) / 2048)
+
+	image, err := iso9660.NewImage(
+		fstest.MapFS{"NEW.TXT": {Data: []byte("new")}},
+		iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first)}),
+		iso9660.WithExtendedAttributes(iso9660.FileInfoAttributes),
+	)
+	require.NoError(t, err, "NewImage should not return an error for a valid previous session")
+
+	combined := appendSession(t, first, image, end)
+	img, err := reader.OpenAt(bytes.NewReader(combined), end)
+	require.NoError(t, err, "New session should be readable")
+
+	assert.EqualValues(t, 0, findRecord(t, img, "OLD.TXT").ExtendedAttributeRecordLength, "Files from the previous session should be recorded without extended attributes")
+	assert.Equal(t, "old", readRecord(t, img, "OLD.TXT"), "Files from the previous session should be readable through the new session")
+	assert.NotZero(t, findRecord(t, img, "NEW.TXT").ExtendedAttributeRecordLength, "New files should be recorded with extended attributes")
+	assert.Equal(t, "new", readRecord(t, img, "NEW.TXT"), "New files should be readable through the new session")
+}
+
+func TestWithPreviousSession_Errors(t *testing.T) {
+	first := writeImage(t, fstest.MapFS{"OLD.TXT": {Data: []byte("old")}})
+
+	image, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first), NextStart: 20}))
+	require.NoError(t, err, "NewImage should not read the previous session")
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, iso9660.ErrSessionOverlap, "WriteTo should not allow a session that overlaps the previous session")
+
+	image, err = iso9660.NewImage(
+		fstest.MapFS{},
+		iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first)}),
+		iso9660.WithGPT(iso9660.GPT{}),
+	)
+	require.NoError(t, err, "NewImage should not check for conflicting options")
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, iso9660.ErrSessionSystemArea, "WriteTo should not allow writing a system area in a new session")
+
+	image, err = iso9660.NewImage(fstest.MapFS{}, iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(make([]byte, 64*1024))}))
+	require.NoError(t, err, "NewImage should not read the previous session")
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, reader.ErrNotISO9660, "WriteTo should fail if the previous session isn't ISO 9660")
+}
@@ -0,0 +1,104 @@
+package iso9660
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"io"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// WithSortWeights places the data of files in descending order of the weights given by weight, which is called with
+// the path of each file in the image's contents. This is the equivalent of the -sort option of mkisofs, and is used to
+// place files that are read together, such as a kernel and initrd, next to each other at the start of a disc, where
+// they are read fastest.
+//
+// Files with the same weight, including any that weight gives 0, keep the order in which they would otherwise be
+// placed. Directories and path tables aren't affected by weights, and are placed before the data of every file.
+func WithSortWeights(weight func(filePath string) int) ImageOption {
+	return func(i *Image) error {
+		i.sortWeight = weight
+		return nil
+	}
+}
+
+// ParseSortFile reads a sort file in the format used by mkisofs, for [WithSortWeights]. Each line has a path, or a
+// pattern in the syntax of [path.Match], followed by whitespace and a weight. Paths are in the image's contents, and
+// the first line that matches a file gives its weight. Files that no line matches have a weight of 0.
+func ParseSortFile(r io.Reader) (func(filePath string) int, error) {
+	type sortEntry struct {
+		pattern string
+		weight  int
+	}
+
+	var entries []sortEntry
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		// Paths may contain spaces, so the weight is whatever follows the last whitespace
+		index := strings.LastIndexAny(text, " \t")
+		if index == -1 {
+			return nil, fmt.Errorf("line %d of sort file has no weight", line)
+		}
+
+		weight, err := strconv.Atoi(text[index+1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d of sort file has invalid weight: %w", line, err)
+		}
+
+		pattern := path.Clean("/" + strings.TrimSpace(text[:index]))[1:]
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("line %d of sort file has invalid pattern: %w", line, err)
+		}
+
+		entries = append(entries, sortEntry{pattern: pattern, weight: weight})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("could not read sort file: %w", err)
+	}
+
+	return func(filePath string) int {
+		for _, entry := range entries {
+			if matched, _ := path.Match(entry.pattern, filePath); matched {
+				return entry.weight
+			}
+		}
+
+		return 0
+	}, nil
+}
+
+// fileWeights returns the weight of each file in files, which are by their path in the image's contents. Every file
+// has a weight of 0 if no weights were given.
+func (i *Image) fileWeights(files map[string]*builder.File) func(*builder.File) int {
+	weights := make(map[*builder.File]int, len(files))
+	if i.sortWeight != nil {
+		for filePath, file := range files {
+			weights[file] = i.sortWeight(filePath)
+		}
+	}
+
+	return func(file *builder.File) int {
+		return weights[file]
+	}
+}
+
+// relocateTree allocates blocks to the directories and files of the primary hierarchy, in the order given by the
+// image's sort weights if it has any, and with files aligned as given by its alignment
+func (i *Image) relocateTree(dir *builder.Directory, files map[string]*builder.File, block *uint32) {
+	extents := slices.Collect(dir.Extents())
+	if i.sortWeight != nil {
+		extents = dir.ExtentsByWeight(i.fileWeights(files))
+	}
+
+	builder.RelocateExtents(extents, block, i.fileAlignments(files))
+}
@@ -0,0 +1,65 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithSortWeights(t *testing.T) {
+	source := fstest.MapFS{
+		"A.TXT":             {Data: []byte("a")},
+		"BOOT/INITRD.IMG":   {Data: bytes.Repeat([]byte("i"), 5000)},
+		"BOOT/VMLINUZ":      {Data: bytes.Repeat([]byte("k"), 3000)},
+		"DOCS/README.TXT":   {Data: []byte("readme")},
+		"DOCS/LICENSE.TXT":  {Data: []byte("license")},
+		"ZZZ/DEEP/LAST.TXT": {Data: []byte("last")},
+	}
+
+	weight, err := iso9660.ParseSortFile(strings.NewReader("BOOT/VMLINUZ 100\n\n/BOOT/* 50\nDOCS/*.TXT -1\n"))
+	require.NoError(t, err, "ParseSortFile should not return an error for a valid sort file")
+
+	image, err := iso9660.NewImage(source, iso9660.WithSortWeights(weight))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Sorted image should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	for name, file := range source {
+		assert.Equal(t, string(file.Data), readRecord(t, img, name), "'%s' should be written to its extent", name)
+	}
+
+	// Files with equal weights keep their usual (breadth-first) order
+	order := []string{"BOOT/VMLINUZ", "BOOT/INITRD.IMG", "A.TXT", "ZZZ/DEEP/LAST.TXT", "DOCS/LICENSE.TXT", "DOCS/README.TXT"}
+	for i := 1; i < len(order); i++ {
+		assert.Less(t,
+			findRecord(t, img, order[i-1]).ExtentLocation.RealValue(),
+			findRecord(t, img, order[i]).ExtentLocation.RealValue(),
+			"'%s' should be placed before '%s'", order[i-1], order[i],
+		)
+	}
+
+	deepest := findRecord(t, img, "ZZZ/DEEP").ExtentLocation.RealValue()
+	assert.Less(t, deepest, findRecord(t, img, "BOOT/VMLINUZ").ExtentLocation.RealValue(), "Directories should be placed before files")
+}
+
+func TestParseSortFile_Errors(t *testing.T) {
+	for name, contents := range map[string]string{
+		"no weight":      "BOOT/VMLINUZ\n",
+		"invalid weight": "BOOT/VMLINUZ high\n",
+		"bad pattern":    "BOOT/[ 1\n",
+	} {
+		_, err := iso9660.ParseSortFile(strings.NewReader(contents))
+		assert.Error(t, err, "ParseSortFile should return an error for a sort file with %s", name)
+	}
+}
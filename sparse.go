@@ -0,0 +1,254 @@
+package iso9660
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+)
+
+// zeroBuffer is written in place of holes in source files, and its first block is compared with blocks to be written
+// to find those that can be skipped
+var (
+	zeroBuffer = make([]byte, 32*spec.LogicalSectorSize)
+	zeroBlock  = zeroBuffer[:spec.LogicalSectorSize]
+)
+
+// SparseWriter writes an image to a file, skipping over blocks that are entirely zeros rather than writing them, so
+// that the file is sparse on filesystems that support it. Images often contain large areas of zeros, such as padding,
+// unused parts of the system area, and the contents of mostly empty disk images, which then take no space on disk
+// and no time to write.
+//
+// Skipped blocks are left as they are, so the file must not already contain data where the image is written, as is
+// the case for a newly created or truncated file. Since a file doesn't grow when blocks at its end are skipped,
+// [SparseWriter.Close] must be called once the image has been written.
+//
+// SparseWriter implements [io.WriteSeeker] and [io.WriterAt], so can be used with both [Image.WriteTo] and
+// [Image.WriteToWriterAt], and with [WithImplantedMD5].
+type SparseWriter struct {
+	f *os.File
+
+	// start is the offset in f at which the image starts, which blocks are aligned to, and pos is the current offset.
+	// Skipped blocks are seeked over just before the next write, so the offset of f may be behind pos.
+	start  int64
+	pos    int64
+	seeked bool
+
+	// end is the offset in f of the end of everything written or skipped so far
+	mu  sync.Mutex
+	end int64
+}
+
+// NewSparseWriter returns a writer that writes an image to f sparsely, starting at the current offset in f
+func NewSparseWriter(f *os.File) (*SparseWriter, error) {
+	start, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("could not find start of image: %w", err)
+	}
+
+	return &SparseWriter{f: f, start: start, pos: start, end: start, seeked: true}, nil
+}
+
+func (s *SparseWriter) Write(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		data, zeros := s.split(s.pos, p[n:])
+
+		if data > 0 {
+			if !s.seeked {
+				if _, err := s.f.Seek(s.pos, io.SeekStart); err != nil {
+					return n, fmt.Errorf("could not skip zeros: %w", err)
+				}
+
+				s.seeked = true
+			}
+
+			written, err := s.f.Write(p[n : n+data])
+			s.pos += int64(written)
+			n += written
+			s.extend(s.pos)
+
+			if err != nil {
+				return n, err
+			}
+		}
+
+		if zeros > 0 {
+			s.pos += int64(zeros)
+			s.seeked = false
+			n += zeros
+			s.extend(s.pos)
+		}
+	}
+
+	return n, nil
+}
+
+// WriteAt writes p at the given offset from the start of the image, skipping whole blocks of zeros
+func (s *SparseWriter) WriteAt(p []byte, off int64) (int, error) {
+	off += s.start
+
+	n := 0
+	for n < len(p) {
+		data, zeros := s.split(off+int64(n), p[n:])
+
+		if data > 0 {
+			written, err := s.f.WriteAt(p[n:n+data], off+int64(n))
+			n += written
+			s.extend(off + int64(n))
+
+			if err != nil {
+				return n, err
+			}
+		}
+
+		n += zeros
+		s.extend(off + int64(n))
+	}
+
+	return n, nil
+}
+
+func (s *SparseWriter) Seek(offset int64, whence int) (int64, error) {
+	// The end of the file may not be the end of the image yet, since skipped blocks at the end don't extend the file
+	if whence == io.SeekEnd {
+		if err := s.Close(); err != nil {
+			return s.pos, err
+		}
+	}
+
+	if whence == io.SeekCurrent {
+		offset += s.pos
+		whence = io.SeekStart
+	}
+
+	pos, err := s.f.Seek(offset, whence)
+	if err != nil {
+		return s.pos, err
+	}
+
+	s.pos = pos
+	s.seeked = true
+	return pos, nil
+}
+
+// ReadAt reads the image written so far at the given offset from its start, including any skipped blocks at its end
+func (s *SparseWriter) ReadAt(p []byte, off int64) (int, error) {
+	if err := s.Close(); err != nil {
+		return 0, err
+	}
+
+	return s.f.ReadAt(p, s.start+off)
+}
+
+// Close extends the file to the end of the image, if blocks at its end were skipped. It doesn't close the file.
+func (s *SparseWriter) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := s.f.Stat()
+	if err != nil {
+		return fmt.Errorf("could not find size of file: %w", err)
+	}
+
+	if info.Size() < s.end {
+		if err := s.f.Truncate(s.end); err != nil {
+			return fmt.Errorf("could not extend file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// split returns the length of the data at the start of p, which is to be written at the given offset, that must be
+// written, and the length of the whole blocks of zeros after it that can be skipped
+func (s *SparseWriter) split(offset int64, p []byte) (data int, zeros int) {
+	i := 0
+	for i < len(p) {
+		size := min(len(p)-i, len(zeroBlock)-int((offset-s.start+int64(i))%int64(len(zeroBlock))))
+		if size == len(zeroBlock) && bytes.Equal(p[i:i+size], zeroBlock) {
+			if data > 0 {
+				break
+			}
+
+			zeros += size
+		} else {
+			if zeros > 0 {
+				break
+			}
+
+			data += size
+		}
+
+		i += size
+	}
+
+	return data, zeros
+}
+
+func (s *SparseWriter) extend(end int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.end = max(s.end, end)
+}
+
+// seekableFile is a file whose holes may be found by seeking, such as an [os.File]
+type seekableFile interface {
+	fs.File
+	io.ReaderAt
+	io.Seeker
+}
+
+// sparseFile is a file in the image's contents whose holes (ranges without data, which read as zeros) can be found
+// with SEEK_DATA and SEEK_HOLE, so that they needn't be read when the file is written to an image. The zeros written
+// in their place are then skipped by a [SparseWriter]. Files that can't report holes are read in full.
+type sparseFile struct {
+	seekableFile
+}
+
+// copyFile copies a file in the image's contents to w, skipping its holes if it is a [seekableFile]. Wrappers around
+// files, such as those of a [treeFS], implement [io.WriterTo] with copyFile so that holes are skipped through them.
+func copyFile(w io.Writer, r io.Reader) (int64, error) {
+	if f, ok := r.(seekableFile); ok {
+		return (&sparseFile{f}).WriteTo(w)
+	}
+
+	return io.Copy(w, r)
+}
+
+func (s *sparseFile) WriteTo(w io.Writer) (int64, error) {
+	info, err := s.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	written := int64(0)
+	for offset := int64(0); offset < info.Size(); {
+		data, hole, err := nextData(s.seekableFile, offset, info.Size())
+		if err != nil {
+			return written, err
+		}
+
+		for written < data {
+			n, err := w.Write(zeroBuffer[:min(data-written, int64(len(zeroBuffer)))])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+
+		n, err := io.Copy(w, io.NewSectionReader(s.seekableFile, data, hole-data))
+		written += n
+		if err != nil {
+			return written, err
+		}
+
+		offset = hole
+	}
+
+	return written, nil
+}
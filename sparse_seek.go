@@ -0,0 +1,29 @@
+//go:build linux || darwin || freebsd
+
+package iso9660
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"io"
+)
+
+// nextData returns the offset of the next data in f at or after offset, and the offset of the hole that follows it.
+// Holes that the filesystem can't report are treated as data, as is the rest of the file if f doesn't understand
+// SEEK_DATA and SEEK_HOLE, which files that aren't on disk (e.g. in an [fstest.MapFS]) may treat as another whence.
+func nextData(f io.Seeker, offset int64, size int64) (data int64, hole int64, err error) {
+	data, err = f.Seek(offset, unix.SEEK_DATA)
+	if errors.Is(err, unix.ENXIO) {
+		// There is no data after offset, so the rest of the file is a hole
+		return size, size, nil
+	} else if err != nil {
+		return offset, size, nil
+	}
+
+	hole, err = f.Seek(data, unix.SEEK_HOLE)
+	if err != nil || data < offset || hole <= data {
+		return offset, size, nil
+	}
+
+	return data, min(hole, size), nil
+}
@@ -0,0 +1,186 @@
+//go:build unix
+
+package iso9660_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+)
+
+// allocatedSize returns the number of bytes of disk space allocated to a file, which is less than its size if it is
+// sparse
+func allocatedSize(t *testing.T, name string) int64 {
+	info, err := os.Stat(name)
+	require.NoError(t, err, "Should be able to stat '%s'", name)
+
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+func TestSparseWriter(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.TXT"), []byte("mostly empty"), 0o644), "Should be able to create source file")
+
+	// The disk image is a hole apart from its last few bytes
+	disk, err := os.Create(filepath.Join(dir, "DISK.IMG"))
+	require.NoError(t, err, "Should be able to create source file")
+	_, err = disk.WriteAt([]byte("end"), 16<<20-3)
+	require.NoError(t, err, "Should be able to write to source file")
+	require.NoError(t, disk.Close(), "Should be able to close source file")
+
+	image, err := iso9660.NewImage(os.DirFS(dir).(fs.ReadDirFS), iso9660.WithImplantedMD5())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	for name, write := range map[string]func(sw *iso9660.SparseWriter) (int64, error){
+		"WriteTo":         func(sw *iso9660.SparseWriter) (int64, error) { return image.WriteTo(sw) },
+		"WriteToWriterAt": func(sw *iso9660.SparseWriter) (int64, error) { return image.WriteToWriterAt(sw, 2) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			f, err := os.Create(filepath.Join(t.TempDir(), "image.iso"))
+			require.NoError(t, err, "Should be able to create output file")
+			defer f.Close()
+
+			sw, err := iso9660.NewSparseWriter(f)
+			require.NoError(t, err, "NewSparseWriter should not return an error for a new file")
+
+			written, err := write(sw)
+			require.NoError(t, err, "Writing to a SparseWriter should not return an error")
+			require.NoError(t, sw.Close(), "Close should not return an error")
+
+			data, err := os.ReadFile(f.Name())
+			require.NoError(t, err, "Should be able to read output file")
+			require.EqualValues(t, written, len(data), "File should be extended to the size of the image")
+			assert.Less(t, allocatedSize(t, f.Name()), int64(1<<20), "Blocks of zeros should not be written")
+
+			assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Sparse image should not violate the spec")
+			assert.NoError(t, iso9660.VerifyImplantedMD5(bytes.NewReader(data)), "Sparse image should match its implanted checksum")
+
+			img, err := reader.Open(bytes.NewReader(data))
+			require.NoError(t, err, "Image should be readable")
+
+			contents := readRecord(t, img, "DISK.IMG")
+			assert.Len(t, contents, 16<<20, "Holes in source files should be written as zeros")
+			assert.Equal(t, "end", contents[len(contents)-3:], "Data after holes in source files should be written")
+			assert.Equal(t, "mostly empty", readRecord(t, img, "README.TXT"), "Files should be written")
+		})
+	}
+}
+
+// readCountingFS counts the bytes read from its files with Read, rather than ReadAt
+type readCountingFS struct {
+	fs.ReadDirFS
+
+	read atomic.Int64
+}
+
+func (r *readCountingFS) Open(name string) (fs.File, error) {
+	f, err := r.ReadDirFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if osFile, ok := f.(*os.File); ok {
+		return &readCountingFile{File: osFile, read: &r.read}, nil
+	}
+
+	return f, nil
+}
+
+type readCountingFile struct {
+	*os.File
+
+	read *atomic.Int64
+}
+
+func (r *readCountingFile) Read(p []byte) (int, error) {
+	n, err := r.File.Read(p)
+	r.read.Add(int64(n))
+	return n, err
+}
+
+func TestNewImage_HolesThroughWrappers(t *testing.T) {
+	dir := t.TempDir()
+
+	// The disk image is a hole apart from its last few bytes
+	disk, err := os.Create(filepath.Join(dir, "DISK.IMG"))
+	require.NoError(t, err, "Should be able to create source file")
+	_, err = disk.WriteAt([]byte("end"), 16<<20-3)
+	require.NoError(t, err, "Should be able to write to source file")
+	require.NoError(t, disk.Close(), "Should be able to close source file")
+
+	for name, opts := range map[string][]iso9660.ImageOption{
+		"graft":               nil,
+		"graft with manifest": {iso9660.WithManifest(iso9660.Manifest{})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			source := &readCountingFS{ReadDirFS: os.DirFS(dir).(fs.ReadDirFS)}
+			grafted, err := iso9660.NewGraftFS(iso9660.ConflictPolicyError, iso9660.GraftPoint{Path: "DISKS", Source: source})
+			require.NoError(t, err, "NewGraftFS should not return an error")
+
+			image, err := iso9660.NewImage(grafted, opts...)
+			require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+			var buff bytes.Buffer
+			_, err = image.WriteTo(&buff)
+			require.NoError(t, err, "WriteTo should not return an error")
+			assert.Zero(t, source.read.Load(), "Files on disk should be written without reading them in full")
+
+			img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+			require.NoError(t, err, "Image should be readable")
+
+			contents := readRecord(t, img, "DISKS/DISK.IMG")
+			assert.Len(t, contents, 16<<20, "Holes in grafted files should be written as zeros")
+			assert.Equal(t, "end", contents[len(contents)-3:], "Data after holes in grafted files should be written")
+
+			if len(opts) > 0 {
+				digest := sha256.Sum256([]byte(contents))
+				assert.Contains(t, readRecord(t, img, iso9660.DefaultManifestName), hex.EncodeToString(digest[:])+"  DISKS/DISK.IMG", "Holes should be hashed as zeros")
+			}
+		})
+	}
+}
+
+func TestSparseWriter_Write(t *testing.T) {
+	data := make([]byte, 100*2048)
+	random := rand.New(rand.NewSource(1))
+	for block := 0; block < 100; block += 3 {
+		random.Read(data[block*2048 : block*2048+100+block])
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "image.iso"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	// Writes that aren't aligned to blocks should be split into data to write and whole blocks of zeros to skip
+	_, err = f.Write([]byte("before"))
+	require.NoError(t, err, "Should be able to write to output file")
+
+	sw, err := iso9660.NewSparseWriter(f)
+	require.NoError(t, err, "NewSparseWriter should not return an error")
+
+	for offset := 0; offset < len(data); offset += 1000 {
+		_, err := sw.Write(data[offset:min(offset+1000, len(data))])
+		require.NoError(t, err, "Write should not return an error")
+	}
+
+	require.NoError(t, sw.Close(), "Close should not return an error")
+
+	_, err = sw.WriteAt([]byte("patch"), 2048)
+	require.NoError(t, err, "WriteAt should not return an error")
+	copy(data[2048:], "patch")
+
+	written, err := os.ReadFile(f.Name())
+	require.NoError(t, err, "Should be able to read output file")
+	assert.Equal(t, append([]byte("before"), data...), written, "File should contain everything written, at offsets from the start of the image")
+}
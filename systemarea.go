@@ -0,0 +1,144 @@
+package iso9660
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/partition"
+	"io"
+)
+
+// systemAreaSize is the size of the system area, which is the first 16 blocks of the image. The spec leaves its
+// contents up to the system that uses the image; we use it for partition tables.
+//
+// ECMA-119 (5th ed.) §6.2.1
+const systemAreaSize = 16 * 2048
+
+// ErrSystemAreaTooLarge indicates that the data given to [WithSystemArea] doesn't fit in the system area
+var ErrSystemAreaTooLarge = errors.New("system area data is larger than 32 KiB")
+
+// WithSystemArea writes data verbatim to the system area, which is the first 32 KiB of the image, before the volume
+// descriptor set. Some systems expect boot code or other data here. The data is read immediately, and must be no more
+// than 32 KiB; shorter data is padded with zeros.
+//
+// If used with [WithHybridMBR] or [WithGPT], the partition tables they create are written over the relevant parts of
+// the data, i.e. the first 512 bytes, and the 16 KiB after that for a GPT (or more, if it has an Apple partition map).
+// With [WithGPT] alone, boot code in the first 440 bytes of the data is kept.
+func WithSystemArea(r io.Reader) ImageOption {
+	return func(i *Image) error {
+		data, err := io.ReadAll(io.LimitReader(r, systemAreaSize+1))
+		if err != nil {
+			return fmt.Errorf("could not read system area data: %w", err)
+		}
+
+		if len(data) > systemAreaSize {
+			return ErrSystemAreaTooLarge
+		}
+
+		i.systemAreaData = data
+		return nil
+	}
+}
+
+// systemArea builds the contents of the system area, once the layout of the image is known. volumeSpaceSize is the
+// size of the ISO 9660 filesystem in blocks. It returns nil if the system area should be left empty, and also returns
+// the GPT, if there is one, since its backup copy is written at the end of the image.
+func (i *Image) systemArea(
+	files map[string]*builder.File,
+	volumeSpaceSize uint32,
+	layout *gptLayout,
+) ([]byte, *partition.GPT, error) {
+	if i.systemAreaData == nil && i.hybrid == nil && i.gpt == nil {
+		return nil, nil, nil
+	}
+
+	area := make([]byte, systemAreaSize)
+	copy(area, i.systemAreaData)
+
+	if i.hybrid == nil && i.gpt == nil {
+		return area, nil, nil
+	}
+
+	var mbr *partition.MBR
+	var err error
+
+	if i.hybrid != nil {
+		mbr, err = i.hybrid.build(files, volumeSpaceSize)
+	} else {
+		// Keep any boot code from the system area data, so that only the partition table is replaced
+		mbr, err = partition.NewMBR(area[:partition.BootCodeSize], binary.LittleEndian.Uint32(area[440:444]))
+		if mbr != nil {
+			mbr.BootLoaderLBA = binary.LittleEndian.Uint64(area[partition.BootCodeSize:440])
+		}
+	}
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not create MBR: %w", err)
+	}
+
+	var gpt *partition.GPT
+	var apm *partition.APM
+	if i.gpt != nil {
+		if gpt, err = i.gpt.build(layout); err != nil {
+			return nil, nil, fmt.Errorf("could not create GPT: %w", err)
+		}
+
+		gpt.ProtectiveMBR(mbr)
+
+		if i.gpt.AppleMap {
+			apm = i.gpt.buildAPM(layout)
+
+			// The Apple partition map occupies the blocks where the GPT entry array would usually be
+			gpt.EntryLBA = uint64(1+apm.MapBlocks()) * sectorsPerBlock
+
+			apmMap, err := apm.Map()
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not create Apple partition map: %w", err)
+			}
+
+			if err := writeAt(area, partition.APMBlockSize, apmMap); err != nil {
+				return nil, nil, fmt.Errorf("could not write Apple partition map: %w", err)
+			}
+		}
+
+		header, entries, err := gpt.Primary()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not create primary GPT: %w", err)
+		}
+
+		if err := writeAt(area, partition.SectorSize, header); err != nil {
+			return nil, nil, fmt.Errorf("could not write primary GPT header: %w", err)
+		}
+
+		if err := writeAt(area, int(gpt.EntryLBA)*partition.SectorSize, entries); err != nil {
+			return nil, nil, fmt.Errorf("could not write primary GPT entry array: %w", err)
+		}
+	}
+
+	if err := writeAt(area, 0, mbr); err != nil {
+		return nil, nil, fmt.Errorf("could not write MBR: %w", err)
+	}
+
+	if apm != nil {
+		copy(area, apm.DriverDescriptorMap())
+	}
+
+	return area, gpt, nil
+}
+
+// writeAt writes a structure into a buffer at the given offset, failing if it would overrun the buffer
+func writeAt(buffer []byte, offset int, contents io.WriterTo) error {
+	var buff bytes.Buffer
+	if _, err := contents.WriteTo(&buff); err != nil {
+		return err
+	}
+
+	if offset+buff.Len() > len(buffer) {
+		return fmt.Errorf("%d bytes at offset %d would overrun %d byte buffer", buff.Len(), offset, len(buffer))
+	}
+
+	copy(buffer[offset:], buff.Bytes())
+	return nil
+}
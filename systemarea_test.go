@@ -0,0 +1,49 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithSystemArea(t *testing.T) {
+	systemArea := bytes.Repeat([]byte("SGI!"), 5000)
+
+	image, err := iso9660.NewImage(fstest.MapFS{"README.TXT": {Data: []byte("readme")}}, iso9660.WithSystemArea(bytes.NewReader(systemArea)))
+	require.NoError(t, err, "NewImage should not return an error for system area data that fits")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error with system area data")
+
+	data := buff.Bytes()
+	assert.Equal(t, systemArea, data[:len(systemArea)], "System area data should be written verbatim")
+	assert.Equal(t, make([]byte, 32*1024-len(systemArea)), data[len(systemArea):32*1024], "Remainder of system area should be zero")
+	assert.Equal(t, "CD001", string(data[32*1024+1:32*1024+6]), "Volume descriptor set should follow the system area")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image with system area data should not violate the spec")
+}
+
+func TestWithSystemArea_WithGPT(t *testing.T) {
+	systemArea := bytes.Repeat([]byte{0xAB}, 32*1024)
+
+	image, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithSystemArea(bytes.NewReader(systemArea)), iso9660.WithGPT(iso9660.GPT{}))
+	require.NoError(t, err, "NewImage should not return an error for a full system area")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error with system area data and a GPT")
+
+	data := buff.Bytes()
+	assert.Equal(t, systemArea[:440], data[:440], "Boot code from system area data should be kept")
+	assert.EqualValues(t, 0xEE, data[446+4], "Partition table should be replaced with a protective MBR")
+	assert.Equal(t, "EFI PART", string(data[512:520]), "GPT should be written over the system area data")
+	assert.Equal(t, systemArea[34*512:], data[34*512:32*1024], "System area data after the GPT should be kept")
+}
+
+func TestWithSystemArea_TooLarge(t *testing.T) {
+	_, err := iso9660.NewImage(fstest.MapFS{}, iso9660.WithSystemArea(bytes.NewReader(make([]byte, 32*1024+1))))
+	assert.ErrorIs(t, err, iso9660.ErrSystemAreaTooLarge, "NewImage should reject system area data larger than 32 KiB")
+}
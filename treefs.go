@@ -0,0 +1,289 @@
+package iso9660
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// maxLinkDepth is the maximum number of links that will be followed when resolving a path, which protects against
+// link cycles. This is the same limit that Linux uses.
+const maxLinkDepth = 40
+
+var errTooManyLinks = errors.New("too many levels of links")
+
+// treeNode is a file, directory, or link in a [treeFS]
+type treeNode struct {
+	info fs.FileInfo
+
+	// open returns the contents of a regular file. It is nil for directories and links.
+	open func() (io.ReadCloser, error)
+
+	// link is the slash-separated path of the node that this node refers to, relative to the root of the tree. It is
+	// empty unless the node is a hard or symbolic link.
+	link string
+
+	// children is nil if and only if the node is not a directory
+	children map[string]*treeNode
+}
+
+func newTreeDir(info fs.FileInfo) *treeNode {
+	return &treeNode{info: info, children: make(map[string]*treeNode)}
+}
+
+func (n *treeNode) isDir() bool {
+	return n.children != nil
+}
+
+// treeFS is a read-only, in-memory directory tree whose file contents are opened lazily by each node. It backs
+// filesystems that are assembled from other sources, such as graft points and archives.
+type treeFS struct {
+	root *treeNode
+}
+
+var _ fs.ReadDirFS = &treeFS{}
+var _ fs.StatFS = &treeFS{}
+
+func newTreeFS(modTime time.Time) *treeFS {
+	return &treeFS{root: newTreeDir(&syntheticDirInfo{name: ".", modTime: modTime})}
+}
+
+// mkdirAll returns the directory node at the given path, creating it and any missing parents as synthetic directories
+// with the given modification time. It returns nil if a non-directory is in the way.
+func (t *treeFS) mkdirAll(name string, modTime time.Time) *treeNode {
+	node := t.root
+	if name == "." {
+		return node
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		child, ok := node.children[part]
+		if !ok {
+			child = newTreeDir(&syntheticDirInfo{name: part, modTime: modTime})
+			node.children[part] = child
+		} else if !child.isDir() {
+			return nil
+		}
+
+		node = child
+	}
+
+	return node
+}
+
+// resolve finds the node at the given path. Links in parent directories are always followed; the node itself is only
+// followed if it is a link and follow is true.
+func (t *treeFS) resolve(op string, name string, follow bool) (*treeNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	node, err := t.resolveDepth(name, follow, 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return node, nil
+}
+
+func (t *treeFS) resolveDepth(name string, follow bool, depth int) (*treeNode, error) {
+	if depth > maxLinkDepth {
+		return nil, errTooManyLinks
+	}
+
+	node := t.root
+	if name == "." {
+		return node, nil
+	}
+
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if !node.isDir() {
+			return nil, fs.ErrNotExist
+		}
+
+		child, ok := node.children[part]
+		if !ok {
+			return nil, fs.ErrNotExist
+		}
+
+		if child.link != "" && (follow || i < len(parts)-1) {
+			var err error
+			if child, err = t.resolveDepth(child.link, true, depth+1); err != nil {
+				return nil, err
+			}
+		}
+
+		node = child
+	}
+
+	return node, nil
+}
+
+func (t *treeFS) Open(name string) (fs.File, error) {
+	node, err := t.resolve("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	info := renameFileInfo(node.info, path.Base(name))
+
+	if node.isDir() {
+		entries, err := t.ReadDir(name)
+		if err != nil {
+			return nil, err
+		}
+
+		return &treeDir{info: info, entries: entries}, nil
+	}
+
+	r, err := node.open()
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return &treeFile{ReadCloser: r, info: info}, nil
+}
+
+func (t *treeFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	node, err := t.resolve("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if !node.isDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(node.children))
+	for childName, child := range node.children {
+		entries = append(entries, fs.FileInfoToDirEntry(renameFileInfo(child.info, childName)))
+	}
+
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return entries, nil
+}
+
+func (t *treeFS) Stat(name string) (fs.FileInfo, error) {
+	node, err := t.resolve("stat", name, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return renameFileInfo(node.info, path.Base(name)), nil
+}
+
+// treeFile is an open regular file in a treeFS
+type treeFile struct {
+	io.ReadCloser
+	info fs.FileInfo
+}
+
+var _ fs.File = &treeFile{}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// WriteTo writes the contents of the file, skipping holes in the underlying file if it has any (see [copyFile])
+func (f *treeFile) WriteTo(w io.Writer) (int64, error) {
+	return copyFile(w, f.ReadCloser)
+}
+
+// treeDir is an open directory in a treeFS
+type treeDir struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+var _ fs.ReadDirFile = &treeDir{}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.Name(), Err: errors.New("is a directory")}
+}
+
+func (d *treeDir) Close() error {
+	return nil
+}
+
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(remaining))
+	d.offset += n
+
+	return remaining[:n], nil
+}
+
+// renamedFileInfo overrides the name of a file, since a node in a treeFS can have a different name from the one it
+// has in its source
+type renamedFileInfo struct {
+	fs.FileInfo
+	name string
+}
+
+func (r *renamedFileInfo) Name() string {
+	return r.name
+}
+
+// renameFileInfo returns info with the given name. The original info is returned where possible, so that any methods
+// it has beyond those in [fs.FileInfo] remain available.
+func renameFileInfo(info fs.FileInfo, name string) fs.FileInfo {
+	if info.Name() == name {
+		return info
+	}
+
+	return &renamedFileInfo{FileInfo: info, name: name}
+}
+
+// syntheticDirInfo describes a directory that doesn't exist in any source, but which is needed as the parent of
+// another entry
+type syntheticDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+var _ fs.FileInfo = &syntheticDirInfo{}
+
+func (s *syntheticDirInfo) Name() string       { return s.name }
+func (s *syntheticDirInfo) Size() int64        { return 0 }
+func (s *syntheticDirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o755 }
+func (s *syntheticDirInfo) ModTime() time.Time { return s.modTime }
+func (s *syntheticDirInfo) IsDir() bool        { return true }
+func (s *syntheticDirInfo) Sys() any           { return nil }
+
+// syntheticFileInfo describes a regular file that is generated in memory rather than read from a source
+type syntheticFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+var _ fs.FileInfo = &syntheticFileInfo{}
+
+func (s *syntheticFileInfo) Name() string       { return s.name }
+func (s *syntheticFileInfo) Size() int64        { return s.size }
+func (s *syntheticFileInfo) Mode() fs.FileMode  { return 0o644 }
+func (s *syntheticFileInfo) ModTime() time.Time { return s.modTime }
+func (s *syntheticFileInfo) IsDir() bool        { return false }
+func (s *syntheticFileInfo) Sys() any           { return nil }
@@ -0,0 +1,99 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/udf"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// ErrUDFOptions indicates that a UDF bridge was requested along with options that it can't be used with
+var ErrUDFOptions = errors.New("UDF bridge cannot be used with previous sessions or volume sets")
+
+// WithUDF adds a UDF bridge to the image: UDF 1.02 structures alongside the ISO 9660 structures, for readers that only
+// understand UDF, such as some set-top boxes. The UDF file set has the same files and directories as the image, with
+// their names as they are in the image's contents, and its file entries refer to the same data as the ISO 9660
+// directory records.
+//
+// The ISO 9660 path tables, directories and files follow the UDF structures, which extend past the anchor that UDF
+// requires at block 256, so a UDF bridge adds at least 512 KiB to an image.
+func WithUDF() ImageOption {
+	return func(i *Image) error {
+		i.udf = true
+		return nil
+	}
+}
+
+// newUDFVolume creates a UDF bridge volume for the files in source. files are the files in the primary hierarchy by
+// their path in source, which determines which files are recorded. The locations of the files are recorded in the
+// volume by [setUDFLocations], once they have been allocated. Hidden files are hidden in the volume too, but associated
+// files aren't recorded, since UDF 1.02 has no equivalent.
+func newUDFVolume(source fs.ReadDirFS, identifier string, recordedAt time.Time, files map[string]*builder.File, flags fileFlags) (*udf.Volume, map[*udf.Node]*builder.File, error) {
+	rootInfo, err := fs.Stat(source, ".")
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not stat root directory: %w", err)
+	}
+
+	root := &udf.Node{ModTime: rootInfo.ModTime(), IsDir: true}
+	nodes := map[string]*udf.Node{".": root}
+	nodeFiles := make(map[*udf.Node]*builder.File, len(files))
+
+	err = fs.WalkDir(source, ".", func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entryPath == "." {
+			return nil
+		}
+
+		parent := nodes[path.Dir(entryPath)]
+		if parent == nil {
+			return nil
+		}
+
+		_, isAssociated := flags.associated[entryPath]
+		file, isFile := files[entryPath]
+		if !d.IsDir() && (!isFile || isAssociated) {
+			// Files that aren't in the primary hierarchy, such as symbolic links to directories, aren't recorded
+			return nil
+		}
+
+		info, err := fs.Stat(source, entryPath)
+		if err != nil {
+			return fmt.Errorf("could not stat '%s': %w", entryPath, err)
+		}
+
+		node := &udf.Node{Name: d.Name(), ModTime: info.ModTime(), IsDir: d.IsDir(), Hidden: flags.isHidden(entryPath)}
+		parent.Children = append(parent.Children, node)
+
+		if d.IsDir() {
+			nodes[entryPath] = node
+		} else {
+			nodeFiles[node] = file
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	volume, err := udf.NewVolume(identifier, recordedAt, root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return volume, nodeFiles, nil
+}
+
+// setUDFLocations records the locations of files in a UDF volume, once they have been allocated
+func setUDFLocations(files map[*udf.Node]*builder.File) {
+	for node, file := range files {
+		node.Location = file.DataLocation()
+		node.Size = uint64(file.PointerRecord().DataLength.RealValue())
+	}
+}
@@ -0,0 +1,101 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/udf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// findUDFEntry finds the entry at a slash-separated path in the file set of a UDF volume
+func findUDFEntry(t *testing.T, volume *udf.Reader, name string) *udf.DirectoryEntry {
+	root, err := volume.Root()
+	require.NoError(t, err, "Should be able to read UDF root directory")
+
+	entry := &udf.DirectoryEntry{Entry: root}
+	for _, part := range strings.Split(name, "/") {
+		entries, err := volume.ReadDir(entry.Entry)
+		require.NoError(t, err, "Should be able to read UDF directory")
+
+		entry = nil
+		for _, candidate := range entries {
+			if candidate.Characteristics&udf.FileCharacteristicParent == 0 && candidate.Name == part {
+				entry = &candidate
+				break
+			}
+		}
+
+		if entry == nil {
+			return nil
+		}
+	}
+
+	return entry
+}
+
+func TestWithUDF(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT":       {Data: []byte("readme")},
+		"Video/Movie.m2ts": {Data: bytes.Repeat([]byte("movie"), 1000)},
+		"Video/empty":      {Data: []byte{}},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "ISO 9660 structures should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "ISO 9660 structures should be readable")
+	assert.EqualValues(t, buff.Len()/2048, img.Primary.VolumeSpaceSize.RealValue(), "Volume space should include the UDF structures")
+
+	volume, err := udf.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "UDF structures should be readable")
+
+	for name, file := range source {
+		entry := findUDFEntry(t, volume, name)
+		require.NotNil(t, entry, "UDF file set should record '%s' with its original name", name)
+
+		data, err := volume.ReadFile(entry.Entry)
+		require.NoError(t, err, "Should be able to read '%s' with UDF", name)
+		assert.Equal(t, file.Data, data, "'%s' should have the correct contents with UDF", name)
+
+		record := findRecord(t, img, strings.ToUpper(name))
+		require.NotNil(t, record, "ISO 9660 hierarchy should record '%s'", name)
+		if len(file.Data) > 0 {
+			var descriptor udf.ShortAD
+			require.NoError(t, udf.Unpack(entry.Entry.AllocationDescriptors, &descriptor), "Should be able to read allocation descriptor of '%s'", name)
+			assert.Equal(t, record.ExtentLocation.RealValue(), volume.PartitionStart+descriptor.Position, "UDF and ISO 9660 should share the data of '%s'", name)
+		}
+	}
+
+}
+
+func TestWithUDF_Options(t *testing.T) {
+	source := fstest.MapFS{"README.TXT": {Data: []byte("readme")}}
+
+	image, err := iso9660.NewImage(source, iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteVolumeSet(1000*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrUDFOptions, "WriteVolumeSet should not allow a UDF bridge")
+
+	var first bytes.Buffer
+	_, err = image.WriteTo(&first)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	image, err = iso9660.NewImage(source, iso9660.WithUDF(), iso9660.WithPreviousSession(iso9660.PreviousSession{Image: bytes.NewReader(first.Bytes())}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, iso9660.ErrUDFOptions, "WriteTo should not allow a UDF bridge with a previous session")
+}
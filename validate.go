@@ -0,0 +1,447 @@
+package iso9660
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrUnreadable indicates that part of an image could not be read or decoded, so could not be validated
+	ErrUnreadable = errors.New("unreadable structure")
+	// ErrBothByteMismatch indicates that the little endian and big endian halves of a both-byte field disagree
+	ErrBothByteMismatch = errors.New("both-byte field halves disagree")
+	// ErrRecordOrder indicates that the records in a directory are not in the order required by the spec
+	ErrRecordOrder = errors.New("directory records out of order")
+	// ErrRecordCrossesSector indicates that a directory record does not end in the logical sector in which it begins
+	ErrRecordCrossesSector = errors.New("directory record crosses sector boundary")
+	// ErrPathTableMismatch indicates that a path table disagrees with the other path table, or with the directory
+	// hierarchy
+	ErrPathTableMismatch = errors.New("path table mismatch")
+	// ErrOverlappingExtents indicates that two different extents share logical blocks
+	ErrOverlappingExtents = errors.New("overlapping extents")
+	// ErrExtentOutOfRange indicates that an extent lies partly or wholly beyond the end of the volume
+	ErrExtentOutOfRange = errors.New("extent beyond end of volume")
+	// ErrInvalidSelfRecord indicates that the '.' or '..' record of a directory doesn't point to the directory or its
+	// parent respectively
+	ErrInvalidSelfRecord = errors.New("invalid self or parent record")
+	// ErrDuplicateIdentifier indicates that two records in a directory have the same identifier, without being sections
+	// of the same file or an associated file and its file
+	ErrDuplicateIdentifier = errors.New("duplicate identifier")
+)
+
+// Problem is a violation of ECMA-119 found by [Validate]. Problems wrap one of the Err* values of this package (e.g.
+// [ErrRecordOrder]), so can be inspected with [errors.Is].
+type Problem struct {
+	// Path is the path in the image of the file or directory with the problem, or empty if the problem isn't specific
+	// to a file or directory
+	Path string
+
+	// Offset is the byte offset in the image of the structure with the problem
+	Offset int64
+
+	Err error
+}
+
+func (p Problem) Error() string {
+	if p.Path == "" {
+		return fmt.Sprintf("offset %d: %v", p.Offset, p.Err)
+	}
+
+	return fmt.Sprintf("%s (offset %d): %v", p.Path, p.Offset, p.Err)
+}
+
+func (p Problem) Unwrap() error {
+	return p.Err
+}
+
+// extent is a range of logical blocks used by a structure in the image
+type extent struct {
+	start  uint32
+	blocks uint32
+	what   string
+	offset int64
+}
+
+type validator struct {
+	image    *reader.Image
+	problems []Problem
+	extents  []extent
+
+	// pathTable is the path table we expect from the directory hierarchy
+	pathTable []*spec.PathTableRecord
+}
+
+// Validate checks an image for violations of ECMA-119, returning every problem found. A nil result means the image is
+// valid, as far as the checks go.
+//
+// The checks are:
+//   - Both-byte fields in volume descriptors and directory records have halves that agree
+//   - Records in each directory are in the order given by [spec.CompareDirectoryEntries]
+//   - No two records in a directory have the same identifier, except for the sections of a file and an associated file
+//     and its file
+//   - No directory record crosses a logical sector boundary
+//   - The '.' and '..' records of each directory point to the directory and its parent
+//   - The L and M path tables agree with each other and with the directory hierarchy
+//   - No two extents overlap, except where directory records share an extent (e.g. hard links)
+//   - No extent lies beyond the volume space size
+//
+// Extents recorded on other volumes of a volume set are not checked.
+func Validate(img io.ReaderAt) []Problem {
+	image, err := reader.Open(img)
+	if err != nil {
+		return []Problem{{Offset: 16 * spec.LogicalSectorSize, Err: fmt.Errorf("%w: %w", ErrUnreadable, err)}}
+	}
+
+	v := &validator{image: image}
+	v.descriptors()
+
+	root, err := image.Root()
+	if err != nil {
+		v.report("", 0, ErrUnreadable, "%v", err)
+		return v.problems
+	}
+
+	v.hierarchy(root)
+	v.pathTables()
+	v.overlaps()
+
+	return v.problems
+}
+
+func (v *validator) report(p string, offset int64, kind error, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Path: p, Offset: offset, Err: fmt.Errorf("%w: "+format, append([]any{kind}, args...)...)})
+}
+
+func (v *validator) addExtent(start uint32, length uint32, what string, offset int64) {
+	if length == 0 {
+		return
+	}
+
+	v.extents = append(v.extents, extent{
+		start:  start,
+		blocks: (length + spec.LogicalSectorSize - 1) / spec.LogicalSectorSize,
+		what:   what,
+		offset: offset,
+	})
+}
+
+func (v *validator) descriptors() {
+	// Blocks 0-15 are the system area
+	v.addExtent(0, 16*spec.LogicalSectorSize, "system area", 0)
+
+	for _, descriptor := range v.image.Descriptors {
+		offset := int64(descriptor.Block) * spec.LogicalSectorSize
+		v.addExtent(descriptor.Block, spec.LogicalSectorSize, "volume descriptor", offset)
+
+		if descriptor.Header.Kind != spec.VolumeDescriptorTypePrimary && descriptor.Header.Kind != spec.VolumeDescriptorTypeSupplementary {
+			continue
+		}
+
+		pvd, err := descriptor.Volume()
+		if err != nil {
+			v.report("", offset, ErrUnreadable, "%v", err)
+			continue
+		}
+
+		fields := map[string]bool{
+			"volume space size":      pvd.VolumeSpaceSize.IsConsistent(),
+			"volume set size":        pvd.VolumeSetSize.IsConsistent(),
+			"volume sequence number": pvd.VolumeSequenceNumber.IsConsistent(),
+			"logical block size":     pvd.LogicalBlockSize.IsConsistent(),
+			"path table size":        pvd.PathTableSize.IsConsistent(),
+		}
+
+		for _, field := range slices.Sorted(maps.Keys(fields)) {
+			if !fields[field] {
+				v.report("", offset, ErrBothByteMismatch, "%s in volume descriptor at block %d", field, descriptor.Block)
+			}
+		}
+	}
+
+	pvd := v.image.Primary
+	tableSize := pvd.PathTableSize.RealValue()
+	tables := map[string]uint32{
+		"type L path table":          pvd.LocationTypeLPathTable,
+		"optional type L path table": pvd.LocationTypeLOptionalPathTable,
+		"type M path table":          pvd.LocationTypeMPathTable,
+		"optional type M path table": pvd.LocationTypeMOptionalPathTable,
+	}
+
+	for _, what := range slices.Sorted(maps.Keys(tables)) {
+		if location := tables[what]; location != 0 {
+			v.addExtent(location, tableSize, what, int64(location)*spec.LogicalSectorSize)
+		}
+	}
+}
+
+// hierarchy walks the directory hierarchy breadth-first, which is the order in which directories appear in the path
+// table, checking each directory and building the expected path table along the way
+func (v *validator) hierarchy(root *reader.Record) {
+	type queued struct {
+		record *reader.Record
+		path   string
+		number uint16
+		parent uint32
+	}
+
+	visited := make(map[uint32]bool)
+	queue := []queued{{record: root, path: "/", number: 1, parent: root.ExtentLocation.RealValue()}}
+
+	v.pathTable = append(v.pathTable, &spec.PathTableRecord{
+		LengthOfDirectoryIdentifier:   1,
+		ExtendedAttributeRecordLength: root.ExtendedAttributeRecordLength,
+		LocationOfExtent:              root.ExtentLocation.RealValue(),
+		ParentDirectoryNumber:         1,
+		DirectoryIdentifier:           spec.FileIdentifierSelf,
+	})
+
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		location := dir.record.ExtentLocation.RealValue()
+		if visited[location] {
+			v.report(dir.path, dir.record.Offset, ErrPathTableMismatch, "directory at block %d is recorded more than once", location)
+			continue
+		}
+		visited[location] = true
+
+		v.record(dir.record, dir.path)
+		if !dir.record.ExtentLocation.IsConsistent() || !dir.record.DataLength.IsConsistent() {
+			// We can't trust where the directory is, so there's no point reading it
+			continue
+		}
+
+		records, err := v.image.ReadDir(dir.record)
+		if err != nil {
+			v.report(dir.path, dir.record.Offset, ErrUnreadable, "%v", err)
+			continue
+		}
+
+		v.directory(records, dir.path, location, dir.parent)
+
+		for _, record := range records {
+			if record.IsSelf() || record.IsParent() || !record.IsDir() {
+				continue
+			}
+
+			v.pathTable = append(v.pathTable, &spec.PathTableRecord{
+				LengthOfDirectoryIdentifier:   record.LengthOfFileIdentifier,
+				ExtendedAttributeRecordLength: record.ExtendedAttributeRecordLength,
+				LocationOfExtent:              record.ExtentLocation.RealValue(),
+				ParentDirectoryNumber:         dir.number,
+				DirectoryIdentifier:           record.FileIdentifier,
+			})
+
+			queue = append(queue, queued{
+				record: record,
+				path:   path.Join(dir.path, record.Name()),
+				number: uint16(len(v.pathTable)),
+				parent: location,
+			})
+		}
+	}
+}
+
+// directory checks the records of a single directory. Subdirectories are checked by the caller.
+func (v *validator) directory(records []*reader.Record, dirPath string, location uint32, parent uint32) {
+	if len(records) < 2 || !records[0].IsSelf() || !records[1].IsParent() {
+		v.report(dirPath, int64(location)*spec.LogicalSectorSize, ErrInvalidSelfRecord, "directory does not start with '.' and '..' records")
+	} else {
+		if records[0].ExtentLocation.RealValue() != location {
+			v.report(dirPath, records[0].Offset, ErrInvalidSelfRecord, "'.' record points to block %d rather than %d", records[0].ExtentLocation.RealValue(), location)
+		}
+
+		if records[1].ExtentLocation.RealValue() != parent {
+			v.report(dirPath, records[1].Offset, ErrInvalidSelfRecord, "'..' record points to block %d rather than %d", records[1].ExtentLocation.RealValue(), parent)
+		}
+	}
+
+	var previous *reader.Record
+	identifiers := make(map[string]*reader.Record, len(records))
+	for _, record := range records {
+		recordPath := path.Join(dirPath, string(record.FileIdentifier))
+
+		if record.Offset%spec.LogicalSectorSize+int64(record.Length) > spec.LogicalSectorSize {
+			v.report(recordPath, record.Offset, ErrRecordCrossesSector, "%d-byte record starts at offset %d in sector", record.Length, record.Offset%spec.LogicalSectorSize)
+		}
+
+		if record.IsSelf() || record.IsParent() {
+			continue
+		}
+
+		if !record.IsDir() {
+			v.record(record, recordPath)
+		}
+
+		if previous != nil && spec.CompareDirectoryEntries(&recordEntryAdapter{previous}, &recordEntryAdapter{record}) > 0 {
+			v.report(recordPath, record.Offset, ErrRecordOrder, "'%s' should come before '%s'", record.FileIdentifier, previous.FileIdentifier)
+		}
+
+		// A file's identifier may only be repeated by the next section of the file, or by the file after its associated
+		// file
+		if other, ok := identifiers[string(record.FileIdentifier)]; ok {
+			nextSection := other.FileFlags&spec.FileFlagMultiExtent != 0
+			associated := other.FileFlags&spec.FileFlagAssociatedFile != 0 && record.FileFlags&spec.FileFlagAssociatedFile == 0
+			if !nextSection && !associated {
+				v.report(recordPath, record.Offset, ErrDuplicateIdentifier, "'%s' is recorded more than once", record.FileIdentifier)
+			}
+		}
+
+		identifiers[string(record.FileIdentifier)] = record
+		previous = record
+	}
+}
+
+// record checks the fields of a single directory record, and records its extent
+func (v *validator) record(record *reader.Record, recordPath string) {
+	fields := []struct {
+		name       string
+		consistent bool
+	}{
+		{"extent location", record.ExtentLocation.IsConsistent()},
+		{"data length", record.DataLength.IsConsistent()},
+		{"volume sequence number", record.VolumeSequenceNumber.IsConsistent()},
+	}
+
+	for _, field := range fields {
+		if !field.consistent {
+			v.report(recordPath, record.Offset, ErrBothByteMismatch, "%s", field.name)
+		}
+	}
+
+	if record.VolumeSequenceNumber.RealValue() != v.image.Primary.VolumeSequenceNumber.RealValue() {
+		// The extent is on another volume of the volume set, so it can't overlap anything in this one
+		return
+	}
+
+	length := record.DataLength.RealValue() + uint32(record.ExtendedAttributeRecordLength)*spec.LogicalSectorSize
+	v.addExtent(record.ExtentLocation.RealValue(), length, recordPath, record.Offset)
+}
+
+func (v *validator) pathTables() {
+	tables := make([][]*spec.PathTableRecord, 2)
+	for i, bigEndian := range []bool{false, true} {
+		table, err := v.image.ReadPathTable(bigEndian)
+		if err != nil {
+			v.report("", 0, ErrUnreadable, "%v", err)
+			return
+		}
+
+		tables[i] = table
+	}
+
+	location := int64(v.image.Primary.LocationTypeLPathTable) * spec.LogicalSectorSize
+	if !slices.EqualFunc(tables[0], tables[1], pathTableRecordsEqual) {
+		v.report("", location, ErrPathTableMismatch, "type L and type M path tables differ")
+	}
+
+	if len(tables[0]) != len(v.pathTable) {
+		v.report("", location, ErrPathTableMismatch, "path table has %d records, but the hierarchy has %d directories", len(tables[0]), len(v.pathTable))
+		return
+	}
+
+	for i, expected := range v.pathTable {
+		if !pathTableRecordsEqual(tables[0][i], expected) {
+			v.report(
+				"",
+				location,
+				ErrPathTableMismatch,
+				"path table record %d is '%s' at block %d with parent %d, but the hierarchy has '%s' at block %d with parent %d",
+				i+1,
+				tables[0][i].DirectoryIdentifier,
+				tables[0][i].LocationOfExtent,
+				tables[0][i].ParentDirectoryNumber,
+				expected.DirectoryIdentifier,
+				expected.LocationOfExtent,
+				expected.ParentDirectoryNumber,
+			)
+		}
+	}
+}
+
+func (v *validator) overlaps() {
+	volumeSize := v.image.Primary.VolumeSpaceSize.RealValue()
+
+	slices.SortStableFunc(v.extents, func(a, b extent) int {
+		return cmp.Compare(a.start, b.start)
+	})
+
+	for i, e := range v.extents {
+		if uint64(e.start)+uint64(e.blocks) > uint64(volumeSize) {
+			v.report(e.what, e.offset, ErrExtentOutOfRange, "extent at block %d spans %d blocks, but volume has %d blocks", e.start, e.blocks, volumeSize)
+		}
+
+		// Directory records may legitimately share an extent, but extents may not partially overlap
+		for _, other := range v.extents[i+1:] {
+			if other.start >= e.start+e.blocks {
+				break
+			}
+
+			if other.start != e.start || other.blocks != e.blocks || !strings.HasPrefix(other.what, "/") || !strings.HasPrefix(e.what, "/") {
+				v.report(other.what, other.offset, ErrOverlappingExtents, "extent at block %d overlaps %s at block %d", other.start, e.what, e.start)
+			}
+		}
+	}
+}
+
+func pathTableRecordsEqual(a, b *spec.PathTableRecord) bool {
+	return a.LocationOfExtent == b.LocationOfExtent &&
+		a.ParentDirectoryNumber == b.ParentDirectoryNumber &&
+		a.ExtendedAttributeRecordLength == b.ExtendedAttributeRecordLength &&
+		string(a.DirectoryIdentifier) == string(b.DirectoryIdentifier)
+}
+
+// recordEntryAdapter allows records read from an image to be compared with [spec.CompareDirectoryEntries]
+type recordEntryAdapter struct {
+	record *reader.Record
+}
+
+var _ spec.DirectoryEntry = &recordEntryAdapter{}
+
+func (r *recordEntryAdapter) nameAndExtension() (string, string) {
+	identifier := string(r.record.FileIdentifier)
+	if r.IsDir() {
+		return identifier, ""
+	}
+
+	identifier, _, _ = strings.Cut(identifier, ";")
+	name, extension, _ := strings.Cut(identifier, ".")
+	return name, extension
+}
+
+func (r *recordEntryAdapter) Name() string {
+	name, _ := r.nameAndExtension()
+	return name
+}
+
+func (r *recordEntryAdapter) Extension() string {
+	_, extension := r.nameAndExtension()
+	return extension
+}
+
+func (r *recordEntryAdapter) Version() string {
+	_, version, _ := strings.Cut(string(r.record.FileIdentifier), ";")
+	return version
+}
+
+func (r *recordEntryAdapter) IsDir() bool {
+	return r.record.IsDir()
+}
+
+func (r *recordEntryAdapter) IsAssociated() bool {
+	return r.record.FileFlags&spec.FileFlagAssociatedFile != 0
+}
+
+func (r *recordEntryAdapter) FileSectionIndex() int {
+	// Sections of the same file have identical identifiers, so compare as equal regardless of this
+	return 0
+}
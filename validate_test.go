@@ -0,0 +1,183 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+func writeImage(t *testing.T, contents fs.ReadDirFS, opts ...iso9660.ImageOption) []byte {
+	image, err := iso9660.NewImage(contents, opts...)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	return buff.Bytes()
+}
+
+func assertProblem(t *testing.T, problems []iso9660.Problem, kind error) {
+	for _, problem := range problems {
+		if errors.Is(problem, kind) {
+			return
+		}
+	}
+
+	assert.Failf(t, "Validate should report problem", "expected %v, got %v", kind, problems)
+}
+
+func TestValidate(t *testing.T) {
+	largeDir := fstest.MapFS{}
+	for i := 0; i < 200; i++ {
+		largeDir[fmt.Sprintf("DIR/FILE%04d.TXT", i)] = &fstest.MapFile{Data: []byte("data")}
+	}
+
+	sources := map[string]fs.ReadDirFS{
+		"testdata":  os.DirFS("testdata/imageroot").(fs.ReadDirFS),
+		"large dir": largeDir,
+		"mixed case": fstest.MapFS{
+			"a.txt":     &fstest.MapFile{Data: []byte("a")},
+			"EFI/x.txt": &fstest.MapFile{Data: []byte("x")},
+			"b.TXT":     &fstest.MapFile{Data: []byte("b")},
+		},
+		"empty": fstest.MapFS{},
+	}
+
+	for name, source := range sources {
+		t.Run(name, func(t *testing.T) {
+			problems := iso9660.Validate(bytes.NewReader(writeImage(t, source)))
+			assert.Empty(t, problems, "Images we write should not have any problems")
+		})
+	}
+}
+
+func TestValidate_Problems(t *testing.T) {
+	source := fstest.MapFS{
+		"AAA.TXT":    {Data: []byte("aaa")},
+		"BBB.TXT":    {Data: []byte("bbb")},
+		"DIR/CCC.TX": {Data: []byte("ccc")},
+	}
+
+	// findRecord returns the offset of the record with the given identifier in the root directory
+	findRecord := func(t *testing.T, data []byte, identifier string) int64 {
+		img, err := reader.Open(bytes.NewReader(data))
+		require.NoError(t, err, "Should be able to open image")
+		root, err := img.Root()
+		require.NoError(t, err, "Should be able to read root record")
+		records, err := img.ReadDir(root)
+		require.NoError(t, err, "Should be able to read root directory")
+
+		for _, record := range records {
+			if string(record.FileIdentifier) == identifier {
+				return record.Offset
+			}
+		}
+
+		require.Failf(t, "Record not found", "no record '%s' in root directory", identifier)
+		return 0
+	}
+
+	cases := map[string]struct {
+		corrupt func(t *testing.T, data []byte)
+		kind    error
+	}{
+		"both-byte mismatch": {
+			corrupt: func(t *testing.T, data []byte) {
+				// Little endian half of the data length
+				data[findRecord(t, data, "AAA.TXT;1")+10] ^= 0xFF
+			},
+			kind: iso9660.ErrBothByteMismatch,
+		},
+		"record order": {
+			corrupt: func(t *testing.T, data []byte) {
+				offset := findRecord(t, data, "AAA.TXT;1")
+				copy(data[offset+33:], "ZZZ")
+			},
+			kind: iso9660.ErrRecordOrder,
+		},
+		"duplicate identifier": {
+			corrupt: func(t *testing.T, data []byte) {
+				offset := findRecord(t, data, "BBB.TXT;1")
+				copy(data[offset+33:], "AAA")
+			},
+			kind: iso9660.ErrDuplicateIdentifier,
+		},
+		"out of range": {
+			corrupt: func(t *testing.T, data []byte) {
+				offset := findRecord(t, data, "BBB.TXT;1")
+				binary.LittleEndian.PutUint32(data[offset+2:], 10000)
+				binary.BigEndian.PutUint32(data[offset+6:], 10000)
+			},
+			kind: iso9660.ErrExtentOutOfRange,
+		},
+		"overlapping extents": {
+			corrupt: func(t *testing.T, data []byte) {
+				// Point the file at the path tables
+				offset := findRecord(t, data, "BBB.TXT;1")
+				binary.LittleEndian.PutUint32(data[offset+2:], 18)
+				binary.BigEndian.PutUint32(data[offset+6:], 18)
+			},
+			kind: iso9660.ErrOverlappingExtents,
+		},
+		"path table mismatch": {
+			corrupt: func(t *testing.T, data []byte) {
+				img, err := reader.Open(bytes.NewReader(data))
+				require.NoError(t, err, "Should be able to open image")
+				// Rename the second directory in the type M path table
+				copy(data[int64(img.Primary.LocationTypeMPathTable)*2048+10+8:], "XYZ")
+			},
+			kind: iso9660.ErrPathTableMismatch,
+		},
+		"not an image": {
+			corrupt: func(t *testing.T, data []byte) {
+				clear(data)
+			},
+			kind: iso9660.ErrUnreadable,
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			data := writeImage(t, source)
+			require.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image should be valid before it is corrupted")
+
+			c.corrupt(t, data)
+			assertProblem(t, iso9660.Validate(bytes.NewReader(data)), c.kind)
+		})
+	}
+}
+
+func TestValidate_RecordCrossesSector(t *testing.T) {
+	source := fstest.MapFS{}
+	for i := 0; i < 100; i++ {
+		source[fmt.Sprintf("FILE%04d.TXT", i)] = &fstest.MapFile{Data: []byte("data")}
+	}
+
+	data := writeImage(t, source)
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Should be able to open image")
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root record")
+
+	// Remove the padding at the end of the first sector of the root directory, so that the first record of the second
+	// sector starts in the first sector instead
+	start := int(root.DataOffset())
+	end := start
+	for data[end] != 0 {
+		end += int(data[end])
+	}
+
+	copy(data[end:start+2*2048], data[start+2048:start+3*2048-(start+2048-end)])
+	assertProblem(t, iso9660.Validate(bytes.NewReader(data)), iso9660.ErrRecordCrossesSector)
+}
@@ -0,0 +1,70 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+)
+
+// maxFileVersion is the highest version number that a file may be recorded with
+const maxFileVersion = 32767
+
+// ErrFileVersion indicates that a file can't be recorded with the given version, because the version number is out of
+// range, the file is a directory, or another file is recorded under the same name with the same version
+var ErrFileVersion = errors.New("invalid file version")
+
+// FileVersion is the name and version number under which a file is recorded in the primary hierarchy
+type FileVersion struct {
+	// Name is the name under which the file is recorded, which may be the name of another file in the same directory
+	// (e.g. to record CONFIG.OLD as an older version of CONFIG.TXT). If it is empty, the file's own name is used.
+	Name string
+
+	// Version is the version number of the file, from 1 to 32767. Versions of the same name are recorded highest first,
+	// and most readers only show the highest version.
+	Version int
+}
+
+// FileVersions determines the version numbers of files in the primary hierarchy
+type FileVersions struct {
+	// Files contains the name and version of files, by their paths in the image's contents. Other files are recorded
+	// under their own names with version 1.
+	Files map[string]FileVersion
+
+	// OmitVersionOne records files with version 1 without a version number (e.g. "KERNEL." rather than "KERNEL.;1"),
+	// for readers that don't strip version numbers from names. Other versions are still recorded. ECMA-119 requires a
+	// version number, so this makes the image non-compliant.
+	OmitVersionOne bool
+}
+
+// WithFileVersions records files in the primary hierarchy with version numbers other than 1, or without version
+// numbers (see [FileVersions]). Several files in the same directory may be recorded as versions of the same name.
+//
+// The enhanced hierarchy and UDF bridge, if the image has them, have no version numbers, so files are recorded in them
+// under their own names. [Extract] only extracts the highest version of each name.
+func WithFileVersions(versions FileVersions) ImageOption {
+	return func(i *Image) error {
+		if i.flags.versions == nil {
+			i.flags.versions = make(map[string]FileVersion, len(versions.Files))
+		}
+
+		for filePath, version := range versions.Files {
+			if !fs.ValidPath(filePath) || filePath == "." {
+				return fmt.Errorf("%w: '%s' is not a valid path", ErrFileVersion, filePath)
+			}
+
+			if version.Name != "" && (!fs.ValidPath(version.Name) || version.Name == "." || path.Base(version.Name) != version.Name) {
+				return fmt.Errorf("%w: '%s' cannot be recorded under the name '%s'", ErrFileVersion, filePath, version.Name)
+			}
+
+			if version.Version < 1 || version.Version > maxFileVersion {
+				return fmt.Errorf("%w: version of '%s' is %d, but must be from 1 to %d", ErrFileVersion, filePath, version.Version, maxFileVersion)
+			}
+
+			i.flags.versions[filePath] = version
+		}
+
+		i.omitVersionOne = i.omitVersionOne || versions.OmitVersionOne
+		return nil
+	}
+}
@@ -0,0 +1,120 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+// identifiers returns the file identifiers of the records in the root directory of an image, after '.' and '..'
+func identifiers(t *testing.T, img *reader.Image) []string {
+	root, err := img.Root()
+	require.NoError(t, err, "Should be able to read root directory")
+
+	records, err := img.ReadDir(root)
+	require.NoError(t, err, "Should be able to read root directory")
+
+	var identifiers []string
+	for _, record := range records[2:] {
+		identifiers = append(identifiers, string(record.FileIdentifier))
+	}
+
+	return identifiers
+}
+
+func TestWithFileVersions(t *testing.T) {
+	source := fstest.MapFS{
+		"CONFIG.TXT": {Data: []byte("new")},
+		"CONFIG.OLD": {Data: []byte("old")},
+		"CONFIG.V10": {Data: []byte("newest")},
+		"KERNEL":     {Data: []byte("kernel")},
+		"DOCS/A.TXT": {Data: []byte("a")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithFileVersions(iso9660.FileVersions{Files: map[string]iso9660.FileVersion{
+		"CONFIG.TXT": {Version: 2},
+		"CONFIG.OLD": {Name: "CONFIG.TXT", Version: 1},
+		"CONFIG.V10": {Name: "CONFIG.TXT", Version: 10},
+	}}), iso9660.WithEnhancedVolumeDescriptor())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with several versions of a file should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	assert.Equal(t, []string{"CONFIG.TXT;10", "CONFIG.TXT;2", "CONFIG.TXT;1", "DOCS", "KERNEL.;1"}, identifiers(t, img), "Versions should be recorded in descending order, and files without extensions should have a version")
+	assert.Equal(t, "A.TXT;1", string(findRecord(t, img, "DOCS/A.TXT").FileIdentifier), "Other files should be recorded with version 1")
+
+	// Extracting takes the highest version of each name
+	dir := t.TempDir()
+	require.NoError(t, iso9660.Extract(bytes.NewReader(buff.Bytes()), dir, nil), "Extract should not return an error")
+
+	extracted, err := os.ReadFile(filepath.Join(dir, "CONFIG.TXT"))
+	require.NoError(t, err, "File should be extracted")
+	assert.Equal(t, "newest", string(extracted), "Highest version of a file should be extracted")
+
+	// The enhanced hierarchy has no versions, so files keep their own names
+	for _, name := range []string{"CONFIG.TXT", "CONFIG.OLD", "CONFIG.V10"} {
+		assert.NotNil(t, findEnhancedRecord(t, img, name), "'%s' should be recorded under its own name in the enhanced hierarchy", name)
+	}
+}
+
+func TestWithFileVersions_OmitVersionOne(t *testing.T) {
+	source := fstest.MapFS{
+		"README.TXT": {Data: []byte("readme")},
+		"KERNEL":     {Data: []byte("kernel")},
+		"KERNEL.OLD": {Data: []byte("old kernel")},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithFileVersions(iso9660.FileVersions{
+		Files:          map[string]iso9660.FileVersion{"KERNEL": {Version: 2}, "KERNEL.OLD": {Name: "KERNEL", Version: 1}},
+		OmitVersionOne: true,
+	}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	assert.Equal(t, []string{"KERNEL.;2", "KERNEL.", "README.TXT"}, identifiers(t, img), "Only versions other than 1 should be recorded")
+	assert.Equal(t, "readme", readRecord(t, img, "README.TXT"), "Files without versions should be readable by name")
+}
+
+func TestWithFileVersions_Invalid(t *testing.T) {
+	source := fstest.MapFS{
+		"A.TXT":     {Data: []byte("a")},
+		"B.TXT":     {Data: []byte("b")},
+		"DIR/C.TXT": {Data: []byte("c")},
+	}
+
+	for name, versions := range map[string]map[string]iso9660.FileVersion{
+		"version 0":          {"A.TXT": {Version: 0}},
+		"too high a version": {"A.TXT": {Version: 32768}},
+		"directory":          {"DIR": {Version: 2}},
+		"name in directory":  {"A.TXT": {Name: "DIR/A.TXT", Version: 2}},
+		"same version":       {"B.TXT": {Name: "A.TXT", Version: 1}},
+		"same versions":      {"A.TXT": {Version: 3}, "B.TXT": {Name: "A.TXT", Version: 3}},
+		"same recorded name": {"B.TXT": {Name: "a.txt", Version: 1}},
+	} {
+		image, err := iso9660.NewImage(source, iso9660.WithFileVersions(iso9660.FileVersions{Files: versions}))
+		if err == nil {
+			_, err = image.WriteTo(io.Discard)
+		}
+
+		assert.ErrorIs(t, err, iso9660.ErrFileVersion, "Recording a file with %s should fail", name)
+	}
+}
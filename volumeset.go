@@ -0,0 +1,279 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"io"
+	"io/fs"
+	"math"
+	"path"
+	"time"
+)
+
+var (
+	// ErrVolumeTooSmall indicates that the capacity of the volumes in a volume set is too small to hold the directory
+	// hierarchy along with the largest file
+	ErrVolumeTooSmall = errors.New("volume capacity is too small")
+	// ErrVolumeSetOptions indicates that options which can't apply to a volume set were used with
+	// [Image.WriteVolumeSet]
+	ErrVolumeSetOptions = errors.New("system area options and previous sessions cannot be used with volume sets")
+)
+
+// volumePlan records which volume of a volume set each file is recorded on
+type volumePlan struct {
+	// volumes is the sequence number of the volume holding each file, by its path in the source
+	volumes map[string]uint16
+	count   uint16
+}
+
+// volumeFileInfo describes a file whose data is recorded on an earlier volume of a volume set
+type volumeFileInfo struct {
+	fs.FileInfo
+
+	location uint32
+	volume   uint16
+}
+
+var _ placedFileInfo = &volumeFileInfo{}
+
+func (v *volumeFileInfo) extentLocation() uint32 {
+	return v.location
+}
+
+func (v *volumeFileInfo) extentVolume() uint16 {
+	return v.volume
+}
+
+// WriteVolumeSet splits the contents of the image across a volume set of as many volumes as are needed, none of which
+// is larger than capacity bytes, and writes each volume to a writer obtained from next. Volumes are numbered from 1,
+// and each writer is closed once its volume has been written if it implements [io.Closer]. The number of volumes in
+// the set is returned.
+//
+// Files are assigned to volumes in the order in which they would be recorded in a single image, so each volume holds
+// a contiguous part of the directory hierarchy. Every volume records the whole directory hierarchy, with entries for
+// the files on that volume and all volumes before it, as ECMA-119 requires; directory records give the sequence number
+// of the volume holding each file. The last volume therefore describes every file in the set.
+//
+// Files larger than a volume can't be split across volumes, and result in [ErrVolumeTooSmall].
+func (i *Image) WriteVolumeSet(capacity int64, next func(sequenceNumber int) (io.Writer, error)) (int, error) {
+	if i.systemAreaData != nil || i.hybrid != nil || i.gpt != nil || i.previous != nil {
+		return 0, ErrVolumeSetOptions
+	}
+
+	if i.udf {
+		return 0, ErrUDFOptions
+	}
+
+	if i.zisofs != nil {
+		return 0, ErrZisofsOptions
+	}
+
+	if i.implantMD5 {
+		return 0, ErrImplantMD5Options
+	}
+
+	if i.manifest != nil {
+		return 0, ErrManifestOptions
+	}
+
+	plan, err := i.planVolumeSet(uint32(min(capacity/spec.LogicalSectorSize, math.MaxUint32)))
+	if err != nil {
+		return 0, err
+	}
+
+	// locations records where each file was placed, once the volume holding it has been written
+	locations := make(map[string]uint32)
+
+	for sequenceNumber := uint16(1); sequenceNumber <= plan.count; sequenceNumber++ {
+		source, err := plan.volumeFS(i.source, sequenceNumber, locations)
+		if err != nil {
+			return 0, fmt.Errorf("could not read contents of volume %d: %w", sequenceNumber, err)
+		}
+
+		w, err := next(int(sequenceNumber))
+		if err != nil {
+			return 0, fmt.Errorf("could not create writer for volume %d: %w", sequenceNumber, err)
+		}
+
+		_, files, err := i.writeVolume(w, source, 0, volume{setSize: plan.count, sequenceNumber: sequenceNumber})
+		if err != nil {
+			return 0, fmt.Errorf("could not write volume %d: %w", sequenceNumber, err)
+		}
+
+		if closer, ok := w.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				return 0, fmt.Errorf("could not close writer for volume %d: %w", sequenceNumber, err)
+			}
+		}
+
+		for filePath, file := range files {
+			if plan.volumes[filePath] == sequenceNumber {
+				locations[filePath] = file.Location()
+			}
+		}
+	}
+
+	return int(plan.count), nil
+}
+
+// planVolumeSet assigns files to volumes with the given capacity in blocks
+func (i *Image) planVolumeSet(capacity uint32) (*volumePlan, error) {
+	recordedAt := time.Now()
+	dir, files, err := newDirectoryFromFS(i.source, ".", recordedAt, 1, i.primaryNaming(), i.flags, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	paths := make(map[*builder.File]string, len(files))
+	for filePath, file := range files {
+		paths[file] = filePath
+	}
+
+	// Every volume records the whole path table and directory hierarchy. The directories on each volume have records
+	// for a subset of the files in the set, so they can't be larger than the directories of the whole set.
+	pathTableBlocks := blocks(builder.NewPathTable(dir).Size())
+	overhead := 18 + 2*pathTableBlocks + i.padding // 18 because 16 is PVD and 17 is TVD
+
+	// Files are assigned to volumes in the order in which they are placed, so that files with greater sort weights are
+	// on earlier volumes
+	var extents []*builder.File
+	for _, entry := range dir.ExtentsByWeight(i.fileWeights(files)) {
+		switch entry := entry.(type) {
+		case *builder.Directory:
+			overhead += blocks(builder.ExtentSize(entry))
+		case *builder.File:
+			extents = append(extents, entry)
+		}
+	}
+
+	if i.enhanced {
+		enhancedDir, err := newEnhancedDirectoryFromFS(i.source, recordedAt, 1, files, i.flags, nil, false)
+		if err != nil {
+			return nil, fmt.Errorf("could not create enhanced directory: %w", err)
+		}
+
+		overhead += 1 + 2*blocks(builder.NewPathTable(enhancedDir).Size())
+		for entry := range enhancedDir.Extents() {
+			overhead += blocks(builder.ExtentSize(entry))
+		}
+	}
+
+	if overhead >= capacity {
+		return nil, fmt.Errorf("%w: directory hierarchy needs %d blocks, but volumes have %d blocks", ErrVolumeTooSmall, overhead, capacity)
+	}
+
+	available := capacity - overhead
+	plan := &volumePlan{volumes: make(map[string]uint16, len(files)), count: 1}
+	used := uint32(0)
+
+	alignment := i.fileAlignments(files)
+	for _, file := range extents {
+		// Aligned files may need to skip up to a whole alignment, less a block, wherever they are placed
+		size := blocks(builder.ExtentSize(file))
+		if file.PointerRecord().DataLength.RealValue() > 0 {
+			size += alignment(file) - 1
+		}
+		if size > available {
+			return nil, fmt.Errorf("%w: '%s' needs %d blocks, but only %d blocks per volume are available for files", ErrVolumeTooSmall, paths[file], size, available)
+		}
+
+		if used+size > available {
+			if plan.count == math.MaxUint16 {
+				return nil, fmt.Errorf("%w: more than %d volumes would be needed", ErrVolumeTooSmall, math.MaxUint16)
+			}
+
+			plan.count++
+			used = 0
+		}
+
+		plan.volumes[paths[file]] = plan.count
+		used += size
+	}
+
+	// Links share the extent of their target, so are recorded on the same volume
+	for filePath, file := range files {
+		if owner := file.Owner(); owner != file {
+			plan.volumes[filePath] = plan.volumes[paths[owner]]
+		}
+	}
+
+	return plan, nil
+}
+
+// volumeFS returns the contents of a volume: every directory in source, and the files recorded on this volume or on
+// earlier volumes. Files on earlier volumes refer to the locations at which they were written.
+func (p *volumePlan) volumeFS(source fs.ReadDirFS, sequenceNumber uint16, locations map[string]uint32) (fs.ReadDirFS, error) {
+	rootInfo, err := fs.Stat(source, ".")
+	if err != nil {
+		return nil, fmt.Errorf("could not stat root directory: %w", err)
+	}
+
+	tree := newTreeFS(rootInfo.ModTime())
+	tree.root.info = rootInfo
+	nodes := map[string]*treeNode{".": tree.root}
+
+	err = fs.WalkDir(source, ".", func(entryPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entryPath == "." {
+			return nil
+		}
+
+		parent := nodes[path.Dir(entryPath)]
+		if parent == nil {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not get info for '%s': %w", entryPath, err)
+		}
+
+		if d.IsDir() {
+			node := newTreeDir(info)
+			parent.children[d.Name()] = node
+			nodes[entryPath] = node
+			return nil
+		}
+
+		// Files that aren't in the plan, such as symbolic links to directories, aren't recorded in any volume
+		volume, ok := p.volumes[entryPath]
+		if !ok || volume > sequenceNumber {
+			return nil
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Symbolic links are followed when building the directory hierarchy, which must see the target's info
+			if info, err = fs.Stat(source, entryPath); err != nil {
+				return fmt.Errorf("could not follow symbolic link '%s': %w", entryPath, err)
+			}
+		}
+
+		if volume < sequenceNumber {
+			info = &volumeFileInfo{FileInfo: info, location: locations[entryPath], volume: volume}
+		}
+
+		parent.children[d.Name()] = &treeNode{
+			info: info,
+			open: func() (io.ReadCloser, error) {
+				return source.Open(entryPath)
+			},
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return tree, nil
+}
+
+// blocks returns the number of logical blocks needed to hold size bytes
+func blocks(size uint32) uint32 {
+	return (size + spec.LogicalSectorSize - 1) / spec.LogicalSectorSize
+}
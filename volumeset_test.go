@@ -0,0 +1,130 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+// volumeBuffer records a volume of a volume set, and whether it has been closed
+type volumeBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (v *volumeBuffer) Close() error {
+	v.closed = true
+	return nil
+}
+
+func TestImage_WriteVolumeSet(t *testing.T) {
+	const capacity = 200 * 2048
+
+	source := fstest.MapFS{}
+	for i := 0; i < 10; i++ {
+		source[fmt.Sprintf("DATA/FILE%d.BIN", i)] = &fstest.MapFile{Data: bytes.Repeat([]byte{byte(i)}, 100*1024)}
+	}
+	source["README.TXT"] = &fstest.MapFile{Data: []byte("readme")}
+
+	image, err := iso9660.NewImage(source)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var volumes []*volumeBuffer
+	count, err := image.WriteVolumeSet(capacity, func(sequenceNumber int) (io.Writer, error) {
+		assert.Equal(t, len(volumes)+1, sequenceNumber, "Volumes should be created in order")
+		volumes = append(volumes, &volumeBuffer{})
+		return volumes[len(volumes)-1], nil
+	})
+	require.NoError(t, err, "WriteVolumeSet should not return an error for valid arguments")
+	require.Len(t, volumes, count, "WriteVolumeSet should return the number of volumes written")
+	assert.Equal(t, 4, count, "Three files should fit on each volume")
+
+	images := make([]*reader.Image, count)
+	for i, volume := range volumes {
+		assert.True(t, volume.closed, "Volume %d should be closed once written", i+1)
+		assert.LessOrEqual(t, volume.Len(), capacity, "Volume %d should not exceed the capacity", i+1)
+		assert.Empty(t, iso9660.Validate(bytes.NewReader(volume.Bytes())), "Volume %d should not violate the spec", i+1)
+
+		images[i], err = reader.Open(bytes.NewReader(volume.Bytes()))
+		require.NoError(t, err, "Volume %d should be readable", i+1)
+		assert.EqualValues(t, count, images[i].Primary.VolumeSetSize.RealValue(), "Volume %d should record the size of the set", i+1)
+		assert.EqualValues(t, i+1, images[i].Primary.VolumeSequenceNumber.RealValue(), "Volume %d should record its sequence number", i+1)
+	}
+
+	assert.Nil(t, findRecord(t, images[0], "DATA/FILE9.BIN"), "First volume should not describe files on later volumes")
+
+	// The last volume describes every file in the set, each of which can be read from the volume it's recorded on
+	last := images[count-1]
+	for name, file := range source {
+		record := findRecord(t, last, name)
+		require.NotNil(t, record, "Last volume should describe '%s'", name)
+
+		sequenceNumber := record.VolumeSequenceNumber.RealValue()
+		require.True(t, sequenceNumber >= 1 && int(sequenceNumber) <= count, "'%s' should be on a volume in the set", name)
+
+		data, err := io.ReadAll(images[sequenceNumber-1].Open(record))
+		require.NoError(t, err, "Should be able to read '%s' from volume %d", name, sequenceNumber)
+		assert.Equal(t, file.Data, data, "'%s' should have the correct contents on volume %d", name, sequenceNumber)
+	}
+}
+
+func TestImage_WriteVolumeSet_Errors(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{"BIG.BIN": {Data: make([]byte, 100*2048)}})
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+	_, err = image.WriteVolumeSet(50*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrVolumeTooSmall, "WriteVolumeSet should fail if a file doesn't fit on a volume")
+
+	_, err = image.WriteVolumeSet(10*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrVolumeTooSmall, "WriteVolumeSet should fail if the directory hierarchy doesn't fit on a volume")
+
+	image, err = iso9660.NewImage(fstest.MapFS{}, iso9660.WithGPT(iso9660.GPT{}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+	_, err = image.WriteVolumeSet(1000*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrVolumeSetOptions, "WriteVolumeSet should not allow options that write the system area")
+}
+
+func TestImage_WriteVolumeSet_Links(t *testing.T) {
+	tarFS, err := iso9660.NewTarFS(bytes.NewReader(buildTestTar(t)))
+	require.NoError(t, err, "NewTarFS should not return an error for a valid archive")
+	image, err := iso9660.NewImage(tarFS)
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	// Volumes only have room for the directory hierarchy (24 blocks) and a block of file data, so each file is on its own
+	// volume
+	var volumes [][]byte
+	var current *bytes.Buffer
+	next := func(int) (io.Writer, error) {
+		if current != nil {
+			volumes = append(volumes, current.Bytes())
+		}
+		current = &bytes.Buffer{}
+		return current, nil
+	}
+
+	_, err = image.WriteVolumeSet(25*2048, next)
+	require.NoError(t, err, "WriteVolumeSet should not return an error for valid arguments")
+	volumes = append(volumes, current.Bytes())
+	require.Greater(t, len(volumes), 1, "Files should be split across several volumes")
+
+	last, err := reader.Open(bytes.NewReader(volumes[len(volumes)-1]))
+	require.NoError(t, err, "Last volume should be readable")
+
+	kernel := findRecord(t, last, "BOOT/KERNEL")
+	target := findRecord(t, last, "BOOT/VMLINUZ")
+	require.NotNil(t, kernel, "Last volume should describe hard link")
+	require.NotNil(t, target, "Last volume should describe link target")
+	assert.Equal(t, target.VolumeSequenceNumber, kernel.VolumeSequenceNumber, "Hard link should be on the same volume as its target")
+	assert.Equal(t, target.ExtentLocation, kernel.ExtentLocation, "Hard link should share the extent of its target")
+
+	volume, err := reader.Open(bytes.NewReader(volumes[target.VolumeSequenceNumber.RealValue()-1]))
+	require.NoError(t, err, "Volume holding link target should be readable")
+	data, err := io.ReadAll(volume.Open(kernel))
+	require.NoError(t, err, "Should be able to read hard link")
+	assert.Equal(t, "unique kernel data", string(data), "Hard link should have the contents of its target")
+}
@@ -0,0 +1,170 @@
+package iso9660
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/builder"
+	"io"
+	"slices"
+	"sync"
+)
+
+// blockWrite is a write of something to a volume, starting at the given block
+type blockWrite struct {
+	number uint32
+
+	// description is what is written, for errors
+	description string
+
+	writeTo func(w io.Writer) (int64, error)
+	phase   writePhase
+}
+
+// writePhase determines when a write happens when an image is written out of order (see [Image.WriteToWriterAt])
+type writePhase int
+
+const (
+	// writePhaseFileData is the data of files, which is written first, by several goroutines at once
+	writePhaseFileData writePhase = iota
+	// writePhaseMetadata is directories, path tables, and other structures that refer to file data
+	writePhaseMetadata
+	// writePhaseDescriptors is the volume descriptors, system area and backup GPT, which are written last so that an
+	// image isn't recognised until everything they refer to has been written
+	writePhaseDescriptors
+)
+
+// concurrentWriter passes an [io.WriterAt] to [Image.writeVolume], so that blocks are written at their offsets in it
+// rather than in order. It is also an [io.Writer] that writes sequentially from the start of the io.WriterAt, although
+// writeVolume doesn't use it as one.
+type concurrentWriter struct {
+	*io.OffsetWriter
+
+	w io.WriterAt
+
+	// concurrency is the number of files whose data may be written at once
+	concurrency int
+
+	// volumeSpaceSize is the size of the volume, in blocks, once it has been laid out
+	volumeSpaceSize uint32
+}
+
+var _ volumeSpaceWriter = &concurrentWriter{}
+
+func (c *concurrentWriter) setVolumeSpaceSize(blocks uint32) {
+	c.volumeSpaceSize = blocks
+}
+
+// WriteToWriterAt writes the image to w, like [Image.WriteTo], but writes each block at its offset in w rather than
+// in order, so w is usually an [*os.File] or block device. The data of files is written first, by up to concurrency
+// goroutines at once (one if concurrency is less than 1); then directories, path tables and other structures; and
+// finally the volume descriptors, so that an image that is only partly written isn't mistaken for a complete one.
+// Blocks that are skipped, such as the unused part of the system area, are filled with zeros.
+//
+// Since files are read concurrently, the image's contents must allow files to be opened and read by several goroutines
+// at once. An implanted MD5 checksum (see [WithImplantedMD5]) is computed by reading the image back once it has been
+// written, which requires w to implement [io.ReaderAt] too.
+func (i *Image) WriteToWriterAt(w io.WriterAt, concurrency int) (int64, error) {
+	source, start, err := i.sessionSource()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, readable := w.(io.ReaderAt); i.implantMD5 && !readable {
+		return 0, ErrImplantMD5Writer
+	}
+
+	cw := &concurrentWriter{OffsetWriter: io.NewOffsetWriter(w, 0), w: w, concurrency: max(concurrency, 1)}
+	written, _, err := i.writeVolume(cw, source, start, volume{setSize: 1, sequenceNumber: 1})
+	if err != nil || !i.implantMD5 {
+		return written, err
+	}
+
+	return written, implantMD5At(w.(io.ReaderAt), w, cw.volumeSpaceSize)
+}
+
+// writeBlocks performs writes to the volume written to w, starting at the given block. They are written in block order,
+// unless w is a [concurrentWriter].
+func writeBlocks(w io.Writer, start uint32, writes []blockWrite) (int64, error) {
+	cw, concurrent := w.(*concurrentWriter)
+	if !concurrent {
+		// Files may not be in block order, if they have been sorted (see [WithSortWeights])
+		slices.SortStableFunc(writes, func(a, b blockWrite) int {
+			return cmp.Compare(a.number, b.number)
+		})
+
+		bw := builder.NewBlockWriterAt(w, start)
+		for _, write := range writes {
+			if err := bw.WriteBlockFunc(write.number, write.writeTo); err != nil {
+				return bw.BytesWritten(), fmt.Errorf("failed to write %s: %w", write.description, err)
+			}
+		}
+
+		return bw.BytesWritten(), nil
+	}
+
+	bw := builder.NewConcurrentBlockWriter(cw.w, start)
+	if err := cw.writeFileData(bw, writes); err != nil {
+		return bw.BytesWritten(), err
+	}
+
+	for _, phase := range []writePhase{writePhaseMetadata, writePhaseDescriptors} {
+		for _, write := range writes {
+			if write.phase != phase {
+				continue
+			}
+
+			if err := bw.WriteBlockFunc(write.number, write.writeTo); err != nil {
+				return bw.BytesWritten(), fmt.Errorf("failed to write %s: %w", write.description, err)
+			}
+		}
+	}
+
+	if err := bw.FillUnwritten(); err != nil {
+		return bw.BytesWritten(), err
+	}
+
+	return bw.BytesWritten(), nil
+}
+
+// writeFileData performs the writes of file data, with up to c.concurrency at once. Once a write fails, no more are
+// started, and the first error is returned once those in progress have finished.
+func (c *concurrentWriter) writeFileData(bw *builder.ConcurrentBlockWriter, writes []blockWrite) error {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+
+	slots := make(chan struct{}, c.concurrency)
+	for _, write := range writes {
+		if write.phase != writePhaseFileData {
+			continue
+		}
+
+		slots <- struct{}{}
+
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+
+		if failed {
+			break
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			if err := bw.WriteBlockFunc(write.number, write.writeTo); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to write %s: %w", write.description, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
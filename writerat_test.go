@@ -0,0 +1,69 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImage_WriteToWriterAt(t *testing.T) {
+	source := fstest.MapFS{}
+	for i := range 20 {
+		source[fmt.Sprintf("DIR%d/FILE%d.TXT", i%3, i)] = &fstest.MapFile{Data: bytes.Repeat([]byte{byte('a' + i)}, 1000*i)}
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithImplantedMD5(), iso9660.WithManifest(iso9660.Manifest{}), iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	// The file starts with garbage, which should be overwritten, as it would be on a block device
+	f, err := os.Create(filepath.Join(t.TempDir(), "image.iso"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	_, err = f.Write(bytes.Repeat([]byte{0xFF}, 64*2048))
+	require.NoError(t, err, "Should be able to fill output file")
+
+	written, err := image.WriteToWriterAt(f, 4)
+	require.NoError(t, err, "WriteToWriterAt should not return an error for a file")
+
+	data, err := os.ReadFile(f.Name())
+	require.NoError(t, err, "Should be able to read output file")
+	require.EqualValues(t, len(data), written, "WriteToWriterAt should return the size of the image")
+
+	assert.Equal(t, make([]byte, 16*2048), data[:16*2048], "Unused system area should be filled with zeros")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(data)), "Image written out of order should not violate the spec")
+	assert.NoError(t, iso9660.VerifyImplantedMD5(bytes.NewReader(data)), "Image should match the checksum implanted once it was written")
+
+	img, err := reader.Open(bytes.NewReader(data))
+	require.NoError(t, err, "Image should be readable")
+
+	for name, file := range source {
+		assert.Equal(t, string(file.Data), readRecord(t, img, name), "'%s' should be written to its extent", name)
+		assert.Contains(t, readRecord(t, img, "SHA256SUMS"), manifestLine(file.Data, name), "Manifest should list '%s'", name)
+	}
+}
+
+// writerAtOnly hides any methods of an io.WriterAt other than WriteAt
+type writerAtOnly struct {
+	io.WriterAt
+}
+
+func TestImage_WriteToWriterAt_ImplantMD5(t *testing.T) {
+	image, err := iso9660.NewImage(fstest.MapFS{"A.TXT": {Data: []byte("a")}}, iso9660.WithImplantedMD5())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "image.iso"))
+	require.NoError(t, err, "Should be able to create output file")
+	defer f.Close()
+
+	_, err = image.WriteToWriterAt(writerAtOnly{f}, 1)
+	assert.ErrorIs(t, err, iso9660.ErrImplantMD5Writer, "WriteToWriterAt should require a writer that can be read to implant a checksum")
+}
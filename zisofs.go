@@ -0,0 +1,167 @@
+package iso9660
+
+import (
+	"errors"
+	"fmt"
+	"github.com/davejbax/go-iso9660/internal/spec"
+	"github.com/davejbax/go-iso9660/internal/zisofs"
+	"io/fs"
+	"math"
+	"path"
+)
+
+// ErrZisofsOptions indicates that zisofs compression was requested along with options that it can't be used with
+var ErrZisofsOptions = errors.New("zisofs compression cannot be used with a UDF bridge or volume sets")
+
+// Zisofs configures the transparent compression of files, see [WithZisofs]
+type Zisofs struct {
+	// MinSize is the size, in bytes, below which files aren't compressed
+	MinSize int64
+
+	// Exclude are patterns, in the syntax of [path.Match], of files that aren't compressed. Each pattern is matched
+	// against both the path of a file in the image's contents and its name, so '*.efi' excludes files with that
+	// extension in any directory.
+	Exclude []string
+
+	// BlockSizeLog2 is the base 2 logarithm of the size of the blocks in which files are compressed, between 15 and
+	// 17. If zero, files are compressed in 32 KiB blocks, as with mkzftree.
+	BlockSizeLog2 uint8
+}
+
+// WithZisofs compresses files in the zisofs format, which Linux decompresses transparently when they are read. Each
+// compressed file's record has a ZF entry giving its uncompressed size, and the root directory's '.' record has an SP
+// entry, which indicates that the image uses the System Use Sharing Protocol that ZF entries are part of. Every other
+// record has an empty PD (padding) entry. Readers that don't understand ZF entries see the compressed data.
+//
+// Files are only compressed if this saves at least one block. Files whose data is already in the image, such as files
+// from a previous session, aren't compressed (though files that were compressed in a previous session keep their ZF
+// entries whether or not this option is used), and nor are the files used by [WithHybridMBR], since they are read by
+// firmware. Other files that are read before Linux is running, such as boot loaders, should be excluded with
+// [Zisofs.Exclude].
+//
+// Since the size of a compressed file must be known before the image is laid out, files are compressed twice: once to
+// find their size, and again when they are written.
+func WithZisofs(z Zisofs) ImageOption {
+	return func(i *Image) error {
+		if z.BlockSizeLog2 == 0 {
+			z.BlockSizeLog2 = zisofs.DefaultBlockSizeLog2
+		}
+
+		if z.BlockSizeLog2 < zisofs.MinBlockSizeLog2 || z.BlockSizeLog2 > zisofs.MaxBlockSizeLog2 {
+			return fmt.Errorf("zisofs block size must be between 2^%d and 2^%d bytes, but got 2^%d", zisofs.MinBlockSizeLog2, zisofs.MaxBlockSizeLog2, z.BlockSizeLog2)
+		}
+
+		for _, pattern := range z.Exclude {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid zisofs exclude pattern '%s': %w", pattern, err)
+			}
+		}
+
+		i.zisofs = &z
+		return nil
+	}
+}
+
+// excludes returns true if a file at the given path in the image's contents shouldn't be compressed
+func (z *Zisofs) excludes(filePath string) bool {
+	for _, pattern := range z.Exclude {
+		if matched, _ := path.Match(pattern, filePath); matched {
+			return true
+		}
+
+		if matched, _ := path.Match(pattern, path.Base(filePath)); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compressFiles finds the files in source that should be compressed, and the layout of their compressed data, by their
+// path in source
+func (i *Image) compressFiles(source fs.ReadDirFS) (map[string]*zisofs.Layout, error) {
+	if i.zisofs == nil {
+		return nil, nil
+	}
+
+	excluded := make(map[string]bool)
+	if i.hybrid != nil {
+		for _, filePath := range []string{i.hybrid.BootLoader, i.hybrid.EFIImage} {
+			excluded[path.Clean("/" + filePath)[1:]] = true
+		}
+	}
+
+	layouts := make(map[string]*zisofs.Layout)
+	err := fs.WalkDir(source, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || excluded[filePath] || i.zisofs.excludes(filePath) {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return fmt.Errorf("could not stat '%s': %w", filePath, err)
+		}
+
+		if info.Mode()&fs.ModeSymlink != 0 {
+			// Symbolic links are followed when building the directory tree, so their targets are what is compressed
+			if info, err = fs.Stat(source, filePath); err != nil || info.IsDir() {
+				return nil
+			}
+		}
+
+		if _, placed := info.(placedFileInfo); placed || info.Size() < max(i.zisofs.MinSize, 1) || info.Size() > math.MaxUint32 {
+			return nil
+		}
+
+		layout, err := measureFile(source, filePath, uint32(info.Size()), i.zisofs.BlockSizeLog2)
+		if err != nil {
+			return err
+		}
+
+		// Compressed files occupy whole blocks, like any other file, so compression only helps if it saves a block
+		if blocks(layout.Size()) < blocks(uint32(info.Size())) {
+			layouts[filePath] = layout
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not compress files: %w", err)
+	}
+
+	return layouts, nil
+}
+
+func measureFile(source fs.FS, filePath string, size uint32, blockSizeLog2 uint8) (*zisofs.Layout, error) {
+	f, err := source.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read input file '%s': %w", filePath, err)
+	}
+	defer f.Close()
+
+	layout, err := zisofs.Measure(f, size, blockSizeLog2)
+	if err != nil {
+		return nil, fmt.Errorf("could not compress '%s': %w", filePath, err)
+	}
+
+	return layout, nil
+}
+
+// sharingProtocolSystemUse returns the system use fields that are recorded when files are compressed: the root
+// directory's '.' record has an SP entry, since ZF entries are SUSP entries, and every other record without a ZF entry
+// has a PD entry. Some readers, such as libarchive, expect every record of a volume that uses SUSP to have at least one
+// entry, and otherwise ignore the volume's SUSP entries entirely.
+func sharingProtocolSystemUse() (root []byte, padding []byte, err error) {
+	sp := spec.NewSharingProtocolIndicator()
+	pd := spec.NewPaddingField()
+
+	if root, err = spec.PackSystemUse(&sp, &pd); err != nil {
+		return nil, nil, fmt.Errorf("could not create SP entry: %w", err)
+	}
+
+	if padding, err = spec.PackSystemUse(&pd); err != nil {
+		return nil, nil, fmt.Errorf("could not create PD entry: %w", err)
+	}
+
+	return root, padding, nil
+}
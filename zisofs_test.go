@@ -0,0 +1,103 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"github.com/davejbax/go-iso9660"
+	"github.com/davejbax/go-iso9660/internal/reader"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestWithZisofs(t *testing.T) {
+	random := make([]byte, 20000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	source := fstest.MapFS{
+		"LIVE/FILESYS.IMG": {Data: bytes.Repeat([]byte("compressible "), 20000)},
+		"LIVE/VMLINUZ.EFI": {Data: bytes.Repeat([]byte("excluded "), 20000)},
+		"SMALL.TXT":        {Data: bytes.Repeat([]byte("small "), 100)},
+		"RANDOM.BIN":       {Data: random},
+		"SPARSE.BIN":       {Data: make([]byte, 1<<20)},
+	}
+
+	image, err := iso9660.NewImage(source, iso9660.WithZisofs(iso9660.Zisofs{MinSize: 1000, Exclude: []string{"*.EFI"}}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	var buff bytes.Buffer
+	_, err = image.WriteTo(&buff)
+	require.NoError(t, err, "WriteTo should not return an error for valid arguments")
+	assert.Empty(t, iso9660.Validate(bytes.NewReader(buff.Bytes())), "Image with compressed files should not violate the spec")
+
+	img, err := reader.Open(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err, "Image should be readable")
+
+	hasSUSP, err := img.HasSUSP()
+	require.NoError(t, err, "Should be able to read root directory")
+	assert.True(t, hasSUSP, "Root directory should have an SP entry")
+
+	for name, compressed := range map[string]bool{
+		"LIVE/FILESYS.IMG": true,
+		"LIVE/VMLINUZ.EFI": false,
+		"SMALL.TXT":        false,
+		"RANDOM.BIN":       false,
+		"SPARSE.BIN":       true,
+	} {
+		record := findRecord(t, img, name)
+		require.NotNil(t, record, "Image should contain '%s'", name)
+
+		rr, err := img.RockRidge(record)
+		require.NoError(t, err, "Should be able to read system use entries of '%s'", name)
+
+		if !compressed {
+			entries, err := img.SystemUseEntries(record)
+			require.NoError(t, err, "Should be able to read system use entries of '%s'", name)
+			assert.Equal(t, []reader.SystemUseEntry{{Signature: "PD", Version: 1, Data: []byte{}}}, entries, "'%s' should have a PD entry, since some readers expect every record to have a SUSP entry", name)
+
+			assert.Nil(t, rr, "'%s' should not be compressed", name)
+			assert.EqualValues(t, len(source[name].Data), record.DataLength.RealValue(), "'%s' should have its original size", name)
+			continue
+		}
+
+		require.NotNil(t, rr, "'%s' should have a ZF entry", name)
+		assert.True(t, rr.Compressed, "'%s' should be compressed", name)
+		assert.EqualValues(t, len(source[name].Data), rr.UncompressedSize, "ZF entry of '%s' should record its original size", name)
+		assert.Less(t, record.DataLength.RealValue(), uint32(len(source[name].Data))/4, "'%s' should be smaller once compressed", name)
+	}
+
+	dst := t.TempDir()
+	require.NoError(t, iso9660.Extract(bytes.NewReader(buff.Bytes()), dst, nil), "Extract should not return an error for a valid image")
+
+	for name, file := range source {
+		extracted, err := os.ReadFile(filepath.Join(dst, filepath.FromSlash(name)))
+		require.NoError(t, err, "'%s' should be extracted", name)
+		assert.Equal(t, file.Data, extracted, "'%s' should be decompressed when extracted", name)
+	}
+}
+
+func TestWithZisofs_Options(t *testing.T) {
+	source := fstest.MapFS{"A.TXT": {Data: bytes.Repeat([]byte("a"), 10000)}}
+
+	_, err := iso9660.NewImage(source, iso9660.WithZisofs(iso9660.Zisofs{BlockSizeLog2: 14}))
+	assert.Error(t, err, "WithZisofs should not allow block sizes that Linux can't read")
+
+	_, err = iso9660.NewImage(source, iso9660.WithZisofs(iso9660.Zisofs{Exclude: []string{"["}}))
+	assert.Error(t, err, "WithZisofs should not allow invalid exclude patterns")
+
+	image, err := iso9660.NewImage(source, iso9660.WithZisofs(iso9660.Zisofs{}), iso9660.WithUDF())
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteTo(io.Discard)
+	assert.ErrorIs(t, err, iso9660.ErrZisofsOptions, "WriteTo should not allow zisofs with a UDF bridge")
+
+	image, err = iso9660.NewImage(source, iso9660.WithZisofs(iso9660.Zisofs{}))
+	require.NoError(t, err, "NewImage should not return an error for valid arguments")
+
+	_, err = image.WriteVolumeSet(1000*2048, func(int) (io.Writer, error) { return io.Discard, nil })
+	assert.ErrorIs(t, err, iso9660.ErrZisofsOptions, "WriteVolumeSet should not allow zisofs")
+}